@@ -83,7 +83,7 @@ func (n YamlNode) KeyValueMap() (map[string]astnode.AstNode, bool) {
 	for i := 0; i < len(n.Children); i += 2 {
 		key := *n.Children[i]
 		if n.tag == "json" {
-			key.Value = getIgnKeyName(key.Value)
+			key.Value = IgnKeyName(key.Value)
 		}
 		value := *n.Children[i+1]
 		kvmap[key.Value] = YamlNode{
@@ -114,9 +114,9 @@ func (n *YamlNode) ChangeKey(oldKeyName, newKeyName string, newValue YamlNode) e
 	return ErrKeyNotFound
 }
 
-// getIgnKeyName converts a snake_case (used by clct) to a camelCase (used by
+// IgnKeyName converts a snake_case (used by clct) to a camelCase (used by
 // ignition)
-func getIgnKeyName(keyname string) string {
+func IgnKeyName(keyname string) string {
 	words := strings.Split(keyname, "_")
 	for i, word := range words[1:] {
 		words[i+1] = strings.Title(word)
@@ -132,3 +132,19 @@ func (n YamlNode) Tag() string {
 func (n *YamlNode) ChangeTreeTag(newTag string) {
 	n.tag = newTag
 }
+
+// Copy returns a copy of the tree that shares no nodes with it, so that it
+// can be changed through its Node without changing n.
+func (n YamlNode) Copy() YamlNode {
+	n.Node = *copyNode(&n.Node)
+	return n
+}
+
+func copyNode(n *yaml.Node) *yaml.Node {
+	c := *n
+	c.Children = make([]*yaml.Node, len(n.Children))
+	for i, child := range n.Children {
+		c.Children[i] = copyNode(child)
+	}
+	return &c
+}
@@ -0,0 +1,287 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package astyaml
+
+import (
+	"errors"
+	"regexp"
+	"sort"
+	"strings"
+
+	yaml "github.com/ajeddeloh/yaml"
+)
+
+var (
+	ErrAnchors = errors.New("documents with anchors or aliases can't be encoded")
+
+	// blockHeader matches lines ending in the header of a block scalar
+	blockHeader = regexp.MustCompile(`(?:^|:\s+|-\s+)([|>][1-9+-]*)$`)
+)
+
+// Document is a parsed YAML document that, unlike the node tree alone, keeps
+// the comments and the original text of the scalars so that it can be
+// written back out with Encode.
+type Document struct {
+	Root *yaml.Node
+
+	lines []string
+	// comments at the top of the document, set apart from the rest by an
+	// empty line
+	header []comment
+	// full line comments, by the line of the key or sequence entry that
+	// follows them
+	head map[int][]comment
+	// comments after everything else
+	foot []comment
+	// comments at the end of a line, by line
+	trailing map[int]string
+	// block scalars, by the line of their header
+	blocks map[int]block
+}
+
+// comment is a comment on a line of its own.
+type comment struct {
+	line int
+	text string
+}
+
+// block is the content of a block scalar.
+type block struct {
+	header string
+	// first and last line of the content, both inclusive
+	first, last int
+	indent      int
+}
+
+// ParseDocument parses data, keeping its comments. Like the rest of the
+// package, lines are zero based.
+func ParseDocument(data []byte) (*Document, error) {
+	// UnmarshalToNode panics on invalid documents, so make sure it's valid
+	var v interface{}
+	if err := yaml.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+
+	d := newDocument(data)
+	if node := yaml.UnmarshalToNode(data); node != nil && len(node.Children) > 0 {
+		if len(node.Anchors) > 0 {
+			return nil, ErrAnchors
+		}
+		d.Root = node.Children[0]
+	}
+
+	comments := d.scan()
+	anchors := d.anchors()
+	if len(anchors) > 0 {
+		for i := anchors[0] - 1; i >= 0; i-- {
+			if strings.TrimSpace(d.lines[i]) != "" {
+				continue
+			}
+			for len(comments) > 0 && comments[0].line < i {
+				d.header = append(d.header, comments[0])
+				comments = comments[1:]
+			}
+			break
+		}
+	}
+	for _, c := range comments {
+		i := sort.SearchInts(anchors, c.line+1)
+		if i == len(anchors) {
+			d.foot = append(d.foot, c)
+			continue
+		}
+		d.head[anchors[i]] = append(d.head[anchors[i]], c)
+	}
+	return d, nil
+}
+
+// BlockScalarLines returns the lines of data that are the content of block
+// scalars. Unlike ParseDocument, it works on documents that aren't valid.
+func BlockScalarLines(data []byte) map[int]bool {
+	d := newDocument(data)
+	d.scan()
+	lines := map[int]bool{}
+	for _, b := range d.blocks {
+		for i := b.first; i <= b.last; i++ {
+			lines[i] = true
+		}
+	}
+	return lines
+}
+
+// BlockScalarIndents returns the indentation of the content of the block
+// scalars of data, by the line of their header.
+func BlockScalarIndents(data []byte) map[int]int {
+	d := newDocument(data)
+	d.scan()
+	indents := map[int]int{}
+	for line, b := range d.blocks {
+		indents[line] = b.indent
+	}
+	return indents
+}
+
+func newDocument(data []byte) *Document {
+	return &Document{
+		lines:    strings.Split(strings.Replace(string(data), "\r\n", "\n", -1), "\n"),
+		head:     map[int][]comment{},
+		trailing: map[int]string{},
+		blocks:   map[int]block{},
+	}
+}
+
+// scan finds the comments and block scalars of the document. It returns the
+// full line comments.
+func (d *Document) scan() []comment {
+	var comments []comment
+	for i := 0; i < len(d.lines); i++ {
+		trimmed := strings.TrimSpace(d.lines[i])
+		switch {
+		case trimmed == "":
+			continue
+		case trimmed[0] == '#':
+			comments = append(comments, comment{line: i, text: trimmed})
+			continue
+		}
+
+		content, trailing := SplitComment(d.lines[i])
+		if trailing != "" {
+			d.trailing[i] = trailing
+		}
+		m := blockHeader.FindStringSubmatch(strings.TrimSpace(content))
+		if m == nil {
+			continue
+		}
+		b := block{header: m[1], first: i + 1, last: i, indent: -1}
+		parent := keyIndent(content)
+		for j := i + 1; j < len(d.lines); j++ {
+			if strings.TrimSpace(d.lines[j]) == "" {
+				if strings.Contains(b.header, "+") {
+					// keep chomping makes trailing empty lines content
+					b.last = j
+				}
+				continue
+			}
+			indent := indentOf(d.lines[j])
+			if (b.indent == -1 && indent <= parent) || (b.indent != -1 && indent < b.indent) {
+				break
+			}
+			if b.indent == -1 {
+				b.indent = indent
+			}
+			b.last = j
+		}
+		d.blocks[i] = b
+		i = b.last
+	}
+	return comments
+}
+
+// anchors returns the sorted lines of all keys and sequence entries, which
+// are the nodes comments are attached to.
+func (d *Document) anchors() []int {
+	lines := map[int]bool{}
+	var walk func(n *yaml.Node)
+	walk = func(n *yaml.Node) {
+		switch n.Kind {
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(n.Children); i += 2 {
+				lines[n.Children[i].Line] = true
+				walk(n.Children[i+1])
+			}
+		case yaml.SequenceNode:
+			for _, child := range n.Children {
+				lines[child.Line] = true
+				walk(child)
+			}
+		}
+	}
+	if d.Root != nil {
+		walk(d.Root)
+	}
+	var anchors []int
+	for line := range lines {
+		anchors = append(anchors, line)
+	}
+	sort.Ints(anchors)
+	return anchors
+}
+
+// raw returns the text of a scalar as it was written. It returns false for
+// scalars spanning multiple lines, which can't be copied verbatim.
+func (d *Document) raw(n *yaml.Node) (string, bool) {
+	if n.Line >= len(d.lines) || n.Column > len(d.lines[n.Line]) {
+		return "", false
+	}
+	s := d.lines[n.Line][n.Column:]
+	if s == "" {
+		return "", n.Value == ""
+	}
+	switch quote := s[0]; quote {
+	case '"', '\'':
+		for i := 1; i < len(s); i++ {
+			switch {
+			case quote == '"' && s[i] == '\\':
+				i++
+			case quote == '\'' && s[i] == '\'' && i+1 < len(s) && s[i+1] == '\'':
+				i++
+			case s[i] == quote:
+				return s[:i+1], true
+			}
+		}
+		return "", false
+	}
+	content, _ := SplitComment(s)
+	content = strings.TrimRight(content, " \t")
+	// anything else, like plain scalars in flow collections, doesn't match
+	return content, content == n.Value
+}
+
+// SplitComment splits a line into its content and the comment at its end.
+func SplitComment(line string) (string, string) {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			if i == 0 || strings.ContainsRune(" \t[{,:-", rune(line[i-1])) {
+				quote = c
+			}
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i], strings.TrimSpace(line[i:])
+		}
+	}
+	return line, ""
+}
+
+// keyIndent returns the column of the innermost key or sequence entry on a
+// line, which block scalars on the line must be indented beyond.
+func keyIndent(line string) int {
+	indent := indentOf(line)
+	for strings.HasPrefix(line[indent:], "- ") {
+		indent += 2
+		indent += indentOf(line[indent:])
+	}
+	return indent
+}
+
+func indentOf(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
@@ -0,0 +1,236 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package astyaml
+
+import (
+	"bytes"
+	"sort"
+	"strconv"
+	"strings"
+
+	yaml "github.com/ajeddeloh/yaml"
+)
+
+const (
+	indentWidth = 2
+)
+
+// EncodeOptions control how a document is written.
+type EncodeOptions struct {
+	// KeyOrder, if set, returns the keys of the mapping at path in the
+	// order they should be written in. Keys it leaves out are written
+	// last, in their original order.
+	KeyOrder func(path []interface{}, keys []string) []string
+	// Scalar, if set, may replace the text of the scalar at path. It
+	// returns the text unchanged to keep it.
+	Scalar func(path []interface{}, text string) string
+}
+
+// Encode writes the document in block style with two space indentation,
+// keeping comments, the text of scalars and single empty lines between
+// entries.
+func (d *Document) Encode(options EncodeOptions) []byte {
+	e := encoder{doc: d, options: options, comments: map[int]bool{}}
+	for _, c := range d.header {
+		e.blankBefore(c.line, false)
+		e.out.WriteString(c.text + "\n")
+	}
+	if len(d.header) > 0 && d.Root != nil {
+		e.out.WriteString("\n")
+	}
+	if d.Root != nil {
+		e.value(d.Root, nil, "", d.Root.Line, 0, true)
+	}
+	for _, c := range d.foot {
+		e.blankBefore(c.line, false)
+		e.out.WriteString(c.text + "\n")
+	}
+	return e.out.Bytes()
+}
+
+type encoder struct {
+	doc     *Document
+	options EncodeOptions
+	out     bytes.Buffer
+	// trailing comments that were written, by line
+	comments map[int]bool
+}
+
+// value writes a node. prefix is the text before the node on its first line,
+// like "key:" or "- ", source the line the prefix came from and indent the
+// indentation of nested entries.
+func (e *encoder) value(n *yaml.Node, path []interface{}, prefix string, source, indent int, root bool) {
+	switch n.Kind {
+	case yaml.MappingNode:
+		if len(n.Children) == 0 {
+			e.line(join(prefix, "{}"), source)
+			return
+		}
+		if !strings.HasSuffix(prefix, "- ") && !root {
+			e.line(prefix, source)
+			prefix = ""
+		}
+		e.mapping(n, path, prefix, indent)
+	case yaml.SequenceNode:
+		if len(n.Children) == 0 {
+			e.line(join(prefix, "[]"), source)
+			return
+		}
+		if !root {
+			e.line(prefix, source)
+		}
+		e.sequence(n, path, indent)
+	case yaml.ScalarNode:
+		if b, ok := e.doc.blocks[n.Line]; ok && strings.HasPrefix(e.doc.lines[n.Line][n.Column:], b.header) {
+			e.block(b, prefix, indent)
+			return
+		}
+		text, ok := e.doc.raw(n)
+		if !ok {
+			text = quote(n)
+		}
+		if e.options.Scalar != nil {
+			text = e.options.Scalar(path, text)
+		}
+		e.line(join(prefix, text), n.Line)
+	}
+}
+
+// mapping writes the entries of a mapping. The first entry is written after
+// prefix, which is either empty or the "- " of a sequence entry.
+func (e *encoder) mapping(n *yaml.Node, path []interface{}, prefix string, indent int) {
+	var keys []string
+	var entries []int
+	for i := 0; i+1 < len(n.Children); i += 2 {
+		keys = append(keys, n.Children[i].Value)
+		entries = append(entries, i)
+	}
+	if e.options.KeyOrder != nil {
+		rank := map[string]int{}
+		for i, key := range e.options.KeyOrder(path, keys) {
+			rank[key] = i + 1
+		}
+		sort.Stable(byRank{entries, n, rank})
+	}
+
+	for i, entry := range entries {
+		key, value := n.Children[entry], n.Children[entry+1]
+		if i > 0 || prefix == "" {
+			e.head(key.Line, indent, i == 0)
+			prefix = strings.Repeat(" ", indent)
+		}
+		text, ok := e.doc.raw(key)
+		if !ok {
+			text = quote(key)
+		}
+		e.value(value, appendPath(path, key.Value), prefix+text+":", key.Line, indent+indentWidth, false)
+		prefix = ""
+	}
+}
+
+// sequence writes the entries of a sequence, with the "- " at indent.
+func (e *encoder) sequence(n *yaml.Node, path []interface{}, indent int) {
+	for i, child := range n.Children {
+		e.head(child.Line, indent, i == 0)
+		prefix := strings.Repeat(" ", indent) + "- "
+		if child.Kind == yaml.SequenceNode && len(child.Children) > 0 {
+			// nested sequences start on their own line
+			e.line(strings.TrimRight(prefix, " "), child.Line)
+			e.sequence(child, appendPath(path, i), indent+indentWidth)
+			continue
+		}
+		e.value(child, appendPath(path, i), prefix, child.Line, indent+indentWidth, false)
+	}
+}
+
+// block writes a block scalar, reindenting its content.
+func (e *encoder) block(b block, prefix string, indent int) {
+	e.line(join(prefix, b.header), b.first-1)
+	for i := b.first; i <= b.last; i++ {
+		line := e.doc.lines[i]
+		if strings.TrimSpace(line) == "" {
+			e.out.WriteString("\n")
+			continue
+		}
+		e.out.WriteString(strings.Repeat(" ", indent) + line[b.indent:] + "\n")
+	}
+}
+
+// head writes the comments before the key or sequence entry on line, and an
+// empty line if there was one before them.
+func (e *encoder) head(line, indent int, first bool) {
+	comments := e.doc.head[line]
+	delete(e.doc.head, line)
+	for i, c := range comments {
+		e.blankBefore(c.line, first && i == 0)
+		e.out.WriteString(strings.Repeat(" ", indent) + c.text + "\n")
+	}
+	if len(comments) == 0 {
+		e.blankBefore(line, first)
+	} else if line-1 > comments[len(comments)-1].line {
+		e.blankBefore(line, false)
+	}
+}
+
+// blankBefore writes an empty line if the line before line was empty, unless
+// it would be the first line of its parent.
+func (e *encoder) blankBefore(line int, first bool) {
+	if first || e.out.Len() == 0 || line == 0 {
+		return
+	}
+	if strings.TrimSpace(e.doc.lines[line-1]) == "" {
+		e.out.WriteString("\n")
+	}
+}
+
+// line writes a line, followed by the comment at the end of the source line
+// it came from.
+func (e *encoder) line(text string, source int) {
+	if c, ok := e.doc.trailing[source]; ok && !e.comments[source] {
+		e.comments[source] = true
+		text += " " + c
+	}
+	e.out.WriteString(strings.TrimRight(text, " ") + "\n")
+}
+
+// byRank sorts the entries of a mapping by the rank of their keys. Keys
+// without a rank go last.
+type byRank struct {
+	entries []int
+	n       *yaml.Node
+	rank    map[string]int
+}
+
+func (s byRank) Len() int      { return len(s.entries) }
+func (s byRank) Swap(a, b int) { s.entries[a], s.entries[b] = s.entries[b], s.entries[a] }
+func (s byRank) Less(a, b int) bool {
+	ra, rb := s.rank[s.n.Children[s.entries[a]].Value], s.rank[s.n.Children[s.entries[b]].Value]
+	return ra != 0 && (rb == 0 || ra < rb)
+}
+
+// quote returns the text of a scalar that can't be copied verbatim.
+func quote(n *yaml.Node) string {
+	if n.Value == "" || strings.ContainsAny(n.Value, "\n\"'#:") {
+		return strconv.Quote(n.Value)
+	}
+	return n.Value
+}
+
+func join(prefix, text string) string {
+	if prefix == "" || strings.HasSuffix(prefix, " ") {
+		return prefix + text
+	}
+	return prefix + " " + text
+}
@@ -0,0 +1,184 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package astyaml
+
+import (
+	"reflect"
+	"strings"
+
+	yaml "github.com/ajeddeloh/yaml"
+)
+
+var (
+	unmarshalerType = reflect.TypeOf((*yaml.Unmarshaler)(nil)).Elem()
+)
+
+// UnknownKey is a key in the tree that doesn't map to any field.
+type UnknownKey struct {
+	Key          string
+	Path         []interface{}
+	Line, Column int
+	// Keys are the valid keys of the mapping the key is in.
+	Keys []string
+}
+
+// UnknownKeys walks the tree alongside v, which the tree was unmarshalled
+// into, and returns every key of a mapping that doesn't map to a field of the
+// struct at the same place according to the yaml tags of its fields. Keys
+// are returned in the order they appear in the tree.
+func (n YamlNode) UnknownKeys(v reflect.Value) []UnknownKey {
+	return unknownKeys(&n.Node, v, nil)
+}
+
+func unknownKeys(n *yaml.Node, v reflect.Value, path []interface{}) []UnknownKey {
+	if v = indirect(v); !v.IsValid() {
+		// nothing is known about the type
+		return nil
+	}
+
+	var unknown []UnknownKey
+	switch {
+	case n.Kind == yaml.MappingNode && v.Kind() == reflect.Struct:
+		fields, keys := yamlFields(v)
+		if len(keys) == 0 {
+			// structs without tags, like semver.Version, unmarshal from scalars
+			return nil
+		}
+		for i := 0; i+1 < len(n.Children); i += 2 {
+			key := n.Children[i]
+			if field, ok := fields[key.Value]; ok {
+				unknown = append(unknown, unknownKeys(n.Children[i+1], field, appendPath(path, key.Value))...)
+				continue
+			}
+			unknown = append(unknown, UnknownKey{
+				Key:    key.Value,
+				Path:   appendPath(path, key.Value),
+				Line:   key.Line + 1,
+				Column: key.Column + 1,
+				Keys:   keys,
+			})
+		}
+	case n.Kind == yaml.SequenceNode && v.Kind() == reflect.Slice:
+		for i, child := range n.Children {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if i < v.Len() {
+				elem = v.Index(i)
+			}
+			unknown = append(unknown, unknownKeys(child, elem, appendPath(path, i))...)
+		}
+	}
+	return unknown
+}
+
+// yamlFields returns the fields of a struct by their yaml keys, as well as the
+// keys in field order. Embedded fields, like the version specific etcd
+// options, are flattened into the struct.
+func yamlFields(v reflect.Value) (map[string]reflect.Value, []string) {
+	fields := map[string]reflect.Value{}
+	var keys []string
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous {
+			embedded := v.Field(i)
+			if embedded.Kind() == reflect.Interface && !embedded.IsNil() {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				embeddedFields, embeddedKeys := yamlFields(embedded)
+				for _, key := range embeddedKeys {
+					fields[key] = embeddedFields[key]
+				}
+				keys = append(keys, embeddedKeys...)
+			}
+			continue
+		}
+		if field.PkgPath != "" {
+			// unexported
+			continue
+		}
+		key := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if key == "-" {
+			continue
+		}
+		if key == "" {
+			if reflect.PtrTo(t).Implements(unmarshalerType) {
+				// only tagged fields are known to be keys of custom types
+				continue
+			}
+			key = strings.ToLower(field.Name)
+		}
+		fields[key] = v.Field(i)
+		keys = append(keys, key)
+	}
+	return fields, keys
+}
+
+// FieldOrder returns a function for EncodeOptions.KeyOrder that orders the
+// keys of every mapping like the fields of the struct at the same place in v.
+// Only the types of v are used, so it can be the zero value.
+func FieldOrder(v reflect.Value) func(path []interface{}, keys []string) []string {
+	return func(path []interface{}, keys []string) []string {
+		v := v
+		for _, elem := range path {
+			v = indirect(v)
+			switch elem := elem.(type) {
+			case string:
+				if v.Kind() == reflect.Map {
+					v = reflect.New(v.Type().Elem()).Elem()
+					continue
+				}
+				if v.Kind() != reflect.Struct {
+					return nil
+				}
+				fields, _ := yamlFields(v)
+				field, ok := fields[elem]
+				if !ok {
+					return nil
+				}
+				v = field
+			case int:
+				if v.Kind() != reflect.Slice {
+					return nil
+				}
+				if elem < v.Len() {
+					v = v.Index(elem)
+				} else {
+					v = reflect.New(v.Type().Elem()).Elem()
+				}
+			}
+		}
+		if v = indirect(v); v.Kind() != reflect.Struct {
+			return nil
+		}
+		_, order := yamlFields(v)
+		return order
+	}
+}
+
+// indirect follows pointers and interfaces, replacing nil pointers with new
+// values. It returns an invalid value for nil interfaces.
+func indirect(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			if v.Kind() == reflect.Interface {
+				return reflect.Value{}
+			}
+			v = reflect.New(v.Type().Elem())
+		}
+		v = v.Elem()
+	}
+	return v
+}
@@ -0,0 +1,120 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package astyaml
+
+import (
+	"bytes"
+	"fmt"
+
+	yaml "github.com/ajeddeloh/yaml"
+	"github.com/coreos/ignition/config/validate/astnode"
+)
+
+// FormatPath formats a path of keys and indices, like "storage.files[3].mode".
+func FormatPath(path ...interface{}) string {
+	var b bytes.Buffer
+	for _, p := range path {
+		switch p := p.(type) {
+		case int:
+			fmt.Fprintf(&b, "[%d]", p)
+		default:
+			if b.Len() > 0 {
+				b.WriteByte('.')
+			}
+			fmt.Fprint(&b, p)
+		}
+	}
+	return b.String()
+}
+
+// NodeAt returns the node at a path of yaml keys and indices.
+func NodeAt(n astnode.AstNode, path ...interface{}) (astnode.AstNode, bool) {
+	for _, key := range path {
+		if n == nil {
+			return nil, false
+		}
+		switch key := key.(type) {
+		case string:
+			children, ok := n.KeyValueMap()
+			if !ok {
+				return nil, false
+			}
+			n = children[key]
+		case int:
+			child, ok := n.SliceChild(key)
+			if !ok {
+				return nil, false
+			}
+			n = child
+		}
+	}
+	return n, n != nil
+}
+
+// PathAt returns the path of the node at a position reported by ValueLineCol
+// or KeyLineCol. The keys in the path are the ones used in the yaml,
+// regardless of the tag of the tree. A mapping starts at the same position as
+// its first key, in which case the path of the mapping is returned, unless the
+// mapping is the root of the tree.
+func (n YamlNode) PathAt(line, col int) ([]interface{}, bool) {
+	if path, ok := walkChildren(&n.Node, line-1, col-1, nil, valuePathAt); ok {
+		return path, true
+	}
+	return keyPathAt(&n.Node, line-1, col-1, nil)
+}
+
+// valuePathAt finds the value node at the zero based position.
+func valuePathAt(n *yaml.Node, line, col int, path []interface{}) ([]interface{}, bool) {
+	if n.Line == line && n.Column == col {
+		return path, true
+	}
+	return walkChildren(n, line, col, path, valuePathAt)
+}
+
+// keyPathAt finds the key at the zero based position.
+func keyPathAt(n *yaml.Node, line, col int, path []interface{}) ([]interface{}, bool) {
+	if n.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(n.Children); i += 2 {
+			key := n.Children[i]
+			if key.Line == line && key.Column == col {
+				return appendPath(path, key.Value), true
+			}
+		}
+	}
+	return walkChildren(n, line, col, path, keyPathAt)
+}
+
+func walkChildren(n *yaml.Node, line, col int, path []interface{}, find func(*yaml.Node, int, int, []interface{}) ([]interface{}, bool)) ([]interface{}, bool) {
+	switch n.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Children); i += 2 {
+			if p, ok := find(n.Children[i+1], line, col, appendPath(path, n.Children[i].Value)); ok {
+				return p, true
+			}
+		}
+	case yaml.SequenceNode:
+		for i, child := range n.Children {
+			if p, ok := find(child, line, col, appendPath(path, i)); ok {
+				return p, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// appendPath appends to a copy of path, so sibling paths don't share storage.
+func appendPath(path []interface{}, elem interface{}) []interface{} {
+	return append(append([]interface{}{}, path...), elem)
+}
@@ -0,0 +1,67 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package astyaml
+
+import (
+	"github.com/coreos/ignition/config/validate/report"
+)
+
+// ReportPaths records the paths of the nodes that report entries are about.
+// Entries without a position, like entries about a missing key, have no other
+// way to name their node, and the position of an entry about a mapping is also
+// the position of its first key. It is kept next to the report rather than in
+// its entries. Entries are looked up by their value, and identical entries get
+// their paths in the order they were recorded. So a path must be recorded for
+// every entry, even an empty one, and reports must be merged in the order
+// their paths were recorded. The methods of a nil ReportPaths do nothing.
+type ReportPaths struct {
+	paths map[report.Entry][]string
+}
+
+// Add records the path of the node the entries of r are about, like
+// report.AddPosition does for positions.
+func (p *ReportPaths) Add(r report.Report, path ...interface{}) {
+	for _, e := range r.Entries {
+		p.Set(e, path...)
+	}
+}
+
+// Set records the path of the node an entry is about.
+func (p *ReportPaths) Set(e report.Entry, path ...interface{}) {
+	if p == nil {
+		return
+	}
+	if p.paths == nil {
+		p.paths = map[report.Entry][]string{}
+	}
+	p.paths[e] = append(p.paths[e], FormatPath(path...))
+}
+
+// Lookup returns the recorded paths of the entries of r, by index. Entries
+// without one have an empty path.
+func (p *ReportPaths) Lookup(r report.Report) []string {
+	paths := make([]string, len(r.Entries))
+	if p == nil {
+		return paths
+	}
+	seen := map[report.Entry]int{}
+	for i, e := range r.Entries {
+		if recorded := p.paths[e]; seen[e] < len(recorded) {
+			paths[i] = recorded[seen[e]]
+		}
+		seen[e]++
+	}
+	return paths
+}
@@ -15,10 +15,14 @@
 package config
 
 import (
+	"encoding/json"
 	"reflect"
+	"regexp"
+	"strconv"
 
 	yaml "github.com/ajeddeloh/yaml"
 	"github.com/coreos/container-linux-config-transpiler/config/astyaml"
+	"github.com/coreos/container-linux-config-transpiler/config/decompile"
 	"github.com/coreos/container-linux-config-transpiler/config/platform"
 	"github.com/coreos/container-linux-config-transpiler/config/types"
 	ignTypes "github.com/coreos/ignition/config/v2_3/types"
@@ -27,15 +31,66 @@ import (
 	"github.com/coreos/ignition/config/validate/report"
 )
 
+var (
+	yamlErrorLine = regexp.MustCompile(`\bline (\d+):`)
+)
+
+// ParseOptions holds the settings that control parsing.
+type ParseOptions struct {
+	// Strict makes keys that don't map to anything in the config errors
+	// rather than warnings.
+	Strict bool
+	// Path is the path of the config, which includes are relative to.
+	// If it is empty, they are relative to the working directory.
+	Path string
+	// Variables are the values of the variables declared in the config,
+	// by name. Values can be strings, which are converted to the type of
+	// the variable, or values of that type like those from yaml.Unmarshal.
+	Variables map[string]interface{}
+	// NoIncludes makes include an error, for configs from untrusted
+	// sources that shouldn't read other files.
+	NoIncludes bool
+}
+
 // Parse will convert a byte slice containing a Container Linux Config into a
 // golang struct representing the config, the parse tree from parsing the yaml
 // and a report of any warnings or errors that occurred during the parsing.
 func Parse(data []byte) (types.Config, astnode.AstNode, report.Report) {
+	return ParseWithOptions(data, ParseOptions{})
+}
+
+// ParseWithOptions works like Parse, with the behavior controlled by options.
+// The configs listed in the include section are parsed and merged into the
+// result, see mergeIncludes.
+func ParseWithOptions(data []byte, options ParseOptions) (types.Config, astnode.AstNode, report.Report) {
+	cfg, root, r := parseConfig(data, options)
+	if r.IsFatal() {
+		return types.Config{}, nil, r
+	}
+	if len(cfg.Include) > 0 {
+		var includeReport report.Report
+		cfg, includeReport = mergeIncludes(cfg, root, options)
+		r.Merge(includeReport)
+		if r.IsFatal() {
+			return types.Config{}, nil, r
+		}
+	}
+	r.Merge(checkUndeclaredVariables(cfg.Variables, options.Variables))
+	return cfg, root, r
+}
+
+// parseConfig parses a single config, without its includes.
+func parseConfig(data []byte, options ParseOptions) (types.Config, astnode.AstNode, report.Report) {
 	var cfg types.Config
-	var r report.Report
+
+	data, r := substituteVariables(data, options.Variables)
+	if r.IsFatal() {
+		return types.Config{}, nil, r
+	}
 
 	if err := yaml.Unmarshal(data, &cfg); err != nil {
-		return types.Config{}, nil, report.ReportFromError(err, report.EntryError)
+		r.Merge(yamlErrorReport(err))
+		return types.Config{}, nil, r
 	}
 
 	nodes := yaml.UnmarshalToNode(data)
@@ -47,13 +102,16 @@ func Parse(data []byte) (types.Config, astnode.AstNode, report.Report) {
 		})
 		r.Merge(validate.ValidateWithoutSource(reflect.ValueOf(cfg)))
 	} else {
-		var err error
-		root, err = astyaml.FromYamlDocumentNode(*nodes)
+		yamlRoot, err := astyaml.FromYamlDocumentNode(*nodes)
 		if err != nil {
 			return types.Config{}, nil, report.ReportFromError(err, report.EntryError)
 		}
+		root = yamlRoot
 
-		r.Merge(validate.Validate(reflect.ValueOf(cfg), root, nil, true))
+		// unknown keys are checked separately, with better suggestions
+		r.Merge(validate.Validate(reflect.ValueOf(cfg), root, nil, false))
+		r.Merge(checkUnknownKeys(yamlRoot, reflect.ValueOf(cfg), options.Strict))
+		r.Merge(checkUnitContents(root, cfg, data))
 	}
 
 	if r.IsFatal() {
@@ -62,14 +120,30 @@ func Parse(data []byte) (types.Config, astnode.AstNode, report.Report) {
 	return cfg, root, r
 }
 
+// yamlErrorReport creates a report from an error returned by yaml.Unmarshal.
+// The errors only mention the line in their message, so it is extracted to
+// position the entry.
+func yamlErrorReport(err error) report.Report {
+	r := report.ReportFromError(err, report.EntryError)
+	if m := yamlErrorLine.FindStringSubmatch(err.Error()); m != nil {
+		line, _ := strconv.Atoi(m[1])
+		r.AddPosition(line, 0, "")
+	}
+	return r
+}
+
 // Convert will convert a golang struct representing a Container Linux
 // Config into an Ignition Config, and a report of any warnings or errors. It
 // takes the parse tree from parsing the Container Linux config as well.
-// Convert also accepts a platform string, which can either be one of the
-// platform strings defined in config/templating/templating.go or an empty
-// string if [dynamic data](doc/dynamic-data.md) isn't used.
-func Convert(in types.Config, p string, ast astnode.AstNode) (ignTypes.Config, report.Report) {
-	if !platform.IsSupportedPlatform(p) {
+// Convert also accepts a set of options. The platform in the options can
+// either be one of the platform strings defined in config/platform/platform.go
+// or an empty string if [dynamic data](doc/dynamic-data.md) isn't used. The
+// files directory in the options must be set if any local file sources are
+// used. The Ignition version in the options selects the spec of the output,
+// and features which can't be expressed in it are reported as errors. The
+// dependencies between the generated units are checked, see CheckUnitGraph.
+func Convert(in types.Config, options types.ConvertOptions, ast astnode.AstNode) (ignTypes.Config, report.Report) {
+	if !platform.IsSupportedPlatform(options.Platform) {
 		r := report.Report{}
 		r.Add(report.Entry{
 			Kind:    report.EntryError,
@@ -77,5 +151,29 @@ func Convert(in types.Config, p string, ast astnode.AstNode) (ignTypes.Config, r
 		})
 		return ignTypes.Config{}, r
 	}
-	return types.Convert(in, p, ast)
+	// the source map positions the warnings about the units
+	if options.SourceMap == nil {
+		options.SourceMap = &types.SourceMap{}
+	}
+	out, r := types.Convert(in, options, ast)
+	if r.IsFatal() {
+		return out, r
+	}
+	// the graph records its paths after the conversion, so its entries must
+	// follow the conversion's for identical entries to get the right paths
+	r.Merge(CheckUnitGraph(out, *options.SourceMap, options.ReportPaths))
+	return out, r
+}
+
+// Decompile will convert a byte slice containing an Ignition Config into a
+// golang struct representing an equivalent Container Linux Config, and a
+// report of any warnings or errors. Units and files that ct generates for the
+// etcd, flannel, docker, update and locksmith sections are turned back into
+// those sections. The result can be serialized with decompile.Marshal.
+func Decompile(data []byte) (types.Config, report.Report) {
+	var cfg ignTypes.Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return types.Config{}, report.ReportFromError(err, report.EntryError)
+	}
+	return decompile.Decompile(cfg)
 }
@@ -15,12 +15,20 @@
 package config
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io/ioutil"
 	"net/url"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 
+	"github.com/coreos/container-linux-config-transpiler/config/astyaml"
+	"github.com/coreos/container-linux-config-transpiler/config/decompile"
+	"github.com/coreos/container-linux-config-transpiler/config/platform"
 	"github.com/coreos/container-linux-config-transpiler/config/types"
 	"github.com/coreos/container-linux-config-transpiler/internal/util"
 	"github.com/coreos/go-semver/semver"
@@ -1797,7 +1805,7 @@ func TestConvert(t *testing.T) {
 	}
 
 	for i, test := range tests {
-		cfg, r := Convert(test.in.cfg, "", nil)
+		cfg, r := Convert(test.in.cfg, types.ConvertOptions{}, nil)
 		assert.Equal(t, test.out.r, r, "#%d: bad report", i)
 		assert.Equal(t, test.out.cfg, cfg, "#%d: bad config", i)
 	}
@@ -2107,9 +2115,1881 @@ storage:
 		if len(r.Entries) != 0 {
 			t.Errorf("#%d: got error while parsing input: %v", i, r)
 		}
-		igncfg, r := Convert(cfg, "", ast)
+		igncfg, r := Convert(cfg, types.ConvertOptions{}, ast)
 		assert.Equal(t, test.out.r, r, "#%d: bad report", i)
 		assert.Equal(t, test.out.cfg, igncfg, "#%d: bad config", i)
 	}
 
 }
+
+func TestConvertIgnitionVersion(t *testing.T) {
+	type in struct {
+		data    string
+		version string
+	}
+	type out struct {
+		cfg ignTypes.Config
+		r   report.Report
+	}
+
+	tests := []struct {
+		in  in
+		out out
+	}{
+		{
+			in: in{data: `
+storage:
+  disks:
+    - device: /dev/sda
+      partitions:
+        - size: 1GiB
+          start: 2MiB
+`, version: "2.2"},
+			out: out{cfg: ignTypes.Config{
+				Ignition: ignTypes.Ignition{Version: "2.2.0"},
+				Storage: ignTypes.Storage{
+					Disks: []ignTypes.Disk{{
+						Device: "/dev/sda",
+						Partitions: []ignTypes.Partition{{
+							Size:  util.IntToPtr(2097152),
+							Start: util.IntToPtr(4096),
+						}},
+					}},
+				},
+			}},
+		},
+		{
+			in: in{data: `
+storage:
+  files:
+    - path: /opt/file
+      filesystem: root
+      mode: 0644
+      append: true
+`, version: "2.1.0"},
+			out: out{r: report.Report{
+				Entries: []report.Entry{{
+					Kind:    report.EntryError,
+					Message: "append requires Ignition spec version 2.2.0 or newer, but 2.1.0 was requested",
+					Line:    7,
+					Column:  7,
+				}},
+			}},
+		},
+		{
+			in: in{data: `
+networkd:
+  units:
+    - name: static.network
+      dropins:
+        - name: mtu.conf
+          contents: "[Link]\nMTUBytes=9000"
+`, version: "2.2.0"},
+			out: out{r: report.Report{
+				Entries: []report.Entry{{
+					Kind:    report.EntryError,
+					Message: "networkd dropins requires Ignition spec version 2.3.0 or newer, but 2.2.0 was requested",
+					Line:    5,
+					Column:  7,
+				}},
+			}},
+		},
+		{
+			in: in{data: `
+networkd:
+  units:
+    - name: static.network
+      dropins:
+        - name: mtu.conf
+          contents: "[Link]\nMTUBytes=9000"
+`, version: "2.3.0"},
+			out: out{cfg: ignTypes.Config{
+				Ignition: ignTypes.Ignition{Version: "2.3.0"},
+				Networkd: ignTypes.Networkd{
+					Units: []ignTypes.Networkdunit{{
+						Name: "static.network",
+						Dropins: []ignTypes.NetworkdDropin{{
+							Name:     "mtu.conf",
+							Contents: "[Link]\nMTUBytes=9000",
+						}},
+					}},
+				},
+			}},
+		},
+		{
+			in: in{data: `
+storage:
+  raid:
+    - name: data
+      level: raid1
+      devices: [/dev/sdb, /dev/sdc]
+      options: [--assume-clean]
+`, version: "2.2"},
+			out: out{r: report.Report{
+				Entries: []report.Entry{{
+					Kind:    report.EntryError,
+					Message: "raid options requires Ignition spec version 2.3.0 or newer, but 2.2.0 was requested",
+					Line:    7,
+					Column:  7,
+				}},
+			}},
+		},
+		{
+			in:  in{data: ``, version: "2.0.0"},
+			out: out{r: report.ReportFromError(types.ErrUnsupportedIgnitionVersion, report.EntryError)},
+		},
+	}
+
+	for i, test := range tests {
+		cfg, ast, _ := Parse([]byte(test.in.data))
+		igncfg, r := Convert(cfg, types.ConvertOptions{IgnitionVersion: test.in.version}, ast)
+		assert.Equal(t, test.out.r, r, "#%d: bad report", i)
+		assert.Equal(t, test.out.cfg, igncfg, "#%d: bad config", i)
+	}
+}
+
+func TestDecompile(t *testing.T) {
+	type in struct {
+		data     string
+		platform string
+	}
+	type out struct {
+		cfg types.Config
+	}
+
+	tests := []struct {
+		in  in
+		out out
+	}{
+		{
+			in: in{data: `
+storage:
+  files:
+    - path: /etc/motd
+      filesystem: root
+      mode: 0644
+      contents:
+        inline: |
+          hello
+          world
+`},
+			out: out{cfg: types.Config{
+				Storage: types.Storage{
+					Files: []types.File{{
+						Filesystem: "root",
+						Path:       "/etc/motd",
+						Mode:       util.IntToPtr(0644),
+						Contents:   types.FileContents{Inline: "hello\nworld\n"},
+					}},
+				},
+			}},
+		},
+		{
+			// braces in contents are kept as they are
+			in: in{data: `
+storage:
+  files:
+    - path: /etc/motd
+      filesystem: root
+      mode: 0644
+      contents:
+        inline: "\\{HOSTNAME} {{HOSTNAME}}"
+`},
+			out: out{cfg: types.Config{
+				Storage: types.Storage{
+					Files: []types.File{{
+						Filesystem: "root",
+						Path:       "/etc/motd",
+						Mode:       util.IntToPtr(0644),
+						Contents:   types.FileContents{Inline: `\{HOSTNAME} {{HOSTNAME}}`},
+					}},
+				},
+			}},
+		},
+		{
+			in: in{data: `
+storage:
+  disks:
+    - device: /dev/sda
+      partitions:
+        - size: 1GiB
+`},
+			out: out{cfg: types.Config{
+				Storage: types.Storage{
+					Disks: []types.Disk{{
+						Device:     "/dev/sda",
+						Partitions: []types.Partition{{Size: "1024MiB"}},
+					}},
+				},
+			}},
+		},
+		{
+			in: in{data: `
+etcd:
+  version: 3.2.0
+  name: "{HOSTNAME}"
+  snapshot_count: 5
+  enable_v2: true
+`, platform: "ec2"},
+			out: out{cfg: types.Config{
+				Etcd: &types.Etcd{
+					Version: func(ver types.EtcdVersion) *types.EtcdVersion {
+						return &ver
+					}(types.EtcdVersion(semver.Version{Major: 3, Minor: 2})),
+					Options: types.Etcd3_2{
+						Name:          util.StringToPtr("{HOSTNAME}"),
+						SnapshotCount: util.IntToPtr(5),
+						EnableV2:      util.BoolToPtr(true),
+					},
+				},
+			}},
+		},
+		{
+			in: in{data: `
+flannel:
+  etcd_endpoints: "http://a:2379"
+  network_config: '{"Network": "10.1.0.0/16"}'
+docker:
+  flags:
+    - --debug
+update:
+  group: beta
+locksmith:
+  reboot_strategy: etcd-lock
+`},
+			out: out{cfg: types.Config{
+				Flannel: &types.Flannel{
+					NetworkConfig: `{"Network": "10.1.0.0/16"}`,
+					Options: types.Flannel0_6{
+						EtcdEndpoints: util.StringToPtr("http://a:2379"),
+					},
+				},
+				Docker: &types.Docker{Flags: []string{"--debug"}},
+				Update: &types.Update{Group: "beta"},
+				Locksmith: &types.Locksmith{
+					RebootStrategy: util.StringToPtr("etcd-lock"),
+				},
+			}},
+		},
+		{
+			in: in{data: `
+systemd:
+  units:
+    - name: docker.service
+      enable: true
+      dropins:
+        - name: 20-clct-docker.conf
+          contents: |
+            [Service]
+            Environment=FOO=bar
+`},
+			out: out{cfg: types.Config{
+				Systemd: types.Systemd{
+					Units: []types.SystemdUnit{{
+						Name:   "docker.service",
+						Enable: true,
+						Dropins: []types.SystemdUnitDropIn{{
+							Name:     "20-clct-docker.conf",
+							Contents: "[Service]\nEnvironment=FOO=bar\n",
+						}},
+					}},
+				},
+			}},
+		},
+	}
+
+	for i, test := range tests {
+		cfg, ast, r := Parse([]byte(test.in.data))
+		if r.IsFatal() {
+			t.Errorf("#%d: got error while parsing input: %v", i, r)
+			continue
+		}
+		igncfg, r := Convert(cfg, types.ConvertOptions{Platform: test.in.platform}, ast)
+		if r.IsFatal() {
+			t.Errorf("#%d: got error while converting input: %v", i, r)
+			continue
+		}
+		ignData, err := json.Marshal(igncfg)
+		if err != nil {
+			t.Errorf("#%d: failed to marshal ignition config: %v", i, err)
+			continue
+		}
+
+		decompiled, r := Decompile(ignData)
+		if r.IsFatal() {
+			t.Errorf("#%d: got error while decompiling: %v", i, r)
+			continue
+		}
+		assert.Equal(t, test.out.cfg, decompiled, "#%d: bad decompiled config", i)
+
+		// the decompiled config must transpile back into the same config
+		data, err := decompile.Marshal(decompiled)
+		if err != nil {
+			t.Errorf("#%d: failed to marshal decompiled config: %v", i, err)
+			continue
+		}
+		cfg, ast, r = Parse(data)
+		if r.IsFatal() {
+			t.Errorf("#%d: got error while parsing decompiled config: %v", i, r)
+			continue
+		}
+		roundTripped, _ := Convert(cfg, types.ConvertOptions{Platform: test.in.platform}, ast)
+		assert.Equal(t, igncfg, roundTripped, "#%d: decompiled config doesn't convert to the original", i)
+	}
+}
+
+func TestDecompileUnsupported(t *testing.T) {
+	tests := []struct {
+		in  string
+		out report.Report
+	}{
+		{
+			in: `{"ignition": {"version": "2.3.0"}, "storage": {"disks": [{"device": "/dev/sda", "partitions": [
+				{"number": 1, "sizeMiB": 1024},
+				{"number": 2, "shouldExist": false},
+				{"number": 3, "sizeMiB": 1024, "shouldExist": true, "wipePartitionEntry": true}
+			]}]}}`,
+			out: report.Report{Entries: []report.Entry{
+				{
+					Kind:    report.EntryWarning,
+					Message: "storage.disks[0].partitions[1].shouldExist: not supported by Container Linux Configs, left out",
+				},
+				{
+					Kind:    report.EntryWarning,
+					Message: "storage.disks[0].partitions[2].shouldExist: not supported by Container Linux Configs, left out",
+				},
+				{
+					Kind:    report.EntryWarning,
+					Message: "storage.disks[0].partitions[2].wipePartitionEntry: not supported by Container Linux Configs, left out",
+				},
+			}},
+		},
+		{
+			in:  `{"ignition": {"version": "2.3.0"}, "storage": {"disks": [{"device": "/dev/sda", "partitions": [{"number": 1, "sizeMiB": 1024}]}]}}`,
+			out: report.Report{},
+		},
+	}
+
+	for i, test := range tests {
+		_, r := Decompile([]byte(test.in))
+		assert.Equal(t, test.out, r, "#%d: bad report", i)
+	}
+}
+
+func TestConvertSourceMap(t *testing.T) {
+	type in struct {
+		data     string
+		platform string
+	}
+	type out struct {
+		sourceMap types.SourceMap
+	}
+
+	tests := []struct {
+		in  in
+		out out
+	}{
+		{
+			in: in{data: `
+storage:
+  files:
+    - path: /opt/first
+      filesystem: root
+      mode: 0644
+    - path: /opt/second
+      filesystem: root
+      mode: 0644
+systemd:
+  units:
+    - name: example.service
+      dropins:
+        - name: override.conf
+`},
+			out: out{sourceMap: types.SourceMap{
+				{Target: "storage.files[0]", Source: types.Source{Path: "storage.files[0]", Line: 4, Column: 7}},
+				{Target: "storage.files[1]", Source: types.Source{Path: "storage.files[1]", Line: 7, Column: 7}},
+				{Target: "systemd.units[0]", Source: types.Source{Path: "systemd.units[0]", Line: 12, Column: 7}},
+				{Target: "systemd.units[0].dropins[0]", Source: types.Source{Path: "systemd.units[0].dropins[0]", Line: 14, Column: 11}},
+			}},
+		},
+		{
+			in: in{data: `
+docker:
+  flags:
+    - --debug
+locksmith:
+  reboot_strategy: off
+ignition:
+  security:
+    tls:
+      certificate_authorities:
+        - source: https://example.com/ca.pem
+`, platform: "openstack-metadata"},
+			out: out{sourceMap: types.SourceMap{
+				{Target: "systemd.units[0]"},
+				{Target: "systemd.units[0].dropins[0]"},
+				{Target: "systemd.units[1]"},
+				{Target: "systemd.units[1].dropins[0]"},
+				{Target: "systemd.units[2]", Source: types.Source{Path: "docker", Line: 2, Column: 1}},
+				{Target: "systemd.units[2].dropins[0]", Source: types.Source{Path: "docker", Line: 2, Column: 1}},
+				{Target: "ignition.security.tls.certificateAuthorities[0]", Source: types.Source{Path: "ignition.security.tls.certificate_authorities[0]", Line: 11, Column: 11}},
+				{Target: "storage.files[0]", Source: types.Source{Path: "locksmith", Line: 5, Column: 1}},
+			}},
+		},
+	}
+
+	for i, test := range tests {
+		cfg, ast, r := Parse([]byte(test.in.data))
+		assert.Equal(t, report.Report{}, r, "#%d: bad parse report", i)
+		sourceMap := types.SourceMap{}
+		_, r = Convert(cfg, types.ConvertOptions{Platform: test.in.platform, SourceMap: &sourceMap}, ast)
+		assert.Equal(t, report.Report{}, r, "#%d: bad report", i)
+		assert.Equal(t, test.out.sourceMap, sourceMap, "#%d: bad source map", i)
+	}
+}
+
+func TestParseErrorPosition(t *testing.T) {
+	tests := []struct {
+		in   string
+		line int
+	}{
+		{"storage:\n  files:\n   - path: [\n", 3},
+		{"storage:\n  files:\n    - path: /a\n      mode: abc\n", 4},
+	}
+
+	for i, test := range tests {
+		_, _, r := Parse([]byte(test.in))
+		assert.Equal(t, 1, len(r.Entries), "#%d: bad number of entries", i)
+		assert.Equal(t, test.line, r.Entries[0].Line, "#%d: bad line", i)
+	}
+}
+
+func TestParseUnknownKeys(t *testing.T) {
+	type in struct {
+		data   string
+		strict bool
+	}
+	type out struct {
+		r report.Report
+	}
+
+	tests := []struct {
+		in  in
+		out out
+	}{
+		{
+			in: in{data: `
+etcd:
+  version: 3.0.0
+  name: node
+  nmae: node
+passwd:
+  users:
+    - name: core
+      ssh_authorised_keys:
+        - ssh-rsa key
+systemd:
+  units:
+    - name: example.service
+      dropins:
+        - name: 10-example.conf
+          enabled: yes
+`},
+			out: out{r: report.Report{Entries: []report.Entry{
+				{
+					Kind:    report.EntryWarning,
+					Message: "Config has unrecognized key: nmae, did you mean name?",
+					Line:    5,
+					Column:  3,
+				},
+				{
+					Kind:    report.EntryWarning,
+					Message: "Config has unrecognized key: ssh_authorised_keys, did you mean ssh_authorized_keys?",
+					Line:    9,
+					Column:  7,
+				},
+				{
+					Kind:    report.EntryWarning,
+					Message: "Config has unrecognized key: enabled",
+					Line:    16,
+					Column:  11,
+				},
+			}}},
+		},
+		{
+			in: in{data: `
+docker:
+  flag:
+    - --debug
+`, strict: true},
+			out: out{r: report.Report{Entries: []report.Entry{
+				{
+					Kind:    report.EntryError,
+					Message: "Config has unrecognized key: flag, did you mean flags?",
+					Line:    3,
+					Column:  3,
+				},
+			}}},
+		},
+	}
+
+	for i, test := range tests {
+		_, _, r := ParseWithOptions([]byte(test.in.data), ParseOptions{Strict: test.in.strict})
+		assert.Equal(t, test.out.r, r, "#%d: bad report", i)
+	}
+}
+
+func TestParseUnitContents(t *testing.T) {
+	tests := []struct {
+		in  string
+		out report.Report
+	}{
+		{
+			in: `
+systemd:
+  units:
+    - name: example.service
+      contents: |
+        [Unit]
+        Description=example
+        Wants=network-online.target
+
+        [Service]
+        ExecStrat=/usr/bin/true
+        X-Custom=yes
+
+        [Instal]
+        WantedBy=multi-user.target
+      dropins:
+        - name: 10-limits.conf
+          contents: |
+            [Service]
+            LimitNOFILE=65536
+            Memory=1G
+    - name: example.timer
+      contents: |
+        [Timer]
+        OnCalendar=daily
+        Persistent=true
+networkd:
+  units:
+    - name: 10-eth0.network
+      contents: |
+        [Match]
+        Name=eth0
+
+        [Network]
+        DHCP=yes
+        Adress=192.0.2.10/24
+
+        [X-Extra]
+        Anything=goes
+`,
+			out: report.Report{Entries: []report.Entry{
+				{
+					Kind:    report.EntryWarning,
+					Message: "unknown directive ExecStrat in section [Service] of service unit example.service, did you mean ExecStart?",
+					Line:    11,
+					Column:  9,
+				},
+				{
+					Kind:    report.EntryWarning,
+					Message: "unknown section [Instal] in service unit example.service, did you mean [Install]?",
+					Line:    15,
+					Column:  9,
+				},
+				{
+					Kind:    report.EntryWarning,
+					Message: "unknown directive Memory in section [Service] of service unit example.service",
+					Line:    21,
+					Column:  13,
+				},
+				{
+					Kind:    report.EntryWarning,
+					Message: "unknown directive Adress in section [Network] of network unit 10-eth0.network, did you mean Address?",
+					Line:    36,
+					Column:  9,
+				},
+			}},
+		},
+		{
+			in: `
+systemd:
+  units:
+    - name: example.service
+      contents: |
+        [Service]
+        ExecStart=/usr/bin/true
+        [Install
+        WantedBy=multi-user.target
+`,
+			// syntax errors are reported when the transpiled config is
+			// validated
+			out: report.Report{},
+		},
+		{
+			// types without a list of directives are only parsed
+			in: `
+systemd:
+  units:
+    - name: example.path
+      contents: |
+        [Path]
+        PathChanged=/etc/example
+        Unknown=yes
+`,
+		},
+	}
+
+	for i, test := range tests {
+		_, _, r := Parse([]byte(test.in))
+		assert.Equal(t, test.out, r, "#%d: bad report", i)
+	}
+}
+
+func TestCheckUnitGraph(t *testing.T) {
+	in := `
+docker:
+  flags:
+    - --debug
+systemd:
+  units:
+    - name: docker.service
+      dropins:
+        - name: 20-after.conf
+          contents: |
+            [Unit]
+            After=app.service
+    - name: app.service
+      enabled: true
+      contents: |
+        [Unit]
+        After=docker.service
+        Requires=docker.service db.service
+        [Install]
+        WantedBy=multi-user.target
+`
+	expected := report.Report{Entries: []report.Entry{
+		{
+			Kind:    report.EntryWarning,
+			Message: "ordering cycle: docker.service -> app.service -> docker.service",
+			Line:    7,
+			Column:  7,
+		},
+		{
+			Kind:    report.EntryWarning,
+			Message: "app.service references a unit that isn't in the config or shipped with Container Linux: Requires=db.service",
+			Line:    13,
+			Column:  7,
+		},
+	}}
+
+	cfg, ast, r := Parse([]byte(in))
+	assert.Len(t, r.Entries, 0, "parsing")
+	sourceMap := &types.SourceMap{}
+	igncfg, r := Convert(cfg, types.ConvertOptions{SourceMap: sourceMap}, ast)
+	assert.Equal(t, expected, r)
+	assert.Equal(t, expected, CheckUnitGraph(igncfg, *sourceMap, nil))
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		distance int
+	}{
+		{"", "", 0},
+		{"name", "name", 0},
+		{"nmae", "name", 1},
+		{"flag", "flags", 1},
+		{"ssh_authorised_keys", "ssh_authorized_keys", 1},
+		{"enable", "mask", 5},
+	}
+
+	for i, test := range tests {
+		assert.Equal(t, test.distance, editDistance(test.a, test.b), "#%d: bad distance", i)
+	}
+}
+
+func TestConvertDynamicData(t *testing.T) {
+	data := `storage:
+  files:
+    - path: /etc/motd
+      mode: 0644
+      contents:
+        inline: "{HOSTNAME} ${HOSTNAME}"
+systemd:
+  units:
+    - name: app.service
+      contents: "ExecStart=/usr/bin/app {PRIVATE_IPV4}"
+networkd:
+  units:
+    - name: 10-eth.network
+      contents: "Address={PRIVATE_IPV4}/24"
+`
+	cfg, ast, r := Parse([]byte(data))
+	assert.Equal(t, report.Report{}, r)
+	igncfg, r := Convert(cfg, types.ConvertOptions{Platform: "ec2", DynamicDataInContents: true}, ast)
+	assert.Equal(t, report.Report{}, r)
+
+	assert.Equal(t, []ignTypes.Unit{
+		{
+			Name:    "clct-render-etc-motd.service",
+			Enabled: util.BoolToPtr(true),
+			Contents: `[Unit]
+# Units reading /etc/motd should have After=clct-render-etc-motd.service and Requires=clct-render-etc-motd.service
+Description=Render /etc/motd from dynamic data
+Requires=coreos-metadata.service
+After=coreos-metadata.service
+Before=multi-user.target
+
+[Service]
+Type=oneshot
+RemainAfterExit=yes
+EnvironmentFile=/run/metadata/coreos
+ExecStart=/usr/bin/cp --preserve=mode,ownership /var/lib/clct/templates/etc/motd /etc/motd
+ExecStart=/usr/bin/awk "BEGIN { RS = \"^$$\"; out = ARGV[2]; for (i = 3; i < ARGC; i += 2) m[ARGV[i]] = ENVIRON[ARGV[i + 1]]; ARGC = 2 } { s = $$0; r = \"\"; while (match(s, /@CLCT_[A-Z0-9_]+@/)) { k = substr(s, RSTART, RLENGTH); r = r substr(s, 1, RSTART - 1) (k in m ? m[k] : k); s = substr(s, RSTART + RLENGTH) } printf \"%%s\", r s > out }" /var/lib/clct/templates/etc/motd /etc/motd @CLCT_HOSTNAME@ COREOS_EC2_HOSTNAME
+
+[Install]
+WantedBy=multi-user.target`,
+		},
+		{
+			Name:    `clct-render-etc-systemd-network-10\x2deth.network.service`,
+			Enabled: util.BoolToPtr(true),
+			Contents: `[Unit]
+# Units reading /etc/systemd/network/10-eth.network should have After=clct-render-etc-systemd-network-10\x2deth.network.service and Requires=clct-render-etc-systemd-network-10\x2deth.network.service
+Description=Render /etc/systemd/network/10-eth.network from dynamic data
+Requires=coreos-metadata.service
+After=coreos-metadata.service
+Before=multi-user.target
+
+[Service]
+Type=oneshot
+RemainAfterExit=yes
+EnvironmentFile=/run/metadata/coreos
+ExecStart=/usr/bin/cp --preserve=mode,ownership /var/lib/clct/templates/etc/systemd/network/10-eth.network /etc/systemd/network/10-eth.network
+ExecStart=/usr/bin/awk "BEGIN { RS = \"^$$\"; out = ARGV[2]; for (i = 3; i < ARGC; i += 2) m[ARGV[i]] = ENVIRON[ARGV[i + 1]]; ARGC = 2 } { s = $$0; r = \"\"; while (match(s, /@CLCT_[A-Z0-9_]+@/)) { k = substr(s, RSTART, RLENGTH); r = r substr(s, 1, RSTART - 1) (k in m ? m[k] : k); s = substr(s, RSTART + RLENGTH) } printf \"%%s\", r s > out }" /var/lib/clct/templates/etc/systemd/network/10-eth.network /etc/systemd/network/10-eth.network @CLCT_PRIVATE_IPV4@ COREOS_EC2_IPV4_LOCAL
+ExecStartPost=/usr/bin/systemctl try-restart systemd-networkd.service
+
+[Install]
+WantedBy=multi-user.target`,
+		},
+		{
+			Name:     "app.service",
+			Contents: "ExecStart=/usr/bin/app ${COREOS_EC2_IPV4_LOCAL}",
+			Dropins: []ignTypes.SystemdDropin{{
+				Name: "20-clct-metadata.conf",
+				Contents: `[Unit]
+Requires=coreos-metadata.service
+After=coreos-metadata.service
+
+[Service]
+EnvironmentFile=/run/metadata/coreos`,
+			}},
+		},
+	}, igncfg.Systemd.Units)
+
+	assert.Equal(t, 2, len(igncfg.Storage.Files))
+	assert.Equal(t, "/var/lib/clct/templates/etc/motd", igncfg.Storage.Files[0].Path)
+	assert.Equal(t, "data:,%40CLCT_HOSTNAME%40%20%24%7BHOSTNAME%7D", igncfg.Storage.Files[0].Contents.Source)
+	assert.Equal(t, "/var/lib/clct/templates/etc/systemd/network/10-eth.network", igncfg.Storage.Files[1].Path)
+	assert.Equal(t, 0, len(igncfg.Networkd.Units))
+
+	// every section needs a platform that provides the data
+	tests := []struct {
+		platform string
+		r        report.Report
+	}{
+		{"", report.Report{Entries: []report.Entry{
+			{Kind: report.EntryError, Message: types.ErrPlatformUnspecified.Error(), Line: 6, Column: 17},
+			{Kind: report.EntryError, Message: types.ErrPlatformUnspecified.Error(), Line: 14, Column: 17},
+			{Kind: report.EntryError, Message: types.ErrPlatformUnspecified.Error(), Line: 10, Column: 17},
+		}}},
+		{"azure", report.Report{Entries: []report.Entry{
+			{Kind: report.EntryError, Message: `dynamic data {HOSTNAME} is not available on platform "azure"`, Line: 6, Column: 17},
+		}}},
+	}
+	for i, test := range tests {
+		_, r := Convert(cfg, types.ConvertOptions{Platform: test.platform, DynamicDataInContents: true}, ast)
+		assert.Equal(t, test.r, r, "#%d: bad report", i)
+	}
+}
+
+func TestConvertDynamicDataLiteralBraces(t *testing.T) {
+	// braces of templates and escaped references aren't dynamic data
+	data := `storage:
+  files:
+    - path: /etc/app.tmpl
+      mode: 0644
+      contents:
+        inline: "host={{HOSTNAME}} name={{ .Name }} ip=\\{PRIVATE_IPV4}"
+systemd:
+  units:
+    - name: app.service
+      contents: |
+        [Service]
+        ExecStart=/usr/bin/echo \{HOSTNAME}
+`
+	cfg, ast, r := Parse([]byte(data))
+	assert.Equal(t, report.Report{}, r)
+	for _, platform := range []string{"", "ec2"} {
+		igncfg, r := Convert(cfg, types.ConvertOptions{Platform: platform, DynamicDataInContents: true}, ast)
+		assert.Equal(t, report.Report{}, r, "bad report on platform %q", platform)
+		assert.Equal(t, 1, len(igncfg.Storage.Files))
+		assert.Equal(t, "/etc/app.tmpl", igncfg.Storage.Files[0].Path)
+		assert.Equal(t, "data:,host%3D%7B%7BHOSTNAME%7D%7D%20name%3D%7B%7B%20.Name%20%7D%7D%20ip%3D%7BPRIVATE_IPV4%7D", igncfg.Storage.Files[0].Contents.Source)
+		assert.Equal(t, []ignTypes.Unit{{
+			Name:     "app.service",
+			Contents: "[Service]\nExecStart=/usr/bin/echo {HOSTNAME}\n",
+		}}, igncfg.Systemd.Units)
+	}
+}
+
+func TestConvertDynamicDataUnexpanded(t *testing.T) {
+	// systemd only expands variables in the commands of services
+	data := `systemd:
+  units:
+    - name: app.socket
+      contents: |
+        [Socket]
+        ListenStream={PRIVATE_IPV4}:80
+    - name: app.service
+      contents: |
+        [Service]
+        Environment=IP={PRIVATE_IPV4}
+        ExecStart=/usr/bin/app {PRIVATE_IPV4}
+    - name: other.service
+      dropins:
+        - name: ip.conf
+          contents: |
+            [Unit]
+            Description=App on {PRIVATE_IPV4}
+`
+	cfg, ast, r := Parse([]byte(data))
+	assert.Equal(t, report.Report{}, r)
+	_, r = Convert(cfg, types.ConvertOptions{Platform: "ec2", DynamicDataInContents: true}, ast)
+	assert.Equal(t, report.Report{Entries: []report.Entry{
+		{Kind: report.EntryError, Message: "dynamic data {PRIVATE_IPV4} can't be used in ListenStream of app.socket, systemd only expands it in the Exec directives of services", Line: 4, Column: 17},
+		{Kind: report.EntryError, Message: "dynamic data {PRIVATE_IPV4} can't be used in Environment of app.service, systemd only expands it in the Exec directives of services", Line: 8, Column: 17},
+		{Kind: report.EntryError, Message: "dynamic data {PRIVATE_IPV4} can't be used in Description of other.service, systemd only expands it in the Exec directives of services", Line: 15, Column: 21},
+	}}, r)
+}
+
+func TestConvertDynamicDataDisabled(t *testing.T) {
+	// without the option, contents are written as they are
+	data := `storage:
+  files:
+    - path: /etc/motd
+      mode: 0644
+      contents:
+        inline: "{HOSTNAME} \\{HOSTNAME}"
+systemd:
+  units:
+    - name: app.socket
+      contents: |
+        [Socket]
+        ListenStream={PRIVATE_IPV4}:80
+networkd:
+  units:
+    - name: 10-eth.network
+      contents: "Address={PRIVATE_IPV4}/24"
+`
+	cfg, ast, r := Parse([]byte(data))
+	assert.Equal(t, report.Report{}, r)
+	for _, platform := range []string{"", "ec2"} {
+		igncfg, r := Convert(cfg, types.ConvertOptions{Platform: platform}, ast)
+		assert.Equal(t, report.Report{}, r, "bad report on platform %q", platform)
+		assert.Equal(t, 1, len(igncfg.Storage.Files))
+		assert.Equal(t, "data:,%7BHOSTNAME%7D%20%5C%7BHOSTNAME%7D", igncfg.Storage.Files[0].Contents.Source)
+		assert.Equal(t, []ignTypes.Unit{{
+			Name:     "app.socket",
+			Contents: "[Socket]\nListenStream={PRIVATE_IPV4}:80\n",
+		}}, igncfg.Systemd.Units)
+		assert.Equal(t, []ignTypes.Networkdunit{{
+			Name:     "10-eth.network",
+			Contents: "Address={PRIVATE_IPV4}/24",
+		}}, igncfg.Networkd.Units)
+	}
+}
+
+func TestParseVariables(t *testing.T) {
+	const data = `variables:
+  group:
+    default: stable
+  mode:
+    type: number
+  keys:
+    type: list
+storage:
+  files:
+    - path: "/opt/${var.group}/file"
+      mode: ${var.mode}
+      contents:
+        inline: |
+          group=${var.group} # not a comment
+          escaped=$${var.group}
+passwd:
+  users:
+    - name: core
+      ssh_authorized_keys: ${var.keys} # ${var.ignored}
+`
+	type out struct {
+		path     string
+		mode     int
+		contents string
+		keys     []string
+		r        report.Report
+	}
+	tests := []struct {
+		in  map[string]interface{}
+		out out
+	}{
+		{
+			in: map[string]interface{}{"mode": "0600", "keys": "[ssh-rsa a, 'ssh-rsa: b']"},
+			out: out{
+				path:     "/opt/stable/file",
+				mode:     0600,
+				contents: "group=stable # not a comment\nescaped=${var.group}\n",
+				keys:     []string{"ssh-rsa a", "ssh-rsa: b"},
+			},
+		},
+		{
+			in: map[string]interface{}{"group": "beta", "mode": 420, "keys": []interface{}{"ssh-rsa a"}, "other": "x"},
+			out: out{
+				path:     "/opt/beta/file",
+				mode:     0644,
+				contents: "group=beta # not a comment\nescaped=${var.group}\n",
+				keys:     []string{"ssh-rsa a"},
+				r: report.Report{Entries: []report.Entry{
+					{Kind: report.EntryWarning, Message: "variable other is set but not declared"},
+				}},
+			},
+		},
+		{
+			in: map[string]interface{}{"keys": "[]"},
+			out: out{r: report.Report{Entries: []report.Entry{
+				{Kind: report.EntryError, Message: "variable mode is not set and has no default", Line: 11, Column: 13},
+			}}},
+		},
+		{
+			in: map[string]interface{}{"mode": "rw", "keys": "ssh-rsa a"},
+			out: out{r: report.Report{Entries: []report.Entry{
+				{Kind: report.EntryError, Message: "value of variable keys: ssh-rsa a is not a list"},
+				{Kind: report.EntryError, Message: "value of variable mode: rw is not a number"},
+				{Kind: report.EntryError, Message: "variable mode is not set and has no default", Line: 11, Column: 13},
+				{Kind: report.EntryError, Message: "variable keys is not set and has no default", Line: 19, Column: 28},
+			}}},
+		},
+	}
+
+	for i, test := range tests {
+		cfg, _, r := ParseWithOptions([]byte(data), ParseOptions{Variables: test.in})
+		assert.Equal(t, test.out.r, r, "#%d: bad report", i)
+		if r.IsFatal() {
+			continue
+		}
+		assert.Equal(t, test.out.path, cfg.Storage.Files[0].Path, "#%d: bad path", i)
+		assert.Equal(t, test.out.mode, *cfg.Storage.Files[0].Mode, "#%d: bad mode", i)
+		assert.Equal(t, test.out.contents, cfg.Storage.Files[0].Contents.Inline, "#%d: bad contents", i)
+		assert.Equal(t, test.out.keys, cfg.Passwd.Users[0].SSHAuthorizedKeys, "#%d: bad keys", i)
+	}
+
+	_, _, r := Parse([]byte("update:\n  group: ${var.nope}\n"))
+	assert.Equal(t, report.Report{Entries: []report.Entry{
+		{Kind: report.EntryError, Message: "variable nope is not declared", Line: 2, Column: 10},
+	}}, r)
+}
+
+func TestParseVariablesDefaultText(t *testing.T) {
+	// a default is used as written, like the same value given with --var
+	const data = `variables:
+  mode:
+    type: number
+    default: 0644
+  name:
+    default: 0644
+storage:
+  files:
+    - path: /etc/motd
+      mode: ${var.mode}
+      contents:
+        inline: "mode is ${var.mode}, name is ${var.name}"
+`
+	var contents []string
+	for _, values := range []map[string]interface{}{nil, {"mode": "0644", "name": "0644"}} {
+		cfg, _, r := ParseWithOptions([]byte(data), ParseOptions{Variables: values})
+		assert.Equal(t, report.Report{}, r)
+		assert.Equal(t, 1, len(cfg.Storage.Files))
+		assert.Equal(t, 0644, *cfg.Storage.Files[0].Mode)
+		contents = append(contents, cfg.Storage.Files[0].Contents.Inline)
+	}
+	assert.Equal(t, "mode is 0644, name is 0644", contents[0])
+	assert.Equal(t, contents[0], contents[1])
+}
+
+func TestParseVariablesEscaping(t *testing.T) {
+	// values are escaped for the scalars they are used in
+	const data = `variables:
+  motd: {}
+storage:
+  files:
+    - path: /etc/${var.motd}
+      mode: 0644
+      contents:
+        inline: "Welcome to ${var.motd}"
+    - path: '/etc/${var.motd}'
+      mode: 0644
+      contents:
+        inline: |
+          Welcome to ${var.motd} # not a comment
+passwd:
+  users:
+    - name: core
+      groups: ["a${var.motd}", b]
+`
+	tests := []string{
+		"prod # cluster",
+		"prod: cluster",
+		`it's "prod" \ cluster`,
+		"prod, cluster]",
+	}
+
+	for i, motd := range tests {
+		cfg, _, r := ParseWithOptions([]byte(data), ParseOptions{Variables: map[string]interface{}{"motd": motd}})
+		assert.Equal(t, report.Report{}, r, "#%d: bad report", i)
+		if r.IsFatal() {
+			continue
+		}
+		assert.Equal(t, "/etc/"+motd, cfg.Storage.Files[0].Path, "#%d: bad plain scalar", i)
+		assert.Equal(t, "Welcome to "+motd, cfg.Storage.Files[0].Contents.Inline, "#%d: bad double-quoted scalar", i)
+		assert.Equal(t, "/etc/"+motd, cfg.Storage.Files[1].Path, "#%d: bad single-quoted scalar", i)
+		assert.Equal(t, "Welcome to "+motd+" # not a comment\n", cfg.Storage.Files[1].Contents.Inline, "#%d: bad block scalar", i)
+		assert.Equal(t, []string{"a" + motd, "b"}, cfg.Passwd.Users[0].Groups, "#%d: bad flow scalar", i)
+	}
+}
+
+func TestParseIncludes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ct-include")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"base.yaml": `include:
+  - fragments/users.yaml
+systemd:
+  units:
+    - name: app.service
+      enabled: true
+`,
+		"fragments/users.yaml": `passwd:
+  users:
+    - name: core
+      ssh_authorized_keys: [ssh-rsa b]
+    - name: admin
+`,
+		"worker.yaml": `systemd:
+  units:
+    - name: app.service
+      mask: true
+    - name: worker.service
+`,
+		"conflict.yaml": `storage:
+  files:
+    - path: /etc/motd
+      mode: 0600
+`,
+		"cycle.yaml": `include: [config.yaml]
+`,
+	}
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		assert.Nil(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.Nil(t, ioutil.WriteFile(path, []byte(data), 0644))
+	}
+
+	const root = `include:
+  - base.yaml
+  - %s
+passwd:
+  users:
+    - name: core
+      ssh_authorized_keys: [ssh-rsa a]
+storage:
+  files:
+    - path: /etc/motd
+      mode: 0644
+`
+	path := filepath.Join(dir, "config.yaml")
+
+	cfg, _, r := ParseWithOptions([]byte(fmt.Sprintf(root, "worker.yaml")), ParseOptions{Path: path})
+	assert.Equal(t, report.Report{}, r)
+	assert.Nil(t, cfg.Include)
+	assert.Equal(t, []types.User{
+		{Name: "core", SSHAuthorizedKeys: []string{"ssh-rsa a", "ssh-rsa b"}},
+		{Name: "admin"},
+	}, cfg.Passwd.Users)
+	assert.Equal(t, []types.SystemdUnit{
+		{Name: "app.service", Enabled: util.BoolToPtr(true), Mask: true},
+		{Name: "worker.service"},
+	}, cfg.Systemd.Units)
+	assert.Equal(t, 1, len(cfg.Storage.Files))
+	assert.Equal(t, []string{
+		filepath.Join(dir, "base.yaml"),
+		filepath.Join(dir, "fragments/users.yaml"),
+		filepath.Join(dir, "worker.yaml"),
+	}, Includes([]byte(fmt.Sprintf(root, "worker.yaml")), path))
+
+	_, _, r = ParseWithOptions([]byte(fmt.Sprintf(root, "conflict.yaml")), ParseOptions{Path: path})
+	assert.Equal(t, report.Report{Entries: []report.Entry{{
+		Kind:    report.EntryError,
+		Message: fmt.Sprintf("conflicting values for storage.files[/etc/motd].mode: 0644 in %s:11:13 and 0600 in %s:4:13", path, filepath.Join(dir, "conflict.yaml")),
+		Line:    11,
+		Column:  13,
+	}}}, r)
+
+	_, _, r = ParseWithOptions([]byte(fmt.Sprintf(root, "cycle.yaml")), ParseOptions{Path: path})
+	assert.Equal(t, report.Report{Entries: []report.Entry{{
+		Kind:    report.EntryError,
+		Message: fmt.Sprintf("include cycle: %s includes %s", filepath.Join(dir, "cycle.yaml"), path),
+		Line:    3,
+		Column:  5,
+	}}}, r)
+
+	_, _, r = ParseWithOptions([]byte(fmt.Sprintf(root, "missing.yaml")), ParseOptions{Path: path})
+	assert.Equal(t, 1, len(r.Entries))
+	assert.Equal(t, 3, r.Entries[0].Line)
+	assert.True(t, r.IsFatal())
+}
+
+func TestParseIncludesDuplicates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ct-include")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	const docker = `systemd:
+  units:
+    - name: docker.service
+      enabled: true
+    - name: docker.service
+      mask: true
+    - name: docker.service
+      enable: true
+passwd:
+  users:
+    - name: core
+      groups: [docker, wheel]
+`
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "docker.yaml"), []byte(docker), 0644))
+
+	// entries of the same config are never merged with each other
+	const root = `include: [docker.yaml]
+systemd:
+  units:
+    - name: docker.service
+      dropins:
+        - name: 10-a.conf
+    - name: docker.service
+      dropins:
+        - name: 10-b.conf
+passwd:
+  users:
+    - name: core
+      groups: [docker, docker]
+`
+	cfg, _, r := ParseWithOptions([]byte(root), ParseOptions{Path: filepath.Join(dir, "config.yaml")})
+	assert.False(t, r.IsFatal(), "unexpected report: %v", r)
+	assert.Equal(t, []types.SystemdUnit{
+		{Name: "docker.service", Enabled: util.BoolToPtr(true), Dropins: []types.SystemdUnitDropIn{{Name: "10-a.conf"}}},
+		{Name: "docker.service", Mask: true, Dropins: []types.SystemdUnitDropIn{{Name: "10-b.conf"}}},
+		{Name: "docker.service", Enable: true},
+	}, cfg.Systemd.Units)
+	assert.Equal(t, []string{"docker", "docker", "wheel"}, cfg.Passwd.Users[0].Groups)
+}
+
+func TestOverlay(t *testing.T) {
+	base := types.Config{
+		Etcd: &types.Etcd{Options: types.Etcd3_0{
+			Name:           util.StringToPtr("node"),
+			InitialCluster: util.StringToPtr("node=http://10.0.0.1:2380"),
+		}},
+		Passwd: types.Passwd{Users: []types.User{
+			{Name: "core", SSHAuthorizedKeys: []string{"ssh-rsa a", "ssh-rsa b"}},
+			{Name: "admin"},
+		}},
+		Systemd: types.Systemd{Units: []types.SystemdUnit{
+			{Name: "docker.service", Enabled: util.BoolToPtr(true)},
+			{Name: "debug.service"},
+		}},
+	}
+
+	cfg, _, r := Overlay(base, nil, []byte(`patches:
+  - target: systemd.units[docker.service].dropins
+    merge:
+      - name: 10-opts.conf
+        contents: "[Service]\nEnvironment=DOCKER_OPTS=--debug"
+  - target: systemd.units[debug.service]
+    delete: true
+  - target: systemd.units[app.service]
+    merge:
+      enabled: true
+  - target: passwd.users[core].ssh_authorized_keys
+    remove: [ssh-rsa a]
+  - target: etcd.initial_cluster
+    set: node=http://10.0.0.2:2380
+`))
+	assert.Equal(t, report.Report{}, r)
+	assert.Equal(t, types.Etcd3_0{
+		Name:           util.StringToPtr("node"),
+		InitialCluster: util.StringToPtr("node=http://10.0.0.2:2380"),
+	}, cfg.Etcd.Options)
+	assert.Equal(t, []types.User{
+		{Name: "core", SSHAuthorizedKeys: []string{"ssh-rsa b"}},
+		{Name: "admin"},
+	}, cfg.Passwd.Users)
+	assert.Equal(t, []types.SystemdUnit{
+		{Name: "docker.service", Enabled: util.BoolToPtr(true), Dropins: []types.SystemdUnitDropIn{
+			{Name: "10-opts.conf", Contents: "[Service]\nEnvironment=DOCKER_OPTS=--debug"},
+		}},
+		{Name: "app.service", Enabled: util.BoolToPtr(true)},
+	}, cfg.Systemd.Units)
+	// the base config is left alone
+	assert.Equal(t, []string{"ssh-rsa a", "ssh-rsa b"}, base.Passwd.Users[0].SSHAuthorizedKeys)
+	assert.Equal(t, 2, len(base.Systemd.Units))
+
+	_, _, r = Overlay(base, nil, []byte(`patches:
+  - target: passwd.users[root]
+    delete: true
+`))
+	assert.Equal(t, report.Report{Entries: []report.Entry{{
+		Kind:    report.EntryError,
+		Message: "passwd.users[root]: no entry root",
+		Line:    3,
+		Column:  13,
+	}}}, r)
+
+	_, _, r = Overlay(base, nil, []byte(`patches:
+  - target: passwd.users[core].ssh_authorized_keys
+    remove: [ssh-rsa c]
+  - target: systemd.units[docker.service]
+    set: {}
+    delete: true
+`))
+	assert.Equal(t, report.Report{Entries: []report.Entry{
+		{
+			Kind:    report.EntryWarning,
+			Message: "passwd.users[core].ssh_authorized_keys: ssh-rsa c is not in the list",
+			Line:    3,
+			Column:  13,
+		},
+		{
+			Kind:    report.EntryError,
+			Message: ErrPatchOperation.Error(),
+			Line:    4,
+			Column:  13,
+		},
+	}}, r)
+}
+
+func TestOverlayPatchValues(t *testing.T) {
+	base := types.Config{
+		Systemd: types.Systemd{Units: []types.SystemdUnit{
+			{Name: "docker.service", Dropins: []types.SystemdUnitDropIn{{Name: "10-x.conf", Contents: "[Service]\nUser=a"}}},
+		}},
+	}
+
+	cfg, _, r := Overlay(base, nil, []byte(`patches:
+  - target: systemd.units[docker.service].dropins[10-x.conf]
+    set:
+      contents: "[Service]\nUser=b"
+`))
+	assert.Equal(t, report.Report{}, r)
+	assert.Equal(t, []types.SystemdUnitDropIn{{Name: "10-x.conf", Contents: "[Service]\nUser=b"}}, cfg.Systemd.Units[0].Dropins)
+
+	_, _, r = Overlay(base, nil, []byte(`patches:
+  - target: systemd.units[docker.service].dropins[10-x.conf]
+    merge:
+      contnets: "[Service]\nUsr=b"
+  - target: systemd.units[docker.service]
+    merge:
+      contents: "[Service]\nUsr=b"
+`))
+	assert.Equal(t, report.Report{Entries: []report.Entry{
+		{
+			Kind:    report.EntryWarning,
+			Message: "Config has unrecognized key: contnets, did you mean contents?",
+			Line:    4,
+			Column:  7,
+		},
+		{
+			Kind:    report.EntryWarning,
+			Message: "unknown directive Usr in section [Service] of service unit docker.service, did you mean User?",
+			Line:    7,
+			Column:  7,
+		},
+	}}, r)
+
+	_, _, r = Overlay(base, nil, []byte(`patches:
+  - target: etcd.initial_cluster
+    set: node=http://10.0.0.2:2380
+`))
+	assert.Equal(t, report.Report{Entries: []report.Entry{{
+		Kind:    report.EntryError,
+		Message: "etcd.initial_cluster: the config has no etcd section",
+		Line:    3,
+		Column:  10,
+	}}}, r)
+}
+
+func TestOverlayPositions(t *testing.T) {
+	cfg, ast, r := Parse([]byte(`passwd:
+  users:
+    - name: old
+    - name: core
+      password_hash: a
+`))
+	assert.False(t, r.IsFatal(), "unexpected report: %v", r)
+
+	cfg, ast, r = Overlay(cfg, ast, []byte(`patches:
+  - target: passwd.users[old]
+    delete: true
+`))
+	assert.Equal(t, report.Report{}, r)
+	n, ok := astyaml.NodeAt(ast, "passwd", "users", 0, "password_hash")
+	if assert.True(t, ok) {
+		line, col, _ := n.ValueLineCol(nil)
+		assert.Equal(t, []int{5, 22}, []int{line, col})
+	}
+	_, ok = astyaml.NodeAt(ast, "passwd", "users", 1)
+	assert.False(t, ok)
+	assert.Equal(t, "core", cfg.Passwd.Users[0].Name)
+}
+
+func TestConvertPlatforms(t *testing.T) {
+	data := `passwd:
+  users:
+    - name: core
+    - name: ec2-user
+      platforms: [ec2]
+storage:
+  files:
+    - path: /etc/gce
+      mode: 0644
+      platforms: [gce]
+systemd:
+  units:
+    - name: ec2.service
+      platforms: [ec2, packet]
+    - name: app.service
+networkd:
+  units:
+    - name: 10-packet.network
+      platforms: [packet]
+`
+	cfg, ast, r := Parse([]byte(data))
+	assert.Equal(t, report.Report{}, r)
+
+	igncfg, r := Convert(cfg, types.ConvertOptions{Platform: "ec2"}, ast)
+	assert.Equal(t, report.Report{}, r)
+	assert.Equal(t, []ignTypes.PasswdUser{{Name: "core"}, {Name: "ec2-user"}}, igncfg.Passwd.Users)
+	assert.Equal(t, 0, len(igncfg.Storage.Files))
+	assert.Equal(t, []ignTypes.Unit{{Name: "ec2.service"}, {Name: "app.service"}}, igncfg.Systemd.Units)
+	assert.Equal(t, 0, len(igncfg.Networkd.Units))
+
+	igncfg, r = Convert(cfg, types.ConvertOptions{Platform: "packet"}, ast)
+	assert.Equal(t, report.Report{}, r)
+	assert.Equal(t, []ignTypes.PasswdUser{{Name: "core"}}, igncfg.Passwd.Users)
+	assert.Equal(t, []ignTypes.Networkdunit{{Name: "10-packet.network"}}, igncfg.Networkd.Units)
+
+	igncfg, r = Convert(cfg, types.ConvertOptions{}, ast)
+	assert.Equal(t, 4, len(r.Entries))
+	assert.Equal(t, report.Entry{
+		Kind:    report.EntryWarning,
+		Message: types.WarningPlatformsUnset.Error(),
+		Line:    10,
+		Column:  7,
+	}, r.Entries[0])
+	assert.Equal(t, []ignTypes.Unit{{Name: "app.service"}}, igncfg.Systemd.Units)
+
+	_, _, r = Parse([]byte(`systemd:
+  units:
+    - name: app.service
+      platforms: [ec2, metal]
+`))
+	assert.Equal(t, report.Report{Entries: []report.Entry{{
+		Kind:    report.EntryError,
+		Message: fmt.Sprintf("unknown platform %q, accepted values: %v", "metal", platform.Platforms),
+		Line:    4,
+		Column:  18,
+	}}}, r)
+}
+
+func TestConvertNetworkdInterfaces(t *testing.T) {
+	data := `networkd:
+  units:
+    - name: 00-lo.network
+      contents: "[Match]\nName=lo"
+  interfaces:
+    - name: lan0
+      match:
+        mac: "52:54:00:12:34:56"
+      bond: bond0
+    - name: lan1
+      match:
+        name: enp1s*
+      bond: bond0
+    - name: eth0
+      match:
+        name: eth0
+      dhcp: true
+    - name: bond0
+      kind: bond
+      bond_mode: 802.3ad
+      mtu: 9000
+      vlans: [vlan10]
+      dhcp: ipv4
+    - name: vlan10
+      kind: vlan
+      vlan_id: 10
+      bridge: br0
+    - name: br0
+      kind: bridge
+      addresses: [192.0.2.10/24, "2001:db8::10/64"]
+      gateways: [192.0.2.1]
+      dns: [192.0.2.53]
+      domains: [example.com, example.net]
+`
+	cfg, ast, r := Parse([]byte(data))
+	assert.Equal(t, report.Report{}, r)
+	igncfg, r := Convert(cfg, types.ConvertOptions{}, ast)
+	assert.Equal(t, report.Report{}, r)
+	assert.Equal(t, []ignTypes.Networkdunit{
+		{Name: "00-lo.network", Contents: "[Match]\nName=lo"},
+		{Name: "10-lan0.link", Contents: "[Match]\nMACAddress=52:54:00:12:34:56\n\n[Link]\nName=lan0"},
+		{Name: "10-lan0.network", Contents: "[Match]\nName=lan0\n\n[Network]\nBond=bond0"},
+		{Name: "10-lan1.link", Contents: "[Match]\nOriginalName=enp1s*\n\n[Link]\nName=lan1"},
+		{Name: "10-lan1.network", Contents: "[Match]\nName=lan1\n\n[Network]\nBond=bond0"},
+		{Name: "10-eth0.network", Contents: "[Match]\nName=eth0\n\n[Network]\nDHCP=yes"},
+		{Name: "10-bond0.netdev", Contents: "[NetDev]\nName=bond0\nKind=bond\nMTUBytes=9000\n\n[Bond]\nMode=802.3ad"},
+		{Name: "10-bond0.network", Contents: "[Match]\nName=bond0\n\n[Network]\nDHCP=ipv4\nVLAN=vlan10"},
+		{Name: "10-vlan10.netdev", Contents: "[NetDev]\nName=vlan10\nKind=vlan\n\n[VLAN]\nId=10"},
+		{Name: "10-vlan10.network", Contents: "[Match]\nName=vlan10\n\n[Network]\nBridge=br0"},
+		{Name: "10-br0.netdev", Contents: "[NetDev]\nName=br0\nKind=bridge"},
+		{Name: "10-br0.network", Contents: "[Match]\nName=br0\n\n[Network]\nAddress=192.0.2.10/24\nAddress=2001:db8::10/64\nGateway=192.0.2.1\nDNS=192.0.2.53\nDomains=example.com example.net"},
+	}, igncfg.Networkd.Units)
+
+	tests := []struct {
+		in  string
+		out report.Report
+	}{
+		{
+			in: `networkd:
+  interfaces:
+    - name: eth0
+      addresses: [192.0.2.10]
+      mtu: 20
+`,
+			out: report.Report{Entries: []report.Entry{
+				{
+					Kind:    report.EntryError,
+					Message: "mtu must be between 68 and 65535",
+					Line:    5,
+					Column:  12,
+				},
+				{
+					Kind:    report.EntryError,
+					Message: `invalid address "192.0.2.10", expected an address with a prefix length like 192.0.2.10/24`,
+					Line:    4,
+					Column:  18,
+				},
+			}},
+		},
+		{
+			in: `networkd:
+  interfaces:
+    - name: vlan5000
+      kind: vlan
+      vlan_id: 5000
+    - name: bond0
+      kind: bond
+      bond_mode: fastest
+`,
+			out: report.Report{Entries: []report.Entry{
+				{
+					Kind:    report.EntryError,
+					Message: types.ErrInvalidVLANID.Error(),
+					Line:    5,
+					Column:  16,
+				},
+				{
+					Kind:    report.EntryError,
+					Message: types.ErrUnknownBondMode.Error(),
+					Line:    8,
+					Column:  18,
+				},
+			}},
+		},
+	}
+	for i, test := range tests {
+		_, _, r := Parse([]byte(test.in))
+		assert.Equal(t, test.out, r, "#%d: bad report", i)
+	}
+
+	cfg, ast, r = Parse([]byte(`networkd:
+  units:
+    - name: 10-eth0.network
+  interfaces:
+    - name: eth0
+      bond: bond0
+    - name: eth1
+      vlans: [eth0]
+`))
+	assert.Equal(t, report.Report{}, r)
+	_, r = Convert(cfg, types.ConvertOptions{}, ast)
+	assert.Equal(t, report.Report{Entries: []report.Entry{
+		{
+			Kind:    report.EntryError,
+			Message: "bond bond0 is not in interfaces",
+			Line:    6,
+			Column:  13,
+		},
+		{
+			Kind:    report.EntryError,
+			Message: "interface eth0 is not a vlan",
+			Line:    8,
+			Column:  14,
+		},
+	}}, r)
+
+	cfg, ast, r = Parse([]byte(`networkd:
+  units:
+    - name: 10-eth0.network
+  interfaces:
+    - name: eth0
+      dhcp: true
+`))
+	assert.Equal(t, report.Report{}, r)
+	_, r = Convert(cfg, types.ConvertOptions{}, ast)
+	assert.Equal(t, report.Report{Entries: []report.Entry{{
+		Kind:    report.EntryError,
+		Message: "networkd unit 10-eth0.network is generated for interface eth0 but also listed in units",
+		Line:    5,
+		Column:  13,
+	}}}, r)
+}
+
+func TestConvertSystemdJobs(t *testing.T) {
+	data := `systemd:
+  units:
+    - name: docker.service
+      enabled: true
+  jobs:
+    - name: backup
+      command: /opt/bin/backup --to "s3://bucket" --stamp $STAMP --quota 90%
+      on_calendar: Mon..Fri *-*-* 02:00
+      user: core
+      environment:
+        - AWS_REGION=us-east-1
+        - LABEL=say "hi"
+        - STAMP=%Y-%m-%d
+      randomized_delay: 30m
+    - name: cleanup
+      command: -/usr/bin/docker system prune -f
+      interval: 90m
+`
+	cfg, ast, r := Parse([]byte(data))
+	assert.Equal(t, report.Report{}, r)
+	igncfg, r := Convert(cfg, types.ConvertOptions{}, ast)
+	assert.Equal(t, report.Report{}, r)
+	assert.Equal(t, []ignTypes.Unit{
+		{Name: "docker.service", Enabled: util.BoolToPtr(true)},
+		{
+			Name:     "backup.service",
+			Contents: "[Unit]\nDescription=Job backup\n\n[Service]\nType=oneshot\nUser=core\nEnvironment=\"AWS_REGION=us-east-1\"\nEnvironment=\"LABEL=say \\\"hi\\\"\"\nEnvironment=\"STAMP=%%Y-%%m-%%d\"\nExecStart=/opt/bin/backup --to \"s3://bucket\" --stamp $STAMP --quota 90%%",
+		},
+		{
+			Name:     "backup.timer",
+			Enabled:  util.BoolToPtr(true),
+			Contents: "[Unit]\nDescription=Timer for job backup\n\n[Timer]\nOnCalendar=Mon..Fri *-*-* 02:00\nPersistent=true\nRandomizedDelaySec=30min\n\n[Install]\nWantedBy=timers.target",
+		},
+		{
+			Name:     "cleanup.service",
+			Contents: "[Unit]\nDescription=Job cleanup\n\n[Service]\nType=oneshot\nExecStart=-/usr/bin/docker system prune -f",
+		},
+		{
+			Name:     "cleanup.timer",
+			Enabled:  util.BoolToPtr(true),
+			Contents: "[Unit]\nDescription=Timer for job cleanup\n\n[Timer]\nOnBootSec=1h30min\nOnUnitActiveSec=1h30min\n\n[Install]\nWantedBy=timers.target",
+		},
+	}, igncfg.Systemd.Units)
+
+	tests := []struct {
+		in  string
+		out report.Report
+	}{
+		{
+			in: `systemd:
+  jobs:
+    - name: report
+      command: report.sh
+      on_calendar: mon 25:00
+`,
+			out: report.Report{Entries: []report.Entry{
+				{
+					Kind:    report.EntryError,
+					Message: types.ErrRelativeJobCommand.Error(),
+					Line:    4,
+					Column:  16,
+				},
+				{
+					Kind:    report.EntryError,
+					Message: "couldn't parse on_calendar: hour must be between 0 and 23, not 25",
+					Line:    5,
+					Column:  20,
+				},
+			}},
+		},
+		{
+			in: `systemd:
+  jobs:
+    - name: my job
+      command: /bin/true
+      interval: -5m
+      environment: [FOO]
+`,
+			out: report.Report{Entries: []report.Entry{
+				{
+					Kind:    report.EntryError,
+					Message: types.ErrInvalidJobName.Error(),
+					Line:    3,
+					Column:  13,
+				},
+				{
+					Kind:    report.EntryError,
+					Message: types.ErrParsingInterval.Error(),
+					Line:    5,
+					Column:  17,
+				},
+				{
+					Kind:    report.EntryError,
+					Message: types.ErrInvalidJobEnvironment.Error(),
+					Line:    6,
+					Column:  20,
+				},
+			}},
+		},
+		{
+			in: `systemd:
+  jobs:
+    - name: report
+      command: /opt/bin/report
+      on_calendar: daily
+      interval: 1h
+`,
+			out: report.Report{Entries: []report.Entry{{
+				Kind:    report.EntryError,
+				Message: types.ErrJobScheduleRequired.Error(),
+				Line:    3,
+				Column:  7,
+			}}},
+		},
+	}
+	for i, test := range tests {
+		_, _, r := Parse([]byte(test.in))
+		assert.Equal(t, test.out, r, "#%d: bad report", i)
+	}
+
+	cfg, ast, r = Parse([]byte(`systemd:
+  units:
+    - name: backup.timer
+  jobs:
+    - name: backup
+      command: /opt/bin/backup
+      on_calendar: daily
+`))
+	assert.Equal(t, report.Report{}, r)
+	_, r = Convert(cfg, types.ConvertOptions{}, ast)
+	assert.Equal(t, report.Report{Entries: []report.Entry{{
+		Kind:    report.EntryError,
+		Message: "systemd unit backup.timer is generated for job backup but also listed in units",
+		Line:    5,
+		Column:  13,
+	}}}, r)
+}
+
+func TestConvertContainers(t *testing.T) {
+	data := `containers:
+  - name: db
+    image: postgres:10
+    environment: ["POSTGRES_PASSWORD=pa$$ word"]
+    volumes: ["pgdata:/var/lib/postgresql/data"]
+  - name: web
+    image: quay.io/example/web@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef
+    command: [--motd, '100% "up"']
+    ports: ["127.0.0.1:8080:80"]
+    read_only: true
+    capabilities: [NET_BIND_SERVICE]
+    restart: on-failure
+    depends_on: [db, etcd-member.service]
+`
+	cfg, ast, r := Parse([]byte(data))
+	assert.Equal(t, report.Report{}, r)
+	igncfg, r := Convert(cfg, types.ConvertOptions{}, ast)
+	assert.Equal(t, report.Report{}, r)
+	assert.Equal(t, []ignTypes.Unit{
+		{
+			Name:    "container-db.service",
+			Enabled: util.BoolToPtr(true),
+			Contents: `[Unit]
+Description=Container db
+Wants=network-online.target
+After=network-online.target docker.service
+Requires=docker.service
+
+[Service]
+TimeoutStartSec=0
+ExecStartPre=-/usr/bin/docker rm --force db
+ExecStartPre=-/usr/bin/docker pull postgres:10
+ExecStart=/usr/bin/docker run --rm --name db --security-opt no-new-privileges --volume pgdata:/var/lib/postgresql/data --env "POSTGRES_PASSWORD=pa$$$$ word" postgres:10
+ExecStop=/usr/bin/docker stop db
+Restart=always
+RestartSec=10s
+
+[Install]
+WantedBy=multi-user.target`,
+		},
+		{
+			Name:    "container-web.service",
+			Enabled: util.BoolToPtr(true),
+			Contents: `[Unit]
+Description=Container web
+Wants=network-online.target
+After=network-online.target docker.service container-db.service etcd-member.service
+Requires=docker.service container-db.service etcd-member.service
+
+[Service]
+TimeoutStartSec=0
+ExecStartPre=-/usr/bin/docker rm --force web
+ExecStart=/usr/bin/docker run --rm --name web --security-opt no-new-privileges --read-only --cap-drop ALL --cap-add NET_BIND_SERVICE --publish 127.0.0.1:8080:80 quay.io/example/web@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef --motd "100%% \"up\""
+ExecStop=/usr/bin/docker stop web
+Restart=on-failure
+RestartSec=10s
+
+[Install]
+WantedBy=multi-user.target`,
+		},
+	}, igncfg.Systemd.Units)
+
+	tests := []struct {
+		in  string
+		out report.Report
+	}{
+		{
+			in: `containers:
+  - name: web
+    image: Example/Web
+    ports: ["80:http"]
+    volumes: ["./html:/usr/share/nginx/html"]
+    restart: unless-stopped
+`,
+			out: report.Report{Entries: []report.Entry{
+				{
+					Kind:    report.EntryError,
+					Message: types.ErrInvalidImage.Error(),
+					Line:    3,
+					Column:  12,
+				},
+				{
+					Kind:    report.EntryError,
+					Message: `invalid port "80:http", expected [IP:][HOST_PORT:]CONTAINER_PORT[/PROTOCOL] like 127.0.0.1:8080:80/tcp`,
+					Line:    4,
+					Column:  12,
+				},
+				{
+					Kind:    report.EntryError,
+					Message: `invalid volume "./html:/usr/share/nginx/html", expected [SOURCE:]DESTINATION[:OPTIONS] where the source is an absolute path or the name of a volume`,
+					Line:    5,
+					Column:  14,
+				},
+				{
+					Kind:    report.EntryError,
+					Message: types.ErrUnknownRestartPolicy.Error(),
+					Line:    6,
+					Column:  14,
+				},
+			}},
+		},
+		{
+			in: `containers:
+  - name: proxy
+    image: nginx
+    network: host
+    ports: ["80"]
+    capabilities: [net_admin]
+`,
+			out: report.Report{Entries: []report.Entry{
+				{
+					Kind:    report.EntryError,
+					Message: types.ErrPortsWithoutNetwork.Error(),
+					Line:    5,
+					Column:  12,
+				},
+				{
+					Kind:    report.EntryError,
+					Message: types.ErrInvalidCapability.Error(),
+					Line:    6,
+					Column:  19,
+				},
+			}},
+		},
+	}
+	for i, test := range tests {
+		_, _, r := Parse([]byte(test.in))
+		assert.Equal(t, test.out, r, "#%d: bad report", i)
+	}
+
+	cfg, ast, r = Parse([]byte(`systemd:
+  units:
+    - name: container-web.service
+containers:
+  - name: web
+    image: nginx
+    depends_on: [cache]
+  - name: web
+    image: nginx
+`))
+	assert.Equal(t, report.Report{}, r)
+	_, r = Convert(cfg, types.ConvertOptions{}, ast)
+	assert.Equal(t, report.Report{Entries: []report.Entry{
+		{
+			Kind:    report.EntryError,
+			Message: "container web is listed more than once",
+			Line:    8,
+			Column:  11,
+		},
+		{
+			Kind:    report.EntryError,
+			Message: "container cache is not in containers, units must be named with their type like cache.service",
+			Line:    7,
+			Column:  17,
+		},
+	}}, r)
+
+	cfg, ast, r = Parse([]byte(`systemd:
+  units:
+    - name: container-web.service
+containers:
+  - name: web
+    image: nginx
+`))
+	assert.Equal(t, report.Report{}, r)
+	_, r = Convert(cfg, types.ConvertOptions{}, ast)
+	assert.Equal(t, report.Report{Entries: []report.Entry{{
+		Kind:    report.EntryError,
+		Message: "systemd unit container-web.service is generated for container web but also listed in units",
+		Line:    5,
+		Column:  11,
+	}}}, r)
+}
@@ -0,0 +1,418 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package decompile converts Ignition configs back into equivalent Container
+// Linux Configs.
+package decompile
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/coreos/go-semver/semver"
+	ignTypes "github.com/coreos/ignition/config/v2_3/types"
+	"github.com/coreos/ignition/config/validate/report"
+	"github.com/vincent-petithory/dataurl"
+
+	"github.com/coreos/container-linux-config-transpiler/config/types"
+)
+
+const (
+	sectorsPerMiB = types.MEGABYTE / 512
+)
+
+var (
+	ErrUnsupportedVersion = errors.New("unsupported Ignition config version, only 2.x configs can be decompiled")
+)
+
+// decompiler converts a single section of an Ignition config. Sections that
+// ct generates from high level Container Linux Config sections are consumed
+// from in, so that later decompilers don't convert them a second time.
+type decompiler func(in *ignTypes.Config, out *types.Config) report.Report
+
+// decompilers run in order. The ones recognizing generated units and files
+// must come before the ones converting units and files verbatim.
+var decompilers = []decompiler{
+	decompileIgnition,
+	decompileProviderOverride,
+	decompileEtcd,
+	decompileFlannel,
+	decompileDocker,
+	decompileUpdate,
+	decompileStorage,
+	decompileSystemd,
+	decompileNetworkd,
+	decompilePasswd,
+}
+
+// Decompile converts an Ignition config into a Container Linux Config that
+// transpiles back into an equivalent Ignition config, and a report of any
+// warnings or errors.
+func Decompile(in ignTypes.Config) (types.Config, report.Report) {
+	v, err := semver.NewVersion(in.Ignition.Version)
+	if err != nil || v.Major != 2 || v.Minor > 3 {
+		return types.Config{}, report.ReportFromError(ErrUnsupportedVersion, report.EntryError)
+	}
+
+	out := types.Config{}
+	r := report.Report{}
+	for _, decompile := range decompilers {
+		r.Merge(decompile(&in, &out))
+	}
+	if r.IsFatal() {
+		return types.Config{}, r
+	}
+	return out, r
+}
+
+func decompileIgnition(in *ignTypes.Config, out *types.Config) report.Report {
+	for _, ref := range in.Ignition.Config.Append {
+		out.Ignition.Config.Append = append(out.Ignition.Config.Append, types.ConfigReference{
+			Source:       ref.Source,
+			Verification: decompileVerification(ref.Verification),
+		})
+	}
+	if ref := in.Ignition.Config.Replace; ref != nil {
+		out.Ignition.Config.Replace = &types.ConfigReference{
+			Source:       ref.Source,
+			Verification: decompileVerification(ref.Verification),
+		}
+	}
+	out.Ignition.Timeouts.HTTPResponseHeaders = in.Ignition.Timeouts.HTTPResponseHeaders
+	out.Ignition.Timeouts.HTTPTotal = in.Ignition.Timeouts.HTTPTotal
+	for _, ca := range in.Ignition.Security.TLS.CertificateAuthorities {
+		out.Ignition.Security.TLS.CertificateAuthorities = append(out.Ignition.Security.TLS.CertificateAuthorities, types.CaReference{
+			Source:       ca.Source,
+			Verification: decompileVerification(ca.Verification),
+		})
+	}
+	return report.Report{}
+}
+
+func decompileVerification(in ignTypes.Verification) types.Verification {
+	if in.Hash == nil {
+		return types.Verification{}
+	}
+	parts := strings.SplitN(*in.Hash, "-", 2)
+	if len(parts) != 2 {
+		return types.Verification{}
+	}
+	return types.Verification{
+		Hash: types.Hash{
+			Function: parts[0],
+			Sum:      parts[1],
+		},
+	}
+}
+
+func decompileStorage(in *ignTypes.Config, out *types.Config) report.Report {
+	r := report.Report{}
+	for i, disk := range in.Storage.Disks {
+		newDisk := types.Disk{
+			Device:    disk.Device,
+			WipeTable: disk.WipeTable,
+		}
+		for j, partition := range disk.Partitions {
+			size, err := decompilePartitionDimension(partition.SizeMiB, partition.Size)
+			if err != nil {
+				r.Add(report.Entry{
+					Kind:    report.EntryError,
+					Message: fmt.Sprintf("storage.disks[%d].partitions[%d].size: %v", i, j, err),
+				})
+				continue
+			}
+			start, err := decompilePartitionDimension(partition.StartMiB, partition.Start)
+			if err != nil {
+				r.Add(report.Entry{
+					Kind:    report.EntryError,
+					Message: fmt.Sprintf("storage.disks[%d].partitions[%d].start: %v", i, j, err),
+				})
+				continue
+			}
+			path := fmt.Sprintf("storage.disks[%d].partitions[%d]", i, j)
+			if partition.ShouldExist != nil {
+				r.Add(unsupported(path + ".shouldExist"))
+			}
+			if partition.WipePartitionEntry {
+				r.Add(unsupported(path + ".wipePartitionEntry"))
+			}
+			newDisk.Partitions = append(newDisk.Partitions, types.Partition{
+				Label:    partition.Label,
+				Number:   partition.Number,
+				Size:     size,
+				Start:    start,
+				GUID:     partition.GUID,
+				TypeGUID: partition.TypeGUID,
+			})
+		}
+		out.Storage.Disks = append(out.Storage.Disks, newDisk)
+	}
+
+	for _, array := range in.Storage.Raid {
+		newArray := types.Raid{
+			Name:   array.Name,
+			Level:  array.Level,
+			Spares: array.Spares,
+		}
+		for _, device := range array.Devices {
+			newArray.Devices = append(newArray.Devices, string(device))
+		}
+		for _, option := range array.Options {
+			newArray.Options = append(newArray.Options, string(option))
+		}
+		out.Storage.Arrays = append(out.Storage.Arrays, newArray)
+	}
+
+	for _, filesystem := range in.Storage.Filesystems {
+		newFilesystem := types.Filesystem{
+			Name: filesystem.Name,
+			Path: filesystem.Path,
+		}
+		if mount := filesystem.Mount; mount != nil {
+			newFilesystem.Mount = &types.Mount{
+				Device:         mount.Device,
+				Format:         mount.Format,
+				WipeFilesystem: mount.WipeFilesystem,
+				Label:          mount.Label,
+				UUID:           mount.UUID,
+			}
+			for _, option := range mount.Options {
+				newFilesystem.Mount.Options = append(newFilesystem.Mount.Options, string(option))
+			}
+			if mount.Create != nil {
+				newFilesystem.Mount.Create = &types.Create{
+					Force: mount.Create.Force,
+				}
+				for _, option := range mount.Create.Options {
+					newFilesystem.Mount.Create.Options = append(newFilesystem.Mount.Create.Options, string(option))
+				}
+			}
+		}
+		out.Storage.Filesystems = append(out.Storage.Filesystems, newFilesystem)
+	}
+
+	for _, file := range in.Storage.Files {
+		out.Storage.Files = append(out.Storage.Files, types.File{
+			Filesystem: file.Filesystem,
+			Path:       file.Path,
+			User:       decompileFileUser(file.User),
+			Group:      decompileFileGroup(file.Group),
+			Mode:       file.Mode,
+			Contents:   decompileFileContents(file.Contents),
+			Overwrite:  file.Overwrite,
+			Append:     file.Append,
+		})
+	}
+
+	for _, dir := range in.Storage.Directories {
+		out.Storage.Directories = append(out.Storage.Directories, types.Directory{
+			Filesystem: dir.Filesystem,
+			Path:       dir.Path,
+			User:       decompileFileUser(dir.User),
+			Group:      decompileFileGroup(dir.Group),
+			Mode:       dir.Mode,
+			Overwrite:  dir.Overwrite,
+		})
+	}
+
+	for _, link := range in.Storage.Links {
+		out.Storage.Links = append(out.Storage.Links, types.Link{
+			Filesystem: link.Filesystem,
+			Path:       link.Path,
+			User:       decompileFileUser(link.User),
+			Group:      decompileFileGroup(link.Group),
+			Hard:       link.Hard,
+			Target:     link.Target,
+			Overwrite:  link.Overwrite,
+		})
+	}
+	return r
+}
+
+// unsupported returns a warning about the field of the Ignition config at
+// path, which Container Linux Configs can't express and is left out.
+func unsupported(path string) report.Entry {
+	return report.Entry{
+		Kind:    report.EntryWarning,
+		Message: fmt.Sprintf("%s: not supported by Container Linux Configs, left out", path),
+	}
+}
+
+// decompilePartitionDimension converts a partition size or start, given either
+// in MiB or in 512 byte sectors, into a Container Linux Config dimension.
+func decompilePartitionDimension(miB, sectors *int) (string, error) {
+	if miB != nil {
+		return fmt.Sprintf("%dMiB", *miB), nil
+	}
+	if sectors != nil {
+		if *sectors%sectorsPerMiB != 0 {
+			return "", fmt.Errorf("%d sectors is not a multiple of 1MiB", *sectors)
+		}
+		return fmt.Sprintf("%dMiB", *sectors/sectorsPerMiB), nil
+	}
+	return "", nil
+}
+
+func decompileFileUser(in *ignTypes.NodeUser) *types.FileUser {
+	if in == nil {
+		return nil
+	}
+	return &types.FileUser{
+		Id:   in.ID,
+		Name: in.Name,
+	}
+}
+
+func decompileFileGroup(in *ignTypes.NodeGroup) *types.FileGroup {
+	if in == nil {
+		return nil
+	}
+	return &types.FileGroup{
+		Id:   in.ID,
+		Name: in.Name,
+	}
+}
+
+// decompileFileContents turns data URLs holding uncompressed text back into
+// inline contents. Everything else is kept as a remote source.
+func decompileFileContents(in ignTypes.FileContents) types.FileContents {
+	if in.Compression == "" && in.Verification.Hash == nil {
+		if contents, ok := decodeDataURL(in.Source); ok {
+			return types.FileContents{Inline: contents}
+		}
+	}
+	if in.Source == "data:," {
+		// ct generates this for files without any contents
+		in.Source = ""
+	}
+	return types.FileContents{
+		Remote: types.Remote{
+			Url:          in.Source,
+			Compression:  in.Compression,
+			Verification: decompileVerification(in.Verification),
+		},
+	}
+}
+
+// decodeDataURL returns the contents of a data URL, provided they are text
+// which can be written inline.
+func decodeDataURL(source string) (string, bool) {
+	if !strings.HasPrefix(source, "data:") {
+		return "", false
+	}
+	url, err := dataurl.DecodeString(source)
+	if err != nil || len(url.Data) == 0 || !utf8.Valid(url.Data) {
+		return "", false
+	}
+	return string(url.Data), true
+}
+
+func decompileSystemd(in *ignTypes.Config, out *types.Config) report.Report {
+	for _, unit := range in.Systemd.Units {
+		newUnit := types.SystemdUnit{
+			Name:     unit.Name,
+			Enable:   unit.Enable,
+			Enabled:  unit.Enabled,
+			Mask:     unit.Mask,
+			Contents: unit.Contents,
+		}
+		for _, dropin := range unit.Dropins {
+			newUnit.Dropins = append(newUnit.Dropins, types.SystemdUnitDropIn{
+				Name:     dropin.Name,
+				Contents: dropin.Contents,
+			})
+		}
+		out.Systemd.Units = append(out.Systemd.Units, newUnit)
+	}
+	return report.Report{}
+}
+
+func decompileNetworkd(in *ignTypes.Config, out *types.Config) report.Report {
+	for _, unit := range in.Networkd.Units {
+		newUnit := types.NetworkdUnit{
+			Name:     unit.Name,
+			Contents: unit.Contents,
+		}
+		for _, dropin := range unit.Dropins {
+			newUnit.Dropins = append(newUnit.Dropins, types.NetworkdUnitDropIn{
+				Name:     dropin.Name,
+				Contents: dropin.Contents,
+			})
+		}
+		out.Networkd.Units = append(out.Networkd.Units, newUnit)
+	}
+	return report.Report{}
+}
+
+func decompilePasswd(in *ignTypes.Config, out *types.Config) report.Report {
+	for _, user := range in.Passwd.Users {
+		newUser := types.User{
+			Name:         user.Name,
+			PasswordHash: user.PasswordHash,
+			UID:          user.UID,
+			Gecos:        user.Gecos,
+			HomeDir:      user.HomeDir,
+			NoCreateHome: user.NoCreateHome,
+			PrimaryGroup: user.PrimaryGroup,
+			NoUserGroup:  user.NoUserGroup,
+			System:       user.System,
+			NoLogInit:    user.NoLogInit,
+			Shell:        user.Shell,
+		}
+		for _, key := range user.SSHAuthorizedKeys {
+			newUser.SSHAuthorizedKeys = append(newUser.SSHAuthorizedKeys, string(key))
+		}
+		for _, group := range user.Groups {
+			newUser.Groups = append(newUser.Groups, string(group))
+		}
+		if create := user.Create; create != nil {
+			newUser.Create = &types.UserCreate{
+				Uid:          intPointerToUintPointer(create.UID),
+				GECOS:        create.Gecos,
+				Homedir:      create.HomeDir,
+				NoCreateHome: create.NoCreateHome,
+				PrimaryGroup: create.PrimaryGroup,
+				NoUserGroup:  create.NoUserGroup,
+				System:       create.System,
+				NoLogInit:    create.NoLogInit,
+				Shell:        create.Shell,
+			}
+			for _, group := range create.Groups {
+				newUser.Create.Groups = append(newUser.Create.Groups, string(group))
+			}
+		}
+		out.Passwd.Users = append(out.Passwd.Users, newUser)
+	}
+
+	for _, group := range in.Passwd.Groups {
+		out.Passwd.Groups = append(out.Passwd.Groups, types.Group{
+			Name:         group.Name,
+			Gid:          intPointerToUintPointer(group.Gid),
+			PasswordHash: group.PasswordHash,
+			System:       group.System,
+		})
+	}
+	return report.Report{}
+}
+
+// golang--
+func intPointerToUintPointer(i *int) *uint {
+	if i == nil {
+		return nil
+	}
+	x := uint(*i)
+	return &x
+}
@@ -0,0 +1,167 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package decompile
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+
+	yaml "github.com/ajeddeloh/yaml"
+
+	"github.com/coreos/container-linux-config-transpiler/config/format"
+	"github.com/coreos/container-linux-config-transpiler/config/types"
+)
+
+// Marshal serializes a Container Linux Config into YAML. Unlike yaml.Marshal,
+// it leaves out every unset field and keeps the field order of the types, so
+// the result reads like a handwritten config. It is laid out like ct format
+// lays out configs, with modes in octal.
+func Marshal(cfg types.Config) ([]byte, error) {
+	v, ok := toYaml(reflect.ValueOf(cfg))
+	if !ok {
+		return []byte{}, nil
+	}
+	out, err := yaml.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	// yaml.Marshal can only emit modes in decimal, format rewrites the values
+	// of mode keys found in the parsed document, leaving file contents alone
+	return format.Format(out)
+}
+
+// toYaml converts v into something yaml.Marshal emits as the equivalent YAML
+// with all unset fields omitted. It returns false if v is unset.
+func toYaml(v reflect.Value) (interface{}, bool) {
+	switch t := v.Interface().(type) {
+	case types.EtcdVersion:
+		return t.String(), true
+	case types.FlannelVersion:
+		return t.String(), true
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil, false
+		}
+		// pointers are set even if they point to a zero value
+		elem, ok := toYaml(v.Elem())
+		if !ok && v.Elem().Kind() == reflect.Struct {
+			return yaml.MapSlice{}, true
+		}
+		if !ok {
+			return scalarToYaml(v.Elem()), true
+		}
+		return elem, true
+	case reflect.Struct:
+		m := structToYaml(v)
+		return m, len(m) > 0
+	case reflect.Slice:
+		if v.Len() == 0 {
+			return nil, false
+		}
+		s := []interface{}{}
+		for i := 0; i < v.Len(); i++ {
+			elem, ok := toYaml(v.Index(i))
+			if !ok {
+				elem = zeroYaml(v.Index(i))
+			}
+			s = append(s, elem)
+		}
+		return s, true
+	case reflect.Map:
+		if v.Len() == 0 {
+			return nil, false
+		}
+		var keys []string
+		for _, key := range v.MapKeys() {
+			keys = append(keys, key.String())
+		}
+		sort.Strings(keys)
+		m := yaml.MapSlice{}
+		for _, key := range keys {
+			elem, ok := toYaml(v.MapIndex(reflect.ValueOf(key)))
+			if !ok {
+				elem = zeroYaml(v.MapIndex(reflect.ValueOf(key)))
+			}
+			m = append(m, yaml.MapItem{Key: key, Value: elem})
+		}
+		return m, true
+	default:
+		zero := reflect.Zero(v.Type()).Interface()
+		if v.Interface() == zero {
+			return nil, false
+		}
+		return scalarToYaml(v), true
+	}
+}
+
+// structToYaml converts the set fields of a struct into a mapping. Embedded
+// fields, like the version specific etcd and flannel options, are flattened
+// into the mapping.
+func structToYaml(v reflect.Value) yaml.MapSlice {
+	m := yaml.MapSlice{}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous {
+			elem := v.Field(i)
+			if elem.Kind() == reflect.Interface {
+				if elem.IsNil() {
+					continue
+				}
+				elem = elem.Elem()
+			}
+			if elem.Kind() == reflect.Struct {
+				m = append(m, structToYaml(elem)...)
+			}
+			continue
+		}
+		key := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if key == "" || key == "-" {
+			continue
+		}
+		if val, ok := toYaml(v.Field(i)); ok {
+			m = append(m, yaml.MapItem{Key: key, Value: val})
+		}
+	}
+	return m
+}
+
+// zeroYaml returns the representation of an unset list element.
+func zeroYaml(v reflect.Value) interface{} {
+	if v.Kind() == reflect.Struct {
+		return yaml.MapSlice{}
+	}
+	return scalarToYaml(v)
+}
+
+// scalarToYaml converts named scalar types into their underlying type, so
+// yaml.Marshal treats them like any other scalar.
+func scalarToYaml(v reflect.Value) interface{} {
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Bool:
+		return v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint()
+	}
+	return v.Interface()
+}
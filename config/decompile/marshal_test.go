@@ -0,0 +1,139 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package decompile
+
+import (
+	"testing"
+
+	ignTypes "github.com/coreos/ignition/config/v2_3/types"
+	"github.com/coreos/ignition/config/validate/report"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/coreos/container-linux-config-transpiler/config/types"
+	"github.com/coreos/container-linux-config-transpiler/internal/util"
+)
+
+func TestMarshal(t *testing.T) {
+	tests := []struct {
+		in  types.Config
+		out string
+	}{
+		{
+			in:  types.Config{},
+			out: "",
+		},
+		{
+			// modes are octal, unset fields are left out
+			in: types.Config{
+				Storage: types.Storage{
+					Files: []types.File{{
+						Filesystem: "root",
+						Path:       "/etc/motd",
+						Mode:       util.IntToPtr(0644),
+						Contents:   types.FileContents{Inline: "hello\n"},
+					}},
+					Directories: []types.Directory{{
+						Filesystem: "root",
+						Path:       "/opt/bin",
+						Mode:       util.IntToPtr(0755),
+					}},
+				},
+			},
+			out: `storage:
+  files:
+    - filesystem: root
+      path: /etc/motd
+      mode: 0644
+      contents:
+        inline: |
+          hello
+  directories:
+    - filesystem: root
+      path: /opt/bin
+      mode: 0755
+`,
+		},
+		{
+			// contents that look like modes are left alone
+			in: types.Config{
+				Storage: types.Storage{
+					Files: []types.File{{
+						Filesystem: "root",
+						Path:       "/etc/app.yaml",
+						Mode:       util.IntToPtr(0600),
+						Contents:   types.FileContents{Inline: "files:\n- mode: 0644\nmode: 420\n"},
+					}},
+				},
+			},
+			out: `storage:
+  files:
+    - filesystem: root
+      path: /etc/app.yaml
+      mode: 0600
+      contents:
+        inline: |
+          files:
+          - mode: 0644
+          mode: 420
+`,
+		},
+		{
+			// pointers to zero values are kept
+			in: types.Config{
+				Systemd: types.Systemd{
+					Units: []types.SystemdUnit{{
+						Name:    "docker.service",
+						Enabled: util.BoolToPtr(false),
+					}},
+				},
+			},
+			out: `systemd:
+  units:
+    - name: docker.service
+      enabled: false
+`,
+		},
+	}
+
+	for i, test := range tests {
+		out, err := Marshal(test.in)
+		assert.Nil(t, err, "#%d: unexpected error", i)
+		assert.Equal(t, test.out, string(out), "#%d: bad output", i)
+	}
+}
+
+func TestDecompileUnsupportedVersion(t *testing.T) {
+	_, r := Decompile(ignTypes.Config{Ignition: ignTypes.Ignition{Version: "3.0.0"}})
+	assert.Equal(t, report.ReportFromError(ErrUnsupportedVersion, report.EntryError), r)
+}
+
+func TestDecompileDataURL(t *testing.T) {
+	in := ignTypes.Config{Ignition: ignTypes.Ignition{Version: "2.2.0"}}
+	in.Storage.Files = []ignTypes.File{{
+		Node: ignTypes.Node{Filesystem: "root", Path: "/etc/motd"},
+		FileEmbedded1: ignTypes.FileEmbedded1{
+			Mode:     util.IntToPtr(0644),
+			Contents: ignTypes.FileContents{Source: "data:,hello%20world%0A"},
+		},
+	}}
+	out, r := Decompile(in)
+	assert.Equal(t, report.Report{}, r)
+	assert.Equal(t, []types.File{{
+		Filesystem: "root",
+		Path:       "/etc/motd",
+		Mode:       util.IntToPtr(0644),
+		Contents:   types.FileContents{Inline: "hello world\n"},
+	}}, out.Storage.Files)
+}
@@ -0,0 +1,466 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package decompile
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/coreos/go-semver/semver"
+	"github.com/coreos/go-systemd/unit"
+	ignTypes "github.com/coreos/ignition/config/v2_3/types"
+	"github.com/coreos/ignition/config/validate/report"
+
+	"github.com/coreos/container-linux-config-transpiler/config/platform"
+	"github.com/coreos/container-linux-config-transpiler/config/templating"
+	"github.com/coreos/container-linux-config-transpiler/config/types"
+)
+
+var (
+	errUnrecognized = errors.New("not generated by ct")
+)
+
+// wrapperDropin is the parsed form of a drop-in generated by ct for one of
+// the wrapper scripts shipped with Container Linux (etcd and flannel).
+type wrapperDropin struct {
+	args     []string
+	vars     []string
+	pre      []string
+	platform string
+}
+
+// parseWrapperDropin parses the contents of a drop-in generated for the given
+// exec line. It returns errUnrecognized if the drop-in contains anything ct
+// would not have generated.
+func parseWrapperDropin(contents, exec string) (wrapperDropin, error) {
+	opts, err := unit.Deserialize(strings.NewReader(contents))
+	if err != nil {
+		return wrapperDropin{}, err
+	}
+
+	d := wrapperDropin{}
+	templated := 0
+	execStart := ""
+	for _, opt := range opts {
+		switch {
+		case opt.Section == "Unit" && (opt.Name == "Requires" || opt.Name == "After") && opt.Value == "coreos-metadata.service":
+			templated++
+		case opt.Section == "Service" && opt.Name == "EnvironmentFile" && opt.Value == "/run/metadata/coreos":
+			templated++
+		case opt.Section == "Service" && opt.Name == "Environment":
+			d.vars = append(d.vars, strings.Trim(opt.Value, `"`))
+		case opt.Section == "Service" && opt.Name == "ExecStart" && opt.Value == "":
+		case opt.Section == "Service" && opt.Name == "ExecStart" && execStart == "":
+			execStart = opt.Value
+		case opt.Section == "Service" && opt.Name == "ExecStartPre":
+			d.pre = append(d.pre, opt.Value)
+		default:
+			return wrapperDropin{}, errUnrecognized
+		}
+	}
+	if templated != 0 && templated != 3 {
+		return wrapperDropin{}, errUnrecognized
+	}
+
+	if !strings.HasPrefix(execStart, exec) {
+		return wrapperDropin{}, errUnrecognized
+	}
+	d.args, err = splitArgs(strings.TrimPrefix(execStart, exec))
+	if err != nil {
+		return wrapperDropin{}, err
+	}
+
+	if templated != 0 {
+		d.args, d.platform, err = templating.UndoTemplating(d.args)
+		if err != nil {
+			return wrapperDropin{}, err
+		}
+	} else if templating.HasTemplating(d.args) {
+		return wrapperDropin{}, errUnrecognized
+	}
+	return d, nil
+}
+
+// splitArgs splits a command line as generated by ct into its arguments.
+// Double quoted parts of an argument are unquoted and escaped newlines are
+// treated as whitespace.
+func splitArgs(s string) ([]string, error) {
+	var args []string
+	var arg []rune
+	inArg := false
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '\\' && i+1 < len(runes) && runes[i+1] == '\n':
+			i++
+			fallthrough
+		case unicode.IsSpace(r):
+			if inArg {
+				args = append(args, string(arg))
+				arg, inArg = nil, false
+			}
+		case r == '"':
+			end := i + 1
+			for ; end < len(runes) && runes[end] != '"'; end++ {
+				if runes[end] == '\\' {
+					end++
+				}
+			}
+			if end >= len(runes) {
+				return nil, errUnrecognized
+			}
+			unquoted, err := strconv.Unquote(string(runes[i : end+1]))
+			if err != nil {
+				return nil, errUnrecognized
+			}
+			arg = append(arg, []rune(unquoted)...)
+			inArg = true
+			i = end
+		default:
+			arg = append(arg, r)
+			inArg = true
+		}
+	}
+	if inArg {
+		args = append(args, string(arg))
+	}
+	return args, nil
+}
+
+// setFields sets the fields of the struct pointed to by out from a list of
+// KEY=VALUE pairs, where KEY is given by the tagName tag of each field. The
+// prefix is stripped from every pair first.
+func setFields(out interface{}, pairs []string, prefix, tagName string) error {
+	v := reflect.ValueOf(out).Elem()
+	t := v.Type()
+	for _, pair := range pairs {
+		if !strings.HasPrefix(pair, prefix) {
+			return errUnrecognized
+		}
+		kv := strings.SplitN(strings.TrimPrefix(pair, prefix), "=", 2)
+		if len(kv) != 2 {
+			return errUnrecognized
+		}
+
+		found := false
+		for i := 0; i < t.NumField(); i++ {
+			if t.Field(i).Tag.Get(tagName) != kv[0] {
+				continue
+			}
+			found = true
+			field := v.Field(i)
+			val := reflect.New(field.Type().Elem())
+			switch val.Elem().Kind() {
+			case reflect.String:
+				val.Elem().SetString(kv[1])
+			case reflect.Int:
+				n, err := strconv.Atoi(kv[1])
+				if err != nil {
+					return errUnrecognized
+				}
+				val.Elem().SetInt(int64(n))
+			case reflect.Bool:
+				b, err := strconv.ParseBool(kv[1])
+				if err != nil {
+					return errUnrecognized
+				}
+				val.Elem().SetBool(b)
+			default:
+				return errUnrecognized
+			}
+			field.Set(val)
+		}
+		if !found {
+			return errUnrecognized
+		}
+	}
+	return nil
+}
+
+// generatedDropin returns the contents of the given drop-in if it is the only
+// thing in the unit, as is the case for units generated by ct.
+func generatedDropin(u ignTypes.Unit, dropinName string) (string, bool) {
+	if u.Contents != "" || !u.Enable || u.Enabled != nil || u.Mask || len(u.Dropins) != 1 || u.Dropins[0].Name != dropinName {
+		return "", false
+	}
+	return u.Dropins[0].Contents, true
+}
+
+// consumeUnit removes the unit at index i from the config.
+func consumeUnit(in *ignTypes.Config, i int) {
+	in.Systemd.Units = append(in.Systemd.Units[:i], in.Systemd.Units[i+1:]...)
+}
+
+// imageTag extracts the version from the <name>_IMAGE_TAG environment
+// variable, if present.
+func imageTag(vars []string, name string) (*semver.Version, error) {
+	for _, v := range vars {
+		if tag := strings.TrimPrefix(v, name+"_IMAGE_TAG=v"); tag != v {
+			return semver.NewVersion(tag)
+		}
+	}
+	return nil, nil
+}
+
+func dynamicDataReport(p string) report.Report {
+	if p == "" {
+		return report.Report{}
+	}
+	return report.Report{
+		Entries: []report.Entry{{
+			Kind:    report.EntryInfo,
+			Message: fmt.Sprintf("the config uses dynamic data, transpile it with --platform=%s", p),
+		}},
+	}
+}
+
+func decompileEtcd(in *ignTypes.Config, out *types.Config) report.Report {
+	for i, u := range in.Systemd.Units {
+		if u.Name != "etcd-member.service" {
+			continue
+		}
+		contents, ok := generatedDropin(u, "20-clct-etcd-member.conf")
+		if !ok {
+			continue
+		}
+		etcd, p, err := parseEtcd(contents)
+		if err != nil {
+			continue
+		}
+		out.Etcd = &etcd
+		consumeUnit(in, i)
+		return dynamicDataReport(p)
+	}
+	return report.Report{}
+}
+
+func parseEtcd(contents string) (types.Etcd, string, error) {
+	d, err := parseWrapperDropin(contents, "/usr/lib/coreos/etcd-wrapper $ETCD_OPTS")
+	if err != nil || len(d.pre) != 0 {
+		return types.Etcd{}, "", errUnrecognized
+	}
+	version, err := imageTag(d.vars, "ETCD")
+	if err != nil || len(d.vars) > 1 {
+		return types.Etcd{}, "", errUnrecognized
+	}
+
+	etcd := types.Etcd{}
+	v := types.EtcdDefaultVersion
+	if version != nil {
+		v = *version
+		etcdVersion := types.EtcdVersion(v)
+		etcd.Version = &etcdVersion
+	}
+	options := types.EtcdOptions(v)
+	if options == nil {
+		return types.Etcd{}, "", errUnrecognized
+	}
+	o := reflect.New(reflect.TypeOf(options))
+	if err := setFields(o.Interface(), d.args, "--", "cli"); err != nil {
+		return types.Etcd{}, "", err
+	}
+	etcd.Options = o.Elem().Interface()
+	return etcd, d.platform, nil
+}
+
+func decompileFlannel(in *ignTypes.Config, out *types.Config) report.Report {
+	for i, u := range in.Systemd.Units {
+		if u.Name != "flanneld.service" {
+			continue
+		}
+		contents, ok := generatedDropin(u, "20-clct-flannel.conf")
+		if !ok {
+			continue
+		}
+		flannel, p, err := parseFlannel(contents)
+		if err != nil {
+			continue
+		}
+		out.Flannel = &flannel
+		consumeUnit(in, i)
+		return dynamicDataReport(p)
+	}
+	return report.Report{}
+}
+
+func parseFlannel(contents string) (types.Flannel, string, error) {
+	d, err := parseWrapperDropin(contents, "/usr/lib/coreos/flannel-wrapper $FLANNEL_OPTS")
+	if err != nil || len(d.pre) > 1 {
+		return types.Flannel{}, "", errUnrecognized
+	}
+	version, err := imageTag(d.vars, "FLANNEL")
+	if err != nil || len(d.vars) > 1 {
+		return types.Flannel{}, "", errUnrecognized
+	}
+
+	flannel := types.Flannel{}
+	v := types.FlannelDefaultVersion
+	if version != nil {
+		v = *version
+		flannelVersion := types.FlannelVersion(v)
+		flannel.Version = &flannelVersion
+	}
+	options := types.FlannelOptions(v)
+	if options == nil {
+		return types.Flannel{}, "", errUnrecognized
+	}
+	o := reflect.New(reflect.TypeOf(options))
+	if err := setFields(o.Interface(), d.args, "--", "cli"); err != nil {
+		return types.Flannel{}, "", err
+	}
+	flannel.Options = o.Elem().Interface()
+
+	if len(d.pre) == 1 {
+		// The network config is set with etcdctl, using the same etcd
+		// endpoints and certificates as flannel itself, which were just
+		// parsed from the flannel arguments.
+		args, err := splitArgs(d.pre[0])
+		if err != nil || len(args) < 4 || args[0] != "/usr/bin/etcdctl" {
+			return types.Flannel{}, "", errUnrecognized
+		}
+		if args[len(args)-3] != "set" || args[len(args)-2] != "/coreos.com/network/config" {
+			return types.Flannel{}, "", errUnrecognized
+		}
+		flannel.NetworkConfig = types.NetworkConfig(args[len(args)-1])
+	}
+	return flannel, d.platform, nil
+}
+
+func decompileDocker(in *ignTypes.Config, out *types.Config) report.Report {
+	for i, u := range in.Systemd.Units {
+		if u.Name != "docker.service" {
+			continue
+		}
+		contents, ok := generatedDropin(u, "20-clct-docker.conf")
+		if !ok {
+			continue
+		}
+		flags := strings.TrimPrefix(contents, "[Service]\nEnvironment=\"DOCKER_OPTS=")
+		if flags == contents || !strings.HasSuffix(flags, "\"") {
+			continue
+		}
+		out.Docker = &types.Docker{
+			Flags: strings.Fields(strings.TrimSuffix(flags, "\"")),
+		}
+		consumeUnit(in, i)
+		return report.Report{}
+	}
+	return report.Report{}
+}
+
+// decompileProviderOverride removes the units generated for platforms whose
+// metadata provider has to be passed to coreos-metadata explicitly.
+func decompileProviderOverride(in *ignTypes.Config, out *types.Config) report.Report {
+	for _, p := range []string{platform.OpenStackMetadata, platform.CloudStackConfigDrive} {
+		dropin := ignTypes.SystemdDropin{
+			Name:     "20-clct-provider-override.conf",
+			Contents: fmt.Sprintf("[Service]\nEnvironment=COREOS_METADATA_OPT_PROVIDER=--provider=%s", p),
+		}
+		metadata, sshkeys := -1, -1
+		for i, u := range in.Systemd.Units {
+			if len(u.Dropins) != 1 || u.Dropins[0] != dropin || u.Contents != "" || u.Enable || u.Mask {
+				continue
+			}
+			if u.Name == "coreos-metadata.service" && u.Enabled == nil {
+				metadata = i
+			} else if u.Name == "coreos-metadata-sshkeys@.service" && u.Enabled != nil && *u.Enabled {
+				sshkeys = i
+			}
+		}
+		if metadata == -1 || sshkeys == -1 {
+			continue
+		}
+		if metadata > sshkeys {
+			metadata, sshkeys = sshkeys, metadata
+		}
+		consumeUnit(in, sshkeys)
+		consumeUnit(in, metadata)
+		return dynamicDataReport(p)
+	}
+	return report.Report{}
+}
+
+func decompileUpdate(in *ignTypes.Config, out *types.Config) report.Report {
+	for i, f := range in.Storage.Files {
+		if f.Path != "/etc/coreos/update.conf" || f.Filesystem != "root" {
+			continue
+		}
+		if f.Mode == nil || *f.Mode != 0644 || f.User != nil || f.Group != nil || f.Overwrite != nil || f.Append {
+			continue
+		}
+		if f.Contents.Compression != "" || f.Contents.Verification.Hash != nil {
+			continue
+		}
+		contents, ok := decodeDataURL(f.Contents.Source)
+		if !ok {
+			continue
+		}
+		update, locksmith, err := parseUpdateConf(contents)
+		if err != nil {
+			continue
+		}
+		out.Update = update
+		out.Locksmith = locksmith
+		in.Storage.Files = append(in.Storage.Files[:i], in.Storage.Files[i+1:]...)
+		return report.Report{}
+	}
+	return report.Report{}
+}
+
+func parseUpdateConf(contents string) (*types.Update, *types.Locksmith, error) {
+	var update *types.Update
+	var locksmithLines []string
+	for _, line := range strings.Split(contents, "\n") {
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "GROUP="):
+			if update == nil {
+				update = &types.Update{}
+			}
+			update.Group = types.UpdateGroup(strings.TrimPrefix(line, "GROUP="))
+		case strings.HasPrefix(line, "SERVER="):
+			if update == nil {
+				update = &types.Update{}
+			}
+			update.Server = types.UpdateServer(strings.TrimPrefix(line, "SERVER="))
+		default:
+			locksmithLines = append(locksmithLines, line)
+		}
+	}
+
+	var locksmith *types.Locksmith
+	if len(locksmithLines) > 0 {
+		// string values are quoted by ct, so use the same splitting as for
+		// command line arguments to unquote them
+		var pairs []string
+		for _, line := range locksmithLines {
+			args, err := splitArgs(line)
+			if err != nil || len(args) != 1 {
+				return nil, nil, errUnrecognized
+			}
+			pairs = append(pairs, args[0])
+		}
+		locksmith = &types.Locksmith{}
+		if err := setFields(locksmith, pairs, "", "locksmith"); err != nil {
+			return nil, nil, err
+		}
+	}
+	return update, locksmith, nil
+}
@@ -0,0 +1,305 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package diff compares Ignition configs resource by resource, so changes
+// read like "file /etc/hosts: mode changed from 0644 to 0600" rather than
+// like a diff of the JSON.
+package diff
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode/utf8"
+
+	ignTypes "github.com/coreos/ignition/config/v2_3/types"
+	"github.com/vincent-petithory/dataurl"
+)
+
+// Change is a single difference between two configs.
+type Change struct {
+	// Resource identifies the changed resource, e.g. "unit docker.service".
+	Resource string
+	// Message describes the change, e.g. "mode changed from 0644 to 0600".
+	Message string
+	// Diff is a unified diff of changed text contents, if there is one.
+	Diff string
+}
+
+func (c Change) String() string {
+	s := fmt.Sprintf("%s: %s", c.Resource, c.Message)
+	if c.Diff != "" {
+		s += "\n" + indent(c.Diff)
+	}
+	return s
+}
+
+// resourceList describes how to find the resources of one kind in a config.
+type resourceList struct {
+	kind string
+	list func(ignTypes.Config) interface{}
+	id   func(int, reflect.Value) string
+}
+
+var resourceLists = []resourceList{
+	{"disk", func(c ignTypes.Config) interface{} { return c.Storage.Disks }, field("Device")},
+	{"raid", func(c ignTypes.Config) interface{} { return c.Storage.Raid }, field("Name")},
+	{"filesystem", func(c ignTypes.Config) interface{} { return c.Storage.Filesystems }, field("Name")},
+	{"file", func(c ignTypes.Config) interface{} { return c.Storage.Files }, nodePath},
+	{"directory", func(c ignTypes.Config) interface{} { return c.Storage.Directories }, nodePath},
+	{"link", func(c ignTypes.Config) interface{} { return c.Storage.Links }, nodePath},
+	{"unit", func(c ignTypes.Config) interface{} { return c.Systemd.Units }, field("Name")},
+	{"networkd unit", func(c ignTypes.Config) interface{} { return c.Networkd.Units }, field("Name")},
+	{"user", func(c ignTypes.Config) interface{} { return c.Passwd.Users }, field("Name")},
+	{"group", func(c ignTypes.Config) interface{} { return c.Passwd.Groups }, field("Name")},
+}
+
+// Configs returns the changes needed to get from old to new. Resources are
+// matched by their identity, like the path of a file or the name of a unit,
+// rather than by their position.
+func Configs(old, new ignTypes.Config) []Change {
+	changes := diffValues("ignition", "", reflect.ValueOf(old.Ignition), reflect.ValueOf(new.Ignition))
+	for _, l := range resourceLists {
+		changes = append(changes, diffList(l, reflect.ValueOf(l.list(old)), reflect.ValueOf(l.list(new)))...)
+	}
+	return changes
+}
+
+// match is a pair of resources with the same id. old or new is invalid if
+// the resource was added or removed.
+type match struct {
+	id       string
+	old, new reflect.Value
+}
+
+// matchLists matches up the elements of two lists by their ids. Elements
+// sharing an id, like the unit ct generates for the docker section and a unit
+// of the same name in the config, are matched up in the order they appear.
+// Removed and changed elements come first in the old order, followed by the
+// added elements in the new order.
+func matchLists(old, new reflect.Value, id func(int, reflect.Value) string) []match {
+	newByID := map[string][]reflect.Value{}
+	for i := 0; i < new.Len(); i++ {
+		newID := id(i, new.Index(i))
+		newByID[newID] = append(newByID[newID], new.Index(i))
+	}
+	oldCount := map[string]int{}
+
+	var matches []match
+	for i := 0; i < old.Len(); i++ {
+		m := match{id: id(i, old.Index(i)), old: old.Index(i)}
+		if n := oldCount[m.id]; n < len(newByID[m.id]) {
+			m.new = newByID[m.id][n]
+		}
+		oldCount[m.id]++
+		matches = append(matches, m)
+	}
+	seen := map[string]int{}
+	for i := 0; i < new.Len(); i++ {
+		m := match{id: id(i, new.Index(i)), new: new.Index(i)}
+		if seen[m.id] >= oldCount[m.id] {
+			matches = append(matches, m)
+		}
+		seen[m.id]++
+	}
+	return matches
+}
+
+// diffList diffs the resources of one kind.
+func diffList(l resourceList, old, new reflect.Value) []Change {
+	var changes []Change
+	for _, m := range matchLists(old, new, l.id) {
+		resource := l.kind + " " + m.id
+		switch {
+		case !m.new.IsValid():
+			changes = append(changes, Change{Resource: resource, Message: "removed"})
+		case !m.old.IsValid():
+			changes = append(changes, Change{Resource: resource, Message: "added"})
+		default:
+			changes = append(changes, diffValues(resource, "", m.old, m.new)...)
+		}
+	}
+	return changes
+}
+
+// diffValues compares the fields of a resource. path is the json path of the
+// values within the resource.
+func diffValues(resource, path string, old, new reflect.Value) []Change {
+	switch old.Kind() {
+	case reflect.Ptr:
+		switch {
+		case old.IsNil() && new.IsNil():
+			return nil
+		case old.IsNil():
+			return []Change{{Resource: resource, Message: fmt.Sprintf("%s set to %s", path, format(path, new.Elem()))}}
+		case new.IsNil():
+			return []Change{{Resource: resource, Message: fmt.Sprintf("%s unset, was %s", path, format(path, old.Elem()))}}
+		}
+		return diffValues(resource, path, old.Elem(), new.Elem())
+	case reflect.Struct:
+		var changes []Change
+		t := old.Type()
+		for i := 0; i < t.NumField(); i++ {
+			fieldPath := path
+			if !t.Field(i).Anonymous {
+				fieldPath = join(path, strings.Split(t.Field(i).Tag.Get("json"), ",")[0])
+			}
+			changes = append(changes, diffValues(resource, fieldPath, old.Field(i), new.Field(i))...)
+		}
+		return changes
+	case reflect.Slice:
+		return diffSlices(resource, path, old, new)
+	case reflect.String:
+		return diffStrings(resource, path, old.String(), new.String())
+	}
+	if reflect.DeepEqual(old.Interface(), new.Interface()) {
+		return nil
+	}
+	return []Change{{Resource: resource, Message: fmt.Sprintf("%s changed from %s to %s", path, format(path, old), format(path, new))}}
+}
+
+// diffSlices compares lists within a resource. Lists of structs are matched
+// up by their name, label, number or source, lists of scalars are treated as
+// sets.
+func diffSlices(resource, path string, old, new reflect.Value) []Change {
+	if old.Type().Elem().Kind() != reflect.Struct {
+		var changes []Change
+		for _, v := range missing(old, new) {
+			changes = append(changes, Change{Resource: resource, Message: fmt.Sprintf("%s entry %s removed", path, format(path, v))})
+		}
+		for _, v := range missing(new, old) {
+			changes = append(changes, Change{Resource: resource, Message: fmt.Sprintf("%s entry %s added", path, format(path, v))})
+		}
+		return changes
+	}
+
+	var changes []Change
+	for _, m := range matchLists(old, new, elementID) {
+		elemPath := fmt.Sprintf("%s[%s]", path, m.id)
+		switch {
+		case !m.new.IsValid():
+			changes = append(changes, Change{Resource: resource, Message: elemPath + " removed"})
+		case !m.old.IsValid():
+			changes = append(changes, Change{Resource: resource, Message: elemPath + " added"})
+		default:
+			changes = append(changes, diffValues(resource, elemPath, m.old, m.new)...)
+		}
+	}
+	return changes
+}
+
+// diffStrings compares two strings. Multi-line strings, including the
+// decoded contents of data URLs, are shown as unified diffs.
+func diffStrings(resource, path, old, new string) []Change {
+	if old == new {
+		return nil
+	}
+	oldText, oldOK := text(old)
+	newText, newOK := text(new)
+	if oldOK && newOK && (strings.Contains(oldText, "\n") || strings.Contains(newText, "\n") || oldText != old || newText != new) {
+		return []Change{{
+			Resource: resource,
+			Message:  fmt.Sprintf("%s changed", path),
+			Diff:     unifiedDiff(oldText, newText),
+		}}
+	}
+	return []Change{{Resource: resource, Message: fmt.Sprintf("%s changed from %q to %q", path, old, new)}}
+}
+
+// text returns the text a string stands for, decoding data URLs. It returns
+// false if the decoded data isn't text.
+func text(s string) (string, bool) {
+	if strings.HasPrefix(s, "data:") {
+		url, err := dataurl.DecodeString(s)
+		if err != nil || !utf8.Valid(url.Data) {
+			return "", false
+		}
+		return string(url.Data), true
+	}
+	return s, true
+}
+
+// missing returns the elements of a that aren't in b.
+func missing(a, b reflect.Value) []reflect.Value {
+	var res []reflect.Value
+outer:
+	for i := 0; i < a.Len(); i++ {
+		for j := 0; j < b.Len(); j++ {
+			if reflect.DeepEqual(a.Index(i).Interface(), b.Index(j).Interface()) {
+				continue outer
+			}
+		}
+		res = append(res, a.Index(i))
+	}
+	return res
+}
+
+// format formats a scalar for a change message. Modes are shown in octal.
+func format(path string, v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.String:
+		return fmt.Sprintf("%q", v.String())
+	case reflect.Int:
+		if path == "mode" || strings.HasSuffix(path, ".mode") {
+			return fmt.Sprintf("%#o", v.Int())
+		}
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// field returns an id function that reads the named string field.
+func field(name string) func(int, reflect.Value) string {
+	return func(_ int, v reflect.Value) string {
+		return v.FieldByName(name).String()
+	}
+}
+
+// nodePath identifies files, directories and links by their path, prefixed by
+// the filesystem unless it is the root filesystem.
+func nodePath(_ int, v reflect.Value) string {
+	node := v.FieldByName("Node").Interface().(ignTypes.Node)
+	if node.Filesystem == "root" || node.Filesystem == "" {
+		return node.Path
+	}
+	return node.Filesystem + ":" + node.Path
+}
+
+// elementID identifies an element of a list within a resource, like a dropin
+// or a partition, falling back to its index.
+func elementID(i int, v reflect.Value) string {
+	for _, name := range []string{"Name", "Label", "Source"} {
+		f := v.FieldByName(name)
+		if f.Kind() == reflect.Ptr && !f.IsNil() {
+			f = f.Elem()
+		}
+		if f.Kind() == reflect.String && f.String() != "" {
+			return f.String()
+		}
+	}
+	if f := v.FieldByName("Number"); f.IsValid() && f.Int() != 0 {
+		return fmt.Sprintf("#%d", f.Int())
+	}
+	return fmt.Sprint(i)
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func indent(s string) string {
+	return "  " + strings.Replace(strings.TrimSuffix(s, "\n"), "\n", "\n  ", -1)
+}
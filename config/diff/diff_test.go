@@ -0,0 +1,178 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"testing"
+
+	"github.com/coreos/container-linux-config-transpiler/internal/util"
+	ignTypes "github.com/coreos/ignition/config/v2_3/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func file(path string, mode int, source string) ignTypes.File {
+	return ignTypes.File{
+		Node: ignTypes.Node{Filesystem: "root", Path: path},
+		FileEmbedded1: ignTypes.FileEmbedded1{
+			Mode:     util.IntToPtr(mode),
+			Contents: ignTypes.FileContents{Source: source},
+		},
+	}
+}
+
+func TestConfigs(t *testing.T) {
+	type in struct {
+		old ignTypes.Config
+		new ignTypes.Config
+	}
+	type out struct {
+		changes []Change
+	}
+
+	tests := []struct {
+		in  in
+		out out
+	}{
+		{
+			in:  in{},
+			out: out{},
+		},
+		{
+			in: in{
+				old: ignTypes.Config{Storage: ignTypes.Storage{Files: []ignTypes.File{
+					file("/etc/a", 0644, "data:,a"),
+					file("/etc/b", 0644, "data:,b"),
+				}}},
+				new: ignTypes.Config{Storage: ignTypes.Storage{Files: []ignTypes.File{
+					file("/etc/c", 0644, "data:,c"),
+					file("/etc/a", 0600, "data:,a"),
+				}}},
+			},
+			out: out{changes: []Change{
+				{Resource: "file /etc/a", Message: "mode changed from 0644 to 0600"},
+				{Resource: "file /etc/b", Message: "removed"},
+				{Resource: "file /etc/c", Message: "added"},
+			}},
+		},
+		{
+			in: in{
+				old: ignTypes.Config{Storage: ignTypes.Storage{Files: []ignTypes.File{
+					file("/etc/a", 0644, "data:,one%0Atwo%0Athree%0A"),
+				}}},
+				new: ignTypes.Config{Storage: ignTypes.Storage{Files: []ignTypes.File{
+					file("/etc/a", 0644, "data:,one%0A2%0Athree%0A"),
+				}}},
+			},
+			out: out{changes: []Change{{
+				Resource: "file /etc/a",
+				Message:  "contents.source changed",
+				Diff:     "--- old\n+++ new\n@@ -1,3 +1,3 @@\n one\n-two\n+2\n three\n",
+			}}},
+		},
+		{
+			in: in{
+				old: ignTypes.Config{Systemd: ignTypes.Systemd{Units: []ignTypes.Unit{{
+					Name:    "a.service",
+					Dropins: []ignTypes.SystemdDropin{{Name: "10-a.conf", Contents: "[Service]"}},
+				}}}},
+				new: ignTypes.Config{Systemd: ignTypes.Systemd{Units: []ignTypes.Unit{{
+					Name:    "a.service",
+					Enabled: util.BoolToPtr(false),
+					Dropins: []ignTypes.SystemdDropin{{Name: "20-b.conf", Contents: "[Service]"}},
+				}}}},
+			},
+			out: out{changes: []Change{
+				{Resource: "unit a.service", Message: "dropins[10-a.conf] removed"},
+				{Resource: "unit a.service", Message: "dropins[20-b.conf] added"},
+				{Resource: "unit a.service", Message: "enabled set to false"},
+			}},
+		},
+		{
+			in: in{
+				old: ignTypes.Config{Systemd: ignTypes.Systemd{Units: []ignTypes.Unit{
+					{
+						Name:    "docker.service",
+						Enable:  true,
+						Dropins: []ignTypes.SystemdDropin{{Name: "20-clct-docker.conf", Contents: "[Service]"}},
+					},
+					{
+						Name:    "docker.service",
+						Dropins: []ignTypes.SystemdDropin{{Name: "10-mine.conf", Contents: "[Service]\nLimitNOFILE=1024"}},
+					},
+				}}},
+				new: ignTypes.Config{Systemd: ignTypes.Systemd{Units: []ignTypes.Unit{
+					{
+						Name:    "docker.service",
+						Enable:  true,
+						Dropins: []ignTypes.SystemdDropin{{Name: "20-clct-docker.conf", Contents: "[Service]"}},
+					},
+					{
+						Name:    "docker.service",
+						Dropins: []ignTypes.SystemdDropin{{Name: "10-mine.conf", Contents: "[Service]\nLimitNOFILE=4096"}},
+					},
+				}}},
+			},
+			out: out{changes: []Change{{
+				Resource: "unit docker.service",
+				Message:  "dropins[10-mine.conf].contents changed",
+				Diff:     "--- old\n+++ new\n@@ -1,2 +1,2 @@\n [Service]\n-LimitNOFILE=1024\n+LimitNOFILE=4096\n",
+			}}},
+		},
+		{
+			in: in{
+				old: ignTypes.Config{Passwd: ignTypes.Passwd{Users: []ignTypes.PasswdUser{{
+					Name:              "core",
+					SSHAuthorizedKeys: []ignTypes.SSHAuthorizedKey{"ssh-rsa one", "ssh-rsa two"},
+				}}}},
+				new: ignTypes.Config{Passwd: ignTypes.Passwd{Users: []ignTypes.PasswdUser{{
+					Name:              "core",
+					SSHAuthorizedKeys: []ignTypes.SSHAuthorizedKey{"ssh-rsa two"},
+				}}}},
+			},
+			out: out{changes: []Change{
+				{Resource: "user core", Message: `sshAuthorizedKeys entry "ssh-rsa one" removed`},
+			}},
+		},
+	}
+
+	for i, test := range tests {
+		changes := Configs(test.in.old, test.in.new)
+		assert.Equal(t, test.out.changes, changes, "#%d: bad changes", i)
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		a, b string
+		out  string
+	}{
+		{
+			a:   "",
+			b:   "new\n",
+			out: "--- old\n+++ new\n@@ -0,0 +1 @@\n+new\n",
+		},
+		{
+			a: "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n",
+			b: "one\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\ntwelve\n",
+			out: "--- old\n+++ new\n" +
+				"@@ -1,4 +1,4 @@\n-1\n+one\n 2\n 3\n 4\n" +
+				"@@ -9,4 +9,4 @@\n 9\n 10\n 11\n-12\n+twelve\n",
+		},
+	}
+
+	for i, test := range tests {
+		assert.Equal(t, test.out, unifiedDiff(test.a, test.b), "#%d: bad diff", i)
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+const (
+	// contextLines is the number of unchanged lines shown around changes.
+	contextLines = 3
+)
+
+// edit is a single line of a line based diff. op is ' ', '-' or '+'.
+type edit struct {
+	op   byte
+	line string
+}
+
+// unifiedDiff returns a unified diff of the lines of a and b.
+func unifiedDiff(a, b string) string {
+	return UnifiedDiff("old", "new", a, b)
+}
+
+// UnifiedDiff returns a unified diff of the lines of a and b, with the given
+// names in its header.
+func UnifiedDiff(aName, bName, a, b string) string {
+	edits := diffLines(splitLines(a), splitLines(b))
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", aName, bName)
+	for start := 0; start < len(edits); {
+		// find the next change and the extent of its hunk
+		first := start
+		for first < len(edits) && edits[first].op == ' ' {
+			first++
+		}
+		if first == len(edits) {
+			break
+		}
+		last := first
+		for i := first; i < len(edits); i++ {
+			if edits[i].op != ' ' {
+				last = i
+			} else if i-last > 2*contextLines {
+				break
+			}
+		}
+		from := first - contextLines
+		if from < start {
+			from = start
+		}
+		to := last + contextLines + 1
+		if to > len(edits) {
+			to = len(edits)
+		}
+
+		aStart, bStart := lineNumbers(edits[:from])
+		aLen, bLen := lineNumbers(edits[from:to])
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(aStart, aLen), hunkRange(bStart, bLen))
+		for _, e := range edits[from:to] {
+			fmt.Fprintf(&out, "%c%s\n", e.op, e.line)
+		}
+		start = to
+	}
+	return out.String()
+}
+
+// diffLines computes a shortest edit script from a to b using the longest
+// common subsequence of their lines. Configs are small enough for the
+// quadratic table.
+func diffLines(a, b []string) []edit {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] > lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var edits []edit
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			edits = append(edits, edit{' ', a[i]})
+			i++
+			j++
+		case j < len(b) && (i == len(a) || lcs[i][j+1] > lcs[i+1][j]):
+			edits = append(edits, edit{'+', b[j]})
+			j++
+		default:
+			edits = append(edits, edit{'-', a[i]})
+			i++
+		}
+	}
+	return edits
+}
+
+// lineNumbers counts the lines of a and b covered by edits.
+func lineNumbers(edits []edit) (int, int) {
+	a, b := 0, 0
+	for _, e := range edits {
+		if e.op != '+' {
+			a++
+		}
+		if e.op != '-' {
+			b++
+		}
+	}
+	return a, b
+}
+
+// hunkRange formats the range of a hunk header, which starts at the line
+// after start or at start itself for empty ranges.
+func hunkRange(start, length int) string {
+	if length == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if length == 1 {
+		return fmt.Sprint(start + 1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, length)
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
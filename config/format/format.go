@@ -0,0 +1,57 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package format rewrites Container Linux Configs in a canonical layout,
+// keeping their comments.
+package format
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+
+	"github.com/coreos/container-linux-config-transpiler/config/astyaml"
+	"github.com/coreos/container-linux-config-transpiler/config/types"
+)
+
+// Format returns the canonical form of a config: keys are in the order of the
+// config's fields, followed by any unknown keys in their original order,
+// collections are indented by two spaces and file modes are written in
+// octal. Comments and single empty lines between entries are kept. The
+// config is not unmarshalled, only its layout is changed, so values of the
+// wrong type, like references to variables that are lists, are kept as they
+// are.
+func Format(data []byte) ([]byte, error) {
+	doc, err := astyaml.ParseDocument(data)
+	if err != nil {
+		return nil, err
+	}
+	return doc.Encode(astyaml.EncodeOptions{
+		KeyOrder: astyaml.FieldOrder(reflect.ValueOf(types.Config{})),
+		Scalar:   formatScalar,
+	}), nil
+}
+
+// formatScalar writes modes in octal, the way they are shown by ls and
+// chmod.
+func formatScalar(path []interface{}, text string) string {
+	if len(path) == 0 || path[len(path)-1] != "mode" {
+		return text
+	}
+	mode, err := strconv.ParseInt(text, 0, 64)
+	if err != nil || mode < 0 {
+		return text
+	}
+	return fmt.Sprintf("%#o", mode)
+}
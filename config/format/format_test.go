@@ -0,0 +1,188 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package format
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		in  string
+		out string
+	}{
+		{
+			// already canonical
+			in: `storage:
+  files:
+    - path: /opt/file
+      mode: 0644
+`,
+			out: `storage:
+  files:
+    - path: /opt/file
+      mode: 0644
+`,
+		},
+		{
+			// keys are sorted by field order, modes are octal and
+			// indentation is normalised
+			in: `passwd:
+    users:
+    -   ssh_authorized_keys: [ "ssh-rsa key" ]
+        name: core
+storage:
+    files:
+    -   mode: 420
+        filesystem: root
+        path: /opt/file
+`,
+			out: `storage:
+  files:
+    - filesystem: root
+      path: /opt/file
+      mode: 0644
+passwd:
+  users:
+    - name: core
+      ssh_authorized_keys:
+        - "ssh-rsa key"
+`,
+		},
+		{
+			// comments and empty lines stay with their entries
+			in: `# header
+
+systemd:
+  units:
+    # the first unit
+    - name: a.service # trailing
+      enable: true
+
+    # the second unit
+    - name: b.service
+storage:
+  # files
+  files:
+    - path: /opt/file
+# footer
+`,
+			out: `# header
+
+storage:
+  # files
+  files:
+    - path: /opt/file
+
+systemd:
+  units:
+    # the first unit
+    - name: a.service # trailing
+      enable: true
+
+    # the second unit
+    - name: b.service
+# footer
+`,
+		},
+		{
+			// block scalars are reindented, unknown keys go last
+			in: `unknown: value
+systemd:
+  units:
+  - name: a.service
+    contents: |
+        [Service]
+
+        ExecStart=/bin/true
+    enabled: true
+`,
+			out: `systemd:
+  units:
+    - name: a.service
+      enabled: true
+      contents: |
+        [Service]
+
+        ExecStart=/bin/true
+unknown: value
+`,
+		},
+		{
+			// quoted scalars and empty values are kept as they are
+			in: `storage:
+  files:
+    - path: '/opt/it''s'
+      contents:
+        inline: "a: b\n"
+      user: {}
+`,
+			out: `storage:
+  files:
+    - path: '/opt/it''s'
+      user: {}
+      contents:
+        inline: "a: b\n"
+`,
+		},
+		{
+			// references to variables are kept whatever their type,
+			// the values of maps are ordered like their type
+			in: `passwd:
+  users:
+    - ssh_authorized_keys: ${var.ssh_keys}
+      name: core
+update:
+  group: ${var.group}
+variables:
+  ssh_keys:
+    description: keys of the core user
+    type: list
+  group:
+    default: stable
+`,
+			out: `variables:
+  ssh_keys:
+    type: list
+    description: keys of the core user
+  group:
+    default: stable
+passwd:
+  users:
+    - name: core
+      ssh_authorized_keys: ${var.ssh_keys}
+update:
+  group: ${var.group}
+`,
+		},
+	}
+
+	for i, test := range tests {
+		out, err := Format([]byte(test.in))
+		assert.Nil(t, err, "#%d: unexpected error", i)
+		assert.Equal(t, test.out, string(out), "#%d: bad output", i)
+
+		again, err := Format(out)
+		assert.Nil(t, err, "#%d: unexpected error formatting again", i)
+		assert.Equal(t, string(out), string(again), "#%d: not idempotent", i)
+	}
+}
+
+func TestFormatInvalid(t *testing.T) {
+	_, err := Format([]byte("storage: [\n"))
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,426 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	yaml "github.com/ajeddeloh/yaml"
+	"github.com/coreos/container-linux-config-transpiler/config/astyaml"
+	"github.com/coreos/container-linux-config-transpiler/config/localfs"
+	"github.com/coreos/container-linux-config-transpiler/config/types"
+	"github.com/coreos/ignition/config/validate/astnode"
+	"github.com/coreos/ignition/config/validate/report"
+)
+
+var (
+	ErrIncludeDisabled = errors.New("include is not allowed here")
+)
+
+// fragment is a config taking part in a composition.
+type fragment struct {
+	name string
+	cfg  types.Config
+	ast  astnode.AstNode
+	// line and column of the include entry of the root config that pulled
+	// the fragment in, zero for the root config itself
+	line, column int
+}
+
+// location returns where the value at path is in the fragment, like
+// base.yaml:3:5.
+func (f *fragment) location(path []interface{}) string {
+	if n, ok := astyaml.NodeAt(f.ast, path...); ok {
+		line, col, _ := n.ValueLineCol(nil)
+		return fmt.Sprintf("%s:%d:%d", f.name, line, col)
+	}
+	return f.name
+}
+
+// mergeIncludes parses the configs included by cfg, and the configs they
+// include, and merges them into cfg. Included paths are relative to the
+// including config.
+//
+// The entries of the root config come first in merged lists, followed by
+// those of the included configs in the order they are included, so that root
+// can be used to find the positions of everything that came from the root
+// config. Lists of units, files and the like are merged by their names or
+// paths, other lists are concatenated. A value that is set to different
+// values in two configs is a conflict.
+func mergeIncludes(cfg types.Config, root astnode.AstNode, options ParseOptions) (types.Config, report.Report) {
+	name := options.Path
+	if name == "" {
+		name = "<config>"
+	}
+	fragments := []*fragment{{name: name, cfg: cfg, ast: root}}
+	r := loadIncludes(fragments[0], filepath.Dir(options.Path), options, []string{localfs.Abs(options.Path)}, &fragments)
+	if r.IsFatal() {
+		return types.Config{}, r
+	}
+
+	m := merger{origins: map[string]origin{}}
+	merged := types.Config{}
+	for _, f := range fragments {
+		m.merge(reflect.ValueOf(&merged).Elem(), reflect.ValueOf(f.cfg), "", origin{fragment: f})
+	}
+	merged.Include = nil
+	r.Merge(m.r)
+	return merged, r
+}
+
+// loadIncludes parses the configs included by f and appends them to
+// fragments, each followed by the configs it includes in turn. stack holds
+// the absolute paths of the configs being included, to detect cycles.
+func loadIncludes(f *fragment, dir string, options ParseOptions, stack []string, fragments *[]*fragment) report.Report {
+	r := report.Report{}
+	for i, include := range f.cfg.Include {
+		line, column := f.line, f.column
+		if f.line == 0 {
+			if n, ok := astyaml.NodeAt(f.ast, "include", i); ok {
+				line, column, _ = n.ValueLineCol(nil)
+			}
+		}
+		addError := func(message string) {
+			r.Add(report.Entry{
+				Kind:    report.EntryError,
+				Message: message,
+				Line:    line,
+				Column:  column,
+			})
+		}
+
+		if options.NoIncludes {
+			addError(ErrIncludeDisabled.Error())
+			return r
+		}
+		path := include
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		abs := localfs.Abs(path)
+		for _, p := range stack {
+			if p == abs {
+				addError(fmt.Sprintf("include cycle: %s includes %s", f.name, path))
+				return r
+			}
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			addError(fmt.Sprintf("failed to read included config: %v", err))
+			return r
+		}
+		fragmentOptions := options
+		fragmentOptions.Path = path
+		cfg, ast, fragmentReport := parseConfig(data, fragmentOptions)
+		// the positions of the report are in the included config, which
+		// the entry can't point to
+		for _, entry := range fragmentReport.Entries {
+			location := path
+			if entry.Line != 0 {
+				location = fmt.Sprintf("%s:%d:%d", path, entry.Line, entry.Column)
+			}
+			entry.Message = fmt.Sprintf("%s: %s", location, entry.Message)
+			entry.Line, entry.Column = line, column
+			r.Add(entry)
+		}
+		if fragmentReport.IsFatal() {
+			return r
+		}
+
+		included := &fragment{name: path, cfg: cfg, ast: ast, line: line, column: column}
+		*fragments = append(*fragments, included)
+		r.Merge(loadIncludes(included, filepath.Dir(path), options, append(stack, abs), fragments))
+		if r.IsFatal() {
+			return r
+		}
+	}
+	return r
+}
+
+// Includes returns the paths of the configs that the config in data includes,
+// directly or through other included configs. Like in the include section,
+// they are relative to the directory of path. It is meant for tools tracking
+// the inputs of configs, so configs that can't be read are skipped.
+func Includes(data []byte, path string) []string {
+	var paths []string
+	seen := map[string]bool{localfs.Abs(path): true}
+	var walk func(data []byte, dir string)
+	walk = func(data []byte, dir string) {
+		var cfg struct {
+			Include []string `yaml:"include"`
+		}
+		if err := yaml.Unmarshal(data, &cfg); err != nil {
+			return
+		}
+		for _, include := range cfg.Include {
+			if !filepath.IsAbs(include) {
+				include = filepath.Join(dir, include)
+			}
+			if seen[localfs.Abs(include)] {
+				continue
+			}
+			seen[localfs.Abs(include)] = true
+			paths = append(paths, include)
+			if data, err := ioutil.ReadFile(include); err == nil {
+				walk(data, filepath.Dir(include))
+			}
+		}
+	}
+	walk(data, filepath.Dir(path))
+	return paths
+}
+
+// origin is the place a value was merged from.
+type origin struct {
+	fragment *fragment
+	path     []interface{}
+}
+
+func (o origin) child(key interface{}) origin {
+	path := make([]interface{}, len(o.path), len(o.path)+1)
+	copy(path, o.path)
+	return origin{fragment: o.fragment, path: append(path, key)}
+}
+
+// merger deep merges configs, remembering where every value came from to
+// report conflicts.
+type merger struct {
+	// origins of the values, by their names in messages
+	origins map[string]origin
+	// override replaces values that are already set instead of reporting
+	// conflicts, as overlays do
+	override bool
+	// fragments that were merged into each entry of the lists, by the
+	// names of the lists
+	entries map[string][]map[*fragment]bool
+	r       report.Report
+}
+
+// merge merges src into dst. name identifies the value in messages, using
+// the natural keys of list entries like storage.files[/etc/motd].mode.
+func (m *merger) merge(dst, src reflect.Value, name string, o origin) {
+	switch src.Kind() {
+	case reflect.Struct:
+		t := src.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			if field.Anonymous {
+				m.merge(dst.Field(i), src.Field(i), name, o)
+				continue
+			}
+			key := strings.Split(field.Tag.Get("yaml"), ",")[0]
+			if key == "" || key == "-" {
+				continue
+			}
+			m.merge(dst.Field(i), src.Field(i), joinName(name, key), o.child(key))
+		}
+	case reflect.Ptr:
+		if src.IsNil() {
+			return
+		}
+		if src.Elem().Kind() != reflect.Struct {
+			// pointers to scalars are set even if they point to zero
+			m.mergeValue(dst, src, name, o, dst.IsNil())
+			return
+		}
+		if dst.IsNil() {
+			dst.Set(reflect.New(src.Type().Elem()))
+		}
+		m.merge(dst.Elem(), src.Elem(), name, o)
+	case reflect.Interface:
+		if src.IsNil() {
+			return
+		}
+		if dst.IsNil() || dst.Elem().Type() != src.Elem().Type() {
+			m.mergeValue(dst, src, name, o, dst.IsNil())
+			return
+		}
+		// values in interfaces can't be modified in place
+		elem := reflect.New(dst.Elem().Type()).Elem()
+		elem.Set(dst.Elem())
+		m.merge(elem, src.Elem(), name, o)
+		dst.Set(elem)
+	case reflect.Slice:
+		m.mergeSlice(dst, src, name, o)
+	case reflect.Map:
+		if src.Len() == 0 {
+			return
+		}
+		if dst.IsNil() {
+			dst.Set(reflect.MakeMap(src.Type()))
+		}
+		var keys []string
+		for _, key := range src.MapKeys() {
+			keys = append(keys, key.String())
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			// map elements can't be modified in place
+			k := reflect.ValueOf(key).Convert(src.Type().Key())
+			elem := reflect.New(src.Type().Elem()).Elem()
+			if existing := dst.MapIndex(k); existing.IsValid() {
+				elem.Set(existing)
+			}
+			m.merge(elem, src.MapIndex(k), joinName(name, key), o.child(key))
+			dst.SetMapIndex(k, elem)
+		}
+	default:
+		if isZeroValue(src) {
+			return
+		}
+		m.mergeValue(dst, src, name, o, isZeroValue(dst))
+	}
+}
+
+// mergeValue sets dst to src if it is unset, and otherwise reports a conflict
+// if they differ.
+func (m *merger) mergeValue(dst, src reflect.Value, name string, o origin, unset bool) {
+	if unset || m.override {
+		dst.Set(src)
+		m.origins[name] = o
+		return
+	}
+	if reflect.DeepEqual(dst.Interface(), src.Interface()) {
+		return
+	}
+
+	first := m.origins[name]
+	entry := report.Entry{
+		Kind: report.EntryError,
+		Message: fmt.Sprintf("conflicting values for %s: %s in %s and %s in %s",
+			name, formatValue(name, dst), first.fragment.location(first.path), formatValue(name, src), o.fragment.location(o.path)),
+		Line:   o.fragment.line,
+		Column: o.fragment.column,
+	}
+	if first.fragment.line == 0 {
+		// point at the value in the root config
+		if n, ok := astyaml.NodeAt(first.fragment.ast, first.path...); ok {
+			entry.Line, entry.Column, _ = n.ValueLineCol(nil)
+		}
+	}
+	m.r.Add(entry)
+}
+
+// mergeSlice merges the entries of two lists. Entries of structs with a
+// natural key are merged with the entry with the same key, other entries are
+// added unless they already are in the list. Entries are only merged with
+// those of other configs, never with entries of the same config, so that
+// the entries of the root config keep their indices.
+func (m *merger) mergeSlice(dst, src reflect.Value, name string, o origin) {
+	if m.entries == nil {
+		m.entries = map[string][]map[*fragment]bool{}
+	}
+	entries := m.entries[name]
+	for len(entries) < dst.Len() {
+		// entries that were in the list before merging
+		entries = append(entries, map[*fragment]bool{})
+	}
+	for i := 0; i < src.Len(); i++ {
+		elem := src.Index(i)
+		isStruct := elem.Kind() == reflect.Struct
+		key, keyed := "", false
+		if isStruct {
+			key, keyed = naturalKey(elem)
+		}
+
+		target, duplicate := -1, false
+		for j := 0; j < dst.Len() && target == -1; j++ {
+			if isStruct {
+				if k, ok := naturalKey(dst.Index(j)); !keyed || !ok || k != key {
+					continue
+				}
+			} else if !reflect.DeepEqual(dst.Index(j).Interface(), elem.Interface()) {
+				continue
+			}
+			if entries[j][o.fragment] {
+				duplicate = true
+			} else {
+				target = j
+			}
+		}
+		if target != -1 && !isStruct {
+			// already in the list
+			entries[target][o.fragment] = true
+			continue
+		}
+		if target == -1 {
+			dst.Set(reflect.Append(dst, reflect.New(elem.Type()).Elem()))
+			entries = append(entries, map[*fragment]bool{})
+			target = dst.Len() - 1
+		}
+		entries[target][o.fragment] = true
+		if !isStruct {
+			dst.Index(target).Set(elem)
+			continue
+		}
+		if !keyed || duplicate {
+			// entries sharing a key are told apart by their index
+			key = fmt.Sprint(target)
+		}
+		m.merge(dst.Index(target), elem, fmt.Sprintf("%s[%s]", name, key), o.child(i))
+	}
+	m.entries[name] = entries
+}
+
+// naturalKey returns what identifies a list entry, like the name of a unit
+// or the path of a file.
+func naturalKey(v reflect.Value) (string, bool) {
+	for _, field := range []string{"Name", "Path", "Device", "Source"} {
+		f := v.FieldByName(field)
+		if !f.IsValid() || f.Kind() != reflect.String || f.String() == "" {
+			continue
+		}
+		key := f.String()
+		if fs := v.FieldByName("Filesystem"); field == "Path" && fs.IsValid() && fs.String() != "" && fs.String() != "root" {
+			key = fs.String() + ":" + key
+		}
+		return key, true
+	}
+	return "", false
+}
+
+func formatValue(name string, v reflect.Value) string {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	switch {
+	case v.Kind() == reflect.String:
+		return fmt.Sprintf("%q", v.String())
+	case v.Kind() == reflect.Int && strings.HasSuffix(name, ".mode"):
+		return fmt.Sprintf("%#o", v.Int())
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+func joinName(name, key string) string {
+	if name == "" {
+		return key
+	}
+	return name + "." + key
+}
+
+func isZeroValue(v reflect.Value) bool {
+	return reflect.DeepEqual(v.Interface(), reflect.Zero(v.Type()).Interface())
+}
@@ -0,0 +1,102 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/coreos/container-linux-config-transpiler/config/astyaml"
+	"github.com/coreos/ignition/config/validate/report"
+)
+
+// checkUnknownKeys reports every key in the tree that yaml.Unmarshal silently
+// dropped because it doesn't map to any field of v, the config or a value in
+// it. The entries are warnings, or errors if strict is set.
+func checkUnknownKeys(root astyaml.YamlNode, v reflect.Value, strict bool) report.Report {
+	kind := report.EntryWarning
+	if strict {
+		kind = report.EntryError
+	}
+
+	r := report.Report{}
+	for _, key := range root.UnknownKeys(v) {
+		message := fmt.Sprintf("Config has unrecognized key: %s", key.Key)
+		if suggestion := suggestKey(key.Key, key.Keys); suggestion != "" {
+			message += fmt.Sprintf(", did you mean %s?", suggestion)
+		}
+		r.Add(report.Entry{
+			Kind:    kind,
+			Message: message,
+			Line:    key.Line,
+			Column:  key.Column,
+		})
+	}
+	return r
+}
+
+// suggestKey returns the key in candidates closest to key, or an empty string
+// if none of them is close enough to be a likely typo.
+func suggestKey(key string, candidates []string) string {
+	best, bestDistance := "", 0
+	for _, candidate := range candidates {
+		distance := editDistance(strings.ToLower(key), candidate)
+		// allow roughly one typo per four characters
+		if distance > 1 && distance > len(candidate)/4 {
+			continue
+		}
+		if best == "" || distance < bestDistance {
+			best, bestDistance = candidate, distance
+		}
+	}
+	return best
+}
+
+// editDistance returns the number of single character insertions, deletions,
+// substitutions and transpositions of adjacent characters needed to turn a
+// into b.
+func editDistance(a, b string) int {
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d[i][j] = minInt(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				d[i][j] = minInt(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(a)][len(b)]
+}
+
+func minInt(first int, rest ...int) int {
+	for _, i := range rest {
+		if i < first {
+			first = i
+		}
+	}
+	return first
+}
@@ -0,0 +1,213 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package lint checks container linux configs for settings that are valid
+// but likely to be mistakes or insecure. Every check is a rule with an ID,
+// which can be disabled or configured with a lint config.
+package lint
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	yaml "github.com/ajeddeloh/yaml"
+	"github.com/coreos/container-linux-config-transpiler/config/astyaml"
+	"github.com/coreos/container-linux-config-transpiler/config/types"
+	"github.com/coreos/ignition/config/validate/astnode"
+	"github.com/coreos/ignition/config/validate/report"
+)
+
+// DefaultConfigName is the name of the lint config that is used if none is
+// given explicitly.
+const DefaultConfigName = ".ctlint.yaml"
+
+// docURL is where the rules are documented, by ID.
+const docURL = "https://github.com/coreos/container-linux-config-transpiler/blob/master/doc/lint.md#"
+
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+	SeverityInfo    = "info"
+)
+
+var (
+	// Severities are the severities a rule can have.
+	Severities = []string{SeverityError, SeverityWarning, SeverityInfo}
+
+	ErrUnknownRule     = errors.New("unknown rule")
+	ErrUnknownSeverity = fmt.Errorf("unknown severity, accepted values: %v", Severities)
+)
+
+// Rule is a check of container linux configs.
+type Rule struct {
+	ID string
+	// Severity is the severity of the rule's findings unless configured
+	// otherwise.
+	Severity    string
+	Description string
+	// Options points to the default options of the rule, which the options
+	// in a lint config are decoded into. It is nil if the rule has none.
+	Options interface{}
+
+	check func(cfg types.Config, options interface{}) []finding
+}
+
+// Doc returns the link to the documentation of the rule.
+func (r Rule) Doc() string {
+	return docURL + r.ID
+}
+
+// finding is a problem a rule found, at a path of yaml keys and indices.
+type finding struct {
+	path    []interface{}
+	message string
+}
+
+// Config selects and configures the rules to run. The zero value runs every
+// rule with its defaults.
+type Config struct {
+	rules map[string]ruleSettings
+}
+
+type ruleSettings struct {
+	disabled bool
+	severity string
+	options  interface{}
+}
+
+// configFile is the format of lint configs:
+//
+//	rules:
+//	  executable-location:
+//	    severity: error
+//	    options:
+//	      allowed_dirs: [/opt, /usr/local, /etc/scripts]
+//	  user-without-ssh-keys:
+//	    enabled: false
+type configFile struct {
+	Rules map[string]struct {
+		Enabled  *bool                  `yaml:"enabled"`
+		Severity string                 `yaml:"severity"`
+		Options  map[string]interface{} `yaml:"options"`
+	} `yaml:"rules"`
+}
+
+// ParseConfig parses a lint config.
+func ParseConfig(data []byte) (Config, error) {
+	var file configFile
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return Config{}, err
+	}
+
+	c := Config{rules: map[string]ruleSettings{}}
+	for id, settings := range file.Rules {
+		rule, ok := ruleByID(id)
+		if !ok {
+			return Config{}, fmt.Errorf("%s: %v", id, ErrUnknownRule)
+		}
+		s := ruleSettings{
+			disabled: settings.Enabled != nil && !*settings.Enabled,
+			severity: settings.Severity,
+		}
+		if s.severity != "" && !isSeverity(s.severity) {
+			return Config{}, fmt.Errorf("%s: %v", id, ErrUnknownSeverity)
+		}
+		if settings.Options != nil {
+			if rule.Options == nil {
+				return Config{}, fmt.Errorf("%s: rule has no options", id)
+			}
+			options, err := decodeOptions(settings.Options, rule.Options)
+			if err != nil {
+				return Config{}, fmt.Errorf("%s: invalid options: %v", id, err)
+			}
+			s.options = options
+		}
+		c.rules[id] = s
+	}
+	return c, nil
+}
+
+// Lint runs the rules selected by c on cfg. The findings are positioned
+// using ast, the parse tree of cfg, if it is not nil, and the paths of the
+// ones that can't be are recorded in paths.
+func Lint(cfg types.Config, ast astnode.AstNode, c Config, paths *astyaml.ReportPaths) report.Report {
+	r := report.Report{}
+	for _, rule := range Rules {
+		s := c.rules[rule.ID]
+		if s.disabled {
+			continue
+		}
+		severity := rule.Severity
+		if s.severity != "" {
+			severity = s.severity
+		}
+		options := rule.Options
+		if s.options != nil {
+			options = s.options
+		}
+
+		for _, f := range rule.check(cfg, options) {
+			entry := report.Entry{
+				Message: fmt.Sprintf("%s: %s (see %s)", rule.ID, f.message, rule.Doc()),
+			}
+			switch severity {
+			case SeverityError:
+				entry.Kind = report.EntryError
+			case SeverityWarning:
+				entry.Kind = report.EntryWarning
+			default:
+				entry.Kind = report.EntryInfo
+			}
+			if n, ok := astyaml.NodeAt(ast, f.path...); ok {
+				entry.Line, entry.Column, _ = n.ValueLineCol(nil)
+			}
+			r.Add(entry)
+			paths.Set(entry, f.path...)
+		}
+	}
+	return r
+}
+
+func ruleByID(id string) (Rule, bool) {
+	for _, rule := range Rules {
+		if rule.ID == id {
+			return rule, true
+		}
+	}
+	return Rule{}, false
+}
+
+func isSeverity(s string) bool {
+	for _, severity := range Severities {
+		if s == severity {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeOptions decodes options into a copy of the struct defaults points to.
+func decodeOptions(options map[string]interface{}, defaults interface{}) (interface{}, error) {
+	v := reflect.New(reflect.TypeOf(defaults).Elem())
+	v.Elem().Set(reflect.ValueOf(defaults).Elem())
+	data, err := yaml.Marshal(options)
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.UnmarshalStrict(data, v.Interface()); err != nil {
+		return nil, err
+	}
+	return v.Interface(), nil
+}
@@ -0,0 +1,239 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lint
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/coreos/container-linux-config-transpiler/config"
+	"github.com/coreos/ignition/config/validate/report"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLint(t *testing.T) {
+	type in struct {
+		cfg        string
+		lintConfig string
+	}
+	type out struct {
+		r report.Report
+	}
+
+	tests := []struct {
+		in  in
+		out out
+	}{
+		{
+			in: in{cfg: `storage:
+  files:
+    - path: /opt/bin/tool
+      mode: 0755
+      contents:
+        remote:
+          url: https://example.com/tool
+          verification:
+            hash:
+              function: sha512
+              sum: 0123
+passwd:
+  users:
+    - name: core
+      ssh_authorized_keys: [key]
+`},
+			out: out{},
+		},
+		{
+			in: in{cfg: `storage:
+  files:
+    - path: /etc/tool
+      mode: 0777
+      contents:
+        remote:
+          url: https://example.com/tool
+    - path: /etc/ssh/sshd_config.d/10-password.conf
+      mode: 0600
+      contents:
+        inline: |
+          # PasswordAuthentication no
+          PasswordAuthentication yes
+  directories:
+    - path: /var/shared
+      mode: 01777
+    - path: /var/open
+      mode: 0777
+systemd:
+  units:
+    - name: tool.service
+      enabled: true
+      contents: |
+        [Service]
+        ExecStart=/etc/tool
+    - name: other.service
+      enable: true
+      contents: |
+        [Service]
+        ExecStart=/opt/bin/other
+      dropins:
+        - name: install.conf
+          contents: |
+            [Install]
+            WantedBy=multi-user.target
+passwd:
+  users:
+    - name: admin
+    - name: daemon
+      system: true
+`},
+			out: out{r: report.Report{Entries: []report.Entry{
+				{
+					Kind:    report.EntryError,
+					Message: "world-writable-file: file /etc/tool is writable by everyone (mode 0777) (see " + docURL + "world-writable-file)",
+					Line:    4,
+					Column:  13,
+				},
+				{
+					Kind:    report.EntryError,
+					Message: "world-writable-file: directory /var/open is writable by everyone without the sticky bit (mode 0777) (see " + docURL + "world-writable-file)",
+					Line:    18,
+					Column:  13,
+				},
+				{
+					Kind:    report.EntryWarning,
+					Message: "executable-location: executable /etc/tool is not in /opt, /usr/local (see " + docURL + "executable-location)",
+					Line:    4,
+					Column:  13,
+				},
+				{
+					Kind:    report.EntryError,
+					Message: "ssh-password-authentication: /etc/ssh/sshd_config.d/10-password.conf enables password authentication (see " + docURL + "ssh-password-authentication)",
+					Line:    11,
+					Column:  17,
+				},
+				{
+					Kind:    report.EntryWarning,
+					Message: "user-without-ssh-keys: user admin has no SSH authorized keys (see " + docURL + "user-without-ssh-keys)",
+					Line:    38,
+					Column:  7,
+				},
+				{
+					Kind:    report.EntryWarning,
+					Message: "unit-enabled-without-install: unit tool.service is enabled but has no [Install] section (see " + docURL + "unit-enabled-without-install)",
+					Line:    22,
+					Column:  16,
+				},
+				{
+					Kind:    report.EntryWarning,
+					Message: "remote-file-without-hash: file /etc/tool is fetched from https://example.com/tool without verification.hash (see " + docURL + "remote-file-without-hash)",
+					Line:    7,
+					Column:  16,
+				},
+			}}},
+		},
+		{
+			in: in{
+				cfg: `storage:
+  files:
+    - path: /etc/scripts/run
+      mode: 0755
+    - path: /etc/tool
+      mode: 0777
+passwd:
+  users:
+    - name: admin
+`,
+				lintConfig: `rules:
+  world-writable-file:
+    enabled: false
+  executable-location:
+    severity: error
+    options:
+      allowed_dirs: [/opt, /etc/scripts]
+  user-without-ssh-keys:
+    severity: info
+`,
+			},
+			out: out{r: report.Report{Entries: []report.Entry{
+				{
+					Kind:    report.EntryError,
+					Message: "executable-location: executable /etc/tool is not in /opt, /etc/scripts (see " + docURL + "executable-location)",
+					Line:    6,
+					Column:  13,
+				},
+				{
+					Kind:    report.EntryInfo,
+					Message: "user-without-ssh-keys: user admin has no SSH authorized keys (see " + docURL + "user-without-ssh-keys)",
+					Line:    9,
+					Column:  7,
+				},
+			}}},
+		},
+		{
+			in: in{cfg: `containers:
+  - name: web
+    image: nginx:1.15
+  - name: db
+    image: postgres@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef
+`},
+			out: out{r: report.Report{Entries: []report.Entry{{
+				Kind:    report.EntryWarning,
+				Message: "container-image-without-digest: container web runs image nginx:1.15, which isn't pinned by digest (see " + docURL + "container-image-without-digest)",
+				Line:    3,
+				Column:  12,
+			}}}},
+		},
+	}
+
+	for i, test := range tests {
+		cfg, ast, r := config.Parse([]byte(test.in.cfg))
+		assert.False(t, r.IsFatal(), "#%d: parsing config: %v", i, r)
+		lintConfig, err := ParseConfig([]byte(test.in.lintConfig))
+		assert.NoError(t, err, "#%d: parsing lint config", i)
+		assert.Equal(t, test.out.r, Lint(cfg, ast, lintConfig, nil), "#%d: bad report", i)
+	}
+}
+
+func TestParseConfig(t *testing.T) {
+	tests := []struct {
+		in  string
+		err error
+	}{
+		{
+			in:  "rules:\n  world-writable-file:\n    severity: warning\n",
+			err: nil,
+		},
+		{
+			in:  "rules:\n  no-such-rule:\n    enabled: false\n",
+			err: errors.New("no-such-rule: unknown rule"),
+		},
+		{
+			in:  "rules:\n  world-writable-file:\n    severity: fatal\n",
+			err: errors.New("world-writable-file: " + ErrUnknownSeverity.Error()),
+		},
+		{
+			in:  "rules:\n  world-writable-file:\n    options:\n      allowed_dirs: [/opt]\n",
+			err: errors.New("world-writable-file: rule has no options"),
+		},
+		{
+			in:  "rules:\n  executable-location:\n    options:\n      allowed: [/opt]\n",
+			err: errors.New("executable-location: invalid options: yaml: unmarshal errors:\n  line 1: field allowed not found in struct lint.ExecutableLocationOptions"),
+		},
+	}
+
+	for i, test := range tests {
+		_, err := ParseConfig([]byte(test.in))
+		assert.Equal(t, test.err, err, "#%d: bad error", i)
+	}
+}
@@ -0,0 +1,236 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lint
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/coreos/container-linux-config-transpiler/config/types"
+)
+
+// ExecutableLocationOptions are the options of the executable-location rule.
+type ExecutableLocationOptions struct {
+	// AllowedDirs are the directories executables may be in.
+	AllowedDirs []string `yaml:"allowed_dirs"`
+}
+
+// Rules are all rules, in the order they run.
+var Rules = []Rule{
+	{
+		ID:          "world-writable-file",
+		Severity:    SeverityError,
+		Description: "Files and directories without the sticky bit must not be writable by everyone.",
+		check:       checkWorldWritable,
+	},
+	{
+		ID:          "executable-location",
+		Severity:    SeverityWarning,
+		Description: "Executable files belong in /opt or /usr/local, the rest of the filesystem is for configuration and data.",
+		Options:     &ExecutableLocationOptions{AllowedDirs: []string{"/opt", "/usr/local"}},
+		check:       checkExecutableLocation,
+	},
+	{
+		ID:          "ssh-password-authentication",
+		Severity:    SeverityError,
+		Description: "The SSH daemon must not accept passwords, which can be guessed, instead of keys.",
+		check:       checkSSHPasswordAuthentication,
+	},
+	{
+		ID:          "user-without-ssh-keys",
+		Severity:    SeverityWarning,
+		Description: "Users that aren't system users should have SSH keys to log in with.",
+		check:       checkUserWithoutSSHKeys,
+	},
+	{
+		ID:          "unit-enabled-without-install",
+		Severity:    SeverityWarning,
+		Description: "Units can only be enabled if they have an [Install] section saying how.",
+		check:       checkUnitEnabledWithoutInstall,
+	},
+	{
+		ID:          "remote-file-without-hash",
+		Severity:    SeverityWarning,
+		Description: "Files fetched from remote URLs should be verified with a hash.",
+		check:       checkRemoteFileWithoutHash,
+	},
+	{
+		ID:          "container-image-without-digest",
+		Severity:    SeverityWarning,
+		Description: "Container images should be pinned by digest, since tags can be moved to other images.",
+		check:       checkContainerImageWithoutDigest,
+	},
+}
+
+func checkWorldWritable(cfg types.Config, options interface{}) []finding {
+	var findings []finding
+	for i, file := range cfg.Storage.Files {
+		if file.Mode != nil && *file.Mode&0002 != 0 {
+			findings = append(findings, finding{
+				path:    []interface{}{"storage", "files", i, "mode"},
+				message: fmt.Sprintf("file %s is writable by everyone (mode %#o)", file.Path, *file.Mode),
+			})
+		}
+	}
+	for i, dir := range cfg.Storage.Directories {
+		if dir.Mode != nil && *dir.Mode&0002 != 0 && *dir.Mode&01000 == 0 {
+			findings = append(findings, finding{
+				path:    []interface{}{"storage", "directories", i, "mode"},
+				message: fmt.Sprintf("directory %s is writable by everyone without the sticky bit (mode %#o)", dir.Path, *dir.Mode),
+			})
+		}
+	}
+	return findings
+}
+
+func checkExecutableLocation(cfg types.Config, options interface{}) []finding {
+	allowed := options.(*ExecutableLocationOptions).AllowedDirs
+	var findings []finding
+	for i, file := range cfg.Storage.Files {
+		if file.Mode == nil || *file.Mode&0111 == 0 {
+			continue
+		}
+		// other filesystems aren't mounted at their place in the tree
+		if file.Filesystem != "" && file.Filesystem != "root" {
+			continue
+		}
+		if !inDirs(file.Path, allowed) {
+			findings = append(findings, finding{
+				path:    []interface{}{"storage", "files", i, "mode"},
+				message: fmt.Sprintf("executable %s is not in %s", file.Path, strings.Join(allowed, ", ")),
+			})
+		}
+	}
+	return findings
+}
+
+// inDirs returns whether p is in one of dirs or their subdirectories.
+func inDirs(p string, dirs []string) bool {
+	p = path.Clean(p)
+	for _, dir := range dirs {
+		dir = path.Clean(dir)
+		if dir == "/" || strings.HasPrefix(p, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func checkSSHPasswordAuthentication(cfg types.Config, options interface{}) []finding {
+	var findings []finding
+	for i, file := range cfg.Storage.Files {
+		p := path.Clean(file.Path)
+		if p != "/etc/ssh/sshd_config" && path.Dir(p) != "/etc/ssh/sshd_config.d" {
+			continue
+		}
+		for _, line := range strings.Split(file.Contents.Inline, "\n") {
+			fields := strings.Fields(line)
+			if len(fields) >= 2 && strings.EqualFold(fields[0], "PasswordAuthentication") && strings.EqualFold(fields[1], "yes") {
+				findings = append(findings, finding{
+					path:    []interface{}{"storage", "files", i, "contents", "inline"},
+					message: fmt.Sprintf("%s enables password authentication", file.Path),
+				})
+				break
+			}
+		}
+	}
+	return findings
+}
+
+func checkUserWithoutSSHKeys(cfg types.Config, options interface{}) []finding {
+	var findings []finding
+	for i, user := range cfg.Passwd.Users {
+		if len(user.SSHAuthorizedKeys) > 0 || user.System || (user.Create != nil && user.Create.System) {
+			continue
+		}
+		findings = append(findings, finding{
+			path:    []interface{}{"passwd", "users", i},
+			message: fmt.Sprintf("user %s has no SSH authorized keys", user.Name),
+		})
+	}
+	return findings
+}
+
+func checkUnitEnabledWithoutInstall(cfg types.Config, options interface{}) []finding {
+	var findings []finding
+	for i, unit := range cfg.Systemd.Units {
+		key := "enable"
+		if unit.Enabled != nil {
+			key = "enabled"
+		}
+		enabled := unit.Enable || (unit.Enabled != nil && *unit.Enabled)
+		// units without contents come with the OS or another unit
+		if !enabled || unit.Contents == "" || hasInstallSection(unit.Contents) {
+			continue
+		}
+		hasInstall := false
+		for _, dropin := range unit.Dropins {
+			if hasInstallSection(dropin.Contents) {
+				hasInstall = true
+			}
+		}
+		if !hasInstall {
+			findings = append(findings, finding{
+				path:    []interface{}{"systemd", "units", i, key},
+				message: fmt.Sprintf("unit %s is enabled but has no [Install] section", unit.Name),
+			})
+		}
+	}
+	return findings
+}
+
+func hasInstallSection(contents string) bool {
+	for _, line := range strings.Split(contents, "\n") {
+		if strings.TrimSpace(line) == "[Install]" {
+			return true
+		}
+	}
+	return false
+}
+
+func checkRemoteFileWithoutHash(cfg types.Config, options interface{}) []finding {
+	var findings []finding
+	for i, file := range cfg.Storage.Files {
+		remote := file.Contents.Remote
+		if remote.Url == "" || remote.Verification.Hash.Sum != "" {
+			continue
+		}
+		// data urls carry their contents with them
+		if u, err := url.Parse(remote.Url); err == nil && u.Scheme == "data" {
+			continue
+		}
+		findings = append(findings, finding{
+			path:    []interface{}{"storage", "files", i, "contents", "remote", "url"},
+			message: fmt.Sprintf("file %s is fetched from %s without verification.hash", file.Path, remote.Url),
+		})
+	}
+	return findings
+}
+
+func checkContainerImageWithoutDigest(cfg types.Config, options interface{}) []finding {
+	var findings []finding
+	for i, container := range cfg.Containers {
+		if container.Image == "" || strings.Contains(container.Image, "@") {
+			continue
+		}
+		findings = append(findings, finding{
+			path:    []interface{}{"containers", i, "image"},
+			message: fmt.Sprintf("container %s runs image %s, which isn't pinned by digest", container.Name, container.Image),
+		})
+	}
+	return findings
+}
@@ -0,0 +1,103 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package localfs provides the file systems that the contents of local file
+// sources are read from.
+package localfs
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	ErrOutsideRoot = errors.New("local file path is outside of the files directory")
+)
+
+// FS is a read-only file system rooted at a single directory. Names passed to
+// it are slash separated and relative to its root.
+type FS interface {
+	ReadFile(name string) ([]byte, error)
+}
+
+// Clean resolves name against the root of a file system. A leading slash is
+// treated as the root. It returns ErrOutsideRoot if name refers to a file
+// outside of the root, e.g. ../../etc/shadow.
+func Clean(name string) (string, error) {
+	c := path.Clean(name)
+	if path.IsAbs(c) {
+		c = strings.TrimLeft(c, "/")
+		if c == "" {
+			c = "."
+		}
+	}
+	if c == ".." || strings.HasPrefix(c, "../") {
+		return "", ErrOutsideRoot
+	}
+	return c, nil
+}
+
+// Abs returns the absolute form of a path on disk, or the path itself if it
+// can't be made absolute. It is used to tell whether two paths name the same
+// file.
+func Abs(p string) string {
+	if abs, err := filepath.Abs(p); err == nil {
+		return abs
+	}
+	return p
+}
+
+// Dir is a file system backed by a directory on disk.
+type Dir string
+
+// ReadFile reads the named file from the directory. Symlinks are followed, but
+// only as long as they resolve to a file inside of the directory.
+func (d Dir) ReadFile(name string) ([]byte, error) {
+	c, err := Clean(name)
+	if err != nil {
+		return nil, err
+	}
+	root, err := filepath.EvalSymlinks(string(d))
+	if err != nil {
+		return nil, err
+	}
+	p, err := filepath.EvalSymlinks(filepath.Join(root, filepath.FromSlash(c)))
+	if err != nil {
+		return nil, err
+	}
+	if rel, err := filepath.Rel(root, p); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+		return nil, ErrOutsideRoot
+	}
+	return ioutil.ReadFile(p)
+}
+
+// Map is an in-memory file system, keyed by the cleaned path of each file.
+type Map map[string][]byte
+
+// ReadFile returns the contents of the named file.
+func (m Map) ReadFile(name string) ([]byte, error) {
+	c, err := Clean(name)
+	if err != nil {
+		return nil, err
+	}
+	contents, ok := m[c]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	return contents, nil
+}
@@ -0,0 +1,112 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package localfs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestClean(t *testing.T) {
+	tests := []struct {
+		in  string
+		out string
+		err error
+	}{
+		{"file", "file", nil},
+		{"a/b/../c", "a/c", nil},
+		{"/etc/file", "etc/file", nil},
+		{"/../etc/file", "etc/file", nil},
+		{"/", ".", nil},
+		{"..", "", ErrOutsideRoot},
+		{"../../etc/shadow", "", ErrOutsideRoot},
+		{"a/../../etc/shadow", "", ErrOutsideRoot},
+	}
+
+	for i, test := range tests {
+		out, err := Clean(test.in)
+		if out != test.out || err != test.err {
+			t.Errorf("#%d: wanted (%q, %v), got (%q, %v)", i, test.out, test.err, out, err)
+		}
+	}
+}
+
+func TestDir(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "ct-localfs")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	root := filepath.Join(tmp, "root")
+	if err := os.Mkdir(root, 0755); err != nil {
+		t.Fatalf("failed to create root: %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "inside"), []byte("inside"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(tmp, "outside"), []byte("outside"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	if err := os.Symlink("inside", filepath.Join(root, "good-link")); err != nil {
+		t.Fatalf("failed to create symlink: %v", err)
+	}
+	if err := os.Symlink("../outside", filepath.Join(root, "bad-link")); err != nil {
+		t.Fatalf("failed to create symlink: %v", err)
+	}
+
+	tests := []struct {
+		in  string
+		out string
+		err error
+	}{
+		{"inside", "inside", nil},
+		{"/inside", "inside", nil},
+		{"good-link", "inside", nil},
+		{"bad-link", "", ErrOutsideRoot},
+		{"../outside", "", ErrOutsideRoot},
+	}
+
+	for i, test := range tests {
+		out, err := Dir(root).ReadFile(test.in)
+		if string(out) != test.out || err != test.err {
+			t.Errorf("#%d: wanted (%q, %v), got (%q, %v)", i, test.out, test.err, out, err)
+		}
+	}
+
+	if _, err := Dir(root).ReadFile("missing"); !os.IsNotExist(err) {
+		t.Errorf("wanted a not exist error for a missing file, got %v", err)
+	}
+}
+
+func TestMap(t *testing.T) {
+	fs := Map{"dir/file": []byte("contents")}
+
+	for i, name := range []string{"dir/file", "/dir/file", "dir/../dir/file"} {
+		out, err := fs.ReadFile(name)
+		if string(out) != "contents" || err != nil {
+			t.Errorf("#%d: wanted (%q, nil), got (%q, %v)", i, "contents", out, err)
+		}
+	}
+
+	if _, err := fs.ReadFile("../dir/file"); err != ErrOutsideRoot {
+		t.Errorf("wanted %v, got %v", ErrOutsideRoot, err)
+	}
+	if _, err := fs.ReadFile("missing"); !os.IsNotExist(err) {
+		t.Errorf("wanted a not exist error for a missing file, got %v", err)
+	}
+}
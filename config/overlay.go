@@ -0,0 +1,555 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	yaml "github.com/ajeddeloh/yaml"
+	"github.com/coreos/container-linux-config-transpiler/config/astyaml"
+	"github.com/coreos/container-linux-config-transpiler/config/types"
+	"github.com/coreos/ignition/config/validate"
+	"github.com/coreos/ignition/config/validate/astnode"
+	"github.com/coreos/ignition/config/validate/report"
+)
+
+var (
+	ErrPatchTarget    = errors.New("patch has no target")
+	ErrPatchOperation = errors.New("patch needs exactly one of set, merge, remove and delete")
+	ErrPatchRemove    = errors.New("remove needs a list of values or names to remove from a list")
+)
+
+// overlay is a set of patches to a config.
+type overlay struct {
+	Patches []patch `yaml:"patches"`
+}
+
+// patch changes the value at Target, which is a path of yaml keys where list
+// entries are selected by their name, path or device in brackets, like
+// systemd.units[docker.service].dropins.
+type patch struct {
+	Target string `yaml:"target"`
+	// Set replaces the value.
+	Set interface{} `yaml:"set"`
+	// Merge is deep merged into the value, like included configs but
+	// replacing values instead of conflicting with them.
+	Merge interface{} `yaml:"merge"`
+	// Remove lists the values, or names of entries, to remove from a list.
+	Remove interface{} `yaml:"remove"`
+	// Delete removes the value, or the list entry.
+	Delete bool `yaml:"delete"`
+
+	// value is the decoded value of Set or Merge, once the patch is
+	// applied
+	value reflect.Value
+}
+
+// pathElement is a yaml key or, if entry is set, the natural key of a list
+// entry.
+type pathElement struct {
+	key   string
+	entry bool
+}
+
+// Overlay applies the patches of the overlay in data to cfg, in order. Patches
+// that target entries that don't exist yet create them, unless they remove
+// something. ast is the parse tree of cfg, and the returned tree is a copy of
+// it without the values the patches replaced or removed, so that it still
+// gives the positions in the base config of everything that came from there.
+// Values in patches are checked for unknown keys and unit contents like the
+// base config is.
+func Overlay(cfg types.Config, ast astnode.AstNode, data []byte) (types.Config, astnode.AstNode, report.Report) {
+	var o overlay
+	if err := yaml.Unmarshal(data, &o); err != nil {
+		return types.Config{}, nil, yamlErrorReport(err)
+	}
+	var root astnode.AstNode
+	if nodes := yaml.UnmarshalToNode(data); nodes != nil {
+		root, _ = astyaml.FromYamlDocumentNode(*nodes)
+	}
+
+	// patches modify lists and pointers in place, which cfg shares with
+	// the caller
+	cfg = deepCopy(reflect.ValueOf(cfg)).Interface().(types.Config)
+	var tree *yaml.Node
+	if base, ok := ast.(astyaml.YamlNode); ok {
+		base = base.Copy()
+		ast, tree = base, &base.Node
+	}
+
+	r := report.Report{}
+	for i := range o.Patches {
+		p := &o.Patches[i]
+		add := func(entry report.Entry, key string) {
+			n, ok := astyaml.NodeAt(root, "patches", i, key)
+			if !ok {
+				n, ok = astyaml.NodeAt(root, "patches", i)
+			}
+			if ok {
+				entry.Line, entry.Column, _ = n.ValueLineCol(nil)
+			}
+			r.Add(entry)
+		}
+
+		path, err := parseTarget(p.Target)
+		if err != nil {
+			add(report.Entry{Kind: report.EntryError, Message: err.Error()}, "target")
+			continue
+		}
+		op, key, err := p.operation()
+		if err != nil {
+			add(report.Entry{Kind: report.EntryError, Message: err.Error()}, "target")
+			continue
+		}
+		units := unitContents(cfg)
+		warnings, err := applyPatch(reflect.ValueOf(&cfg).Elem(), tree, path, op, p.Delete || p.Remove != nil)
+		if err != nil {
+			add(report.Entry{Kind: report.EntryError, Message: fmt.Sprintf("%s: %v", p.Target, err)}, key)
+			continue
+		}
+		for _, warning := range warnings {
+			add(report.Entry{Kind: report.EntryWarning, Message: fmt.Sprintf("%s: %s", p.Target, warning)}, key)
+		}
+		if p.value.IsValid() {
+			valueNode, _ := astyaml.NodeAt(root, "patches", i, key)
+			if n, ok := valueNode.(astyaml.YamlNode); ok {
+				r.Merge(checkUnknownKeys(n, p.value, false))
+			}
+			c := unitChecker{root: valueNode}
+			forEachUnit(cfg, func(name, contents string, _ []interface{}) {
+				if !units[unitContentsKey(name, contents)] {
+					c.check(name, contents)
+				}
+			})
+			r.Merge(c.r)
+		}
+	}
+	if r.IsFatal() {
+		return types.Config{}, nil, r
+	}
+
+	// the patched values have no position in the base config
+	r.Merge(validate.ValidateWithoutSource(reflect.ValueOf(cfg)))
+	if r.IsFatal() {
+		return types.Config{}, nil, r
+	}
+	return cfg, ast, r
+}
+
+// patchOp changes a value. n is the node of the value in the parse tree of the
+// base config, nil if it has none, and is changed along with it. remove, if
+// set, removes the value from the list or map containing it. It returns
+// warnings about parts of the patch that had no effect.
+type patchOp func(v reflect.Value, n *yaml.Node, remove func()) ([]string, error)
+
+// operation returns the function applying the patch and the key of its
+// operation.
+func (p *patch) operation() (patchOp, string, error) {
+	ops := 0
+	for _, set := range []bool{p.Set != nil, p.Merge != nil, p.Remove != nil, p.Delete} {
+		if set {
+			ops++
+		}
+	}
+	if ops != 1 {
+		return nil, "", ErrPatchOperation
+	}
+
+	switch {
+	case p.Set != nil:
+		return func(v reflect.Value, n *yaml.Node, _ func()) ([]string, error) {
+			value, err := decodeValue(p.Set, v.Type())
+			if err != nil {
+				return nil, err
+			}
+			v.Set(value)
+			clearNode(n)
+			p.value = value
+			return nil, nil
+		}, "set", nil
+	case p.Merge != nil:
+		return func(v reflect.Value, _ *yaml.Node, _ func()) ([]string, error) {
+			value, err := decodeValue(p.Merge, v.Type())
+			if err != nil {
+				return nil, err
+			}
+			m := merger{origins: map[string]origin{}, override: true}
+			m.merge(v, value, "", origin{})
+			p.value = value
+			return nil, nil
+		}, "merge", nil
+	case p.Remove != nil:
+		return func(v reflect.Value, n *yaml.Node, _ func()) ([]string, error) {
+			return removeEntries(v, n, p.Remove)
+		}, "remove", nil
+	default:
+		return func(v reflect.Value, n *yaml.Node, remove func()) ([]string, error) {
+			if remove != nil {
+				remove()
+			} else {
+				v.Set(reflect.Zero(v.Type()))
+				clearNode(n)
+			}
+			return nil, nil
+		}, "delete", nil
+	}
+}
+
+// parseTarget splits a target like systemd.units[docker.service].contents
+// into its elements.
+func parseTarget(target string) ([]pathElement, error) {
+	if target == "" {
+		return nil, ErrPatchTarget
+	}
+	var path []pathElement
+	for rest := target; rest != ""; {
+		switch {
+		case rest[0] == '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 2 {
+				return nil, fmt.Errorf("invalid target %q", target)
+			}
+			path = append(path, pathElement{key: rest[1:end], entry: true})
+			rest = rest[end+1:]
+		case rest[0] == '.' && len(path) > 0:
+			rest = rest[1:]
+		default:
+			end := strings.IndexAny(rest, ".[")
+			if end == -1 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("invalid target %q", target)
+			}
+			path = append(path, pathElement{key: rest[:end]})
+			rest = rest[end:]
+		}
+	}
+	return path, nil
+}
+
+// applyPatch walks v, and n alongside it, along path and applies op to the
+// value at its end. If mustExist is set, missing values are errors rather
+// than created.
+func applyPatch(v reflect.Value, n *yaml.Node, path []pathElement, op patchOp, mustExist bool) ([]string, error) {
+	if len(path) == 0 {
+		return op(v, n, nil)
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			if mustExist {
+				return nil, errors.New("target not found")
+			}
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return applyPatch(v.Elem(), n, path, op, mustExist)
+	case reflect.Interface:
+		if v.IsNil() {
+			return nil, errors.New("target not found")
+		}
+		// values in interfaces can't be modified in place
+		elem := reflect.New(v.Elem().Type()).Elem()
+		elem.Set(v.Elem())
+		warnings, err := applyPatch(elem, n, path, op, mustExist)
+		v.Set(elem)
+		return warnings, err
+	}
+
+	head := path[0]
+	if head.entry {
+		if v.Kind() != reflect.Slice || v.Type().Elem().Kind() != reflect.Struct {
+			return nil, fmt.Errorf("[%s] doesn't select a list entry", head.key)
+		}
+		index := -1
+		for i := 0; i < v.Len(); i++ {
+			if key, ok := naturalKey(v.Index(i)); ok && key == head.key {
+				index = i
+			}
+		}
+		if index == -1 {
+			if mustExist {
+				return nil, fmt.Errorf("no entry %s", head.key)
+			}
+			entry := reflect.New(v.Type().Elem()).Elem()
+			if !setNaturalKey(entry, head.key) {
+				return nil, fmt.Errorf("entries of the list can't be selected by name")
+			}
+			v.Set(reflect.Append(v, entry))
+			index = v.Len() - 1
+		}
+		child := sequenceItem(n, index)
+		if len(path) > 1 {
+			return applyPatch(v.Index(index), child, path[1:], op, mustExist)
+		}
+		removed := false
+		warnings, err := op(v.Index(index), child, func() {
+			v.Set(reflect.AppendSlice(v.Slice(0, index), v.Slice(index+1, v.Len())))
+			removeItem(n, index)
+			removed = true
+		})
+		if !removed {
+			// the entry is still the one the target selected, even if
+			// its value was replaced
+			setNaturalKey(v.Index(index), head.key)
+		}
+		return warnings, err
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		field, embedded, ok := fieldByKey(v, head.key)
+		if !ok {
+			return nil, fmt.Errorf("unknown key %s", head.key)
+		}
+		if embedded {
+			return applyPatch(field, n, path, op, mustExist)
+		}
+		if len(path) > 1 && field.Kind() == reflect.Ptr && field.IsNil() && hasOptions(field.Type().Elem()) {
+			// the keys of sections like etcd depend on their version
+			return nil, fmt.Errorf("the config has no %s section", head.key)
+		}
+		return applyPatch(field, mappingValue(n, head.key), path[1:], op, mustExist)
+	case reflect.Map:
+		key := reflect.ValueOf(head.key).Convert(v.Type().Key())
+		elem := reflect.New(v.Type().Elem()).Elem()
+		if existing := v.MapIndex(key); existing.IsValid() {
+			elem.Set(existing)
+		} else if mustExist {
+			return nil, fmt.Errorf("no entry %s", head.key)
+		} else if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		// map elements can't be modified in place
+		removed := false
+		var warnings []string
+		var err error
+		child := mappingValue(n, head.key)
+		if len(path) == 1 {
+			warnings, err = op(elem, child, func() { removed = true })
+		} else {
+			warnings, err = applyPatch(elem, child, path[1:], op, mustExist)
+		}
+		if removed {
+			v.SetMapIndex(key, reflect.Value{})
+			removeKey(n, head.key)
+		} else {
+			v.SetMapIndex(key, elem)
+		}
+		return warnings, err
+	}
+	return nil, fmt.Errorf("%s is not a mapping", head.key)
+}
+
+// fieldByKey returns the field of a struct with the given yaml key. For fields
+// of embedded structs, like the version specific etcd options, it returns the
+// embedded field containing it and sets embedded.
+func fieldByKey(v reflect.Value, key string) (field reflect.Value, embedded bool, ok bool) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous {
+			inner := v.Field(i)
+			if inner.Kind() == reflect.Interface && !inner.IsNil() {
+				inner = inner.Elem()
+			}
+			if inner.Kind() == reflect.Struct {
+				if _, _, ok := fieldByKey(inner, key); ok {
+					return v.Field(i), true, true
+				}
+			}
+			continue
+		}
+		if strings.Split(f.Tag.Get("yaml"), ",")[0] == key {
+			return v.Field(i), false, true
+		}
+	}
+	return reflect.Value{}, false, false
+}
+
+// hasOptions returns whether the fields of a struct type include version
+// specific options, which are only known once the version is.
+func hasOptions(t reflect.Type) bool {
+	if t.Kind() != reflect.Struct {
+		return false
+	}
+	for i := 0; i < t.NumField(); i++ {
+		if f := t.Field(i); f.Anonymous && f.Type.Kind() == reflect.Interface {
+			return true
+		}
+	}
+	return false
+}
+
+// setNaturalKey sets the field naturalKey reads on a new list entry.
+func setNaturalKey(v reflect.Value, key string) bool {
+	for _, name := range []string{"Name", "Path", "Device", "Source"} {
+		f := v.FieldByName(name)
+		if !f.IsValid() || f.Kind() != reflect.String {
+			continue
+		}
+		if fs := v.FieldByName("Filesystem"); name == "Path" && fs.IsValid() {
+			if i := strings.Index(key, ":"); i > 0 && !strings.HasPrefix(key, "/") {
+				fs.SetString(key[:i])
+				key = key[i+1:]
+			}
+		}
+		f.SetString(key)
+		return true
+	}
+	return false
+}
+
+// removeEntries removes the given values from a list of scalars, or the
+// entries with the given names from a list of structs, and their nodes from n.
+func removeEntries(v reflect.Value, n *yaml.Node, remove interface{}) ([]string, error) {
+	values, ok := remove.([]interface{})
+	if !ok || v.Kind() != reflect.Slice {
+		return nil, ErrPatchRemove
+	}
+	var warnings []string
+	for _, value := range values {
+		found := false
+		for i := 0; i < v.Len(); i++ {
+			elem := v.Index(i)
+			var match bool
+			if elem.Kind() == reflect.Struct {
+				key, ok := naturalKey(elem)
+				match = ok && key == fmt.Sprint(value)
+			} else {
+				decoded, err := decodeValue(value, elem.Type())
+				match = err == nil && reflect.DeepEqual(decoded.Interface(), elem.Interface())
+			}
+			if match {
+				v.Set(reflect.AppendSlice(v.Slice(0, i), v.Slice(i+1, v.Len())))
+				removeItem(n, i)
+				found = true
+				break
+			}
+		}
+		if !found {
+			warnings = append(warnings, fmt.Sprintf("%v is not in the list", value))
+		}
+	}
+	return warnings, nil
+}
+
+// mappingValue returns the value of key in a mapping node, or nil if n isn't a
+// mapping or has no such key.
+func mappingValue(n *yaml.Node, key string) *yaml.Node {
+	if n == nil || n.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Children); i += 2 {
+		if n.Children[i].Value == key {
+			return n.Children[i+1]
+		}
+	}
+	return nil
+}
+
+// sequenceItem returns the item of a sequence node at index, or nil if n isn't
+// a sequence or is shorter.
+func sequenceItem(n *yaml.Node, index int) *yaml.Node {
+	if n == nil || n.Kind != yaml.SequenceNode || index >= len(n.Children) {
+		return nil
+	}
+	return n.Children[index]
+}
+
+// removeItem removes the item at index from a sequence node, if it has one.
+func removeItem(n *yaml.Node, index int) {
+	if sequenceItem(n, index) != nil {
+		n.Children = append(n.Children[:index], n.Children[index+1:]...)
+	}
+}
+
+// removeKey removes key and its value from a mapping node, if it has them.
+func removeKey(n *yaml.Node, key string) {
+	if n == nil || n.Kind != yaml.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(n.Children); i += 2 {
+		if n.Children[i].Value == key {
+			n.Children = append(n.Children[:i], n.Children[i+2:]...)
+			return
+		}
+	}
+}
+
+// clearNode removes the value and children of a node whose value was
+// replaced, keeping its position for entries about the value as a whole.
+func clearNode(n *yaml.Node) {
+	if n != nil {
+		*n = yaml.Node{Kind: n.Kind, Line: n.Line, Column: n.Column}
+	}
+}
+
+// decodeValue converts a value from an overlay into the given type, as if it
+// were part of a config.
+func decodeValue(value interface{}, t reflect.Type) (reflect.Value, error) {
+	data, err := yaml.Marshal(value)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	v := reflect.New(t)
+	if err := yaml.Unmarshal(data, v.Interface()); err != nil {
+		return reflect.Value{}, err
+	}
+	return v.Elem(), nil
+}
+
+// deepCopy returns a copy of v that shares no pointers, lists or maps with it.
+func deepCopy(v reflect.Value) reflect.Value {
+	c := reflect.New(v.Type()).Elem()
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			c.Set(reflect.New(v.Type().Elem()))
+			c.Elem().Set(deepCopy(v.Elem()))
+		}
+	case reflect.Interface:
+		if !v.IsNil() {
+			c.Set(deepCopy(v.Elem()))
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if c.Field(i).CanSet() {
+				c.Field(i).Set(deepCopy(v.Field(i)))
+			}
+		}
+	case reflect.Slice:
+		if !v.IsNil() {
+			c.Set(reflect.MakeSlice(v.Type(), v.Len(), v.Len()))
+			for i := 0; i < v.Len(); i++ {
+				c.Index(i).Set(deepCopy(v.Index(i)))
+			}
+		}
+	case reflect.Map:
+		if !v.IsNil() {
+			c.Set(reflect.MakeMap(v.Type()))
+			for _, key := range v.MapKeys() {
+				c.SetMapIndex(key, deepCopy(v.MapIndex(key)))
+			}
+		}
+	default:
+		c.Set(v)
+	}
+	return c
+}
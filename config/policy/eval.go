@@ -0,0 +1,448 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// Values of expressions are nil, bool, float64, string, []interface{} or
+// map[string]interface{}, like the values encoding/json decodes.
+
+// expr is a parsed expression.
+type expr interface {
+	eval(vars map[string]interface{}) (interface{}, error)
+}
+
+type literalExpr struct {
+	value interface{}
+}
+
+func (e literalExpr) eval(vars map[string]interface{}) (interface{}, error) {
+	return e.value, nil
+}
+
+type identExpr struct {
+	name string
+}
+
+func (e identExpr) eval(vars map[string]interface{}) (interface{}, error) {
+	return vars[e.name], nil
+}
+
+type listExpr struct {
+	elements []expr
+}
+
+func (e listExpr) eval(vars map[string]interface{}) (interface{}, error) {
+	list := make([]interface{}, 0, len(e.elements))
+	for _, element := range e.elements {
+		v, err := element.eval(vars)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+	}
+	return list, nil
+}
+
+// memberExpr accesses a field. Fields that aren't set, and fields of null,
+// are null, so that optional sections don't need to be checked first.
+type memberExpr struct {
+	object expr
+	name   string
+}
+
+func (e memberExpr) eval(vars map[string]interface{}) (interface{}, error) {
+	object, err := e.object.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	switch object := object.(type) {
+	case nil:
+		return nil, nil
+	case map[string]interface{}:
+		return object[e.name], nil
+	}
+	return nil, fmt.Errorf("can't access field %s of a %s", e.name, typeName(object))
+}
+
+// indexExpr indexes a list or map. Indices out of range are null, like
+// missing fields.
+type indexExpr struct {
+	object expr
+	index  expr
+}
+
+func (e indexExpr) eval(vars map[string]interface{}) (interface{}, error) {
+	object, err := e.object.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	index, err := e.index.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	switch object := object.(type) {
+	case nil:
+		return nil, nil
+	case []interface{}:
+		i, ok := index.(float64)
+		if !ok || i != float64(int(i)) {
+			return nil, fmt.Errorf("lists can't be indexed with a %s", typeName(index))
+		}
+		if i < 0 || int(i) >= len(object) {
+			return nil, nil
+		}
+		return object[int(i)], nil
+	case map[string]interface{}:
+		key, ok := index.(string)
+		if !ok {
+			return nil, fmt.Errorf("maps can't be indexed with a %s", typeName(index))
+		}
+		return object[key], nil
+	}
+	return nil, fmt.Errorf("can't index a %s", typeName(object))
+}
+
+type unaryExpr struct {
+	op      string
+	operand expr
+}
+
+func (e unaryExpr) eval(vars map[string]interface{}) (interface{}, error) {
+	v, err := e.operand.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	switch v := v.(type) {
+	case bool:
+		if e.op == "!" {
+			return !v, nil
+		}
+	case float64:
+		if e.op == "-" {
+			return -v, nil
+		}
+	}
+	return nil, fmt.Errorf("can't apply %s to a %s", e.op, typeName(v))
+}
+
+type binaryExpr struct {
+	op          string
+	left, right expr
+}
+
+func (e binaryExpr) eval(vars map[string]interface{}) (interface{}, error) {
+	left, err := e.left.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+
+	if e.op == "&&" || e.op == "||" {
+		l, ok := left.(bool)
+		if !ok {
+			return nil, fmt.Errorf("can't apply %s to a %s", e.op, typeName(left))
+		}
+		if (e.op == "&&" && !l) || (e.op == "||" && l) {
+			return l, nil
+		}
+		right, err := e.right.eval(vars)
+		if err != nil {
+			return nil, err
+		}
+		r, ok := right.(bool)
+		if !ok {
+			return nil, fmt.Errorf("can't apply %s to a %s", e.op, typeName(right))
+		}
+		return r, nil
+	}
+
+	right, err := e.right.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	switch e.op {
+	case "==":
+		return reflect.DeepEqual(left, right), nil
+	case "!=":
+		return !reflect.DeepEqual(left, right), nil
+	case "in":
+		switch right := right.(type) {
+		case []interface{}:
+			for _, element := range right {
+				if reflect.DeepEqual(left, element) {
+					return true, nil
+				}
+			}
+			return false, nil
+		case map[string]interface{}:
+			if key, ok := left.(string); ok {
+				_, found := right[key]
+				return found, nil
+			}
+		case nil:
+			return false, nil
+		}
+	case "<", "<=", ">", ">=":
+		switch l := left.(type) {
+		case float64:
+			if r, ok := right.(float64); ok {
+				return compared(e.op, compare(l < r, l > r)), nil
+			}
+		case string:
+			if r, ok := right.(string); ok {
+				return compared(e.op, compare(l < r, l > r)), nil
+			}
+		}
+	case "+":
+		switch l := left.(type) {
+		case float64:
+			if r, ok := right.(float64); ok {
+				return l + r, nil
+			}
+		case string:
+			if r, ok := right.(string); ok {
+				return l + r, nil
+			}
+		case []interface{}:
+			if r, ok := right.([]interface{}); ok {
+				return append(append([]interface{}{}, l...), r...), nil
+			}
+		}
+	case "-":
+		l, lok := left.(float64)
+		r, rok := right.(float64)
+		if lok && rok {
+			return l - r, nil
+		}
+	}
+	return nil, fmt.Errorf("can't apply %s to a %s and a %s", e.op, typeName(left), typeName(right))
+}
+
+func compare(less, greater bool) int {
+	switch {
+	case less:
+		return -1
+	case greater:
+		return 1
+	}
+	return 0
+}
+
+func compared(op string, c int) bool {
+	switch op {
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	}
+	return c >= 0
+}
+
+type callExpr struct {
+	name     string
+	receiver expr
+	args     []expr
+}
+
+// function is a function or method of expressions. Methods get the value
+// they are called on as their first argument. String methods are false when
+// called on null, like fields that aren't set.
+type function struct {
+	args int
+	call func(args []interface{}) (interface{}, error)
+}
+
+var (
+	globalFunctions = map[string]function{
+		"size": {1, size},
+	}
+	methods = map[string]function{
+		"size":       {1, size},
+		"startsWith": {2, stringFunction(strings.HasPrefix)},
+		"endsWith":   {2, stringFunction(strings.HasSuffix)},
+		"contains":   {2, contains},
+		"matches":    {2, matches},
+	}
+	macros = map[string]bool{
+		"all":    true,
+		"exists": true,
+		"filter": true,
+	}
+)
+
+func (e callExpr) eval(vars map[string]interface{}) (interface{}, error) {
+	var args []interface{}
+	f := globalFunctions[e.name]
+	if e.receiver != nil {
+		f = methods[e.name]
+		receiver, err := e.receiver.eval(vars)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, receiver)
+	}
+	for _, arg := range e.args {
+		v, err := arg.eval(vars)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, v)
+	}
+	v, err := f.call(args)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", e.name, err)
+	}
+	return v, nil
+}
+
+func size(args []interface{}) (interface{}, error) {
+	switch v := args[0].(type) {
+	case nil:
+		return float64(0), nil
+	case string:
+		return float64(len(v)), nil
+	case []interface{}:
+		return float64(len(v)), nil
+	case map[string]interface{}:
+		return float64(len(v)), nil
+	}
+	return nil, fmt.Errorf("a %s has no size", typeName(args[0]))
+}
+
+func stringFunction(f func(s, arg string) bool) func(args []interface{}) (interface{}, error) {
+	return func(args []interface{}) (interface{}, error) {
+		if args[0] == nil {
+			return false, nil
+		}
+		s, sok := args[0].(string)
+		arg, argok := args[1].(string)
+		if !sok || !argok {
+			return nil, fmt.Errorf("expected strings, got a %s and a %s", typeName(args[0]), typeName(args[1]))
+		}
+		return f(s, arg), nil
+	}
+}
+
+// contains works on strings, lists and maps. Null contains nothing.
+func contains(args []interface{}) (interface{}, error) {
+	if _, ok := args[0].(string); ok {
+		return stringFunction(strings.Contains)(args)
+	}
+	return binaryExpr{op: "in", left: literalExpr{args[1]}, right: literalExpr{args[0]}}.eval(nil)
+}
+
+func matches(args []interface{}) (interface{}, error) {
+	if args[0] == nil {
+		return false, nil
+	}
+	s, sok := args[0].(string)
+	pattern, pok := args[1].(string)
+	if !sok || !pok {
+		return nil, fmt.Errorf("expected strings, got a %s and a %s", typeName(args[0]), typeName(args[1]))
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return re.MatchString(s), nil
+}
+
+// macroExpr evaluates body for each element of a list, with the element
+// bound to variable: all is true if body is true for every element, exists
+// if it is for any element, and filter returns the elements it is true for.
+// Null is an empty list.
+type macroExpr struct {
+	name     string
+	list     expr
+	variable string
+	body     expr
+}
+
+func (e macroExpr) eval(vars map[string]interface{}) (interface{}, error) {
+	v, err := e.list.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	var list []interface{}
+	switch v := v.(type) {
+	case nil:
+	case []interface{}:
+		list = v
+	case map[string]interface{}:
+		// like in CEL, macros on maps range over the keys
+		for key := range v {
+			list = append(list, key)
+		}
+	default:
+		return nil, fmt.Errorf("%s: can't range over a %s", e.name, typeName(v))
+	}
+
+	scope := make(map[string]interface{}, len(vars)+1)
+	for name, value := range vars {
+		scope[name] = value
+	}
+	filtered := []interface{}{}
+	for _, element := range list {
+		scope[e.variable] = element
+		result, err := e.body.eval(scope)
+		if err != nil {
+			return nil, err
+		}
+		b, ok := result.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%s: expected a bool, got a %s", e.name, typeName(result))
+		}
+		switch {
+		case e.name == "all" && !b:
+			return false, nil
+		case e.name == "exists" && b:
+			return true, nil
+		case e.name == "filter" && b:
+			filtered = append(filtered, element)
+		}
+	}
+	switch e.name {
+	case "all":
+		return true, nil
+	case "exists":
+		return false, nil
+	}
+	return filtered, nil
+}
+
+func typeName(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "bool"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "list"
+	case map[string]interface{}:
+		return "map"
+	}
+	return fmt.Sprintf("%T", v)
+}
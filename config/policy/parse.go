@@ -0,0 +1,394 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenNumber
+	tokenString
+	tokenOperator
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	// value is the value of number and string literals
+	value interface{}
+	// column is the column the token starts at, from 1
+	column int
+}
+
+// operators are the operators and punctuation of expressions, longest first
+// so that "<=" isn't read as "<".
+var operators = []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!", "+", "-", "(", ")", "[", "]", ".", ","}
+
+// lex splits an expression into tokens.
+func lex(s string) ([]token, error) {
+	var tokens []token
+	i := 0
+	for i < len(s) {
+		c := rune(s[i])
+		column := i + 1
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '_' || unicode.IsLetter(c):
+			start := i
+			for i < len(s) && (s[i] == '_' || unicode.IsLetter(rune(s[i])) || unicode.IsDigit(rune(s[i]))) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: s[start:i], column: column})
+		case unicode.IsDigit(c):
+			start := i
+			for i < len(s) && (s[i] == '.' || s[i] == 'x' || s[i] == 'X' || unicode.IsDigit(rune(s[i])) || strings.ContainsRune("abcdefABCDEF", rune(s[i]))) {
+				i++
+			}
+			text := s[start:i]
+			// integers may be octal like file modes, or hexadecimal
+			var value float64
+			if n, err := strconv.ParseInt(text, 0, 64); err == nil {
+				value = float64(n)
+			} else if f, err := strconv.ParseFloat(text, 64); err == nil {
+				value = f
+			} else {
+				return nil, fmt.Errorf("column %d: invalid number %q", column, text)
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: text, value: value, column: column})
+		case c == '"' || c == '\'':
+			end := i + 1
+			for end < len(s) && rune(s[end]) != c {
+				if s[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(s) {
+				return nil, fmt.Errorf("column %d: unterminated string", column)
+			}
+			body := s[i+1 : end]
+			if c == '\'' {
+				body = strings.Replace(strings.Replace(body, `\'`, `'`, -1), `"`, `\"`, -1)
+			}
+			value, err := strconv.Unquote(`"` + body + `"`)
+			if err != nil {
+				return nil, fmt.Errorf("column %d: invalid string %s", column, s[i:end+1])
+			}
+			tokens = append(tokens, token{kind: tokenString, text: s[i : end+1], value: value, column: column})
+			i = end + 1
+		default:
+			matched := false
+			for _, op := range operators {
+				if strings.HasPrefix(s[i:], op) {
+					tokens = append(tokens, token{kind: tokenOperator, text: op, column: column})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("column %d: unexpected character %q", column, c)
+			}
+		}
+	}
+	return append(tokens, token{kind: tokenEOF, column: len(s) + 1}), nil
+}
+
+// parser parses expressions by recursive descent. Operators bind, from
+// loosest to tightest: ||, &&, comparisons and in, + and -, unary ! and -,
+// then field access, indexing and calls.
+type parser struct {
+	tokens []token
+	pos    int
+	// scope holds the identifiers that are defined
+	scope map[string]int
+}
+
+// parseExpr parses the expression in s, in which the identifiers in vars are
+// defined.
+func parseExpr(s string, vars ...string) (expr, error) {
+	tokens, err := lex(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens, scope: map[string]int{}}
+	for _, v := range vars {
+		p.scope[v]++
+	}
+	e, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, p.unexpected(t)
+	}
+	return e, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+// accept consumes the next token if it is one of ops.
+func (p *parser) accept(ops ...string) (string, bool) {
+	t := p.peek()
+	if t.kind != tokenOperator && !(t.kind == tokenIdent && t.text == "in") {
+		return "", false
+	}
+	for _, op := range ops {
+		if t.text == op {
+			p.pos++
+			return op, true
+		}
+	}
+	return "", false
+}
+
+func (p *parser) expect(op string) error {
+	if _, ok := p.accept(op); !ok {
+		return p.unexpected(p.peek())
+	}
+	return nil
+}
+
+func (p *parser) unexpected(t token) error {
+	if t.kind == tokenEOF {
+		return fmt.Errorf("column %d: unexpected end of expression", t.column)
+	}
+	return fmt.Errorf("column %d: unexpected %q", t.column, t.text)
+}
+
+func (p *parser) or() (expr, error) {
+	return p.binary(p.and, "||")
+}
+
+func (p *parser) and() (expr, error) {
+	return p.binary(p.comparison, "&&")
+}
+
+func (p *parser) comparison() (expr, error) {
+	left, err := p.additive()
+	if err != nil {
+		return nil, err
+	}
+	if op, ok := p.accept("==", "!=", "<", "<=", ">", ">=", "in"); ok {
+		right, err := p.additive()
+		if err != nil {
+			return nil, err
+		}
+		return binaryExpr{op: op, left: left, right: right}, nil
+	}
+	return left, nil
+}
+
+func (p *parser) additive() (expr, error) {
+	return p.binary(p.unary, "+", "-")
+}
+
+// binary parses left associative operators whose operands are parsed by
+// operand.
+func (p *parser) binary(operand func() (expr, error), ops ...string) (expr, error) {
+	left, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.accept(ops...)
+		if !ok {
+			return left, nil
+		}
+		right, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryExpr{op: op, left: left, right: right}
+	}
+}
+
+func (p *parser) unary() (expr, error) {
+	if op, ok := p.accept("!", "-"); ok {
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return unaryExpr{op: op, operand: operand}, nil
+	}
+	return p.postfix()
+}
+
+func (p *parser) postfix() (expr, error) {
+	e, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.accept("."); ok {
+			t := p.next()
+			if t.kind != tokenIdent {
+				return nil, p.unexpected(t)
+			}
+			if _, ok := p.accept("("); ok {
+				e, err = p.call(t, e)
+				if err != nil {
+					return nil, err
+				}
+			} else {
+				e = memberExpr{object: e, name: t.text}
+			}
+		} else if _, ok := p.accept("["); ok {
+			index, err := p.or()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			e = indexExpr{object: e, index: index}
+		} else {
+			return e, nil
+		}
+	}
+}
+
+func (p *parser) primary() (expr, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenNumber, tokenString:
+		return literalExpr{value: t.value}, nil
+	case tokenIdent:
+		switch t.text {
+		case "true":
+			return literalExpr{value: true}, nil
+		case "false":
+			return literalExpr{value: false}, nil
+		case "null":
+			return literalExpr{value: nil}, nil
+		}
+		if _, ok := p.accept("("); ok {
+			return p.call(t, nil)
+		}
+		if p.scope[t.text] == 0 {
+			return nil, fmt.Errorf("column %d: unknown identifier %q", t.column, t.text)
+		}
+		return identExpr{name: t.text}, nil
+	case tokenOperator:
+		switch t.text {
+		case "(":
+			e, err := p.or()
+			if err != nil {
+				return nil, err
+			}
+			return e, p.expect(")")
+		case "[":
+			var list listExpr
+			if _, ok := p.accept("]"); ok {
+				return list, nil
+			}
+			for {
+				e, err := p.or()
+				if err != nil {
+					return nil, err
+				}
+				list.elements = append(list.elements, e)
+				if _, ok := p.accept("]"); ok {
+					return list, nil
+				}
+				if err := p.expect(","); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return nil, p.unexpected(t)
+}
+
+// call parses the arguments of a call to the function named by t, after the
+// opening parenthesis. receiver is the value the function is called on, nil
+// for calls like size(x).
+func (p *parser) call(t token, receiver expr) (expr, error) {
+	name := t.text
+	f, ok := globalFunctions[name]
+	args := f.args
+	if receiver != nil {
+		if macros[name] {
+			return p.macro(t, receiver)
+		}
+		f, ok = methods[name]
+		args = f.args - 1
+	}
+	if !ok {
+		return nil, fmt.Errorf("column %d: unknown function %q", t.column, name)
+	}
+
+	c := callExpr{name: name, receiver: receiver}
+	if _, ok := p.accept(")"); !ok {
+		for {
+			arg, err := p.or()
+			if err != nil {
+				return nil, err
+			}
+			c.args = append(c.args, arg)
+			if _, ok := p.accept(")"); ok {
+				break
+			}
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(c.args) != args {
+		return nil, fmt.Errorf("column %d: %s takes %d arguments, not %d", t.column, name, args, len(c.args))
+	}
+	return c, nil
+}
+
+// macro parses the arguments of a macro like list.all(x, x > 1), whose first
+// argument names a variable defined in the second.
+func (p *parser) macro(t token, receiver expr) (expr, error) {
+	v := p.next()
+	if v.kind != tokenIdent {
+		return nil, fmt.Errorf("column %d: %s needs a variable name as its first argument", t.column, t.text)
+	}
+	if err := p.expect(","); err != nil {
+		return nil, err
+	}
+	p.scope[v.text]++
+	body, err := p.or()
+	p.scope[v.text]--
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	return macroExpr{name: t.text, list: receiver, variable: v.text, body: body}, nil
+}
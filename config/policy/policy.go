@@ -0,0 +1,411 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package policy checks configs against policies written by their users, like
+// "only core may have a password". Policies are expressions over the
+// Container Linux Config and the Ignition config generated from it.
+package policy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	yaml "github.com/ajeddeloh/yaml"
+	"github.com/coreos/container-linux-config-transpiler/config/astyaml"
+	"github.com/coreos/container-linux-config-transpiler/config/types"
+	ignTypes "github.com/coreos/ignition/config/v2_3/types"
+	"github.com/coreos/ignition/config/validate/astnode"
+	"github.com/coreos/ignition/config/validate/report"
+)
+
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+	SeverityInfo    = "info"
+)
+
+// The roots policies are evaluated against.
+const (
+	rootConfig   = "config"
+	rootIgnition = "ignition"
+	self         = "self"
+)
+
+var (
+	// Severities are the severities a policy can have.
+	Severities = []string{SeverityError, SeverityWarning, SeverityInfo}
+
+	ErrNoID            = errors.New("policy has no id")
+	ErrNoRequire       = errors.New("policy has no require expression")
+	ErrUnknownSeverity = fmt.Errorf("unknown severity, accepted values: %v", Severities)
+	ErrForEachRoot     = fmt.Errorf("for_each must start with %s or %s", rootConfig, rootIgnition)
+)
+
+// Policy is a requirement configs must meet, like:
+//
+//	id: no-passwords
+//	description: Only core may log in with a password.
+//	for_each: config.passwd.users
+//	when: self.name != "core"
+//	require: self.password_hash == null
+//
+// Require is checked for every element of the list named by for_each, which
+// is bound to self, that when is true for. The list is in the Container Linux
+// Config if it starts with config and in the Ignition config if it starts
+// with ignition. If for_each names a single value like config.etcd, it is
+// checked if it is set. Policies without for_each are checked once.
+type Policy struct {
+	ID          string `yaml:"id"`
+	Description string `yaml:"description"`
+	// Severity is the severity of violations, error unless set
+	Severity string `yaml:"severity"`
+	ForEach  string `yaml:"for_each"`
+	When     string `yaml:"when"`
+	Require  string `yaml:"require"`
+
+	forEach []string
+	when    expr
+	require expr
+}
+
+// policyFile is the format of policy files.
+type policyFile struct {
+	Policies []Policy `yaml:"policies"`
+}
+
+// Parse parses a policy file.
+func Parse(data []byte) ([]Policy, error) {
+	var file policyFile
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return nil, err
+	}
+	for i := range file.Policies {
+		if err := file.Policies[i].compile(); err != nil {
+			name := file.Policies[i].ID
+			if name == "" {
+				name = fmt.Sprintf("policies[%d]", i)
+			}
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	return file.Policies, nil
+}
+
+// compile checks a policy and parses its expressions.
+func (p *Policy) compile() error {
+	if p.ID == "" {
+		return ErrNoID
+	}
+	if p.Require == "" {
+		return ErrNoRequire
+	}
+	switch p.Severity {
+	case "":
+		p.Severity = SeverityError
+	case SeverityError, SeverityWarning, SeverityInfo:
+	default:
+		return ErrUnknownSeverity
+	}
+
+	vars := []string{rootConfig, rootIgnition}
+	if p.ForEach != "" {
+		p.forEach = strings.Split(p.ForEach, ".")
+		if root := p.forEach[0]; root != rootConfig && root != rootIgnition {
+			return ErrForEachRoot
+		}
+		vars = append(vars, self)
+	}
+
+	var err error
+	if p.When != "" {
+		if p.when, err = parseExpr(p.When, vars...); err != nil {
+			return fmt.Errorf("when: %v", err)
+		}
+	}
+	if p.require, err = parseExpr(p.Require, vars...); err != nil {
+		return fmt.Errorf("require: %v", err)
+	}
+	return nil
+}
+
+// Input is what policies are checked against.
+type Input struct {
+	Config types.Config
+	// AST is the parse tree of Config, used to position violations in the
+	// Container Linux Config. It may be nil.
+	AST      astnode.AstNode
+	Ignition ignTypes.Config
+	// SourceMap is used to position violations in the Ignition config. It
+	// may be nil.
+	SourceMap types.SourceMap
+	// Paths records the paths of violations that can't be positioned. It
+	// may be nil.
+	Paths *astyaml.ReportPaths
+}
+
+// item is a value a policy is checked for, at a path of keys and indices
+// under its root.
+type item struct {
+	path  []interface{}
+	value interface{}
+}
+
+// Check checks in against policies, reporting every violation. If the configs
+// can't be converted into the values policies are checked against, that is
+// reported instead, since no policy could be checked.
+func Check(policies []Policy, in Input) report.Report {
+	cfg, err := configValue(reflect.ValueOf(in.Config))
+	if err != nil {
+		return report.ReportFromError(fmt.Errorf("can't check policies against the config: %v", err), report.EntryError)
+	}
+	ign, err := ignitionValue(in.Ignition)
+	if err != nil {
+		return report.ReportFromError(fmt.Errorf("can't check policies against the Ignition config: %v", err), report.EntryError)
+	}
+	vars := map[string]interface{}{rootConfig: cfg, rootIgnition: ign}
+
+	r := report.Report{}
+	for _, p := range policies {
+		items := []item{{}}
+		if p.forEach != nil {
+			items = collect(vars[p.forEach[0]], nil, p.forEach[1:])
+		}
+		for _, it := range items {
+			entry := report.Entry{}
+			switch p.Severity {
+			case SeverityError:
+				entry.Kind = report.EntryError
+			case SeverityWarning:
+				entry.Kind = report.EntryWarning
+			default:
+				entry.Kind = report.EntryInfo
+			}
+			var subject string
+			var path []interface{}
+			if p.forEach != nil {
+				subject = p.forEach[0]
+				if len(it.path) > 0 {
+					subject += "." + astyaml.FormatPath(it.path...)
+				}
+				subject += ": "
+				path = locate(&entry, in, p.forEach[0], it.path)
+			}
+
+			violated, err := p.violatedBy(vars, it.value)
+			if err != nil {
+				entry.Kind = report.EntryError
+				entry.Message = fmt.Sprintf("policy %s: %s%v", p.ID, subject, err)
+			} else if violated {
+				message := p.Description
+				if message == "" {
+					message = "require " + p.Require + " is false"
+				}
+				entry.Message = fmt.Sprintf("policy %s: %s%s", p.ID, subject, message)
+			} else {
+				continue
+			}
+			r.Add(entry)
+			in.Paths.Set(entry, path...)
+		}
+	}
+	return r
+}
+
+// violatedBy returns whether the item with the given value violates p.
+func (p Policy) violatedBy(vars map[string]interface{}, value interface{}) (bool, error) {
+	if p.forEach != nil {
+		vars[self] = value
+		defer delete(vars, self)
+	}
+	if p.when != nil {
+		applies, err := evalBool(p.when, vars)
+		if err != nil {
+			return false, fmt.Errorf("when: %v", err)
+		}
+		if !applies {
+			return false, nil
+		}
+	}
+	met, err := evalBool(p.require, vars)
+	if err != nil {
+		return false, fmt.Errorf("require: %v", err)
+	}
+	return !met, nil
+}
+
+func evalBool(e expr, vars map[string]interface{}) (bool, error) {
+	v, err := e.eval(vars)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("expected a bool, got a %s", typeName(v))
+	}
+	return b, nil
+}
+
+// collect returns the values at keys under v. Lists on the way are flattened,
+// so config.systemd.units.dropins are the dropins of every unit. Values that
+// aren't set are left out.
+func collect(v interface{}, path []interface{}, keys []string) []item {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		var items []item
+		for i, element := range v {
+			items = append(items, collect(element, appendPath(path, i), keys)...)
+		}
+		return items
+	case map[string]interface{}:
+		if len(keys) > 0 {
+			return collect(v[keys[0]], appendPath(path, keys[0]), keys[1:])
+		}
+	}
+	if len(keys) > 0 {
+		return nil
+	}
+	return []item{{path: path, value: v}}
+}
+
+func appendPath(path []interface{}, key interface{}) []interface{} {
+	return append(append([]interface{}{}, path...), key)
+}
+
+// locate positions entry at the item at path in the Container Linux Config.
+// Items of the Ignition config are positioned at what they were generated
+// from, or the closest parent that is. It returns the path in the Container
+// Linux Config to record for entries without a position, if there is one.
+func locate(entry *report.Entry, in Input, root string, path []interface{}) []interface{} {
+	if root == rootConfig {
+		if n, ok := astyaml.NodeAt(in.AST, path...); ok {
+			entry.Line, entry.Column, _ = n.ValueLineCol(nil)
+		}
+		return path
+	}
+	for i := len(path); i > 0; i-- {
+		if source, ok := in.SourceMap.Lookup(astyaml.FormatPath(path[:i]...)); ok {
+			entry.Line, entry.Column = source.Line, source.Column
+			return []interface{}{source.Path}
+		}
+	}
+	return nil
+}
+
+// configValue converts a Container Linux Config into the values expressions
+// work with, keyed by the keys of the spec. Fields keep their zero values, so
+// an explicit false is false, only unset optional fields like mode are null.
+func configValue(v reflect.Value) (interface{}, error) {
+	switch t := v.Interface().(type) {
+	case types.EtcdVersion:
+		return t.String(), nil
+	case types.FlannelVersion:
+		return t.String(), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil, nil
+		}
+		return configValue(v.Elem())
+	case reflect.Struct:
+		m := map[string]interface{}{}
+		if err := addFields(m, v); err != nil {
+			return nil, err
+		}
+		return m, nil
+	case reflect.Slice:
+		s := make([]interface{}, v.Len())
+		for i := range s {
+			elem, err := configValue(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			s[i] = elem
+		}
+		return s, nil
+	case reflect.Map:
+		m := make(map[string]interface{}, v.Len())
+		for _, key := range v.MapKeys() {
+			elem, err := configValue(v.MapIndex(key))
+			if err != nil {
+				return nil, err
+			}
+			m[fmt.Sprint(key.Interface())] = elem
+		}
+		return m, nil
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return v.Bool(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), nil
+	}
+	return nil, fmt.Errorf("unsupported value of type %s", v.Type())
+}
+
+// addFields adds the fields of a struct to m by their YAML keys. Embedded
+// fields, like the version specific etcd and flannel options, are flattened
+// into m.
+func addFields(m map[string]interface{}, v reflect.Value) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous {
+			elem := v.Field(i)
+			for (elem.Kind() == reflect.Interface || elem.Kind() == reflect.Ptr) && !elem.IsNil() {
+				elem = elem.Elem()
+			}
+			if elem.Kind() == reflect.Struct {
+				if err := addFields(m, elem); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		key := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if key == "" || key == "-" {
+			continue
+		}
+		value, err := configValue(v.Field(i))
+		if err != nil {
+			return fmt.Errorf("%s: %v", key, err)
+		}
+		m[key] = value
+	}
+	return nil
+}
+
+// ignitionValue converts an Ignition config into the values expressions work
+// with, keyed by the keys of its spec. Fields that aren't set are left out.
+func ignitionValue(cfg ignTypes.Config) (interface{}, error) {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var generic interface{}
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return nil, err
+	}
+	return generic, nil
+}
@@ -0,0 +1,272 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/coreos/container-linux-config-transpiler/config"
+	"github.com/coreos/container-linux-config-transpiler/config/types"
+	"github.com/coreos/ignition/config/validate/report"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEval(t *testing.T) {
+	vars := map[string]interface{}{
+		"config": map[string]interface{}{
+			"users": []interface{}{
+				map[string]interface{}{"name": "core", "keys": []interface{}{"a", "b"}},
+				map[string]interface{}{"name": "admin", "password_hash": "$6$x"},
+			},
+			"mode": float64(0644),
+		},
+	}
+
+	tests := []struct {
+		in  string
+		out interface{}
+		err error
+	}{
+		{in: `1 + 2 == 3 && !false`, out: true},
+		{in: `"a" + 'b' == "ab"`, out: true},
+		{in: `config.mode == 0644`, out: true},
+		{in: `config.mode >= 0700 || config.mode < -1`, out: false},
+		{in: `config.users[0].name`, out: "core"},
+		{in: `config.users[5].name == null`, out: true},
+		{in: `config.missing.deeply.nested`, out: nil},
+		{in: `size(config.users) == 2 && config.users[0].keys.size() == 2`, out: true},
+		{in: `"b" in config.users[0].keys && "name" in config.users[1]`, out: true},
+		{in: `config.users.all(u, u.name == "core" || u.password_hash == null)`, out: false},
+		{in: `config.users.exists(u, u.name.startsWith("ad"))`, out: true},
+		{in: `config.users.filter(u, u.keys.contains("a")).size()`, out: float64(1)},
+		{in: `config.users.all(u, u.keys.all(k, k.matches("^[a-z]$")))`, out: true},
+		{in: `config.users[1].missing.endsWith("x")`, out: false},
+		{in: `[1, 2] + [3]`, out: []interface{}{float64(1), float64(2), float64(3)}},
+		{in: `config.mode.name`, err: errors.New("can't access field name of a number")},
+		{in: `config.users && true`, err: errors.New("can't apply && to a list")},
+		{in: `"a" < 1`, err: errors.New("can't apply < to a string and a number")},
+		{in: `"a".matches("(")`, err: errors.New("matches: error parsing regexp: missing closing ): `(`")},
+	}
+
+	for i, test := range tests {
+		e, err := parseExpr(test.in, "config")
+		if !assert.NoError(t, err, "#%d: parsing", i) {
+			continue
+		}
+		out, err := e.eval(vars)
+		assert.Equal(t, test.err, err, "#%d: bad error", i)
+		assert.Equal(t, test.out, out, "#%d: bad value", i)
+	}
+}
+
+func TestParseExpr(t *testing.T) {
+	tests := []struct {
+		in  string
+		err error
+	}{
+		{in: `self.name == "core"`},
+		{in: `sefl.name == "core"`, err: errors.New(`column 1: unknown identifier "sefl"`)},
+		{in: `self.users.all(u, u.name != "")`},
+		{in: `self.users.all(u, u.name != "") && u.name == ""`, err: errors.New(`column 36: unknown identifier "u"`)},
+		{in: `self.users.all("u", true)`, err: errors.New("column 12: all needs a variable name as its first argument")},
+		{in: `self.name.startsWith()`, err: errors.New("column 11: startsWith takes 1 arguments, not 0")},
+		{in: `self.name.lower()`, err: errors.New(`column 11: unknown function "lower"`)},
+		{in: `self.name ==`, err: errors.New("column 13: unexpected end of expression")},
+		{in: `(self.name`, err: errors.New("column 11: unexpected end of expression")},
+		{in: `self.name == "core`, err: errors.New("column 14: unterminated string")},
+		{in: `self.name = "core"`, err: errors.New("column 11: unexpected character '='")},
+	}
+
+	for i, test := range tests {
+		_, err := parseExpr(test.in, "self")
+		assert.Equal(t, test.err, err, "#%d: bad error", i)
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in  string
+		err error
+	}{
+		{
+			in: `policies:
+  - id: ok
+    for_each: config.passwd.users
+    require: self.name != ""
+`,
+		},
+		{
+			in: `policies:
+  - for_each: config.passwd.users
+    require: self.name != ""
+`,
+			err: errors.New("policies[0]: policy has no id"),
+		},
+		{
+			in: `policies:
+  - id: no-require
+`,
+			err: errors.New("no-require: policy has no require expression"),
+		},
+		{
+			in: `policies:
+  - id: bad-root
+    for_each: passwd.users
+    require: true
+`,
+			err: errors.New("bad-root: for_each must start with config or ignition"),
+		},
+		{
+			in: `policies:
+  - id: no-self
+    require: self.name != ""
+`,
+			err: errors.New(`no-self: require: column 1: unknown identifier "self"`),
+		},
+		{
+			in: `policies:
+  - id: bad-severity
+    severity: fatal
+    require: true
+`,
+			err: errors.New("bad-severity: " + ErrUnknownSeverity.Error()),
+		},
+	}
+
+	for i, test := range tests {
+		_, err := Parse([]byte(test.in))
+		assert.Equal(t, test.err, err, "#%d: bad error", i)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	cfg := `passwd:
+  users:
+    - name: core
+      password_hash: "$6$core"
+    - name: admin
+      password_hash: "$6$admin"
+      system: false
+storage:
+  files:
+    - path: /opt/bin/tool
+      mode: 0755
+      contents:
+        remote:
+          url: http://example.com/tool
+    - path: /opt/bin/other
+      mode: 0755
+      contents:
+        remote:
+          url: https://artifacts.example.com/other
+    - path: /etc/app.yaml
+      mode: 0600
+      contents:
+        inline: |
+          mode: 420
+etcd:
+  name: node
+  cert_file: /etc/ssl/etcd.pem
+`
+	policies := `policies:
+  - id: no-passwords
+    description: only core may have a password
+    for_each: config.passwd.users
+    when: self.name != "core"
+    require: self.password_hash == null
+  - id: artifact-host
+    severity: warning
+    for_each: ignition.storage.files
+    when: self.contents.source != "" && !self.contents.source.startsWith("data:")
+    require: self.contents.source.startsWith("https://artifacts.example.com/")
+  - id: etcd-tls
+    description: etcd must have client TLS set
+    for_each: config.etcd
+    require: self.cert_file != null && self.key_file != null
+  - id: etcd-cert
+    for_each: config.etcd
+    require: self.cert_file == "/etc/ssl/etcd.pem"
+  - id: some-units
+    require: size(ignition.systemd.units) > 0
+  - id: no-system-users
+    for_each: config.passwd.users
+    require: self.system == false && self.groups == []
+  - id: app-contents
+    for_each: config.storage.files
+    when: self.path == "/etc/app.yaml"
+    require: 'self.contents.inline == "mode: 420\n" && self.mode == 0600'
+  - id: broken
+    for_each: config.storage.files
+    require: self.mode.value == 1
+`
+
+	c, ast, r := config.Parse([]byte(cfg))
+	assert.False(t, r.IsFatal(), "parsing config: %v", r)
+	sourceMap := types.SourceMap{}
+	ign, r := config.Convert(c, types.ConvertOptions{SourceMap: &sourceMap}, ast)
+	assert.False(t, r.IsFatal(), "converting config: %v", r)
+	p, err := Parse([]byte(policies))
+	assert.NoError(t, err, "parsing policies")
+
+	expected := report.Report{Entries: []report.Entry{
+		{
+			Kind:    report.EntryError,
+			Message: "policy no-passwords: config.passwd.users[1]: only core may have a password",
+			Line:    5,
+			Column:  7,
+		},
+		{
+			Kind:    report.EntryWarning,
+			Message: `policy artifact-host: ignition.storage.files[0]: require self.contents.source.startsWith("https://artifacts.example.com/") is false`,
+			Line:    10,
+			Column:  7,
+		},
+		{
+			Kind:    report.EntryError,
+			Message: "policy etcd-tls: config.etcd: etcd must have client TLS set",
+			Line:    26,
+			Column:  3,
+		},
+		{
+			Kind:    report.EntryError,
+			Message: "policy broken: config.storage.files[0]: require: can't access field value of a number",
+			Line:    10,
+			Column:  7,
+		},
+		{
+			Kind:    report.EntryError,
+			Message: "policy broken: config.storage.files[1]: require: can't access field value of a number",
+			Line:    15,
+			Column:  7,
+		},
+		{
+			Kind:    report.EntryError,
+			Message: "policy broken: config.storage.files[2]: require: can't access field value of a number",
+			Line:    20,
+			Column:  7,
+		},
+	}}
+	assert.Equal(t, expected, Check(p, Input{Config: c, AST: ast, Ignition: ign, SourceMap: sourceMap}))
+}
+
+func TestConfigValue(t *testing.T) {
+	_, err := configValue(reflect.ValueOf(struct {
+		Name  string   `yaml:"name"`
+		Ready chan int `yaml:"ready"`
+	}{}))
+	assert.Equal(t, errors.New("ready: unsupported value of type chan int"), err)
+}
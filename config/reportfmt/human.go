@@ -0,0 +1,111 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reportfmt
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// String formats the entry like the entries of a report, with the path of the
+// node added to the position.
+func (e Entry) String() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("%s: %s", e.Kind, e.Message)
+	}
+	position := fmt.Sprintf("line %d", e.Line)
+	if e.Column != 0 {
+		position += fmt.Sprintf(", column %d", e.Column)
+	}
+	if e.Path != "" {
+		position += fmt.Sprintf(" (%s)", e.Path)
+	}
+	return fmt.Sprintf("%s at %s\n%s", e.Kind, position, e.Message)
+}
+
+// writeHuman writes entries like compiler diagnostics, followed by the line
+// of the config they refer to with the offending token underlined.
+func writeHuman(w io.Writer, entries []Entry, source []byte) error {
+	lines := strings.Split(string(source), "\n")
+	var out bytes.Buffer
+	for _, e := range entries {
+		out.WriteString(e.String())
+		out.WriteByte('\n')
+		if e.Line > 0 && e.Line <= len(lines) {
+			out.WriteString(snippet(lines[e.Line-1], e.Line, e.Column))
+		}
+	}
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+// snippet shows a line of the config and underlines the token at column, if
+// it is known.
+func snippet(line string, lineNumber, column int) string {
+	line = strings.TrimRight(line, "\r")
+	gutter := fmt.Sprint(lineNumber)
+	blank := strings.Repeat(" ", len(gutter))
+	s := fmt.Sprintf("  %s | %s\n", gutter, line)
+	if column < 1 || column > len(line) {
+		return s
+	}
+	// keep tabs, so the underline lines up however they are displayed
+	indent := strings.Map(func(r rune) rune {
+		if r == '\t' {
+			return r
+		}
+		return ' '
+	}, line[:column-1])
+	underline := strings.Repeat("^", tokenWidth(line[column-1:]))
+	return s + fmt.Sprintf("  %s | %s%s\n", blank, indent, underline)
+}
+
+// tokenWidth returns the width of the YAML key or scalar that s starts with.
+func tokenWidth(s string) int {
+	switch s[0] {
+	case '"', '\'':
+		// quoted scalars, including the quotes
+		for i := 1; i < len(s); i++ {
+			if s[i] == '\\' && s[0] == '"' {
+				i++
+			} else if s[i] == s[0] {
+				return i + 1
+			}
+		}
+		return len(s)
+	case '|', '>', '[', '{':
+		// block scalars and flow collections
+		return 1
+	}
+	if s == "-" || strings.HasPrefix(s, "- ") {
+		// sequence entries
+		return 1
+	}
+	end := len(s)
+	for _, sep := range []string{": ", " #"} {
+		if i := strings.Index(s, sep); i >= 0 && i < end {
+			end = i
+		}
+	}
+	if strings.HasSuffix(s[:end], ":") {
+		end--
+	}
+	if width := len(strings.TrimRight(s[:end], " ")); width > 0 {
+		return width
+	}
+	return 1
+}
@@ -0,0 +1,172 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package reportfmt writes the reports of parsing and converting Container
+// Linux Configs in formats meant for humans as well as for tools like CI
+// systems and editors.
+package reportfmt
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+
+	yaml "github.com/ajeddeloh/yaml"
+	"github.com/coreos/container-linux-config-transpiler/config/astyaml"
+	"github.com/coreos/ignition/config/validate/report"
+)
+
+const (
+	FormatHuman = "human"
+	FormatJSON  = "json"
+	FormatSARIF = "sarif"
+)
+
+var (
+	ErrUnknownFormat = errors.New("unknown report format")
+
+	// Formats are the supported report formats.
+	Formats = []string{FormatHuman, FormatJSON, FormatSARIF}
+)
+
+// Entry is a report entry together with the YAML path of the node it refers
+// to, like "storage.files[3].contents.local". File is only set by WriteFiles.
+type Entry struct {
+	File    string `json:"file,omitempty"`
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
+	Line    int    `json:"line,omitempty"`
+	Column  int    `json:"column,omitempty"`
+	Path    string `json:"path,omitempty"`
+}
+
+// File is a config together with the report about it. Name is the name of
+// the config's file, or empty for standard input. Paths are the paths
+// recorded for the entries of the report, if any.
+type File struct {
+	Name   string
+	Source []byte
+	Report report.Report
+	Paths  *astyaml.ReportPaths
+}
+
+// Annotate adds the YAML paths to the entries of a report about the config in
+// source. Entries get the path recorded in paths, which may be nil, and
+// entries without one get the path of the node at their position. Entries
+// without either, or whose position can't be found in the config, are left
+// without a path.
+func Annotate(r report.Report, source []byte, paths *astyaml.ReportPaths) []Entry {
+	tree, ok := parseTree(source)
+	recorded := paths.Lookup(r)
+	entries := make([]Entry, 0, len(r.Entries))
+	for i, e := range r.Entries {
+		entry := Entry{
+			Kind:    e.Kind.String(),
+			Message: e.Message,
+			Line:    e.Line,
+			Column:  e.Column,
+			Path:    recorded[i],
+		}
+		if ok && entry.Path == "" && e.Line != 0 {
+			if path, found := tree.PathAt(e.Line, e.Column); found {
+				entry.Path = astyaml.FormatPath(path...)
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// Write writes the report about a config in the given format. Reports
+// without entries are only written by the machine readable formats, which
+// always produce a valid document. The human readable format shows the line
+// of the config each entry refers to.
+func Write(w io.Writer, format string, f File) error {
+	switch format {
+	case FormatHuman, "":
+		return writeHuman(w, Annotate(f.Report, f.Source, f.Paths), f.Source)
+	case FormatJSON:
+		return writeJSON(w, Annotate(f.Report, f.Source, f.Paths))
+	case FormatSARIF:
+		return writeJSON(w, toSARIF([]File{f}))
+	}
+	return ErrUnknownFormat
+}
+
+// WriteFiles writes the reports about several configs in the given format.
+// The machine readable formats write a single document for all of them: the
+// JSON format a list of the entries of every config, each with the name of
+// its file, and the SARIF format a log with the configs as its artifacts. The
+// human readable format writes the reports one after the other.
+func WriteFiles(w io.Writer, format string, files []File) error {
+	switch format {
+	case FormatHuman, "":
+		for _, f := range files {
+			if err := writeHuman(w, Annotate(f.Report, f.Source, f.Paths), f.Source); err != nil {
+				return err
+			}
+		}
+		return nil
+	case FormatJSON:
+		entries := []Entry{}
+		for _, f := range files {
+			for _, e := range Annotate(f.Report, f.Source, f.Paths) {
+				e.File = f.Name
+				entries = append(entries, e)
+			}
+		}
+		return writeJSON(w, entries)
+	case FormatSARIF:
+		return writeJSON(w, toSARIF(files))
+	}
+	return ErrUnknownFormat
+}
+
+// IsSupportedFormat returns whether format is one of Formats.
+func IsSupportedFormat(format string) bool {
+	for _, f := range Formats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// parseTree parses source into a tree to look up paths in. It returns false
+// if source isn't valid YAML.
+func parseTree(source []byte) (astyaml.YamlNode, bool) {
+	// UnmarshalToNode panics on invalid YAML, so make sure it is valid first
+	var v interface{}
+	if err := yaml.Unmarshal(source, &v); err != nil {
+		return astyaml.YamlNode{}, false
+	}
+	nodes := yaml.UnmarshalToNode(source)
+	if nodes == nil {
+		return astyaml.YamlNode{}, false
+	}
+	tree, err := astyaml.FromYamlDocumentNode(*nodes)
+	if err != nil {
+		return astyaml.YamlNode{}, false
+	}
+	return tree, true
+}
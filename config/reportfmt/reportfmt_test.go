@@ -0,0 +1,251 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reportfmt
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/coreos/ignition/config/validate/report"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/coreos/container-linux-config-transpiler/config/astyaml"
+)
+
+const source = `etcd:
+  name: node
+storage:
+  files:
+    - path: /opt/file
+      mode: 0644
+      contents:
+        local: file
+passwd:
+  users:
+    - name: core
+      ssh_authorized_keys:
+        - ssh-rsa one
+        - ssh-rsa two
+`
+
+func entryAt(line, col int) report.Entry {
+	return report.Entry{Kind: report.EntryWarning, Message: "message", Line: line, Column: col}
+}
+
+func TestAnnotate(t *testing.T) {
+	tests := []struct {
+		in   report.Entry
+		path string
+	}{
+		// keys of sections
+		{entryAt(1, 1), "etcd"},
+		{entryAt(3, 1), "storage"},
+		// list elements start at their first key
+		{entryAt(5, 7), "storage.files[0]"},
+		// keys other than the first
+		{entryAt(6, 7), "storage.files[0].mode"},
+		// values
+		{entryAt(6, 13), "storage.files[0].mode"},
+		{entryAt(8, 16), "storage.files[0].contents.local"},
+		{entryAt(14, 11), "passwd.users[0].ssh_authorized_keys[1]"},
+		// unknown positions
+		{entryAt(100, 1), ""},
+		{report.Entry{Kind: report.EntryError, Message: "no position"}, ""},
+	}
+
+	for i, test := range tests {
+		entries := Annotate(report.Report{Entries: []report.Entry{test.in}}, []byte(source), nil)
+		assert.Equal(t, 1, len(entries), "#%d: bad number of entries", i)
+		assert.Equal(t, test.path, entries[0].Path, "#%d: bad path", i)
+	}
+}
+
+func TestAnnotateRecordedPath(t *testing.T) {
+	r := report.Report{Entries: []report.Entry{
+		{Kind: report.EntryError, Message: "no position"},
+		entryAt(6, 7),
+	}}
+	paths := &astyaml.ReportPaths{}
+	paths.Set(r.Entries[0], "storage", "files", 2, "contents", "local")
+	entry := report.Entry{Kind: report.EntryError, Message: "missing key"}
+	for i := 0; i < 2; i++ {
+		r.Add(entry)
+		paths.Set(entry, "systemd", "units", i, "dropins")
+	}
+
+	// recorded paths don't depend on the config being parseable
+	for _, source := range []string{source, "a: [\n"} {
+		entries := Annotate(r, []byte(source), paths)
+		assert.Equal(t, 4, len(entries), "bad number of entries")
+		assert.Equal(t, "storage.files[2].contents.local", entries[0].Path, "bad recorded path")
+		// identical entries get their paths in the order they were recorded
+		assert.Equal(t, "systemd.units[0].dropins", entries[2].Path, "bad recorded path")
+		assert.Equal(t, "systemd.units[1].dropins", entries[3].Path, "bad recorded path")
+	}
+	// entries with a position and no recorded path get their path from it
+	assert.Equal(t, "storage.files[0].mode", Annotate(r, []byte(source), paths)[1].Path, "bad path of positioned entry")
+	assert.Equal(t, "", Annotate(r, []byte("a: [\n"), paths)[1].Path, "path recorded for positioned entry")
+
+	// recorded paths take precedence over the position, which a mapping
+	// shares with its first key
+	r = report.Report{Entries: []report.Entry{entryAt(5, 7)}}
+	paths.Set(r.Entries[0], "storage", "files", 0)
+	assert.Equal(t, "storage.files[0]", Annotate(r, []byte(source), paths)[0].Path, "position overrode recorded path")
+}
+
+func TestAnnotateInvalidYaml(t *testing.T) {
+	entries := Annotate(report.Report{Entries: []report.Entry{entryAt(1, 1)}}, []byte("a: [\n"), nil)
+	assert.Equal(t, []Entry{{Kind: "warning", Message: "message", Line: 1, Column: 1}}, entries)
+}
+
+func TestWrite(t *testing.T) {
+	r := report.Report{Entries: []report.Entry{
+		{Kind: report.EntryError, Message: "bad local", Line: 8, Column: 16},
+		{Kind: report.EntryInfo, Message: "no position"},
+	}}
+
+	var out bytes.Buffer
+	assert.Nil(t, Write(&out, FormatJSON, File{Name: "config.yaml", Source: []byte(source), Report: r}))
+	var entries []Entry
+	assert.Nil(t, json.Unmarshal(out.Bytes(), &entries))
+	assert.Equal(t, []Entry{
+		{Kind: "error", Message: "bad local", Line: 8, Column: 16, Path: "storage.files[0].contents.local"},
+		{Kind: "info", Message: "no position"},
+	}, entries)
+
+	out.Reset()
+	assert.Nil(t, Write(&out, FormatSARIF, File{Name: "config.yaml", Source: []byte(source), Report: r}))
+	var log sarifLog
+	assert.Nil(t, json.Unmarshal(out.Bytes(), &log))
+	assert.Equal(t, []sarifResult{
+		{
+			Level:   "error",
+			Message: sarifMessage{Text: "bad local"},
+			Locations: []sarifLocation{{
+				PhysicalLocation: &sarifPhysicalLocation{
+					ArtifactLocation: sarifArtifactLocation{URI: "config.yaml"},
+					Region:           &sarifRegion{StartLine: 8, StartColumn: 16},
+				},
+				LogicalLocations: []sarifLogicalLocation{{FullyQualifiedName: "storage.files[0].contents.local"}},
+			}},
+		},
+		{
+			Level:   "note",
+			Message: sarifMessage{Text: "no position"},
+			Locations: []sarifLocation{{
+				PhysicalLocation: &sarifPhysicalLocation{
+					ArtifactLocation: sarifArtifactLocation{URI: "config.yaml"},
+				},
+			}},
+		},
+	}, log.Runs[0].Results)
+
+	out.Reset()
+	assert.Nil(t, Write(&out, FormatJSON, File{}))
+	assert.Equal(t, "[]\n", out.String())
+
+	assert.Equal(t, ErrUnknownFormat, Write(&out, "xml", File{Report: r}))
+}
+
+func TestWriteFiles(t *testing.T) {
+	files := []File{
+		{Name: "a.yaml", Source: []byte(source), Report: report.Report{Entries: []report.Entry{
+			{Kind: report.EntryError, Message: "bad local", Line: 8, Column: 16},
+		}}},
+		{Name: "b.yaml", Source: []byte(source)},
+		{Name: "c.yaml", Source: []byte(source), Report: report.Report{Entries: []report.Entry{
+			{Kind: report.EntryWarning, Message: "no position"},
+		}}},
+	}
+
+	var out bytes.Buffer
+	assert.Nil(t, WriteFiles(&out, FormatJSON, files))
+	var entries []Entry
+	assert.Nil(t, json.Unmarshal(out.Bytes(), &entries))
+	assert.Equal(t, []Entry{
+		{File: "a.yaml", Kind: "error", Message: "bad local", Line: 8, Column: 16, Path: "storage.files[0].contents.local"},
+		{File: "c.yaml", Kind: "warning", Message: "no position"},
+	}, entries)
+
+	out.Reset()
+	assert.Nil(t, WriteFiles(&out, FormatSARIF, files))
+	var log sarifLog
+	assert.Nil(t, json.Unmarshal(out.Bytes(), &log))
+	assert.Len(t, log.Runs, 1)
+	assert.Equal(t, []sarifArtifact{
+		{Location: sarifArtifactLocation{URI: "a.yaml"}},
+		{Location: sarifArtifactLocation{URI: "b.yaml"}},
+		{Location: sarifArtifactLocation{URI: "c.yaml"}},
+	}, log.Runs[0].Artifacts)
+	var uris []string
+	for _, result := range log.Runs[0].Results {
+		uris = append(uris, result.Locations[0].PhysicalLocation.ArtifactLocation.URI)
+	}
+	assert.Equal(t, []string{"a.yaml", "c.yaml"}, uris)
+
+	out.Reset()
+	assert.Nil(t, WriteFiles(&out, FormatJSON, []File{{Name: "a.yaml", Source: []byte(source)}}))
+	assert.Equal(t, "[]\n", out.String())
+}
+
+func TestWriteHuman(t *testing.T) {
+	r := report.Report{Entries: []report.Entry{
+		{Kind: report.EntryError, Message: "bad local", Line: 8, Column: 16},
+		{Kind: report.EntryWarning, Message: "bad mode", Line: 6, Column: 7},
+		{Kind: report.EntryError, Message: "yaml error", Line: 2},
+		{Kind: report.EntryInfo, Message: "no position"},
+	}}
+
+	var out bytes.Buffer
+	assert.Nil(t, Write(&out, FormatHuman, File{Name: "config.yaml", Source: []byte(source), Report: r}))
+	assert.Equal(t, `error at line 8, column 16 (storage.files[0].contents.local)
+bad local
+  8 |         local: file
+    |                ^^^^
+warning at line 6, column 7 (storage.files[0].mode)
+bad mode
+  6 |       mode: 0644
+    |       ^^^^
+error at line 2
+yaml error
+  2 |   name: node
+info: no position
+`, out.String())
+
+	out.Reset()
+	assert.Nil(t, Write(&out, FormatHuman, File{Source: []byte(source)}))
+	assert.Equal(t, "", out.String())
+}
+
+func TestTokenWidth(t *testing.T) {
+	tests := []struct {
+		in    string
+		width int
+	}{
+		{"key: value", 3},
+		{"key:", 3},
+		{"plain scalar # comment", 12},
+		{`"quoted \" scalar": value`, 18},
+		{"'single'", 8},
+		{"- item", 1},
+		{"--flag", 6},
+		{"|", 1},
+	}
+
+	for i, test := range tests {
+		assert.Equal(t, test.width, tokenWidth(test.in), "#%d: bad width", i)
+	}
+}
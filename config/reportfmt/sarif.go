@@ -0,0 +1,147 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reportfmt
+
+import (
+	"github.com/coreos/container-linux-config-transpiler/internal/version"
+)
+
+// The subset of SARIF 2.1.0 needed to describe a report. See
+// https://docs.oasis-open.org/sarif/sarif/v2.1.0/sarif-v2.1.0.html
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool      sarifTool       `json:"tool"`
+	Artifacts []sarifArtifact `json:"artifacts,omitempty"`
+	Results   []sarifResult   `json:"results"`
+}
+
+type sarifArtifact struct {
+	Location sarifArtifactLocation `json:"location"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string `json:"name"`
+	Version        string `json:"version,omitempty"`
+	InformationURI string `json:"informationUri"`
+}
+
+type sarifResult struct {
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations,omitempty"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation *sarifPhysicalLocation `json:"physicalLocation,omitempty"`
+	LogicalLocations []sarifLogicalLocation `json:"logicalLocations,omitempty"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn,omitempty"`
+}
+
+type sarifLogicalLocation struct {
+	FullyQualifiedName string `json:"fullyQualifiedName"`
+}
+
+// sarifLevels maps report entry kinds to SARIF result levels.
+var sarifLevels = map[string]string{
+	"error":      "error",
+	"warning":    "warning",
+	"deprecated": "warning",
+	"info":       "note",
+}
+
+// toSARIF converts the reports about files into a SARIF log with a single
+// run. Files with names are listed as its artifacts.
+func toSARIF(files []File) sarifLog {
+	var artifacts []sarifArtifact
+	results := []sarifResult{}
+	for _, f := range files {
+		if f.Name != "" {
+			artifacts = append(artifacts, sarifArtifact{Location: sarifArtifactLocation{URI: f.Name}})
+		}
+		results = append(results, sarifResults(Annotate(f.Report, f.Source, f.Paths), f.Name)...)
+	}
+
+	return sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs: []sarifRun{{
+			Tool: sarifTool{Driver: sarifDriver{
+				Name:           "ct",
+				Version:        version.Raw,
+				InformationURI: "https://github.com/coreos/container-linux-config-transpiler",
+			}},
+			Artifacts: artifacts,
+			Results:   results,
+		}},
+	}
+}
+
+// sarifResults converts entries into SARIF results. name is the name of the
+// config's file, or empty if it has none.
+func sarifResults(entries []Entry, name string) []sarifResult {
+	results := make([]sarifResult, 0, len(entries))
+	for _, e := range entries {
+		result := sarifResult{
+			Level:   sarifLevels[e.Kind],
+			Message: sarifMessage{Text: e.Message},
+		}
+		var location sarifLocation
+		if name != "" {
+			location.PhysicalLocation = &sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifactLocation{URI: name},
+			}
+			if e.Line != 0 {
+				location.PhysicalLocation.Region = &sarifRegion{
+					StartLine:   e.Line,
+					StartColumn: e.Column,
+				}
+			}
+		}
+		if e.Path != "" {
+			location.LogicalLocations = []sarifLogicalLocation{{FullyQualifiedName: e.Path}}
+		}
+		if location.PhysicalLocation != nil || location.LogicalLocations != nil {
+			result.Locations = []sarifLocation{location}
+		}
+		results = append(results, result)
+	}
+	return results
+}
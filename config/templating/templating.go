@@ -15,6 +15,7 @@
 package templating
 
 import (
+	"bytes"
 	"fmt"
 	"strings"
 
@@ -34,6 +35,10 @@ const (
 	fieldV6Public  = "PUBLIC_IPV6"
 )
 
+// fields are all fields that can be referenced, whether or not a platform
+// supports them.
+var fields = []string{fieldHostname, fieldV4Private, fieldV4Public, fieldV6Private, fieldV6Public}
+
 var platformTemplatingMap = map[string]map[string]string{
 	platform.Azure: {
 		// TODO: is this right?
@@ -131,3 +136,146 @@ func PerformTemplating(platform string, vars []string) ([]string, error) {
 	}
 	return vars, nil
 }
+
+// UndoTemplating reverses PerformTemplating, replacing every reference to a
+// metadata environment variable with the field it was generated from. It also
+// returns the platform the variables belong to.
+func UndoTemplating(vars []string) ([]string, string, error) {
+	p := ""
+	for i := range vars {
+		for {
+			startIndex := strings.Index(vars[i], "${")
+			if startIndex == -1 {
+				break
+			}
+			endIndex := strings.IndexRune(vars[i][startIndex:], '}')
+			if endIndex == -1 {
+				break
+			}
+			endIndex += startIndex
+
+			envName := vars[i][startIndex+2 : endIndex]
+			fieldPlatform, fieldName, ok := lookupEnvVar(envName)
+			if !ok || (p != "" && p != fieldPlatform) {
+				return nil, "", ErrUnknownField
+			}
+			p = fieldPlatform
+			vars[i] = vars[i][:startIndex] + "{" + fieldName + "}" + vars[i][endIndex+1:]
+		}
+	}
+	return vars, p, nil
+}
+
+// lookupEnvVar finds the platform and field that the given metadata
+// environment variable is substituted for.
+func lookupEnvVar(envName string) (string, string, bool) {
+	for p, fields := range platformTemplatingMap {
+		for fieldName, fieldVal := range fields {
+			if fieldVal == envName {
+				return p, fieldName, true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// FindFields returns the fields referenced in s, in the order of their first
+// reference. Unlike the arguments of the etcd and flannel sections, arbitrary
+// text like unit contents uses braces for other things, so only the known
+// fields are considered and references preceded by a $, like ${HOSTNAME} in
+// shell scripts, or by another brace, like {{HOSTNAME}} in mustache and Go
+// templates, are left alone. References preceded by a backslash, like
+// \{HOSTNAME}, are escaped and left alone as well.
+func FindFields(s string) []string {
+	var found []string
+	seen := map[string]bool{}
+	for i := 0; i < len(s); i++ {
+		if !isReference(s, i) {
+			continue
+		}
+		if field := fieldAt(s[i+1:]); field != "" && !seen[field] {
+			seen[field] = true
+			found = append(found, field)
+		}
+	}
+	return found
+}
+
+// FieldVariable returns the name of the environment variable coreos-metadata
+// sets for the field on the platform.
+func FieldVariable(platform, field string) (string, error) {
+	vars, ok := platformTemplatingMap[platform]
+	if !ok {
+		return "", ErrUnknownPlatform
+	}
+	v, ok := vars[field]
+	if !ok {
+		return "", ErrUnknownField
+	}
+	return v, nil
+}
+
+// ReplaceFields replaces every field FindFields finds in s with a reference to
+// the environment variable holding its value.
+func ReplaceFields(platform, s string) (string, error) {
+	for _, field := range FindFields(s) {
+		if _, err := FieldVariable(platform, field); err != nil {
+			return "", err
+		}
+	}
+	return ReplaceFieldsFunc(s, func(field string) string {
+		v, _ := FieldVariable(platform, field)
+		return "${" + v + "}"
+	}), nil
+}
+
+// ReplaceFieldsFunc replaces every field FindFields finds in s with the result
+// of calling repl with its name. Escaped references lose their backslash.
+func ReplaceFieldsFunc(s string, repl func(field string) string) string {
+	var out bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		if isReference(s, i) {
+			if field := fieldAt(s[i+1:]); field != "" {
+				out.WriteString(repl(field))
+				i += len(field) + 1
+				continue
+			}
+		}
+		if s[i] == '\\' && i+1 < len(s) && s[i+1] == '{' {
+			if field := fieldAt(s[i+2:]); field != "" {
+				out.WriteString("{" + field + "}")
+				i += len(field) + 2
+				continue
+			}
+		}
+		out.WriteByte(s[i])
+	}
+	return out.String()
+}
+
+// Unescape removes the backslash of escaped references in s, leaving any
+// other reference as it is.
+func Unescape(s string) string {
+	return ReplaceFieldsFunc(s, func(field string) string {
+		return "{" + field + "}"
+	})
+}
+
+// isReference returns whether the byte at i in s is a brace that can start a
+// reference, which it can't if it follows a $, another brace or a backslash.
+func isReference(s string, i int) bool {
+	if s[i] != '{' {
+		return false
+	}
+	return i == 0 || !strings.ContainsRune(`${\`, rune(s[i-1]))
+}
+
+// fieldAt returns the field whose name and closing brace s starts with.
+func fieldAt(s string) string {
+	for _, field := range fields {
+		if strings.HasPrefix(s, field+"}") {
+			return field
+		}
+	}
+	return ""
+}
@@ -15,6 +15,7 @@
 package templating
 
 import (
+	"reflect"
 	"testing"
 )
 
@@ -119,3 +120,125 @@ func TestPerformTemplating(t *testing.T) {
 		}
 	}
 }
+
+func TestUndoTemplating(t *testing.T) {
+	type in struct {
+		vars []string
+	}
+	type out struct {
+		vars     []string
+		platform string
+		err      error
+	}
+	tests := []struct {
+		in  in
+		out out
+	}{
+		{
+			in{vars: []string{"foo", "bar"}},
+			out{vars: []string{"foo", "bar"}},
+		},
+		{
+			in{vars: []string{"foo: ${COREOS_EC2_HOSTNAME}", "bar"}},
+			out{vars: []string{"foo: {HOSTNAME}", "bar"}, platform: "ec2"},
+		},
+		{
+			in{vars: []string{"foo: ${COREOS_DIGITALOCEAN_IPV4_PRIVATE_0} ${COREOS_DIGITALOCEAN_IPV4_PUBLIC_0}", "bar"}},
+			out{vars: []string{"foo: {PRIVATE_IPV4} {PUBLIC_IPV4}", "bar"}, platform: "digitalocean"},
+		},
+		{
+			in{vars: []string{"foo: ${COREOS_EC2_HOSTNAME}", "bar: ${COREOS_GCE_HOSTNAME}"}},
+			out{err: ErrUnknownField},
+		},
+		{
+			in{vars: []string{"foo: ${BAZ}"}},
+			out{err: ErrUnknownField},
+		},
+	}
+	for i, test := range tests {
+		outVars, p, err := UndoTemplating(test.in.vars)
+		if err != test.out.err {
+			t.Errorf("#%d: err (%v) didn't match expectedErr (%v)", i, err, test.out.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if p != test.out.platform {
+			t.Errorf("#%d: platform didn't match, got %q, expected %q", i, p, test.out.platform)
+		}
+		for j := range outVars {
+			if test.out.vars[j] != outVars[j] {
+				t.Errorf("#%d: var %d didn't match expected result, got %q, expected %q", i, j, outVars[j], test.out.vars[j])
+			}
+		}
+	}
+}
+
+func TestReplaceFields(t *testing.T) {
+	type in struct {
+		platform string
+		s        string
+	}
+	type out struct {
+		s      string
+		fields []string
+		err    error
+	}
+	tests := []struct {
+		in  in
+		out out
+	}{
+		{
+			in{platform: "ec2", s: "no fields {} {FOO}"},
+			out{s: "no fields {} {FOO}"},
+		},
+		{
+			in{platform: "ec2", s: "Address={PRIVATE_IPV4}/24\nName={HOSTNAME} {PRIVATE_IPV4}"},
+			out{
+				s:      "Address=${COREOS_EC2_IPV4_LOCAL}/24\nName=${COREOS_EC2_HOSTNAME} ${COREOS_EC2_IPV4_LOCAL}",
+				fields: []string{"PRIVATE_IPV4", "HOSTNAME"},
+			},
+		},
+		{
+			in{platform: "ec2", s: "echo ${HOSTNAME} {HOSTNAME}{HOSTNAME}"},
+			out{
+				s:      "echo ${HOSTNAME} ${COREOS_EC2_HOSTNAME}${COREOS_EC2_HOSTNAME}",
+				fields: []string{"HOSTNAME"},
+			},
+		},
+		{
+			in{platform: "ec2", s: "{{HOSTNAME}} {{{PRIVATE_IPV4}}} {{ .HOSTNAME }}"},
+			out{s: "{{HOSTNAME}} {{{PRIVATE_IPV4}}} {{ .HOSTNAME }}"},
+		},
+		{
+			in{platform: "ec2", s: `\{HOSTNAME} \\{HOSTNAME} {HOSTNAME} \{FOO}`},
+			out{
+				s:      `{HOSTNAME} \{HOSTNAME} ${COREOS_EC2_HOSTNAME} \{FOO}`,
+				fields: []string{"HOSTNAME"},
+			},
+		},
+		{
+			in{platform: "ec2", s: "{PRIVATE_IPV6}"},
+			out{fields: []string{"PRIVATE_IPV6"}, err: ErrUnknownField},
+		},
+		{
+			in{platform: "aws", s: "{HOSTNAME}"},
+			out{fields: []string{"HOSTNAME"}, err: ErrUnknownPlatform},
+		},
+	}
+	for i, test := range tests {
+		fields := FindFields(test.in.s)
+		if !reflect.DeepEqual(fields, test.out.fields) {
+			t.Errorf("#%d: fields %v didn't match expected %v", i, fields, test.out.fields)
+		}
+		s, err := ReplaceFields(test.in.platform, test.in.s)
+		if err != test.out.err {
+			t.Errorf("#%d: err (%v) didn't match expectedErr (%v)", i, err, test.out.err)
+			continue
+		}
+		if s != test.out.s {
+			t.Errorf("#%d: got %q, expected %q", i, s, test.out.s)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	calendarNumber = regexp.MustCompile(`^[0-9]+$`)
+	// calendarSeconds may have fractions
+	calendarSeconds = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?$`)
+
+	calendarShorthands = []string{"minutely", "hourly", "daily", "weekly", "monthly", "quarterly", "semiannually", "yearly", "annually"}
+
+	weekdays = map[string]bool{
+		"mon": true, "monday": true,
+		"tue": true, "tuesday": true,
+		"wed": true, "wednesday": true,
+		"thu": true, "thursday": true,
+		"fri": true, "friday": true,
+		"sat": true, "saturday": true,
+		"sun": true, "sunday": true,
+	}
+
+	// timezoneAreas are the areas of the tz database, timezoneNames its zones
+	// without an area and timezoneLocation a location within an area, like
+	// Port-au-Prince or GMT+5
+	timezoneAreas = map[string]bool{
+		"Africa": true, "America": true, "Antarctica": true, "Arctic": true,
+		"Asia": true, "Atlantic": true, "Australia": true, "Europe": true,
+		"Indian": true, "Pacific": true, "Etc": true,
+		"Brazil": true, "Canada": true, "Chile": true, "Mexico": true, "US": true,
+	}
+	timezoneNames = map[string]bool{
+		"UTC": true, "UCT": true, "GMT": true, "GMT0": true, "GMT+0": true, "GMT-0": true,
+		"Greenwich": true, "Universal": true, "Zulu": true,
+		"CET": true, "EET": true, "MET": true, "WET": true,
+		"EST": true, "MST": true, "HST": true,
+		"EST5EDT": true, "CST6CDT": true, "MST7MDT": true, "PST8PDT": true,
+		"Cuba": true, "Egypt": true, "Eire": true, "GB": true, "GB-Eire": true,
+		"Hongkong": true, "Iceland": true, "Iran": true, "Israel": true,
+		"Jamaica": true, "Japan": true, "Kwajalein": true, "Libya": true,
+		"Navajo": true, "NZ": true, "NZ-CHAT": true, "Poland": true,
+		"Portugal": true, "PRC": true, "ROC": true, "ROK": true,
+		"Singapore": true, "Turkey": true, "W-SU": true,
+	}
+	timezoneLocation = regexp.MustCompile(`^[A-Z][A-Za-z0-9_+-]*$`)
+)
+
+// checkCalendar checks a calendar event expression of systemd.time(7), like
+// "Mon..Fri *-*-* 02:00:00" or "daily", as used by OnCalendar= of timers:
+//
+//	[WEEKDAYS] [[YEAR-]MONTH-DAY] [HOUR:MINUTE[:SECOND]] [TIMEZONE]
+//
+// Each component of the date and time is *, a value or a range like 1..5,
+// optionally repeated like */15, and may be a comma separated list of those.
+// The day may follow the month with ~ to count from the end of the month.
+func checkCalendar(s string) error {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return errors.New("empty calendar expression")
+	}
+	if len(fields) == 1 {
+		for _, shorthand := range calendarShorthands {
+			if strings.ToLower(fields[0]) == shorthand {
+				return nil
+			}
+		}
+	}
+
+	i := 0
+	if isWeekdays(fields[i]) {
+		if err := checkWeekdays(fields[i]); err != nil {
+			return err
+		}
+		i++
+	}
+	if i < len(fields) && isDate(fields[i]) {
+		if err := checkDate(fields[i]); err != nil {
+			return err
+		}
+		i++
+	}
+	if i < len(fields) && strings.Contains(fields[i], ":") {
+		if err := checkTime(fields[i]); err != nil {
+			return err
+		}
+		i++
+	}
+	if i == 0 {
+		return fmt.Errorf("expected a weekday, date or time, not %q", fields[0])
+	}
+	if i < len(fields) {
+		if i != len(fields)-1 || !isTimezone(fields[i]) {
+			return fmt.Errorf("unexpected %q", fields[i])
+		}
+	}
+	return nil
+}
+
+// isWeekdays returns whether field is meant to be a list of weekdays.
+func isWeekdays(field string) bool {
+	c := field[0]
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// isDate returns whether field is meant to be a date, rather than a time or a
+// timezone like America/Port-au-Prince.
+func isDate(field string) bool {
+	c := field[0]
+	return (c == '*' || (c >= '0' && c <= '9')) && strings.ContainsAny(field, "-~") && !strings.Contains(field, ":")
+}
+
+func checkWeekdays(field string) error {
+	for _, item := range strings.Split(field, ",") {
+		days := strings.Split(item, "..")
+		if len(days) == 1 {
+			// older versions of systemd use - for ranges
+			days = strings.Split(item, "-")
+		}
+		if len(days) > 2 {
+			return fmt.Errorf("invalid weekday range %q", item)
+		}
+		for _, day := range days {
+			if !weekdays[strings.ToLower(day)] {
+				return fmt.Errorf("unknown weekday %q", day)
+			}
+		}
+	}
+	return nil
+}
+
+func checkDate(field string) error {
+	// the day may be counted from the end of the month, like *-02~01
+	field = strings.Replace(field, "~", "-", 1)
+	parts := strings.Split(field, "-")
+	switch len(parts) {
+	case 2:
+		parts = append([]string{"*"}, parts...)
+	case 3:
+	default:
+		return fmt.Errorf("invalid date %q", field)
+	}
+	if err := checkComponent("year", parts[0], 1970, 2199, false); err != nil {
+		return err
+	}
+	if err := checkComponent("month", parts[1], 1, 12, false); err != nil {
+		return err
+	}
+	return checkComponent("day", parts[2], 1, 31, false)
+}
+
+func checkTime(field string) error {
+	parts := strings.Split(field, ":")
+	if len(parts) != 2 && len(parts) != 3 {
+		return fmt.Errorf("invalid time %q", field)
+	}
+	if err := checkComponent("hour", parts[0], 0, 23, false); err != nil {
+		return err
+	}
+	if err := checkComponent("minute", parts[1], 0, 59, false); err != nil {
+		return err
+	}
+	if len(parts) == 3 {
+		return checkComponent("second", parts[2], 0, 59, true)
+	}
+	return nil
+}
+
+// checkComponent checks a component of a date or time, whose values are
+// between min and max. Seconds may have fractions.
+func checkComponent(name, component string, min, max int, fractional bool) error {
+	if component == "" {
+		return fmt.Errorf("missing %s", name)
+	}
+	for _, item := range strings.Split(component, ",") {
+		value := item
+		if slash := strings.Index(item, "/"); slash >= 0 {
+			value = item[:slash]
+			repeat, ok := parseCalendarNumber(item[slash+1:], fractional)
+			if !ok || repeat <= 0 {
+				return fmt.Errorf("invalid %s repetition %q", name, item)
+			}
+		}
+		if value == "*" {
+			continue
+		}
+		bounds := strings.Split(value, "..")
+		if len(bounds) > 2 {
+			return fmt.Errorf("invalid %s range %q", name, item)
+		}
+		var values []float64
+		for _, bound := range bounds {
+			v, ok := parseCalendarNumber(bound, fractional)
+			if !ok {
+				return fmt.Errorf("invalid %s %q", name, bound)
+			}
+			if v < float64(min) || v >= float64(max+1) {
+				return fmt.Errorf("%s must be between %d and %d, not %s", name, min, max, bound)
+			}
+			values = append(values, v)
+		}
+		if len(values) == 2 && values[0] > values[1] {
+			return fmt.Errorf("invalid %s range %q", name, item)
+		}
+	}
+	return nil
+}
+
+// parseCalendarNumber parses a value of a component of a date or time.
+func parseCalendarNumber(s string, fractional bool) (float64, bool) {
+	re := calendarNumber
+	if fractional {
+		re = calendarSeconds
+	}
+	if !re.MatchString(s) {
+		return 0, false
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	return v, err == nil
+}
+
+// isTimezone returns whether field is a timezone systemd accepts. Zones are
+// checked against the areas of the tz database rather than the database of
+// the host ct runs on, so any syntactically valid Area/Location is accepted.
+func isTimezone(field string) bool {
+	parts := strings.Split(field, "/")
+	if len(parts) == 1 {
+		return timezoneNames[field]
+	}
+	if !timezoneAreas[parts[0]] || len(parts) > 3 {
+		return false
+	}
+	for _, part := range parts[1:] {
+		if !timezoneLocation.MatchString(part) {
+			return false
+		}
+	}
+	return true
+}
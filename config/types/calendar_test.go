@@ -0,0 +1,68 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"testing"
+)
+
+func TestCheckCalendar(t *testing.T) {
+	tests := []struct {
+		in  string
+		out string
+	}{
+		{in: "daily"},
+		{in: "Weekly"},
+		{in: "Mon..Fri *-*-* 02:00"},
+		{in: "Sat,Sun 10:00 UTC"},
+		{in: "*-*-* 08:00 America/Port-au-Prince"},
+		{in: "*-*-* 08:00 America/Argentina/Buenos_Aires"},
+		{in: "*-*-* 08:00 Etc/GMT+5"},
+		{in: "mon-wed 08:30:15.5"},
+		{in: "*-*-01 00:00:00"},
+		{in: "2018-12-24"},
+		{in: "*-02~01"},
+		{in: "*:0/15"},
+		{in: "0,12:00"},
+		{in: "*-1..6-* 3..5:*"},
+		{in: "", out: "empty calendar expression"},
+		{in: "foo", out: `unknown weekday "foo"`},
+		{in: "mon 25:00", out: "hour must be between 0 and 23, not 25"},
+		{in: "*:60", out: "minute must be between 0 and 59, not 60"},
+		{in: "*-13-01", out: "month must be between 1 and 12, not 13"},
+		{in: "*-*-32", out: "day must be between 1 and 31, not 32"},
+		{in: "1-2-3-4", out: `invalid date "1-2-3-4"`},
+		{in: "12", out: `expected a weekday, date or time, not "12"`},
+		{in: "*:*:1e1", out: `invalid second "1e1"`},
+		{in: "*:0/0", out: `invalid minute repetition "0/0"`},
+		{in: "10..2:00", out: `invalid hour range "10..2"`},
+		{in: "Mon..Fri..Sun", out: `invalid weekday range "Mon..Fri..Sun"`},
+		{in: "Mon 10:00 Nowhere/Town", out: `unexpected "Nowhere/Town"`},
+		{in: "Mon 10:00 Europe/berlin", out: `unexpected "Europe/berlin"`},
+		{in: "Mon 10:00 Local", out: `unexpected "Local"`},
+		{in: "10:00 Mon", out: `unexpected "Mon"`},
+	}
+
+	for i, test := range tests {
+		err := checkCalendar(test.in)
+		var out string
+		if err != nil {
+			out = err.Error()
+		}
+		if out != test.out {
+			t.Errorf("#%d: wanted %q, got %q", i, test.out, out)
+		}
+	}
+}
@@ -22,6 +22,7 @@ import (
 	ignTypes "github.com/coreos/ignition/config/v2_3/types"
 	"github.com/coreos/ignition/config/validate/report"
 
+	"github.com/coreos/container-linux-config-transpiler/config/astyaml"
 	"github.com/coreos/container-linux-config-transpiler/config/platform"
 	"github.com/coreos/container-linux-config-transpiler/config/templating"
 	"github.com/coreos/container-linux-config-transpiler/config/types/util"
@@ -37,8 +38,13 @@ var (
 )
 
 func init() {
-	register(func(in Config, ast astnode.AstNode, out ignTypes.Config, p string) (ignTypes.Config, report.Report, astnode.AstNode) {
+	register(func(in Config, ast astnode.AstNode, out ignTypes.Config, options ConvertOptions) (ignTypes.Config, report.Report, astnode.AstNode) {
+		p := options.Platform
 		if p == platform.OpenStackMetadata || p == platform.CloudStackConfigDrive {
+			for i := len(out.Systemd.Units); i < len(out.Systemd.Units)+2; i++ {
+				options.SourceMap.add(ast, fmt.Sprintf("systemd.units[%d]", i))
+				options.SourceMap.add(ast, fmt.Sprintf("systemd.units[%d].dropins[0]", i))
+			}
 			out.Systemd.Units = append(out.Systemd.Units, ignTypes.Unit{
 				Name: "coreos-metadata.service",
 				Dropins: []ignTypes.SystemdDropin{{
@@ -170,3 +176,38 @@ func getNodeChildPath(n astnode.AstNode, key ...interface{}) (astnode.AstNode, e
 	}
 	return getNodeChildPath(next, key[1:]...)
 }
+
+// ignPath converts the keys of a path using the Container Linux Config key
+// names to the ones of ast. Once it has json tags, like the tree converters
+// see, its keys are camelCased.
+func ignPath(ast astnode.AstNode, path []interface{}) []interface{} {
+	if n, ok := ast.(astyaml.YamlNode); !ok || n.Tag() != "json" {
+		return path
+	}
+	lookup := make([]interface{}, len(path))
+	for i, p := range path {
+		if key, ok := p.(string); ok {
+			p = astyaml.IgnKeyName(key)
+		}
+		lookup[i] = p
+	}
+	return lookup
+}
+
+// positionReport positions the entries of r at the node at path, which uses
+// the Container Linux Config key names, at its key if atKey is set and at its
+// value otherwise. If the node isn't in ast the path is recorded in paths
+// instead, so reports can still say which part of the config the entries are
+// about.
+func positionReport(r *report.Report, ast astnode.AstNode, paths *astyaml.ReportPaths, atKey bool, path ...interface{}) {
+	if n, err := getNodeChildPath(ast, ignPath(ast, path)...); err == nil {
+		var line, col int
+		if atKey {
+			line, col, _ = n.KeyLineCol(nil)
+		} else {
+			line, col, _ = n.ValueLineCol(nil)
+		}
+		r.AddPosition(line, col, "")
+	}
+	paths.Add(*r, path...)
+}
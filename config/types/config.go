@@ -16,8 +16,10 @@ package types
 
 import (
 	"errors"
+	"fmt"
 	"net/url"
 
+	"github.com/coreos/container-linux-config-transpiler/config/astyaml"
 	ignTypes "github.com/coreos/ignition/config/v2_3/types"
 	"github.com/coreos/ignition/config/validate/astnode"
 	"github.com/coreos/ignition/config/validate/report"
@@ -30,17 +32,21 @@ var (
 type Config struct {
 	// Version is intentionally undocumented. It is only for if we need to make a breaking
 	// change in the future.
-	Version   int        `yaml:"version"`
-	Ignition  Ignition   `yaml:"ignition"`
-	Storage   Storage    `yaml:"storage"`
-	Systemd   Systemd    `yaml:"systemd"`
-	Networkd  Networkd   `yaml:"networkd"`
-	Passwd    Passwd     `yaml:"passwd"`
-	Etcd      *Etcd      `yaml:"etcd"`
-	Flannel   *Flannel   `yaml:"flannel"`
-	Update    *Update    `yaml:"update"`
-	Docker    *Docker    `yaml:"docker"`
-	Locksmith *Locksmith `yaml:"locksmith"`
+	Version   int                 `yaml:"version"`
+	Variables map[string]Variable `yaml:"variables"`
+	Include   []string            `yaml:"include"`
+	Ignition  Ignition            `yaml:"ignition"`
+	Storage   Storage             `yaml:"storage"`
+	Systemd   Systemd             `yaml:"systemd"`
+	Networkd  Networkd            `yaml:"networkd"`
+	Passwd    Passwd              `yaml:"passwd"`
+	Etcd      *Etcd               `yaml:"etcd"`
+	Flannel   *Flannel            `yaml:"flannel"`
+	Update    *Update             `yaml:"update"`
+	Docker    *Docker             `yaml:"docker"`
+	Locksmith *Locksmith          `yaml:"locksmith"`
+	// Containers are rendered into the systemd units running them
+	Containers []Container `yaml:"containers"`
 }
 
 type Ignition struct {
@@ -72,43 +78,41 @@ func (c Config) ValidateVersion() report.Report {
 }
 
 func init() {
-	register(func(in Config, ast astnode.AstNode, out ignTypes.Config, platform string) (ignTypes.Config, report.Report, astnode.AstNode) {
+	register(func(in Config, ast astnode.AstNode, out ignTypes.Config, options ConvertOptions) (ignTypes.Config, report.Report, astnode.AstNode) {
 		r := report.Report{}
 		out.Ignition.Timeouts.HTTPResponseHeaders = in.Ignition.Timeouts.HTTPResponseHeaders
 		out.Ignition.Timeouts.HTTPTotal = in.Ignition.Timeouts.HTTPTotal
-		cfgNode, _ := getNodeChildPath(ast, "ignition", "config", "append")
 		for i, ref := range in.Ignition.Config.Append {
-			tmp, _ := getNodeChild(cfgNode, i)
-			newRef, convertReport := convertConfigReference(ref, tmp)
+			newRef, convertReport := convertConfigReference(ref, ast, options.ReportPaths, "ignition", "config", "append", i)
 			r.Merge(convertReport)
 			if convertReport.IsFatal() {
 				// don't add to the output if invalid
 				continue
 			}
+			options.SourceMap.add(ast, fmt.Sprintf("ignition.config.append[%d]", len(out.Ignition.Config.Append)), "ignition", "config", "append", i)
 			out.Ignition.Config.Append = append(out.Ignition.Config.Append, newRef)
 		}
 
-		cfgNode, _ = getNodeChildPath(ast, "ignition", "config", "replace")
 		if in.Ignition.Config.Replace != nil {
-			newRef, convertReport := convertConfigReference(*in.Ignition.Config.Replace, cfgNode)
+			newRef, convertReport := convertConfigReference(*in.Ignition.Config.Replace, ast, options.ReportPaths, "ignition", "config", "replace")
 			r.Merge(convertReport)
 			if convertReport.IsFatal() {
 				// don't add to the output if invalid
 				return out, r, ast
 			}
+			options.SourceMap.add(ast, "ignition.config.replace", "ignition", "config", "replace")
 			out.Ignition.Config.Replace = &newRef
 		}
 		return out, r, ast
 	})
 }
 
-func convertConfigReference(in ConfigReference, ast astnode.AstNode) (ignTypes.ConfigReference, report.Report) {
+// convertConfigReference converts the config reference at path.
+func convertConfigReference(in ConfigReference, ast astnode.AstNode, paths *astyaml.ReportPaths, path ...interface{}) (ignTypes.ConfigReference, report.Report) {
 	_, err := url.Parse(in.Source)
 	if err != nil {
 		r := report.ReportFromError(err, report.EntryError)
-		if n, err := getNodeChild(ast, "source"); err == nil {
-			r.AddPosition(n.ValueLineCol(nil))
-		}
+		positionReport(&r, ast, paths, false, append(path, "source")...)
 		return ignTypes.ConfigReference{}, r
 	}
 
@@ -18,21 +18,73 @@ import (
 	"reflect"
 
 	"github.com/coreos/container-linux-config-transpiler/config/astyaml"
+	"github.com/coreos/container-linux-config-transpiler/config/localfs"
 	ignTypes "github.com/coreos/ignition/config/v2_3/types"
 	"github.com/coreos/ignition/config/validate"
 	"github.com/coreos/ignition/config/validate/astnode"
 	"github.com/coreos/ignition/config/validate/report"
 )
 
-type converter func(in Config, ast astnode.AstNode, out ignTypes.Config, platform string) (ignTypes.Config, report.Report, astnode.AstNode)
+// ConvertOptions holds the settings that control a single conversion. It is
+// passed to every registered converter, so that conversions don't depend on
+// any global state and can safely run side by side.
+type ConvertOptions struct {
+	// Platform is the platform to target. It is either one of the platforms
+	// defined in config/platform or empty if dynamic data isn't used.
+	Platform string
+	// DynamicDataInContents enables dynamic data in the contents of systemd
+	// and networkd units and in inline file contents. Without it, dynamic
+	// data is only replaced in the etcd and flannel sections and contents
+	// are written as they are.
+	DynamicDataInContents bool
+	// FilesDir is the directory that the paths of local file sources are
+	// relative to. It is ignored if Files is set.
+	FilesDir string
+	// Files is the file system that local file sources are read from. If
+	// neither Files nor FilesDir is set, local file sources are an error.
+	Files localfs.FS
+	// IgnitionVersion is the Ignition spec version to generate. It is one of
+	// IgnitionVersions, or empty for DefaultIgnitionVersion.
+	IgnitionVersion string
+	// SourceMap, if set, is filled in with the source of every element of
+	// the generated config. Its contents are meaningless if the conversion
+	// fails.
+	SourceMap *SourceMap
+	// ReportPaths, if set, is filled in with the paths of the entries of
+	// the report that have no position.
+	ReportPaths *astyaml.ReportPaths
+}
+
+// files returns the file system that local file sources are read from, or nil
+// if none was configured.
+func (o ConvertOptions) files() localfs.FS {
+	if o.Files != nil {
+		return o.Files
+	}
+	if o.FilesDir != "" {
+		return localfs.Dir(o.FilesDir)
+	}
+	return nil
+}
 
+type converter func(in Config, ast astnode.AstNode, out ignTypes.Config, options ConvertOptions) (ignTypes.Config, report.Report, astnode.AstNode)
+
+// converters are only registered by init functions and never change
+// afterwards, so Convert can be called concurrently.
 var converters []converter
 
 func register(f converter) {
 	converters = append(converters, f)
 }
 
-func Convert(in Config, platform string, ast astnode.AstNode) (ignTypes.Config, report.Report) {
+func Convert(in Config, options ConvertOptions, ast astnode.AstNode) (ignTypes.Config, report.Report) {
+	version, err := ParseIgnitionVersion(options.IgnitionVersion)
+	if err != nil {
+		return ignTypes.Config{}, report.ReportFromError(err, report.EntryError)
+	}
+
+	r := checkIgnitionVersion(in, ast, options.ReportPaths, version, options.Platform)
+
 	// convert our tree from having yaml tags to having json tags, so when Validate() is
 	// called on the tree, it can find the keys in the ignition structs (which are denoted
 	// by `json` tags)
@@ -43,15 +95,13 @@ func Convert(in Config, platform string, ast astnode.AstNode) (ignTypes.Config,
 
 	out := ignTypes.Config{
 		Ignition: ignTypes.Ignition{
-			Version: "2.3.0",
+			Version: ignition2_3.String(),
 		},
 	}
 
-	r := report.Report{}
-
 	for _, convert := range converters {
 		var subReport report.Report
-		out, subReport, ast = convert(in, ast, out, platform)
+		out, subReport, ast = convert(in, ast, out, options)
 		r.Merge(subReport)
 	}
 	if r.IsFatal() {
@@ -64,5 +114,6 @@ func Convert(in Config, platform string, ast astnode.AstNode) (ignTypes.Config,
 		return ignTypes.Config{}, r
 	}
 
-	return out, r
+	// validation is done against the newest spec, so only downgrade afterwards
+	return downgradeConfig(out, version), r
 }
@@ -52,9 +52,10 @@ type Partition struct {
 }
 
 func init() {
-	register(func(in Config, ast astnode.AstNode, out ignTypes.Config, platform string) (ignTypes.Config, report.Report, astnode.AstNode) {
+	register(func(in Config, ast astnode.AstNode, out ignTypes.Config, options ConvertOptions) (ignTypes.Config, report.Report, astnode.AstNode) {
 		r := report.Report{}
 		for disk_idx, disk := range in.Storage.Disks {
+			options.SourceMap.add(ast, fmt.Sprintf("storage.disks[%d]", len(out.Storage.Disks)), "storage", "disks", disk_idx)
 			newDisk := ignTypes.Disk{
 				Device:    disk.Device,
 				WipeTable: disk.WipeTable,
@@ -65,9 +66,7 @@ func init() {
 				size, err := convertPartitionDimension(partition.Size)
 				if err != nil {
 					convertReport := report.ReportFromError(err, report.EntryError)
-					if sub_node, err := getNodeChildPath(ast, "storage", "disks", disk_idx, "partitions", part_idx, "size"); err == nil {
-						convertReport.AddPosition(sub_node.ValueLineCol(nil))
-					}
+					positionReport(&convertReport, ast, options.ReportPaths, false, "storage", "disks", disk_idx, "partitions", part_idx, "size")
 					r.Merge(convertReport)
 					// dont add invalid partitions
 					continue
@@ -75,9 +74,7 @@ func init() {
 				start, err := convertPartitionDimension(partition.Start)
 				if err != nil {
 					convertReport := report.ReportFromError(err, report.EntryError)
-					if sub_node, err := getNodeChildPath(ast, "storage", "disks", disk_idx, "partitions", part_idx, "start"); err == nil {
-						convertReport.AddPosition(sub_node.ValueLineCol(nil))
-					}
+					positionReport(&convertReport, ast, options.ReportPaths, false, "storage", "disks", disk_idx, "partitions", part_idx, "start")
 					r.Merge(convertReport)
 					// dont add invalid partitions
 					continue
@@ -94,6 +91,7 @@ func init() {
 					GUID:     partition.GUID,
 					TypeGUID: partition.TypeGUID,
 				}
+				options.SourceMap.add(ast, fmt.Sprintf("storage.disks[%d].partitions[%d]", len(out.Storage.Disks), len(newDisk.Partitions)), "storage", "disks", disk_idx, "partitions", part_idx)
 				newDisk.Partitions = append(newDisk.Partitions, newPart)
 			}
 
@@ -28,9 +28,11 @@ type Docker struct {
 }
 
 func init() {
-	register(func(in Config, ast astnode.AstNode, out ignTypes.Config, platform string) (ignTypes.Config, report.Report, astnode.AstNode) {
+	register(func(in Config, ast astnode.AstNode, out ignTypes.Config, options ConvertOptions) (ignTypes.Config, report.Report, astnode.AstNode) {
 		if in.Docker != nil {
 			contents := fmt.Sprintf("[Service]\nEnvironment=\"DOCKER_OPTS=%s\"", strings.Join(in.Docker.Flags, " "))
+			options.SourceMap.add(ast, fmt.Sprintf("systemd.units[%d]", len(out.Systemd.Units)), "docker")
+			options.SourceMap.add(ast, fmt.Sprintf("systemd.units[%d].dropins[0]", len(out.Systemd.Units)), "docker")
 			out.Systemd.Units = append(out.Systemd.Units, ignTypes.Unit{
 				Name:   "docker.service",
 				Enable: true,
@@ -0,0 +1,234 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	ignTypes "github.com/coreos/ignition/config/v2_3/types"
+	"github.com/coreos/ignition/config/validate/astnode"
+	"github.com/coreos/ignition/config/validate/report"
+	"github.com/vincent-petithory/dataurl"
+
+	"github.com/coreos/container-linux-config-transpiler/config/astyaml"
+	"github.com/coreos/container-linux-config-transpiler/config/templating"
+	"github.com/coreos/container-linux-config-transpiler/config/types/util"
+	"github.com/coreos/container-linux-config-transpiler/config/unitfile"
+	iutil "github.com/coreos/container-linux-config-transpiler/internal/util"
+)
+
+const (
+	// templateDir is where the templates of files with dynamic data are
+	// written to, under the path of the file they are rendered to.
+	templateDir = "/var/lib/clct/templates"
+
+	metadataDropinName = "20-clct-metadata.conf"
+)
+
+var (
+	ErrTemplatingFilesystem = errors.New("dynamic data can only be used in files on the root filesystem")
+	ErrTemplatingAppend     = errors.New("dynamic data can't be used in files that are appended to")
+)
+
+// replaceFields replaces the dynamic data in the contents s with references
+// to the variables coreos-metadata sets on the platform. It returns whether
+// there was any. Escaped references are unescaped. Unless dynamic data in
+// contents is enabled, s is returned as it is.
+func replaceFields(options ConvertOptions, s string) (string, bool, error) {
+	if !options.DynamicDataInContents {
+		return s, false, nil
+	}
+	fields := templating.FindFields(s)
+	if len(fields) == 0 {
+		return templating.Unescape(s), false, nil
+	}
+	if options.Platform == "" {
+		return "", false, ErrPlatformUnspecified
+	}
+	out, err := templating.ReplaceFields(options.Platform, s)
+	if err != nil {
+		return "", false, fieldError(options.Platform, fields, err)
+	}
+	return out, true, nil
+}
+
+// unescapeFields unescapes the escaped references in the contents s, which
+// only have escapes if dynamic data in contents is enabled.
+func unescapeFields(options ConvertOptions, s string) string {
+	if !options.DynamicDataInContents {
+		return s
+	}
+	return templating.Unescape(s)
+}
+
+// replaceUnitFields works like replaceFields for the contents of the systemd
+// unit named name or one of its drop-ins. systemd only expands variables in
+// the commands of services, so dynamic data anywhere else is an error.
+func replaceUnitFields(options ConvertOptions, name, contents string) (string, bool, error) {
+	if options.DynamicDataInContents && len(templating.FindFields(contents)) > 0 {
+		// contents that can't be parsed are reported by the checks
+		// of the unit contents
+		opts, _ := unitfile.Parse(contents)
+		service := unitfile.Type(name) == "service"
+		for _, opt := range opts {
+			fields := templating.FindFields(opt.Value)
+			if len(fields) == 0 || service && opt.Section == "Service" && strings.HasPrefix(opt.Name, "Exec") {
+				continue
+			}
+			return "", false, fmt.Errorf("dynamic data {%s} can't be used in %s of %s, systemd only expands it in the Exec directives of services", fields[0], opt.Name, name)
+		}
+	}
+	return replaceFields(options, contents)
+}
+
+// fieldError makes the errors of the templating package more helpful by
+// naming the field that isn't available.
+func fieldError(platform string, fields []string, err error) error {
+	if err != templating.ErrUnknownField {
+		return err
+	}
+	for _, field := range fields {
+		if _, err := templating.FieldVariable(platform, field); err != nil {
+			return fmt.Errorf("dynamic data {%s} is not available on platform %q", field, platform)
+		}
+	}
+	return err
+}
+
+// templatingReport reports an error in the dynamic data of the value at path.
+func templatingReport(ast astnode.AstNode, paths *astyaml.ReportPaths, err error, path ...interface{}) report.Report {
+	r := report.ReportFromError(err, report.EntryError)
+	positionReport(&r, ast, paths, false, path...)
+	return r
+}
+
+// metadataDropin returns a dropin that makes a service wait for
+// coreos-metadata and load the variables it sets.
+func metadataDropin() ignTypes.SystemdDropin {
+	unit := util.NewSystemdUnit()
+	unit.Unit.Add("Requires=coreos-metadata.service")
+	unit.Unit.Add("After=coreos-metadata.service")
+	unit.Service.Add("EnvironmentFile=/run/metadata/coreos")
+	return ignTypes.SystemdDropin{
+		Name:     metadataDropinName,
+		Contents: unit.String(),
+	}
+}
+
+// renderProgram is the awk program render units run. Its arguments are the
+// template, the file to render it to and pairs of a marker and the variable
+// holding its value. It reads the template as one record and replaces the
+// markers in a single pass, so unlike with sed the values are written as they
+// are, whatever characters they contain.
+const renderProgram = `BEGIN { RS = "^$"; out = ARGV[2]; for (i = 3; i < ARGC; i += 2) m[ARGV[i]] = ENVIRON[ARGV[i + 1]]; ARGC = 2 } ` +
+	`{ s = $0; r = ""; while (match(s, /@CLCT_[A-Z0-9_]+@/)) { k = substr(s, RSTART, RLENGTH); r = r substr(s, 1, RSTART - 1) (k in m ? m[k] : k); s = substr(s, RSTART + RLENGTH) } printf "%s", r s > out }`
+
+// renderUnit returns a oneshot unit that renders the template of the file at
+// path by replacing its dynamic data with the values from coreos-metadata at
+// every boot. The template must have been written to templatePath(path) by
+// templateFile.
+// post, if set, is run once the file has been rendered.
+// The unit keeps its default dependencies and is ordered before
+// multi-user.target, so services in that target that read the file still have
+// to order themselves after the unit; a comment in the unit says how.
+func renderUnit(platform, path, contents, post string) (ignTypes.Unit, error) {
+	fields := templating.FindFields(contents)
+
+	unit := util.NewSystemdUnit()
+	name := renderUnitName(path)
+	unit.Unit.Add(fmt.Sprintf("# Units reading %s should have After=%s and Requires=%s", path, name, name))
+	unit.Unit.Add(fmt.Sprintf("Description=Render %s from dynamic data", path))
+	unit.Unit.Add("Requires=coreos-metadata.service")
+	unit.Unit.Add("After=coreos-metadata.service")
+	unit.Unit.Add("Before=multi-user.target")
+	unit.Service.Add("Type=oneshot")
+	unit.Service.Add("RemainAfterExit=yes")
+	unit.Service.Add("EnvironmentFile=/run/metadata/coreos")
+	unit.Service.Add(fmt.Sprintf("ExecStart=/usr/bin/cp --preserve=mode,ownership %s %s", templatePath(path), path))
+	args := []string{"/usr/bin/awk", renderProgram, templatePath(path), path}
+	for _, field := range fields {
+		v, err := templating.FieldVariable(platform, field)
+		if err != nil {
+			return ignTypes.Unit{}, fieldError(platform, fields, err)
+		}
+		args = append(args, templateMarker(field), v)
+	}
+	unit.Service.Add("ExecStart=" + execArgs(args))
+	if post != "" {
+		unit.Service.Add("ExecStartPost=" + post)
+	}
+	unit.Install.Add("WantedBy=multi-user.target")
+
+	return ignTypes.Unit{
+		Name:     name,
+		Enabled:  iutil.BoolToPtr(true),
+		Contents: unit.String(),
+	}, nil
+}
+
+// templateContents marks the dynamic data in contents so that the render unit
+// only replaces it and not, say, ${HOSTNAME} in a shell script.
+func templateContents(contents string) string {
+	return templating.ReplaceFieldsFunc(contents, templateMarker)
+}
+
+func templateMarker(field string) string {
+	return "@CLCT_" + field + "@"
+}
+
+// templateFile returns the template of the file at path.
+func templateFile(path, contents string) ignTypes.File {
+	return ignTypes.File{
+		Node: ignTypes.Node{
+			Filesystem: "root",
+			Path:       templatePath(path),
+		},
+		FileEmbedded1: ignTypes.FileEmbedded1{
+			Mode: iutil.IntToPtr(DefaultFileMode),
+			Contents: ignTypes.FileContents{
+				Source: (&url.URL{
+					Scheme: "data",
+					Opaque: "," + dataurl.EscapeString(templateContents(contents)),
+				}).String(),
+			},
+		},
+	}
+}
+
+func templatePath(path string) string {
+	return templateDir + path
+}
+
+// renderUnitName returns the name of the unit rendering the file at path,
+// escaping the path like systemd-escape --path.
+func renderUnitName(path string) string {
+	path = strings.Trim(path, "/")
+	name := "clct-render-"
+	for i := 0; i < len(path); i++ {
+		switch c := path[i]; {
+		case c == '/':
+			name += "-"
+		case c == '.' && i == 0,
+			!(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == ':' || c == '_' || c == '.'):
+			name += fmt.Sprintf(`\x%02x`, c)
+		default:
+			name += string(c)
+		}
+	}
+	return name + ".service"
+}
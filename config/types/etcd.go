@@ -17,6 +17,7 @@ package types
 import (
 	"errors"
 	"fmt"
+	"reflect"
 
 	"github.com/coreos/go-semver/semver"
 	ignTypes "github.com/coreos/ignition/config/v2_3/types"
@@ -90,48 +91,45 @@ func (etcd *Etcd) UnmarshalYAML(unmarshal func(interface{}) error) error {
 		version = semver.Version(*etcd.Version)
 	}
 
-	if version.Major == 2 && version.Minor >= 3 {
-		o := Etcd2{}
-		if err := unmarshal(&o); err != nil {
+	if o := EtcdOptions(version); o != nil {
+		v := reflect.New(reflect.TypeOf(o))
+		if err := unmarshal(v.Interface()); err != nil {
 			return err
 		}
-		etcd.Options = o
+		etcd.Options = v.Elem().Interface()
+	}
+
+	return nil
+}
+
+// EtcdOptions returns the zero value of the options struct for the given etcd
+// version, or nil if the version is not supported.
+func EtcdOptions(version semver.Version) Options {
+	if version.Major == 2 && version.Minor >= 3 {
+		return Etcd2{}
 	} else if version.Major == 3 && version.Minor == 0 {
-		o := Etcd3_0{}
-		if err := unmarshal(&o); err != nil {
-			return err
-		}
-		etcd.Options = o
+		return Etcd3_0{}
 	} else if version.Major == 3 && version.Minor == 1 {
-		o := Etcd3_1{}
-		if err := unmarshal(&o); err != nil {
-			return err
-		}
-		etcd.Options = o
+		return Etcd3_1{}
 	} else if version.Major == 3 && version.Minor == 2 {
-		o := Etcd3_2{}
-		if err := unmarshal(&o); err != nil {
-			return err
-		}
-		etcd.Options = o
+		return Etcd3_2{}
 	} else if version.Major == 3 && version.Minor >= 3 {
-		o := Etcd3_3{}
-		if err := unmarshal(&o); err != nil {
-			return err
-		}
-		etcd.Options = o
+		return Etcd3_3{}
 	}
-
 	return nil
 }
 
 func init() {
-	register(func(in Config, ast astnode.AstNode, out ignTypes.Config, platform string) (ignTypes.Config, report.Report, astnode.AstNode) {
+	register(func(in Config, ast astnode.AstNode, out ignTypes.Config, options ConvertOptions) (ignTypes.Config, report.Report, astnode.AstNode) {
 		if in.Etcd != nil {
-			contents, err := etcdContents(*in.Etcd, platform)
+			contents, err := etcdContents(*in.Etcd, options.Platform)
 			if err != nil {
-				return ignTypes.Config{}, report.ReportFromError(err, report.EntryError), ast
+				r := report.ReportFromError(err, report.EntryError)
+				positionReport(&r, ast, options.ReportPaths, true, "etcd")
+				return ignTypes.Config{}, r, ast
 			}
+			options.SourceMap.add(ast, fmt.Sprintf("systemd.units[%d]", len(out.Systemd.Units)), "etcd")
+			options.SourceMap.add(ast, fmt.Sprintf("systemd.units[%d].dropins[0]", len(out.Systemd.Units)), "etcd")
 			out.Systemd.Units = append(out.Systemd.Units, ignTypes.Unit{
 				Name:   "etcd-member.service",
 				Enable: true,
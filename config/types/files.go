@@ -16,11 +16,8 @@ package types
 
 import (
 	"errors"
-	"flag"
 	"fmt"
-	"io/ioutil"
 	"net/url"
-	"path"
 
 	"github.com/coreos/container-linux-config-transpiler/config/astyaml"
 	"github.com/coreos/container-linux-config-transpiler/internal/util"
@@ -40,6 +37,7 @@ var (
 	WarningUnsetDirMode         = fmt.Errorf("mode unspecified for directory, defaulting to %#o", DefaultDirMode)
 
 	ErrTooManyFileSources = errors.New("only one of the following can be set: local, inline, remote.url")
+	ErrNoFilesDir         = errors.New("local files require setting the --files-dir flag to the directory that contains the file")
 )
 
 type FileUser struct {
@@ -61,6 +59,7 @@ type File struct {
 	Contents   FileContents `yaml:"contents"`
 	Overwrite  *bool        `yaml:"overwrite"`
 	Append     bool         `yaml:"append"`
+	Platforms  Platforms    `yaml:"platforms"`
 }
 
 type FileContents struct {
@@ -129,11 +128,31 @@ func (fc FileContents) Validate() report.Report {
 	return report.Report{}
 }
 
+// fileRenderUnit returns the unit rendering a file with dynamic data in its
+// inline contents, and whether there was any.
+func fileRenderUnit(file File, options ConvertOptions) (ignTypes.Unit, bool, error) {
+	if _, templated, err := replaceFields(options, file.Contents.Inline); err != nil || !templated {
+		return ignTypes.Unit{}, false, err
+	}
+	if file.Filesystem != "root" {
+		return ignTypes.Unit{}, false, ErrTemplatingFilesystem
+	}
+	if file.Append {
+		return ignTypes.Unit{}, false, ErrTemplatingAppend
+	}
+	unit, err := renderUnit(options.Platform, file.Path, file.Contents.Inline, "")
+	return unit, err == nil, err
+}
+
 func init() {
-	register(func(in Config, ast astnode.AstNode, out ignTypes.Config, platform string) (ignTypes.Config, report.Report, astnode.AstNode) {
+	register(func(in Config, ast astnode.AstNode, out ignTypes.Config, options ConvertOptions) (ignTypes.Config, report.Report, astnode.AstNode) {
 		r := report.Report{}
 		files_node, _ := getNodeChildPath(ast, "storage", "files")
 		for i, file := range in.Storage.Files {
+			if skip, skipReport := skipForPlatform(file.Platforms, ast, options.ReportPaths, options.Platform, "storage", "files", i); skip {
+				r.Merge(skipReport)
+				continue
+			}
 			if file.Mode == nil {
 				file.Mode = util.IntToPtr(DefaultFileMode)
 			}
@@ -166,37 +185,42 @@ func init() {
 			}
 
 			if file.Contents.Inline != "" {
+				unit, templated, err := fileRenderUnit(file, options)
+				if err != nil {
+					r.Merge(templatingReport(ast, options.ReportPaths, err, "storage", "files", i, "contents", "inline"))
+					continue
+				}
+				contents := unescapeFields(options, file.Contents.Inline)
+				if templated {
+					// write the template instead, the unit renders the file
+					newFile.Path = templatePath(file.Path)
+					contents = templateContents(file.Contents.Inline)
+					options.SourceMap.add(ast, fmt.Sprintf("systemd.units[%d]", len(out.Systemd.Units)), "storage", "files", i)
+					out.Systemd.Units = append(out.Systemd.Units, unit)
+				}
 				newFile.Contents = ignTypes.FileContents{
 					Source: (&url.URL{
 						Scheme: "data",
-						Opaque: "," + dataurl.EscapeString(file.Contents.Inline),
+						Opaque: "," + dataurl.EscapeString(contents),
 					}).String(),
 				}
 			}
 
 			if file.Contents.Local != "" {
-				// The provided local file path is relative to the value of the
-				// --files-dir flag.
-				filesDir := flag.Lookup("files-dir")
-				if filesDir == nil || filesDir.Value.String() == "" {
-					err := errors.New("local files require setting the --files-dir flag to the directory that contains the file")
-					flagReport := report.ReportFromError(err, report.EntryError)
-					if n, err := getNodeChildPath(file_node, "contents", "local"); err == nil {
-						line, col, _ := n.ValueLineCol(nil)
-						flagReport.AddPosition(line, col, "")
-					}
+				// The provided local file path is relative to the root of the
+				// file system in the conversion options.
+				files := options.files()
+				if files == nil {
+					flagReport := report.ReportFromError(ErrNoFilesDir, report.EntryError)
+					positionReport(&flagReport, ast, options.ReportPaths, false, "storage", "files", i, "contents", "local")
 					r.Merge(flagReport)
 					continue
 				}
-				localPath := path.Join(filesDir.Value.String(), file.Contents.Local)
-				contents, err := ioutil.ReadFile(localPath)
+				contents, err := files.ReadFile(file.Contents.Local)
 				if err != nil {
 					// If the file could not be read, record error and continue.
 					convertReport := report.ReportFromError(err, report.EntryError)
-					if n, err := getNodeChildPath(file_node, "contents", "local"); err == nil {
-						line, col, _ := n.ValueLineCol(nil)
-						convertReport.AddPosition(line, col, "")
-					}
+					positionReport(&convertReport, ast, options.ReportPaths, false, "storage", "files", i, "contents", "local")
 					r.Merge(convertReport)
 					continue
 				}
@@ -215,10 +239,7 @@ func init() {
 				if err != nil {
 					// if invalid, record error and continue
 					convertReport := report.ReportFromError(err, report.EntryError)
-					if n, err := getNodeChildPath(file_node, "contents", "remote", "url"); err == nil {
-						line, col, _ := n.ValueLineCol(nil)
-						convertReport.AddPosition(line, col, "")
-					}
+					positionReport(&convertReport, ast, options.ReportPaths, false, "storage", "files", i, "contents", "remote", "url")
 					r.Merge(convertReport)
 					continue
 				}
@@ -248,9 +269,10 @@ func init() {
 			newFile.Contents.Compression = file.Contents.Remote.Compression
 			newFile.Contents.Verification = convertVerification(file.Contents.Remote.Verification)
 
+			options.SourceMap.add(ast, fmt.Sprintf("storage.files[%d]", len(out.Storage.Files)), "storage", "files", i)
 			out.Storage.Files = append(out.Storage.Files, newFile)
 		}
-		for _, dir := range in.Storage.Directories {
+		for i, dir := range in.Storage.Directories {
 			if dir.Mode == nil {
 				dir.Mode = util.IntToPtr(DefaultDirMode)
 			}
@@ -279,9 +301,10 @@ func init() {
 					Name: dir.Group.Name,
 				}
 			}
+			options.SourceMap.add(ast, fmt.Sprintf("storage.directories[%d]", len(out.Storage.Directories)), "storage", "directories", i)
 			out.Storage.Directories = append(out.Storage.Directories, newDir)
 		}
-		for _, link := range in.Storage.Links {
+		for i, link := range in.Storage.Links {
 			if link.Filesystem == "" {
 				link.Filesystem = "root"
 			}
@@ -308,6 +331,7 @@ func init() {
 					Name: link.Group.Name,
 				}
 			}
+			options.SourceMap.add(ast, fmt.Sprintf("storage.links[%d]", len(out.Storage.Links)), "storage", "links", i)
 			out.Storage.Links = append(out.Storage.Links, newLink)
 		}
 		return out, r, ast
@@ -0,0 +1,130 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/coreos/container-linux-config-transpiler/config/astyaml"
+	"github.com/coreos/container-linux-config-transpiler/config/localfs"
+	ignTypes "github.com/coreos/ignition/config/v2_3/types"
+	"github.com/coreos/ignition/config/validate/report"
+)
+
+func TestConvertLocalFile(t *testing.T) {
+	dirs := map[string]string{}
+	for _, contents := range []string{"first", "second"} {
+		dir, err := ioutil.TempDir("", "ct-files-dir")
+		if err != nil {
+			t.Fatalf("failed to create temporary directory: %v", err)
+		}
+		defer os.RemoveAll(dir)
+		if err := ioutil.WriteFile(filepath.Join(dir, "file"), []byte(contents), 0644); err != nil {
+			t.Fatalf("failed to write local file: %v", err)
+		}
+		dirs[contents] = dir
+	}
+
+	in := Config{
+		Storage: Storage{
+			Files: []File{{
+				Path:     "/opt/file",
+				Contents: FileContents{Local: "file"},
+			}},
+		},
+	}
+
+	tests := []struct {
+		filesDir string
+		source   string
+		r        report.Report
+	}{
+		{dirs["first"], "data:,first", report.Report{}},
+		{dirs["second"], "data:,second", report.Report{}},
+		{"", "", localFileReport(ErrNoFilesDir)},
+	}
+
+	for i, test := range tests {
+		paths := &astyaml.ReportPaths{}
+		out, r := Convert(in, ConvertOptions{FilesDir: test.filesDir, ReportPaths: paths}, nil)
+		checkLocalFile(t, i, out, r, paths, test.source, test.r)
+	}
+}
+
+func TestConvertLocalFileFromFS(t *testing.T) {
+	files := localfs.Map{
+		"file":     []byte("contents"),
+		"dir/file": []byte("nested"),
+	}
+
+	tests := []struct {
+		local  string
+		source string
+		r      report.Report
+	}{
+		{"file", "data:,contents", report.Report{}},
+		{"dir/file", "data:,nested", report.Report{}},
+		{"/dir/../file", "data:,contents", report.Report{}},
+		{"../../etc/shadow", "", localFileReport(localfs.ErrOutsideRoot)},
+	}
+
+	for i, test := range tests {
+		in := Config{
+			Storage: Storage{
+				Files: []File{{
+					Path:     "/opt/file",
+					Contents: FileContents{Local: test.local},
+				}},
+			},
+		}
+		paths := &astyaml.ReportPaths{}
+		out, r := Convert(in, ConvertOptions{Files: files, FilesDir: "/ignored", ReportPaths: paths}, nil)
+		checkLocalFile(t, i, out, r, paths, test.source, test.r)
+	}
+}
+
+// localFileReport returns the report of an error reading the local file of
+// the first file.
+func localFileReport(err error) report.Report {
+	return report.ReportFromError(err, report.EntryError)
+}
+
+// checkLocalFile checks the output and report of converting the first file,
+// and that the entries of the report, which have no position since the tests
+// have no AST, record the path of its local contents.
+func checkLocalFile(t *testing.T, i int, out ignTypes.Config, r report.Report, paths *astyaml.ReportPaths, source string, expected report.Report) {
+	if !reflect.DeepEqual(expected, r) {
+		t.Errorf("#%d: wanted report %v, got %v", i, expected, r)
+	}
+	for _, path := range paths.Lookup(r) {
+		if path != "storage.files[0].contents.local" {
+			t.Errorf("#%d: wanted path of the local contents, got %q", i, path)
+		}
+	}
+	if source == "" {
+		return
+	}
+	if len(out.Storage.Files) != 1 {
+		t.Errorf("#%d: wanted 1 file, got %d", i, len(out.Storage.Files))
+		return
+	}
+	if got := out.Storage.Files[0].Contents.Source; got != source {
+		t.Errorf("#%d: wanted source %q, got %q", i, source, got)
+	}
+}
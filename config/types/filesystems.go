@@ -15,6 +15,8 @@
 package types
 
 import (
+	"fmt"
+
 	ignTypes "github.com/coreos/ignition/config/v2_3/types"
 	"github.com/coreos/ignition/config/validate/astnode"
 	"github.com/coreos/ignition/config/validate/report"
@@ -42,9 +44,9 @@ type Create struct {
 }
 
 func init() {
-	register(func(in Config, ast astnode.AstNode, out ignTypes.Config, platform string) (ignTypes.Config, report.Report, astnode.AstNode) {
+	register(func(in Config, ast astnode.AstNode, out ignTypes.Config, options ConvertOptions) (ignTypes.Config, report.Report, astnode.AstNode) {
 		r := report.Report{}
-		for _, filesystem := range in.Storage.Filesystems {
+		for i, filesystem := range in.Storage.Filesystems {
 			newFilesystem := ignTypes.Filesystem{
 				Name: filesystem.Name,
 				Path: filesystem.Path,
@@ -68,6 +70,7 @@ func init() {
 				}
 			}
 
+			options.SourceMap.add(ast, fmt.Sprintf("storage.filesystems[%d]", len(out.Storage.Filesystems)), "storage", "filesystems", i)
 			out.Storage.Filesystems = append(out.Storage.Filesystems, newFilesystem)
 		}
 		return out, r, ast
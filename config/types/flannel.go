@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"reflect"
 
 	"github.com/coreos/go-semver/semver"
 	ignTypes "github.com/coreos/ignition/config/v2_3/types"
@@ -92,35 +93,40 @@ func (flannel *Flannel) UnmarshalYAML(unmarshal func(interface{}) error) error {
 		v = semver.Version(*flannel.Version)
 	}
 
-	if v.Major == 0 && v.Minor >= 7 {
-		o := Flannel0_7{}
-		if err := unmarshal(&o); err != nil {
+	if o := FlannelOptions(v); o != nil {
+		ov := reflect.New(reflect.TypeOf(o))
+		if err := unmarshal(ov.Interface()); err != nil {
 			return err
 		}
-		flannel.Options = o
+		flannel.Options = ov.Elem().Interface()
+	}
+	return nil
+}
+
+// FlannelOptions returns the zero value of the options struct for the given
+// flannel version, or nil if the version is not supported.
+func FlannelOptions(v semver.Version) Options {
+	if v.Major == 0 && v.Minor >= 7 {
+		return Flannel0_7{}
 	} else if v.Major == 0 && v.Minor == 6 {
-		o := Flannel0_6{}
-		if err := unmarshal(&o); err != nil {
-			return err
-		}
-		flannel.Options = o
+		return Flannel0_6{}
 	} else if v.Major == 0 && v.Minor == 5 {
-		o := Flannel0_5{}
-		if err := unmarshal(&o); err != nil {
-			return err
-		}
-		flannel.Options = o
+		return Flannel0_5{}
 	}
 	return nil
 }
 
 func init() {
-	register(func(in Config, ast astnode.AstNode, out ignTypes.Config, platform string) (ignTypes.Config, report.Report, astnode.AstNode) {
+	register(func(in Config, ast astnode.AstNode, out ignTypes.Config, options ConvertOptions) (ignTypes.Config, report.Report, astnode.AstNode) {
 		if in.Flannel != nil {
-			contents, err := flannelContents(*in.Flannel, platform)
+			contents, err := flannelContents(*in.Flannel, options.Platform)
 			if err != nil {
-				return ignTypes.Config{}, report.ReportFromError(err, report.EntryError), ast
+				r := report.ReportFromError(err, report.EntryError)
+				positionReport(&r, ast, options.ReportPaths, true, "flannel")
+				return ignTypes.Config{}, r, ast
 			}
+			options.SourceMap.add(ast, fmt.Sprintf("systemd.units[%d]", len(out.Systemd.Units)), "flannel")
+			options.SourceMap.add(ast, fmt.Sprintf("systemd.units[%d].dropins[0]", len(out.Systemd.Units)), "flannel")
 			out.Systemd.Units = append(out.Systemd.Units, ignTypes.Unit{
 				Name:   "flanneld.service",
 				Enable: true,
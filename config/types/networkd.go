@@ -15,19 +15,23 @@
 package types
 
 import (
+	"fmt"
+
 	ignTypes "github.com/coreos/ignition/config/v2_3/types"
 	"github.com/coreos/ignition/config/validate/astnode"
 	"github.com/coreos/ignition/config/validate/report"
 )
 
 type Networkd struct {
-	Units []NetworkdUnit `yaml:"units"`
+	Units      []NetworkdUnit      `yaml:"units"`
+	Interfaces []NetworkdInterface `yaml:"interfaces"`
 }
 
 type NetworkdUnit struct {
-	Name     string               `yaml:"name"`
-	Contents string               `yaml:"contents"`
-	Dropins  []NetworkdUnitDropIn `yaml:"dropins"`
+	Name      string               `yaml:"name"`
+	Contents  string               `yaml:"contents"`
+	Dropins   []NetworkdUnitDropIn `yaml:"dropins"`
+	Platforms Platforms            `yaml:"platforms"`
 }
 
 type NetworkdUnitDropIn struct {
@@ -35,21 +39,78 @@ type NetworkdUnitDropIn struct {
 	Contents string `yaml:"contents"`
 }
 
+const (
+	networkdDir = "/etc/systemd/network"
+
+	// restartNetworkd applies networkd units after they were rendered
+	restartNetworkd = "/usr/bin/systemctl try-restart systemd-networkd.service"
+)
+
 func init() {
-	register(func(in Config, ast astnode.AstNode, out ignTypes.Config, platform string) (ignTypes.Config, report.Report, astnode.AstNode) {
-		for _, unit := range in.Networkd.Units {
+	register(func(in Config, ast astnode.AstNode, out ignTypes.Config, options ConvertOptions) (ignTypes.Config, report.Report, astnode.AstNode) {
+		r := report.Report{}
+		for i, unit := range in.Networkd.Units {
+			if skip, skipReport := skipForPlatform(unit.Platforms, ast, options.ReportPaths, options.Platform, "networkd", "units", i); skip {
+				r.Merge(skipReport)
+				continue
+			}
 			newUnit := ignTypes.Networkdunit{
-				Name:     unit.Name,
-				Contents: unit.Contents,
+				Name: unit.Name,
 			}
-			for _, dropIn := range unit.Dropins {
+			// networkd doesn't expand variables, so units with dynamic
+			// data are rendered from templates at boot instead
+			path := networkdDir + "/" + unit.Name
+			templated, err := renderNetworkdTemplate(&out, options, ast, path, unit.Contents, "networkd", "units", i)
+			if err != nil {
+				r.Merge(templatingReport(ast, options.ReportPaths, err, "networkd", "units", i, "contents"))
+				continue
+			}
+			rendered := templated
+			if !templated {
+				newUnit.Contents = unescapeFields(options, unit.Contents)
+			}
+			for j, dropIn := range unit.Dropins {
+				path := networkdDir + "/" + unit.Name + ".d/" + dropIn.Name
+				templated, err := renderNetworkdTemplate(&out, options, ast, path, dropIn.Contents, "networkd", "units", i, "dropins", j)
+				if err != nil {
+					r.Merge(templatingReport(ast, options.ReportPaths, err, "networkd", "units", i, "dropins", j, "contents"))
+					continue
+				}
+				if templated {
+					rendered = true
+					continue
+				}
+				options.SourceMap.add(ast, fmt.Sprintf("networkd.units[%d].dropins[%d]", len(out.Networkd.Units), len(newUnit.Dropins)), "networkd", "units", i, "dropins", j)
 				newUnit.Dropins = append(newUnit.Dropins, ignTypes.NetworkdDropin{
 					Name:     dropIn.Name,
-					Contents: dropIn.Contents,
+					Contents: unescapeFields(options, dropIn.Contents),
 				})
 			}
+			if rendered && newUnit.Contents == "" && len(newUnit.Dropins) == 0 {
+				// everything is rendered at boot
+				continue
+			}
+			options.SourceMap.add(ast, fmt.Sprintf("networkd.units[%d]", len(out.Networkd.Units)), "networkd", "units", i)
 			out.Networkd.Units = append(out.Networkd.Units, newUnit)
 		}
-		return out, report.Report{}, ast
+		return out, r, ast
 	})
 }
+
+// renderNetworkdTemplate adds the template and render unit for a networkd unit
+// or dropin with dynamic data, which is written to path at boot. It returns
+// whether there was any dynamic data.
+func renderNetworkdTemplate(out *ignTypes.Config, options ConvertOptions, ast astnode.AstNode, path, contents string, astPath ...interface{}) (bool, error) {
+	if _, templated, err := replaceFields(options, contents); err != nil || !templated {
+		return false, err
+	}
+	unit, err := renderUnit(options.Platform, path, contents, restartNetworkd)
+	if err != nil {
+		return false, err
+	}
+	options.SourceMap.add(ast, fmt.Sprintf("storage.files[%d]", len(out.Storage.Files)), astPath...)
+	out.Storage.Files = append(out.Storage.Files, templateFile(path, contents))
+	options.SourceMap.add(ast, fmt.Sprintf("systemd.units[%d]", len(out.Systemd.Units)), astPath...)
+	out.Systemd.Units = append(out.Systemd.Units, unit)
+	return true, nil
+}
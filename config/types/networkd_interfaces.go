@@ -0,0 +1,370 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/coreos/container-linux-config-transpiler/config/astyaml"
+	"github.com/coreos/container-linux-config-transpiler/config/types/util"
+	ignTypes "github.com/coreos/ignition/config/v2_3/types"
+	"github.com/coreos/ignition/config/validate/astnode"
+	"github.com/coreos/ignition/config/validate/report"
+)
+
+const (
+	InterfaceKindBond   = "bond"
+	InterfaceKindBridge = "bridge"
+	InterfaceKindVLAN   = "vlan"
+
+	// interfaceUnitPrefix orders the generated units before most units
+	// written by hand, which networkd reads in lexical order
+	interfaceUnitPrefix = "10-"
+
+	minMTU    = 68
+	maxMTU    = 65535
+	maxVLANID = 4094
+	// maxInterfaceName is IFNAMSIZ without the terminating null byte
+	maxInterfaceName = 15
+)
+
+var (
+	InterfaceKinds = []string{InterfaceKindBond, InterfaceKindBridge, InterfaceKindVLAN}
+	BondModes      = []string{"balance-rr", "active-backup", "balance-xor", "broadcast", "802.3ad", "balance-tlb", "balance-alb"}
+
+	ErrInterfaceNameRequired = errors.New("interface name is required")
+	ErrInvalidInterfaceName  = fmt.Errorf("interface names must be at most %d characters without slashes, colons or whitespace", maxInterfaceName)
+	ErrUnknownInterfaceKind  = fmt.Errorf("unknown interface kind, accepted values: %v", InterfaceKinds)
+	ErrInvalidDHCP           = errors.New("dhcp must be true, false, ipv4 or ipv6")
+	ErrInvalidMTU            = fmt.Errorf("mtu must be between %d and %d", minMTU, maxMTU)
+	ErrMatchOnVirtual        = errors.New("match can only be set for physical interfaces, bonds, bridges and vlans are matched by name")
+	ErrVLANIDRequired        = errors.New("vlan_id is required for vlan interfaces")
+	ErrVLANIDOnNonVLAN       = errors.New("vlan_id can only be set for vlan interfaces")
+	ErrInvalidVLANID         = fmt.Errorf("vlan_id must be between 1 and %d", maxVLANID)
+	ErrBondModeOnNonBond     = errors.New("bond_mode can only be set for bond interfaces")
+	ErrUnknownBondMode       = fmt.Errorf("unknown bond mode, accepted values: %v", BondModes)
+	ErrBondAndBridge         = errors.New("an interface can't be part of both a bond and a bridge")
+)
+
+// NetworkdInterface is a network interface, which is rendered into the
+// networkd units configuring it.
+type NetworkdInterface struct {
+	Name string `yaml:"name"`
+	// Kind is empty for physical interfaces, or the kind of virtual
+	// interface to create
+	Kind  string         `yaml:"kind"`
+	Match *NetworkdMatch `yaml:"match"`
+	MTU   *int           `yaml:"mtu"`
+	// DHCP is true, false, ipv4 or ipv6
+	DHCP      string   `yaml:"dhcp"`
+	Addresses []string `yaml:"addresses"`
+	Gateways  []string `yaml:"gateways"`
+	DNS       []string `yaml:"dns"`
+	Domains   []string `yaml:"domains"`
+	// Bond and Bridge name the interface this one is part of
+	Bond   string `yaml:"bond"`
+	Bridge string `yaml:"bridge"`
+	// VLANs name the vlan interfaces on top of this one
+	VLANs    []string `yaml:"vlans"`
+	VLANID   *int     `yaml:"vlan_id"`
+	BondMode string   `yaml:"bond_mode"`
+}
+
+// NetworkdMatch selects the physical device of an interface. Matched devices
+// are renamed to the name of the interface.
+type NetworkdMatch struct {
+	Name string `yaml:"name"`
+	MAC  string `yaml:"mac"`
+}
+
+func (i NetworkdInterface) ValidateName() report.Report {
+	if i.Name == "" {
+		return report.ReportFromError(ErrInterfaceNameRequired, report.EntryError)
+	}
+	if !validInterfaceName(i.Name) {
+		return report.ReportFromError(ErrInvalidInterfaceName, report.EntryError)
+	}
+	return report.Report{}
+}
+
+func (i NetworkdInterface) ValidateKind() report.Report {
+	switch i.Kind {
+	case "", InterfaceKindBond, InterfaceKindBridge, InterfaceKindVLAN:
+		return report.Report{}
+	}
+	return report.ReportFromError(ErrUnknownInterfaceKind, report.EntryError)
+}
+
+func (i NetworkdInterface) ValidateMatch() report.Report {
+	if i.Match != nil && i.Kind != "" {
+		return report.ReportFromError(ErrMatchOnVirtual, report.EntryError)
+	}
+	return report.Report{}
+}
+
+func (i NetworkdInterface) ValidateMTU() report.Report {
+	if i.MTU != nil && (*i.MTU < minMTU || *i.MTU > maxMTU) {
+		return report.ReportFromError(ErrInvalidMTU, report.EntryError)
+	}
+	return report.Report{}
+}
+
+func (i NetworkdInterface) ValidateDHCP() report.Report {
+	if _, ok := dhcpSetting(i.DHCP); !ok {
+		return report.ReportFromError(ErrInvalidDHCP, report.EntryError)
+	}
+	return report.Report{}
+}
+
+func (i NetworkdInterface) ValidateAddresses() report.Report {
+	for _, address := range i.Addresses {
+		if _, _, err := net.ParseCIDR(address); err != nil {
+			return report.ReportFromError(fmt.Errorf("invalid address %q, expected an address with a prefix length like 192.0.2.10/24", address), report.EntryError)
+		}
+	}
+	return report.Report{}
+}
+
+func (i NetworkdInterface) ValidateGateways() report.Report {
+	for _, gateway := range i.Gateways {
+		if net.ParseIP(gateway) == nil {
+			return report.ReportFromError(fmt.Errorf("invalid gateway %q, expected an IP address", gateway), report.EntryError)
+		}
+	}
+	return report.Report{}
+}
+
+func (i NetworkdInterface) ValidateDNS() report.Report {
+	for _, server := range i.DNS {
+		if net.ParseIP(server) == nil {
+			return report.ReportFromError(fmt.Errorf("invalid DNS server %q, expected an IP address", server), report.EntryError)
+		}
+	}
+	return report.Report{}
+}
+
+func (i NetworkdInterface) ValidateBridge() report.Report {
+	if i.Bond != "" && i.Bridge != "" {
+		return report.ReportFromError(ErrBondAndBridge, report.EntryError)
+	}
+	return report.Report{}
+}
+
+func (i NetworkdInterface) ValidateVLANID() report.Report {
+	switch {
+	case i.Kind == InterfaceKindVLAN && i.VLANID == nil:
+		return report.ReportFromError(ErrVLANIDRequired, report.EntryError)
+	case i.Kind != InterfaceKindVLAN && i.VLANID != nil:
+		return report.ReportFromError(ErrVLANIDOnNonVLAN, report.EntryError)
+	case i.VLANID != nil && (*i.VLANID < 1 || *i.VLANID > maxVLANID):
+		return report.ReportFromError(ErrInvalidVLANID, report.EntryError)
+	}
+	return report.Report{}
+}
+
+func (i NetworkdInterface) ValidateBondMode() report.Report {
+	if i.BondMode == "" {
+		return report.Report{}
+	}
+	if i.Kind != InterfaceKindBond {
+		return report.ReportFromError(ErrBondModeOnNonBond, report.EntryError)
+	}
+	for _, mode := range BondModes {
+		if i.BondMode == mode {
+			return report.Report{}
+		}
+	}
+	return report.ReportFromError(ErrUnknownBondMode, report.EntryError)
+}
+
+func (m NetworkdMatch) ValidateMAC() report.Report {
+	if m.MAC == "" {
+		return report.Report{}
+	}
+	if _, err := net.ParseMAC(m.MAC); err != nil {
+		return report.ReportFromError(fmt.Errorf("invalid MAC address %q", m.MAC), report.EntryError)
+	}
+	return report.Report{}
+}
+
+func validInterfaceName(name string) bool {
+	if len(name) > maxInterfaceName || name == "." || name == ".." {
+		return false
+	}
+	return !strings.ContainsAny(name, "/: \t\n")
+}
+
+// dhcpSetting returns the value of the DHCP setting of .network units for
+// the dhcp option of an interface.
+func dhcpSetting(dhcp string) (string, bool) {
+	switch strings.ToLower(dhcp) {
+	case "":
+		return "", true
+	case "true", "yes":
+		return "yes", true
+	case "false", "no":
+		return "no", true
+	case "ipv4", "ipv6":
+		return strings.ToLower(dhcp), true
+	}
+	return "", false
+}
+
+func init() {
+	register(func(in Config, ast astnode.AstNode, out ignTypes.Config, options ConvertOptions) (ignTypes.Config, report.Report, astnode.AstNode) {
+		r := checkInterfaceReferences(in.Networkd.Interfaces, ast, options.ReportPaths)
+		if r.IsFatal() {
+			return out, r, ast
+		}
+		for i, iface := range in.Networkd.Interfaces {
+			for _, unit := range iface.units() {
+				if findNetworkdUnit(out.Networkd.Units, unit.Name) {
+					r.Add(interfaceEntry(ast, options.ReportPaths, fmt.Sprintf("networkd unit %s is generated for interface %s but also listed in units", unit.Name, iface.Name), i, "name"))
+					continue
+				}
+				options.SourceMap.add(ast, fmt.Sprintf("networkd.units[%d]", len(out.Networkd.Units)), "networkd", "interfaces", i)
+				out.Networkd.Units = append(out.Networkd.Units, unit)
+			}
+		}
+		return out, r, ast
+	})
+}
+
+// checkInterfaceReferences checks that interfaces have unique names and that
+// the bonds, bridges and vlans they refer to are interfaces of that kind.
+func checkInterfaceReferences(ifaces []NetworkdInterface, ast astnode.AstNode, paths *astyaml.ReportPaths) report.Report {
+	r := report.Report{}
+	kinds := map[string]string{}
+	for i, iface := range ifaces {
+		if _, ok := kinds[iface.Name]; ok {
+			r.Add(interfaceEntry(ast, paths, fmt.Sprintf("interface %s is listed more than once", iface.Name), i, "name"))
+		}
+		kinds[iface.Name] = iface.Kind
+	}
+
+	check := func(i int, key, name, kind string) {
+		if k, ok := kinds[name]; !ok {
+			r.Add(interfaceEntry(ast, paths, fmt.Sprintf("%s %s is not in interfaces", kind, name), i, key))
+		} else if k != kind {
+			r.Add(interfaceEntry(ast, paths, fmt.Sprintf("interface %s is not a %s", name, kind), i, key))
+		}
+	}
+	for i, iface := range ifaces {
+		if iface.Bond != "" {
+			check(i, "bond", iface.Bond, InterfaceKindBond)
+		}
+		if iface.Bridge != "" {
+			check(i, "bridge", iface.Bridge, InterfaceKindBridge)
+		}
+		for _, vlan := range iface.VLANs {
+			check(i, "vlans", vlan, InterfaceKindVLAN)
+		}
+	}
+	return r
+}
+
+// interfaceEntry creates an error about an interface, positioned at one of
+// its keys.
+func interfaceEntry(ast astnode.AstNode, paths *astyaml.ReportPaths, message string, i int, key string) report.Entry {
+	r := report.Report{Entries: []report.Entry{{Kind: report.EntryError, Message: message}}}
+	positionReport(&r, ast, paths, false, "networkd", "interfaces", i, key)
+	return r.Entries[0]
+}
+
+func findNetworkdUnit(units []ignTypes.Networkdunit, name string) bool {
+	for _, unit := range units {
+		if unit.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// units renders the networkd units of an interface: a .link unit renaming the
+// device if it is matched by MAC address or by a name other than its own, a
+// .netdev unit creating it if it is virtual and the .network unit configuring
+// it.
+func (i NetworkdInterface) units() []ignTypes.Networkdunit {
+	var units []ignTypes.Networkdunit
+	base := interfaceUnitPrefix + i.Name
+
+	if m := i.Match; m != nil && (m.MAC != "" || m.Name != "" && m.Name != i.Name) {
+		link := util.NewUnitFile()
+		if m.MAC != "" {
+			link.Section("Match").Add("MACAddress=" + m.MAC)
+		}
+		if m.Name != "" {
+			// names set by .link units don't match, the kernel's do
+			link.Section("Match").Add("OriginalName=" + m.Name)
+		}
+		link.Section("Link").Add("Name=" + i.Name)
+		if i.MTU != nil {
+			link.Section("Link").Add(fmt.Sprintf("MTUBytes=%d", *i.MTU))
+		}
+		units = append(units, ignTypes.Networkdunit{Name: base + ".link", Contents: link.String()})
+	}
+
+	if i.Kind != "" {
+		netdev := util.NewUnitFile()
+		netdev.Section("NetDev").Add("Name=" + i.Name)
+		netdev.Section("NetDev").Add("Kind=" + i.Kind)
+		if i.MTU != nil {
+			netdev.Section("NetDev").Add(fmt.Sprintf("MTUBytes=%d", *i.MTU))
+		}
+		if i.BondMode != "" {
+			netdev.Section("Bond").Add("Mode=" + i.BondMode)
+		}
+		if i.VLANID != nil {
+			netdev.Section("VLAN").Add(fmt.Sprintf("Id=%d", *i.VLANID))
+		}
+		units = append(units, ignTypes.Networkdunit{Name: base + ".netdev", Contents: netdev.String()})
+	}
+
+	network := util.NewUnitFile()
+	network.Section("Match").Add("Name=" + i.Name)
+	if i.MTU != nil && i.Kind == "" {
+		network.Section("Link").Add(fmt.Sprintf("MTUBytes=%d", *i.MTU))
+	}
+	section := network.Section("Network")
+	if dhcp, _ := dhcpSetting(i.DHCP); dhcp != "" {
+		section.Add("DHCP=" + dhcp)
+	}
+	for _, address := range i.Addresses {
+		section.Add("Address=" + address)
+	}
+	for _, gateway := range i.Gateways {
+		section.Add("Gateway=" + gateway)
+	}
+	for _, server := range i.DNS {
+		section.Add("DNS=" + server)
+	}
+	if len(i.Domains) > 0 {
+		section.Add("Domains=" + strings.Join(i.Domains, " "))
+	}
+	if i.Bond != "" {
+		section.Add("Bond=" + i.Bond)
+	}
+	if i.Bridge != "" {
+		section.Add("Bridge=" + i.Bridge)
+	}
+	for _, vlan := range i.VLANs {
+		section.Add("VLAN=" + vlan)
+	}
+	units = append(units, ignTypes.Networkdunit{Name: base + ".network", Contents: network.String()})
+	return units
+}
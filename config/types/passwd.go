@@ -15,6 +15,8 @@
 package types
 
 import (
+	"fmt"
+
 	ignTypes "github.com/coreos/ignition/config/v2_3/types"
 	"github.com/coreos/ignition/config/validate/astnode"
 	"github.com/coreos/ignition/config/validate/report"
@@ -40,6 +42,7 @@ type User struct {
 	System            bool        `yaml:"system"`
 	NoLogInit         bool        `yaml:"no_log_init"`
 	Shell             string      `yaml:"shell"`
+	Platforms         Platforms   `yaml:"platforms"`
 }
 
 type UserCreate struct {
@@ -63,8 +66,14 @@ type Group struct {
 }
 
 func init() {
-	register(func(in Config, ast astnode.AstNode, out ignTypes.Config, platform string) (ignTypes.Config, report.Report, astnode.AstNode) {
-		for _, user := range in.Passwd.Users {
+	register(func(in Config, ast astnode.AstNode, out ignTypes.Config, options ConvertOptions) (ignTypes.Config, report.Report, astnode.AstNode) {
+		r := report.Report{}
+		for i, user := range in.Passwd.Users {
+			if skip, skipReport := skipForPlatform(user.Platforms, ast, options.ReportPaths, options.Platform, "passwd", "users", i); skip {
+				r.Merge(skipReport)
+				continue
+			}
+			options.SourceMap.add(ast, fmt.Sprintf("passwd.users[%d]", len(out.Passwd.Users)), "passwd", "users", i)
 			newUser := ignTypes.PasswdUser{
 				Name:              user.Name,
 				PasswordHash:      user.PasswordHash,
@@ -99,7 +108,8 @@ func init() {
 			out.Passwd.Users = append(out.Passwd.Users, newUser)
 		}
 
-		for _, group := range in.Passwd.Groups {
+		for i, group := range in.Passwd.Groups {
+			options.SourceMap.add(ast, fmt.Sprintf("passwd.groups[%d]", len(out.Passwd.Groups)), "passwd", "groups", i)
 			out.Passwd.Groups = append(out.Passwd.Groups, ignTypes.PasswdGroup{
 				Name:         group.Name,
 				Gid:          convertUintPointerToIntPointer(group.Gid),
@@ -107,7 +117,7 @@ func init() {
 				System:       group.System,
 			})
 		}
-		return out, report.Report{}, ast
+		return out, r, ast
 	})
 }
 
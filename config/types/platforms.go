@@ -0,0 +1,69 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/coreos/container-linux-config-transpiler/config/astyaml"
+	"github.com/coreos/container-linux-config-transpiler/config/platform"
+	"github.com/coreos/ignition/config/validate/astnode"
+	"github.com/coreos/ignition/config/validate/report"
+)
+
+var (
+	WarningPlatformsUnset = errors.New("platforms is set but no platform is targeted, leaving the entry out")
+)
+
+// Platforms selects the platforms a unit, file, networkd unit or user is
+// for. Entries without platforms are for every platform.
+type Platforms []string
+
+func (p Platforms) Validate() report.Report {
+	for _, name := range p {
+		if name == "" || !platform.IsSupportedPlatform(name) {
+			return report.ReportFromError(fmt.Errorf("unknown platform %q, accepted values: %v", name, platform.Platforms), report.EntryError)
+		}
+	}
+	return report.Report{}
+}
+
+// Includes returns whether the entry is for the given platform.
+func (p Platforms) Includes(platform string) bool {
+	if len(p) == 0 {
+		return true
+	}
+	for _, name := range p {
+		if name == platform {
+			return true
+		}
+	}
+	return false
+}
+
+// skipForPlatform returns whether the entry at path is left out because it
+// isn't for the targeted platform, with a warning if no platform is targeted.
+func skipForPlatform(p Platforms, ast astnode.AstNode, paths *astyaml.ReportPaths, platform string, path ...interface{}) (bool, report.Report) {
+	if p.Includes(platform) {
+		return false, report.Report{}
+	}
+	r := report.Report{}
+	if platform == "" {
+		r = report.ReportFromError(WarningPlatformsUnset, report.EntryWarning)
+		positionReport(&r, ast, paths, true, append(path, "platforms")...)
+	}
+	return true, r
+}
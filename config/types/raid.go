@@ -15,6 +15,8 @@
 package types
 
 import (
+	"fmt"
+
 	ignTypes "github.com/coreos/ignition/config/v2_3/types"
 	"github.com/coreos/ignition/config/validate/astnode"
 	"github.com/coreos/ignition/config/validate/report"
@@ -29,8 +31,8 @@ type Raid struct {
 }
 
 func init() {
-	register(func(in Config, ast astnode.AstNode, out ignTypes.Config, platform string) (ignTypes.Config, report.Report, astnode.AstNode) {
-		for _, array := range in.Storage.Arrays {
+	register(func(in Config, ast astnode.AstNode, out ignTypes.Config, options ConvertOptions) (ignTypes.Config, report.Report, astnode.AstNode) {
+		for i, array := range in.Storage.Arrays {
 			newArray := ignTypes.Raid{
 				Name:    array.Name,
 				Level:   array.Level,
@@ -39,6 +41,7 @@ func init() {
 				Options: convertStringSiceToTypesRaidOptionSlice(array.Options),
 			}
 
+			options.SourceMap.add(ast, fmt.Sprintf("storage.raid[%d]", len(out.Storage.Raid)), "storage", "raid", i)
 			out.Storage.Raid = append(out.Storage.Raid, newArray)
 		}
 		return out, report.Report{}, ast
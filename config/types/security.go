@@ -15,6 +15,8 @@
 package types
 
 import (
+	"fmt"
+
 	ignTypes "github.com/coreos/ignition/config/v2_3/types"
 	"github.com/coreos/ignition/config/validate/astnode"
 	"github.com/coreos/ignition/config/validate/report"
@@ -34,8 +36,9 @@ type CaReference struct {
 }
 
 func init() {
-	register(func(in Config, ast astnode.AstNode, out ignTypes.Config, platform string) (ignTypes.Config, report.Report, astnode.AstNode) {
-		for _, ca := range in.Ignition.Security.TLS.CertificateAuthorities {
+	register(func(in Config, ast astnode.AstNode, out ignTypes.Config, options ConvertOptions) (ignTypes.Config, report.Report, astnode.AstNode) {
+		for i, ca := range in.Ignition.Security.TLS.CertificateAuthorities {
+			options.SourceMap.add(ast, fmt.Sprintf("ignition.security.tls.certificateAuthorities[%d]", len(out.Ignition.Security.TLS.CertificateAuthorities)), "ignition", "security", "tls", "certificate_authorities", i)
 			out.Ignition.Security.TLS.CertificateAuthorities = append(out.Ignition.Security.TLS.CertificateAuthorities, ignTypes.CaReference{
 				Source:       ca.Source,
 				Verification: convertVerification(ca.Verification),
@@ -0,0 +1,75 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"github.com/coreos/container-linux-config-transpiler/config/astyaml"
+	"github.com/coreos/ignition/config/validate/astnode"
+)
+
+// SourceMap maps the elements of a generated Ignition config back to the parts
+// of the Container Linux Config they were generated from. Entries are in the
+// order the elements were generated.
+type SourceMap []SourceMapEntry
+
+// SourceMapEntry maps a single element of the Ignition config.
+type SourceMapEntry struct {
+	// Target is the path of the element in the Ignition config, e.g.
+	// "systemd.units[2].dropins[0]".
+	Target string `json:"target"`
+	Source
+}
+
+// Source is a location in a Container Linux Config.
+type Source struct {
+	// Path is the YAML path of the node that produced the element, e.g.
+	// "storage.files[3]" or a high level section like "etcd". It is empty
+	// for elements generated only because of the target platform.
+	Path string `json:"path"`
+	// Line and Column are the position of the node, or zero if unknown.
+	Line   int `json:"line,omitempty"`
+	Column int `json:"column,omitempty"`
+}
+
+// Lookup returns the source of the element at target.
+func (m SourceMap) Lookup(target string) (Source, bool) {
+	for _, e := range m {
+		if e.Target == target {
+			return e.Source, true
+		}
+	}
+	return Source{}, false
+}
+
+// add records that the element at target was generated from the node at
+// path. Paths use the Container Linux Config key names. Sections are
+// positioned at their key, list elements at their first line. It does
+// nothing if m is nil, so converters can call it unconditionally.
+func (m *SourceMap) add(ast astnode.AstNode, target string, path ...interface{}) {
+	if m == nil {
+		return
+	}
+	source := Source{Path: astyaml.FormatPath(path...)}
+	if len(path) > 0 {
+		if n, err := getNodeChildPath(ast, ignPath(ast, path)...); err == nil {
+			if _, ok := path[len(path)-1].(string); ok {
+				source.Line, source.Column, _ = n.KeyLineCol(nil)
+			} else {
+				source.Line, source.Column, _ = n.ValueLineCol(nil)
+			}
+		}
+	}
+	*m = append(*m, SourceMapEntry{Target: target, Source: source})
+}
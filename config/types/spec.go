@@ -0,0 +1,216 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/coreos/container-linux-config-transpiler/config/astyaml"
+	"github.com/coreos/go-semver/semver"
+	ign2_1 "github.com/coreos/ignition/config/v2_1/types"
+	ign2_2 "github.com/coreos/ignition/config/v2_2/types"
+	ignTypes "github.com/coreos/ignition/config/v2_3/types"
+	"github.com/coreos/ignition/config/validate/astnode"
+	"github.com/coreos/ignition/config/validate/report"
+)
+
+const (
+	// sectorsPerMiB is the number of 512 byte sectors in a MiB. Ignition
+	// specs older than 2.3.0 size partitions in sectors rather than MiB.
+	sectorsPerMiB = MEGABYTE / 512
+)
+
+var (
+	ErrUnsupportedIgnitionVersion = errors.New("unsupported Ignition spec version")
+
+	ignition2_1 = *semver.New("2.1.0")
+	ignition2_2 = *semver.New("2.2.0")
+	ignition2_3 = *semver.New("2.3.0")
+
+	// IgnitionVersions are the Ignition spec versions ct can generate.
+	IgnitionVersions = []string{
+		ignition2_1.String(),
+		ignition2_2.String(),
+		ignition2_3.String(),
+	}
+	DefaultIgnitionVersion = ignition2_3
+)
+
+// ParseIgnitionVersion parses one of the versions in IgnitionVersions. The
+// patch version may be left out, and an empty string yields the default.
+func ParseIgnitionVersion(v string) (semver.Version, error) {
+	if v == "" {
+		return DefaultIgnitionVersion, nil
+	}
+	if strings.Count(v, ".") == 1 {
+		v += ".0"
+	}
+	for _, supported := range IgnitionVersions {
+		if v == supported {
+			return *semver.New(v), nil
+		}
+	}
+	return semver.Version{}, ErrUnsupportedIgnitionVersion
+}
+
+// checkIgnitionVersion reports an error for every feature used in the
+// Container Linux Config that can't be expressed in the given Ignition spec
+// version. Entries that aren't for the targeted platform are ignored. It must
+// be called while the tree still has yaml tags.
+func checkIgnitionVersion(in Config, ast astnode.AstNode, paths *astyaml.ReportPaths, v semver.Version, platform string) report.Report {
+	r := report.Report{}
+	require := func(min semver.Version, feature string, path ...interface{}) {
+		if !v.LessThan(min) {
+			return
+		}
+		err := fmt.Errorf("%s requires Ignition spec version %s or newer, but %s was requested", feature, min, v)
+		featureReport := report.ReportFromError(err, report.EntryError)
+		positionReport(&featureReport, ast, paths, true, path...)
+		r.Merge(featureReport)
+	}
+
+	if len(in.Ignition.Security.TLS.CertificateAuthorities) > 0 {
+		require(ignition2_2, "certificate_authorities", "ignition", "security", "tls", "certificate_authorities")
+	}
+	for i, file := range in.Storage.Files {
+		if !file.Platforms.Includes(platform) {
+			continue
+		}
+		if file.Append {
+			require(ignition2_2, "append", "storage", "files", i, "append")
+		}
+		if file.Overwrite != nil {
+			require(ignition2_2, "overwrite", "storage", "files", i, "overwrite")
+		}
+	}
+	for i, dir := range in.Storage.Directories {
+		if dir.Overwrite != nil {
+			require(ignition2_2, "overwrite", "storage", "directories", i, "overwrite")
+		}
+	}
+	for i, link := range in.Storage.Links {
+		if link.Overwrite != nil {
+			require(ignition2_2, "overwrite", "storage", "links", i, "overwrite")
+		}
+	}
+	for i, array := range in.Storage.Arrays {
+		if len(array.Options) > 0 {
+			require(ignition2_3, "raid options", "storage", "raid", i, "options")
+		}
+	}
+	for i, unit := range in.Networkd.Units {
+		if !unit.Platforms.Includes(platform) {
+			continue
+		}
+		if len(unit.Dropins) > 0 {
+			require(ignition2_3, "networkd dropins", "networkd", "units", i, "dropins")
+		}
+	}
+	return r
+}
+
+// downgradeConfig rewrites a validated config into the form expected by the
+// given Ignition spec version.
+func downgradeConfig(out ignTypes.Config, v semver.Version) ignTypes.Config {
+	out.Ignition.Version = v.String()
+	if v.LessThan(ignition2_3) {
+		for i := range out.Storage.Disks {
+			for j := range out.Storage.Disks[i].Partitions {
+				p := &out.Storage.Disks[i].Partitions[j]
+				if p.SizeMiB != nil {
+					p.Size, p.SizeMiB = miBToSectors(p.SizeMiB), nil
+				}
+				if p.StartMiB != nil {
+					p.Start, p.StartMiB = miBToSectors(p.StartMiB), nil
+				}
+			}
+		}
+	}
+	return out
+}
+
+// VersionedConfig returns a converted config in the types of the Ignition spec
+// version it was converted for, so that it only has the fields that version
+// defines when it is marshalled, like the security section that spec 2.1.0
+// lacks. Configs for the latest version are returned as they are.
+func VersionedConfig(cfg ignTypes.Config) (interface{}, error) {
+	var out interface{}
+	switch cfg.Ignition.Version {
+	case ignition2_1.String():
+		out = &ign2_1.Config{}
+	case ignition2_2.String():
+		out = &ign2_2.Config{}
+	default:
+		return &cfg, nil
+	}
+	// the fields of the older specs have the same names as in the latest
+	// one, and downgradeConfig already rewrote the ones that changed
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// NormalizeConfig rewrites an Ignition config of any supported spec version
+// into the form ct generates for the given version, so configs of different
+// versions can be compared. Partition sizes and offsets in sectors that are
+// whole MiB are given in MiB first, like ct generates them for spec 2.3.0.
+func NormalizeConfig(cfg ignTypes.Config, version string) (ignTypes.Config, error) {
+	v, err := ParseIgnitionVersion(version)
+	if err != nil {
+		return ignTypes.Config{}, err
+	}
+	// the partitions are rewritten in place, so they are copied first
+	cfg.Storage.Disks = append([]ignTypes.Disk(nil), cfg.Storage.Disks...)
+	for i := range cfg.Storage.Disks {
+		disk := &cfg.Storage.Disks[i]
+		disk.Partitions = append([]ignTypes.Partition(nil), disk.Partitions...)
+		for j := range disk.Partitions {
+			p := &disk.Partitions[j]
+			if p.SizeMiB == nil {
+				p.Size, p.SizeMiB = sectorsToMiB(p.Size)
+			}
+			if p.StartMiB == nil {
+				p.Start, p.StartMiB = sectorsToMiB(p.Start)
+			}
+		}
+	}
+	return downgradeConfig(cfg, v), nil
+}
+
+// sectorsToMiB returns a number of sectors in MiB if it is whole MiB, or in
+// sectors otherwise.
+func sectorsToMiB(sectors *int) (*int, *int) {
+	if sectors == nil || *sectors%sectorsPerMiB != 0 {
+		return sectors, nil
+	}
+	miB := *sectors / sectorsPerMiB
+	return nil, &miB
+}
+
+func miBToSectors(miB *int) *int {
+	if miB == nil {
+		return nil
+	}
+	sectors := *miB * sectorsPerMiB
+	return &sectors
+}
@@ -0,0 +1,131 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/coreos/container-linux-config-transpiler/internal/util"
+	ign2_1 "github.com/coreos/ignition/config/v2_1/types"
+	ign2_2 "github.com/coreos/ignition/config/v2_2/types"
+	ignTypes "github.com/coreos/ignition/config/v2_3/types"
+	"github.com/coreos/ignition/config/validate"
+)
+
+func partitionsConfig(version string, partitions ...ignTypes.Partition) ignTypes.Config {
+	cfg := ignTypes.Config{Ignition: ignTypes.Ignition{Version: version}}
+	cfg.Storage.Disks = []ignTypes.Disk{{Device: "/dev/sda", Partitions: partitions}}
+	return cfg
+}
+
+func TestNormalizeConfig(t *testing.T) {
+	inSectors := partitionsConfig("2.2.0",
+		ignTypes.Partition{Number: 1, Start: util.IntToPtr(2048), Size: util.IntToPtr(4096)},
+		ignTypes.Partition{Number: 2, Start: util.IntToPtr(6144), Size: util.IntToPtr(1000)},
+	)
+	inMiB := partitionsConfig("2.3.0",
+		ignTypes.Partition{Number: 1, StartMiB: util.IntToPtr(1), SizeMiB: util.IntToPtr(2)},
+		ignTypes.Partition{Number: 2, StartMiB: util.IntToPtr(3), Size: util.IntToPtr(1000)},
+	)
+
+	tests := []struct {
+		in      ignTypes.Config
+		version string
+		out     ignTypes.Config
+	}{
+		{inSectors, "2.3.0", inMiB},
+		{inMiB, "2.3.0", inMiB},
+		{inMiB, "2.2.0", inSectors},
+		{inSectors, "2.2.0", inSectors},
+	}
+
+	for i, test := range tests {
+		out, err := NormalizeConfig(test.in, test.version)
+		if err != nil {
+			t.Errorf("#%d: unexpected error: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(test.out, out) {
+			t.Errorf("#%d: wanted %+v, got %+v", i, test.out, out)
+		}
+	}
+
+	if start := inSectors.Storage.Disks[0].Partitions[0].Start; start == nil || *start != 2048 {
+		t.Errorf("input config was modified")
+	}
+	if _, err := NormalizeConfig(inMiB, "1.0.0"); err != ErrUnsupportedIgnitionVersion {
+		t.Errorf("wanted %v, got %v", ErrUnsupportedIgnitionVersion, err)
+	}
+}
+
+func TestVersionedConfig(t *testing.T) {
+	in := Config{
+		Ignition: Ignition{Timeouts: Timeouts{HTTPTotal: util.IntToPtr(30)}},
+		Storage: Storage{
+			Disks: []Disk{{
+				Device:     "/dev/sda",
+				Partitions: []Partition{{Label: util.StringToPtr("data"), Number: 1, Size: "1GiB"}},
+			}},
+			Files: []File{{
+				Filesystem: "root",
+				Path:       "/etc/motd",
+				Mode:       util.IntToPtr(0644),
+				Contents:   FileContents{Inline: "hello"},
+			}},
+		},
+		Systemd: Systemd{Units: []SystemdUnit{{Name: "app.service", Enabled: util.BoolToPtr(true), Contents: "[Service]\nExecStart=/bin/true\n[Install]\nWantedBy=multi-user.target\n"}}},
+		Passwd:  Passwd{Users: []User{{Name: "core", SSHAuthorizedKeys: []string{"ssh-rsa key"}}}},
+	}
+
+	tests := []struct {
+		version string
+		parsed  interface{}
+	}{
+		{"2.1.0", &ign2_1.Config{}},
+		{"2.2.0", &ign2_2.Config{}},
+	}
+
+	for i, test := range tests {
+		cfg, r := Convert(in, ConvertOptions{IgnitionVersion: test.version}, nil)
+		if r.IsFatal() {
+			t.Errorf("#%d: got error while converting: %v", i, r)
+			continue
+		}
+		out, err := VersionedConfig(cfg)
+		if err != nil {
+			t.Errorf("#%d: unexpected error: %v", i, err)
+			continue
+		}
+		data, err := json.Marshal(out)
+		if err != nil {
+			t.Errorf("#%d: unexpected error: %v", i, err)
+			continue
+		}
+
+		// parse the output like Ignition does for configs of the version
+		if err := json.Unmarshal(data, test.parsed); err != nil {
+			t.Errorf("#%d: failed to unmarshal %s: %v", i, data, err)
+			continue
+		}
+		if r := validate.ValidateConfig(data, reflect.ValueOf(test.parsed).Elem().Interface()); len(r.Entries) > 0 {
+			t.Errorf("#%d: Ignition %s reported on %s: %v", i, test.version, data, r)
+		}
+		if version := reflect.ValueOf(test.parsed).Elem().FieldByName("Ignition").FieldByName("Version").String(); version != test.version {
+			t.Errorf("#%d: wanted version %s, got %s", i, test.version, version)
+		}
+	}
+}
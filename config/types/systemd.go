@@ -15,6 +15,8 @@
 package types
 
 import (
+	"fmt"
+
 	ignTypes "github.com/coreos/ignition/config/v2_3/types"
 	"github.com/coreos/ignition/config/validate/astnode"
 	"github.com/coreos/ignition/config/validate/report"
@@ -22,15 +24,17 @@ import (
 
 type Systemd struct {
 	Units []SystemdUnit `yaml:"units"`
+	Jobs  []SystemdJob  `yaml:"jobs"`
 }
 
 type SystemdUnit struct {
-	Name     string              `yaml:"name"`
-	Enable   bool                `yaml:"enable"`
-	Enabled  *bool               `yaml:"enabled"`
-	Mask     bool                `yaml:"mask"`
-	Contents string              `yaml:"contents"`
-	Dropins  []SystemdUnitDropIn `yaml:"dropins"`
+	Name      string              `yaml:"name"`
+	Enable    bool                `yaml:"enable"`
+	Enabled   *bool               `yaml:"enabled"`
+	Mask      bool                `yaml:"mask"`
+	Contents  string              `yaml:"contents"`
+	Dropins   []SystemdUnitDropIn `yaml:"dropins"`
+	Platforms Platforms           `yaml:"platforms"`
 }
 
 type SystemdUnitDropIn struct {
@@ -39,25 +43,47 @@ type SystemdUnitDropIn struct {
 }
 
 func init() {
-	register(func(in Config, ast astnode.AstNode, out ignTypes.Config, platform string) (ignTypes.Config, report.Report, astnode.AstNode) {
-		for _, unit := range in.Systemd.Units {
+	register(func(in Config, ast astnode.AstNode, out ignTypes.Config, options ConvertOptions) (ignTypes.Config, report.Report, astnode.AstNode) {
+		r := report.Report{}
+		for i, unit := range in.Systemd.Units {
+			if skip, skipReport := skipForPlatform(unit.Platforms, ast, options.ReportPaths, options.Platform, "systemd", "units", i); skip {
+				r.Merge(skipReport)
+				continue
+			}
+			options.SourceMap.add(ast, fmt.Sprintf("systemd.units[%d]", len(out.Systemd.Units)), "systemd", "units", i)
+			contents, templated, err := replaceUnitFields(options, unit.Name, unit.Contents)
+			if err != nil {
+				r.Merge(templatingReport(ast, options.ReportPaths, err, "systemd", "units", i, "contents"))
+				continue
+			}
 			newUnit := ignTypes.Unit{
 				Name:     unit.Name,
 				Enable:   unit.Enable,
 				Enabled:  unit.Enabled,
 				Mask:     unit.Mask,
-				Contents: unit.Contents,
+				Contents: contents,
 			}
 
-			for _, dropIn := range unit.Dropins {
+			for j, dropIn := range unit.Dropins {
+				contents, dropInTemplated, err := replaceUnitFields(options, unit.Name, dropIn.Contents)
+				if err != nil {
+					r.Merge(templatingReport(ast, options.ReportPaths, err, "systemd", "units", i, "dropins", j, "contents"))
+					continue
+				}
+				templated = templated || dropInTemplated
+				options.SourceMap.add(ast, fmt.Sprintf("systemd.units[%d].dropins[%d]", len(out.Systemd.Units), len(newUnit.Dropins)), "systemd", "units", i, "dropins", j)
 				newUnit.Dropins = append(newUnit.Dropins, ignTypes.SystemdDropin{
 					Name:     dropIn.Name,
-					Contents: dropIn.Contents,
+					Contents: contents,
 				})
 			}
+			if templated {
+				options.SourceMap.add(ast, fmt.Sprintf("systemd.units[%d].dropins[%d]", len(out.Systemd.Units), len(newUnit.Dropins)), "systemd", "units", i)
+				newUnit.Dropins = append(newUnit.Dropins, metadataDropin())
+			}
 
 			out.Systemd.Units = append(out.Systemd.Units, newUnit)
 		}
-		return out, report.Report{}, ast
+		return out, r, ast
 	})
 }
@@ -0,0 +1,435 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/coreos/container-linux-config-transpiler/config/astyaml"
+	"github.com/coreos/container-linux-config-transpiler/config/types/util"
+	iutil "github.com/coreos/container-linux-config-transpiler/internal/util"
+	ignTypes "github.com/coreos/ignition/config/v2_3/types"
+	"github.com/coreos/ignition/config/validate/astnode"
+	"github.com/coreos/ignition/config/validate/report"
+)
+
+const (
+	NetworkBridge = "bridge"
+	NetworkHost   = "host"
+	NetworkNone   = "none"
+
+	RestartAlways    = "always"
+	RestartOnFailure = "on-failure"
+	RestartNo        = "no"
+
+	dockerPath = "/usr/bin/docker"
+)
+
+var (
+	// the grammar of image references of docker/distribution
+	imageAlphaNumeric = `[a-z0-9]+`
+	imageComponent    = imageAlphaNumeric + `(?:(?:[._]|__|[-]*)` + imageAlphaNumeric + `)*`
+	imageDomainPart   = `(?:[a-zA-Z0-9]|[a-zA-Z0-9][a-zA-Z0-9-]*[a-zA-Z0-9])`
+	imageDomain       = imageDomainPart + `(?:\.` + imageDomainPart + `)*(?::[0-9]+)?`
+	imageTag          = `[\w][\w.-]{0,127}`
+	imageDigest       = `[A-Za-z][A-Za-z0-9]*(?:[-_+.][A-Za-z][A-Za-z0-9]*)*:[0-9a-fA-F]{32,}`
+	imageReference    = regexp.MustCompile(`^(?:` + imageDomain + `/)?` + imageComponent + `(?:/` + imageComponent + `)*(?::` + imageTag + `)?(?:@` + imageDigest + `)?$`)
+	// maxImageName is the longest name of a repository docker accepts
+	maxImageName = 255
+
+	containerName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+	capability    = regexp.MustCompile(`^[A-Z][A-Z_]*$`)
+
+	RestartPolicies = []string{RestartAlways, RestartOnFailure, RestartNo}
+	VolumeOptions   = []string{"ro", "rw", "z", "Z", "nocopy", "shared", "rshared", "slave", "rslave", "private", "rprivate"}
+
+	ErrContainerNameRequired       = errors.New("container name is required")
+	ErrInvalidContainerName        = errors.New("container names must start with a letter or digit and may only contain letters, digits and the characters _.-")
+	ErrImageRequired               = errors.New("container image is required")
+	ErrInvalidImage                = errors.New("invalid image reference, expected [REGISTRY/]REPOSITORY[:TAG][@DIGEST] like quay.io/coreos/etcd:v3.3.9")
+	ErrInvalidNetwork              = errors.New("network must be bridge, host, none, container:NAME or the name of a user-defined network")
+	ErrPortsWithoutNetwork         = errors.New("ports can only be published on bridge and user-defined networks")
+	ErrUnknownRestartPolicy        = fmt.Errorf("unknown restart policy, accepted values: %v", RestartPolicies)
+	ErrInvalidCapability           = errors.New("capabilities must be names like NET_BIND_SERVICE")
+	ErrDependsOnSelf               = errors.New("a container can't depend on itself")
+	ErrEmptyContainerArgument      = errors.New("command arguments can't be empty")
+	ErrInvalidContainerEnvironment = errors.New("environment entries must be NAME=VALUE")
+)
+
+// Container is a docker container, which is rendered into a systemd service
+// pulling its image and running it. Only docker is supported: the fields
+// follow the flags of docker run, and rkt names ports and volumes in the
+// image manifest instead.
+type Container struct {
+	Name  string `yaml:"name"`
+	Image string `yaml:"image"`
+	// Command is the arguments passed to the entrypoint of the image
+	Command     []string `yaml:"command"`
+	Environment []string `yaml:"environment"`
+	Ports       []string `yaml:"ports"`
+	Volumes     []string `yaml:"volumes"`
+	Network     string   `yaml:"network"`
+	Restart     string   `yaml:"restart"`
+	// Capabilities are the only capabilities the container keeps, when set
+	Capabilities []string `yaml:"capabilities"`
+	ReadOnly     bool     `yaml:"read_only"`
+	// DependsOn names the containers, or units, the container needs
+	DependsOn []string `yaml:"depends_on"`
+}
+
+func (c Container) ValidateName() report.Report {
+	if c.Name == "" {
+		return report.ReportFromError(ErrContainerNameRequired, report.EntryError)
+	}
+	if !containerName.MatchString(c.Name) {
+		return report.ReportFromError(ErrInvalidContainerName, report.EntryError)
+	}
+	return report.Report{}
+}
+
+func (c Container) ValidateImage() report.Report {
+	if c.Image == "" {
+		return report.ReportFromError(ErrImageRequired, report.EntryError)
+	}
+	name := c.Image
+	if at := strings.Index(name, "@"); at >= 0 {
+		name = name[:at]
+	}
+	if len(name) > maxImageName || !imageReference.MatchString(c.Image) {
+		return report.ReportFromError(ErrInvalidImage, report.EntryError)
+	}
+	return report.Report{}
+}
+
+func (c Container) ValidateCommand() report.Report {
+	for _, arg := range c.Command {
+		if arg == "" {
+			return report.ReportFromError(ErrEmptyContainerArgument, report.EntryError)
+		}
+	}
+	return report.Report{}
+}
+
+func (c Container) ValidateEnvironment() report.Report {
+	return checkEnvironment(c.Environment, ErrInvalidContainerEnvironment)
+}
+
+func (c Container) ValidatePorts() report.Report {
+	for _, port := range c.Ports {
+		if !validPort(port) {
+			return report.ReportFromError(fmt.Errorf("invalid port %q, expected [IP:][HOST_PORT:]CONTAINER_PORT[/PROTOCOL] like 127.0.0.1:8080:80/tcp", port), report.EntryError)
+		}
+	}
+	if len(c.Ports) > 0 && (c.Network == NetworkHost || c.Network == NetworkNone || strings.HasPrefix(c.Network, "container:")) {
+		return report.ReportFromError(ErrPortsWithoutNetwork, report.EntryError)
+	}
+	return report.Report{}
+}
+
+func (c Container) ValidateVolumes() report.Report {
+	for _, volume := range c.Volumes {
+		if !validVolume(volume) {
+			return report.ReportFromError(fmt.Errorf("invalid volume %q, expected [SOURCE:]DESTINATION[:OPTIONS] where the source is an absolute path or the name of a volume", volume), report.EntryError)
+		}
+	}
+	return report.Report{}
+}
+
+func (c Container) ValidateNetwork() report.Report {
+	network := strings.TrimPrefix(c.Network, "container:")
+	if c.Network != "" && !containerName.MatchString(network) {
+		return report.ReportFromError(ErrInvalidNetwork, report.EntryError)
+	}
+	return report.Report{}
+}
+
+func (c Container) ValidateRestart() report.Report {
+	switch c.Restart {
+	case "", RestartAlways, RestartOnFailure, RestartNo:
+		return report.Report{}
+	}
+	return report.ReportFromError(ErrUnknownRestartPolicy, report.EntryError)
+}
+
+func (c Container) ValidateCapabilities() report.Report {
+	for _, name := range c.Capabilities {
+		if !capability.MatchString(name) {
+			return report.ReportFromError(ErrInvalidCapability, report.EntryError)
+		}
+	}
+	return report.Report{}
+}
+
+func (c Container) ValidateDependsOn() report.Report {
+	for _, dep := range c.DependsOn {
+		if dep == c.Name {
+			return report.ReportFromError(ErrDependsOnSelf, report.EntryError)
+		}
+	}
+	return report.Report{}
+}
+
+// validPort returns whether port is a port to publish, in the syntax of the
+// --publish flag of docker run.
+func validPort(port string) bool {
+	spec := port
+	if slash := strings.LastIndex(spec, "/"); slash >= 0 {
+		switch spec[slash+1:] {
+		case "tcp", "udp", "sctp":
+		default:
+			return false
+		}
+		spec = spec[:slash]
+	}
+
+	var ip string
+	if strings.HasPrefix(spec, "[") {
+		// IPv6 addresses are in brackets
+		end := strings.Index(spec, "]:")
+		if end < 0 {
+			return false
+		}
+		ip, spec = spec[1:end], spec[end+2:]
+		if parsed := net.ParseIP(ip); parsed == nil || parsed.To4() != nil {
+			return false
+		}
+	}
+	parts := strings.Split(spec, ":")
+	if len(parts) == 3 && ip == "" {
+		ip, parts = parts[0], parts[1:]
+		if parsed := net.ParseIP(ip); parsed == nil || parsed.To4() == nil {
+			return false
+		}
+	}
+
+	var host string
+	switch len(parts) {
+	case 1:
+		if ip != "" {
+			return false
+		}
+	case 2:
+		host = parts[0]
+		if host == "" && ip == "" {
+			return false
+		}
+	default:
+		return false
+	}
+	container := parts[len(parts)-1]
+	first, last, ok := portRange(container)
+	if !ok {
+		return false
+	}
+	if host == "" {
+		return true
+	}
+	hostFirst, hostLast, ok := portRange(host)
+	if !ok {
+		return false
+	}
+	// a range of container ports is published on as many host ports
+	return first == last || hostLast-hostFirst == last-first
+}
+
+// portRange parses a port or a range of ports like 8000-8010.
+func portRange(s string) (int, int, bool) {
+	bounds := strings.Split(s, "-")
+	if len(bounds) > 2 {
+		return 0, 0, false
+	}
+	var ports []int
+	for _, bound := range bounds {
+		port, err := strconv.Atoi(bound)
+		if err != nil || port < 1 || port > 65535 || strings.HasPrefix(bound, "+") {
+			return 0, 0, false
+		}
+		ports = append(ports, port)
+	}
+	first, last := ports[0], ports[len(ports)-1]
+	return first, last, first <= last
+}
+
+// validVolume returns whether volume is a volume to mount, in the syntax of
+// the --volume flag of docker run.
+func validVolume(volume string) bool {
+	parts := strings.Split(volume, ":")
+	if len(parts) > 3 {
+		return false
+	}
+	if len(parts) == 1 {
+		// an anonymous volume
+		return strings.HasPrefix(volume, "/")
+	}
+	source, destination := parts[0], parts[1]
+	if !strings.HasPrefix(source, "/") && !containerName.MatchString(source) {
+		return false
+	}
+	if !strings.HasPrefix(destination, "/") {
+		return false
+	}
+	if len(parts) == 3 {
+		for _, option := range strings.Split(parts[2], ",") {
+			known := false
+			for _, o := range VolumeOptions {
+				known = known || option == o
+			}
+			if !known {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func init() {
+	register(func(in Config, ast astnode.AstNode, out ignTypes.Config, options ConvertOptions) (ignTypes.Config, report.Report, astnode.AstNode) {
+		r := checkContainerReferences(in.Containers, ast, options.ReportPaths)
+		if r.IsFatal() {
+			return out, r, ast
+		}
+		for i, container := range in.Containers {
+			unit := container.unit()
+			if findSystemdUnit(out.Systemd.Units, unit.Name) {
+				r.Add(containerEntry(ast, options.ReportPaths, fmt.Sprintf("systemd unit %s is generated for container %s but also listed in units", unit.Name, container.Name), i, "name"))
+				continue
+			}
+			options.SourceMap.add(ast, fmt.Sprintf("systemd.units[%d]", len(out.Systemd.Units)), "containers", i)
+			out.Systemd.Units = append(out.Systemd.Units, unit)
+		}
+		return out, r, ast
+	})
+}
+
+// checkContainerReferences checks that containers have unique names and that
+// the containers they depend on exist. Dependencies with a dot are units.
+func checkContainerReferences(containers []Container, ast astnode.AstNode, paths *astyaml.ReportPaths) report.Report {
+	r := report.Report{}
+	names := map[string]bool{}
+	for i, container := range containers {
+		if names[container.Name] {
+			r.Add(containerEntry(ast, paths, fmt.Sprintf("container %s is listed more than once", container.Name), i, "name"))
+		}
+		names[container.Name] = true
+	}
+	for i, container := range containers {
+		for _, dep := range container.DependsOn {
+			if !strings.Contains(dep, ".") && !names[dep] {
+				r.Add(containerEntry(ast, paths, fmt.Sprintf("container %s is not in containers, units must be named with their type like %s.service", dep, dep), i, "depends_on"))
+			}
+		}
+	}
+	return r
+}
+
+// containerEntry creates an error about a container, positioned at one of
+// its keys.
+func containerEntry(ast astnode.AstNode, paths *astyaml.ReportPaths, message string, i int, key string) report.Entry {
+	r := report.Report{Entries: []report.Entry{{Kind: report.EntryError, Message: message}}}
+	positionReport(&r, ast, paths, false, "containers", i, key)
+	return r.Entries[0]
+}
+
+// containerUnit returns the name of the unit of the container named name.
+func containerUnit(name string) string {
+	return "container-" + name + ".service"
+}
+
+// unit renders the service of a container, which runs it with docker. It
+// removes any container left by a previous run, pulls the image, since that
+// can take longer than systemd waits for services to start by default, and
+// runs the container without gaining privileges. A failed pull isn't fatal,
+// so that containers start from the local image while the registry is
+// unreachable. Images pinned by digest can't change and aren't pulled again;
+// docker run pulls them if they are missing.
+func (c Container) unit() ignTypes.Unit {
+	deps := []string{"docker.service"}
+	for _, dep := range c.DependsOn {
+		if !strings.Contains(dep, ".") {
+			dep = containerUnit(dep)
+		}
+		deps = append(deps, dep)
+	}
+
+	run := []string{dockerPath, "run", "--rm", "--name", c.Name, "--security-opt", "no-new-privileges"}
+	if c.ReadOnly {
+		run = append(run, "--read-only")
+	}
+	if c.Capabilities != nil {
+		run = append(run, "--cap-drop", "ALL")
+		for _, name := range c.Capabilities {
+			run = append(run, "--cap-add", name)
+		}
+	}
+	if c.Network != "" {
+		run = append(run, "--network", c.Network)
+	}
+	for _, port := range c.Ports {
+		run = append(run, "--publish", port)
+	}
+	for _, volume := range c.Volumes {
+		run = append(run, "--volume", volume)
+	}
+	for _, env := range c.Environment {
+		run = append(run, "--env", env)
+	}
+	run = append(run, c.Image)
+	run = append(run, c.Command...)
+
+	restart := c.Restart
+	if restart == "" {
+		restart = RestartAlways
+	}
+
+	unit := util.NewSystemdUnit()
+	unit.Unit.Add("Description=Container " + c.Name)
+	unit.Unit.Add("Wants=network-online.target")
+	unit.Unit.Add("After=network-online.target " + strings.Join(deps, " "))
+	unit.Unit.Add("Requires=" + strings.Join(deps, " "))
+	unit.Service.Add("TimeoutStartSec=0")
+	unit.Service.Add(fmt.Sprintf("ExecStartPre=-%s rm --force %s", dockerPath, c.Name))
+	if !strings.Contains(c.Image, "@") {
+		unit.Service.Add(fmt.Sprintf("ExecStartPre=-%s pull %s", dockerPath, execArgs([]string{c.Image})))
+	}
+	unit.Service.Add("ExecStart=" + execArgs(run))
+	unit.Service.Add(fmt.Sprintf("ExecStop=%s stop %s", dockerPath, c.Name))
+	unit.Service.Add("Restart=" + restart)
+	unit.Service.Add("RestartSec=10s")
+	unit.Install.Add("WantedBy=multi-user.target")
+
+	return ignTypes.Unit{
+		Name:     containerUnit(c.Name),
+		Enabled:  iutil.BoolToPtr(true),
+		Contents: unit.String(),
+	}
+}
+
+// execArgs joins the arguments of a command line of a unit, quoting those
+// systemd would split or unescape and escaping its specifiers and variables.
+func execArgs(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if strings.ContainsAny(arg, " \t\n\"'\\;") {
+			arg = `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`).Replace(arg) + `"`
+		}
+		quoted[i] = strings.NewReplacer("%", "%%", "$", "$$").Replace(arg)
+	}
+	return strings.Join(quoted, " ")
+}
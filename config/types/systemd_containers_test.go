@@ -0,0 +1,110 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/coreos/ignition/config/validate/report"
+)
+
+func TestValidateImage(t *testing.T) {
+	invalid := report.ReportFromError(ErrInvalidImage, report.EntryError)
+	tests := []struct {
+		in  string
+		out report.Report
+	}{
+		{"busybox", report.Report{}},
+		{"library/busybox:1.29", report.Report{}},
+		{"quay.io/coreos/etcd:v3.3.9", report.Report{}},
+		{"localhost:5000/team/app_server", report.Report{}},
+		{"nginx@sha256:" + strings.Repeat("ab", 32), report.Report{}},
+		{"nginx:1.15@sha256:" + strings.Repeat("ab", 32), report.Report{}},
+		{"", report.ReportFromError(ErrImageRequired, report.EntryError)},
+		{"Busybox", invalid},
+		{"busybox:", invalid},
+		{"quay.io/coreos/etcd:v3.3.9 --privileged", invalid},
+		{"nginx@sha256:abc", invalid},
+		{"-nginx", invalid},
+		{strings.Repeat("a", 256), invalid},
+	}
+
+	for i, test := range tests {
+		r := Container{Image: test.in}.ValidateImage()
+		if !reflect.DeepEqual(test.out, r) {
+			t.Errorf("#%d: wanted %v, got %v", i, test.out, r)
+		}
+	}
+}
+
+func TestValidPort(t *testing.T) {
+	tests := []struct {
+		in  string
+		out bool
+	}{
+		{"80", true},
+		{"8080:80", true},
+		{"53:53/udp", true},
+		{"127.0.0.1:8080:80/tcp", true},
+		{"127.0.0.1::80", true},
+		{"[::1]:8080:80", true},
+		{"8000-8010:8000-8010", true},
+		{"8000-8010:80", true},
+		{"0", false},
+		{"65536", false},
+		{"http", false},
+		{"80/icmp", false},
+		{":80", false},
+		{"8000-8010:9000-9005", false},
+		{"9000-8000", false},
+		{"localhost:8080:80", false},
+		{"127.0.0.1:80", false},
+		{"::1:8080:80", false},
+		{"[127.0.0.1]:8080:80", false},
+		{"1:2:3:4", false},
+	}
+
+	for i, test := range tests {
+		if out := validPort(test.in); out != test.out {
+			t.Errorf("#%d: %q: wanted %t, got %t", i, test.in, test.out, out)
+		}
+	}
+}
+
+func TestValidVolume(t *testing.T) {
+	tests := []struct {
+		in  string
+		out bool
+	}{
+		{"/data", true},
+		{"/srv/data:/data", true},
+		{"data:/data", true},
+		{"/srv/data:/data:ro", true},
+		{"/srv/data:/data:ro,Z", true},
+		{"data", false},
+		{"./data:/data", false},
+		{"/srv/data:data", false},
+		{"/srv/data:/data:readonly", false},
+		{"/srv/data:/data:ro:z", false},
+	}
+
+	for i, test := range tests {
+		if out := validVolume(test.in); out != test.out {
+			t.Errorf("#%d: %q: wanted %t, got %t", i, test.in, test.out, out)
+		}
+	}
+}
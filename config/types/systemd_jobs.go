@@ -0,0 +1,260 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/coreos/container-linux-config-transpiler/config/astyaml"
+	"github.com/coreos/container-linux-config-transpiler/config/types/util"
+	iutil "github.com/coreos/container-linux-config-transpiler/internal/util"
+	ignTypes "github.com/coreos/ignition/config/v2_3/types"
+	"github.com/coreos/ignition/config/validate/astnode"
+	"github.com/coreos/ignition/config/validate/report"
+)
+
+var (
+	jobName = regexp.MustCompile(`^[a-zA-Z0-9:_.\\-]+$`)
+	envName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+	ErrJobNameRequired         = errors.New("job name is required")
+	ErrInvalidJobName          = errors.New("job names may only contain letters, digits and the characters :_.\\-")
+	ErrJobCommandRequired      = errors.New("job command is required")
+	ErrRelativeJobCommand      = errors.New("job command must start with an absolute path to the executable")
+	ErrJobScheduleRequired     = errors.New("exactly one of on_calendar and interval must be specified")
+	ErrParsingOnCalendar       = errors.New("couldn't parse on_calendar")
+	ErrParsingInterval         = errors.New("couldn't parse interval, expected a positive duration like 30m")
+	ErrParsingRandomizedDelay  = errors.New("couldn't parse randomized_delay, expected a positive duration like 30m")
+	ErrInvalidJobEnvironment   = errors.New("environment entries must be NAME=VALUE")
+	ErrWhitespaceInJobUsername = errors.New("job user can't contain whitespace")
+)
+
+// SystemdJob is a command run periodically, which is rendered into a oneshot
+// service running the command and an enabled timer starting the service.
+type SystemdJob struct {
+	Name    string `yaml:"name"`
+	Command string `yaml:"command"`
+	// OnCalendar is a calendar event expression of systemd.time(7) and
+	// Interval a duration between runs, only one of them may be set
+	OnCalendar      string   `yaml:"on_calendar"`
+	Interval        string   `yaml:"interval"`
+	User            string   `yaml:"user"`
+	Environment     []string `yaml:"environment"`
+	RandomizedDelay string   `yaml:"randomized_delay"`
+}
+
+func (j SystemdJob) Validate() report.Report {
+	if (j.OnCalendar == "") == (j.Interval == "") {
+		return report.ReportFromError(ErrJobScheduleRequired, report.EntryError)
+	}
+	return report.Report{}
+}
+
+func (j SystemdJob) ValidateName() report.Report {
+	if j.Name == "" {
+		return report.ReportFromError(ErrJobNameRequired, report.EntryError)
+	}
+	if !jobName.MatchString(j.Name) {
+		return report.ReportFromError(ErrInvalidJobName, report.EntryError)
+	}
+	return report.Report{}
+}
+
+func (j SystemdJob) ValidateCommand() report.Report {
+	if strings.TrimSpace(j.Command) == "" {
+		return report.ReportFromError(ErrJobCommandRequired, report.EntryError)
+	}
+	// the executable may be prefixed by the special characters of ExecStart=
+	if !strings.HasPrefix(strings.TrimLeft(strings.TrimSpace(j.Command), "-@:+!"), "/") {
+		return report.ReportFromError(ErrRelativeJobCommand, report.EntryError)
+	}
+	return report.Report{}
+}
+
+func (j SystemdJob) ValidateOnCalendar() report.Report {
+	if j.OnCalendar == "" {
+		return report.Report{}
+	}
+	if err := checkCalendar(j.OnCalendar); err != nil {
+		return report.ReportFromError(fmt.Errorf("%v: %v", ErrParsingOnCalendar, err), report.EntryError)
+	}
+	return report.Report{}
+}
+
+func (j SystemdJob) ValidateInterval() report.Report {
+	if j.Interval == "" {
+		return report.Report{}
+	}
+	if d, err := time.ParseDuration(j.Interval); err != nil || d <= 0 {
+		return report.ReportFromError(ErrParsingInterval, report.EntryError)
+	}
+	return report.Report{}
+}
+
+func (j SystemdJob) ValidateRandomizedDelay() report.Report {
+	if j.RandomizedDelay == "" {
+		return report.Report{}
+	}
+	if d, err := time.ParseDuration(j.RandomizedDelay); err != nil || d <= 0 {
+		return report.ReportFromError(ErrParsingRandomizedDelay, report.EntryError)
+	}
+	return report.Report{}
+}
+
+func (j SystemdJob) ValidateUser() report.Report {
+	if strings.ContainsAny(j.User, " \t\n") {
+		return report.ReportFromError(ErrWhitespaceInJobUsername, report.EntryError)
+	}
+	return report.Report{}
+}
+
+func (j SystemdJob) ValidateEnvironment() report.Report {
+	return checkEnvironment(j.Environment, ErrInvalidJobEnvironment)
+}
+
+// checkEnvironment checks that environment variables are NAME=VALUE, and
+// reports err if one isn't.
+func checkEnvironment(environment []string, err error) report.Report {
+	for _, env := range environment {
+		parts := strings.SplitN(env, "=", 2)
+		if len(parts) != 2 || !envName.MatchString(parts[0]) {
+			return report.ReportFromError(err, report.EntryError)
+		}
+	}
+	return report.Report{}
+}
+
+func init() {
+	register(func(in Config, ast astnode.AstNode, out ignTypes.Config, options ConvertOptions) (ignTypes.Config, report.Report, astnode.AstNode) {
+		r := report.Report{}
+		names := map[string]bool{}
+		for i, job := range in.Systemd.Jobs {
+			if names[job.Name] {
+				r.Add(jobEntry(ast, options.ReportPaths, fmt.Sprintf("job %s is listed more than once", job.Name), i, "name"))
+				continue
+			}
+			names[job.Name] = true
+			for _, unit := range job.units() {
+				if findSystemdUnit(out.Systemd.Units, unit.Name) {
+					r.Add(jobEntry(ast, options.ReportPaths, fmt.Sprintf("systemd unit %s is generated for job %s but also listed in units", unit.Name, job.Name), i, "name"))
+					continue
+				}
+				options.SourceMap.add(ast, fmt.Sprintf("systemd.units[%d]", len(out.Systemd.Units)), "systemd", "jobs", i)
+				out.Systemd.Units = append(out.Systemd.Units, unit)
+			}
+		}
+		return out, r, ast
+	})
+}
+
+// jobEntry creates an error about a job, positioned at one of its keys.
+func jobEntry(ast astnode.AstNode, paths *astyaml.ReportPaths, message string, i int, key string) report.Entry {
+	r := report.Report{Entries: []report.Entry{{Kind: report.EntryError, Message: message}}}
+	positionReport(&r, ast, paths, false, "systemd", "jobs", i, key)
+	return r.Entries[0]
+}
+
+func findSystemdUnit(units []ignTypes.Unit, name string) bool {
+	for _, unit := range units {
+		if unit.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// units renders the units of a job: the service running its command and the
+// timer starting the service, which is the only one of them that is enabled.
+func (j SystemdJob) units() []ignTypes.Unit {
+	service := util.NewSystemdUnit()
+	service.Unit.Add("Description=Job " + j.Name)
+	service.Service.Add("Type=oneshot")
+	if j.User != "" {
+		service.Service.Add("User=" + escapeSpecifiers(j.User))
+	}
+	for _, env := range j.Environment {
+		service.Service.Add(fmt.Sprintf("Environment=\"%s\"", escapeSpecifiers(escapeEnvironment(env))))
+	}
+	// variables are left for systemd to expand, so that the command can
+	// refer to the environment of the job
+	service.Service.Add("ExecStart=" + escapeSpecifiers(strings.TrimSpace(j.Command)))
+
+	timer := util.NewUnitFile()
+	timer.Section("Unit").Add("Description=Timer for job " + j.Name)
+	section := timer.Section("Timer")
+	if j.OnCalendar != "" {
+		section.Add("OnCalendar=" + j.OnCalendar)
+		// catch up on runs missed while the machine was off
+		section.Add("Persistent=true")
+	} else {
+		interval, _ := time.ParseDuration(j.Interval)
+		section.Add("OnBootSec=" + systemdDuration(interval))
+		section.Add("OnUnitActiveSec=" + systemdDuration(interval))
+	}
+	if j.RandomizedDelay != "" {
+		delay, _ := time.ParseDuration(j.RandomizedDelay)
+		section.Add("RandomizedDelaySec=" + systemdDuration(delay))
+	}
+	timer.Section("Install").Add("WantedBy=timers.target")
+
+	return []ignTypes.Unit{
+		{Name: j.Name + ".service", Contents: service.String()},
+		{Name: j.Name + ".timer", Enabled: iutil.BoolToPtr(true), Contents: timer.String()},
+	}
+}
+
+// systemdDuration formats d as a time span of systemd.time(7), like 1h30min.
+// Unlike Duration.String, it doesn't write fractions like 1.5s or units like
+// µs that systemd doesn't know.
+func systemdDuration(d time.Duration) string {
+	units := []struct {
+		name string
+		d    time.Duration
+	}{
+		{"h", time.Hour},
+		{"min", time.Minute},
+		{"s", time.Second},
+		{"ms", time.Millisecond},
+		{"us", time.Microsecond},
+		{"ns", time.Nanosecond},
+	}
+	var s string
+	for _, unit := range units {
+		if n := d / unit.d; n > 0 {
+			s += fmt.Sprintf("%d%s", n, unit.name)
+			d -= n * unit.d
+		}
+	}
+	if s == "" {
+		return "0"
+	}
+	return s
+}
+
+// escapeEnvironment escapes the characters that are special in the double
+// quoted values of Environment=.
+func escapeEnvironment(env string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(env)
+}
+
+// escapeSpecifiers escapes the specifiers systemd would resolve in a setting,
+// like %H for the hostname.
+func escapeSpecifiers(s string) string {
+	return strings.Replace(s, "%", "%%", -1)
+}
@@ -0,0 +1,40 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSystemdDuration(t *testing.T) {
+	tests := []struct {
+		in  time.Duration
+		out string
+	}{
+		{0, "0"},
+		{30 * time.Minute, "30min"},
+		{90 * time.Minute, "1h30min"},
+		{36 * time.Hour, "36h"},
+		{1500 * time.Millisecond, "1s500ms"},
+		{2 * time.Microsecond, "2us"},
+	}
+
+	for i, test := range tests {
+		if out := systemdDuration(test.in); out != test.out {
+			t.Errorf("#%d: wanted %q, got %q", i, test.out, out)
+		}
+	}
+}
@@ -61,7 +61,7 @@ func (s UpdateServer) Validate() report.Report {
 }
 
 func init() {
-	register(func(in Config, ast astnode.AstNode, out ignTypes.Config, platform string) (ignTypes.Config, report.Report, astnode.AstNode) {
+	register(func(in Config, ast astnode.AstNode, out ignTypes.Config, options ConvertOptions) (ignTypes.Config, report.Report, astnode.AstNode) {
 		var contents string
 		if in.Update != nil {
 			if in.Update.Group != "" {
@@ -78,6 +78,11 @@ func init() {
 			}
 		}
 		if contents != "" {
+			section := "update"
+			if in.Update == nil {
+				section = "locksmith"
+			}
+			options.SourceMap.add(ast, fmt.Sprintf("storage.files[%d]", len(out.Storage.Files)), section)
 			out.Storage.Files = append(out.Storage.Files, ignTypes.File{
 				Node: ignTypes.Node{
 					Filesystem: "root",
@@ -35,18 +35,49 @@ func (u *UnitSection) Add(line string) {
 }
 
 func (s SystemdUnit) String() string {
-	res := ""
-
-	type section struct {
-		name     string
-		contents []string
-	}
-
-	for _, sec := range []section{
+	return formatSections([]*section{
 		{"Unit", *s.Unit},
 		{"Service", *s.Service},
 		{"Install", *s.Install},
-	} {
+	})
+}
+
+// UnitFile is a unit file with any sections, like the units of networkd.
+// Sections are written in the order they were first used.
+type UnitFile struct {
+	sections []*section
+}
+
+type section struct {
+	name     string
+	contents UnitSection
+}
+
+func NewUnitFile() *UnitFile {
+	return &UnitFile{}
+}
+
+// Section returns the section with the given name, adding it if needed.
+func (f *UnitFile) Section(name string) *UnitSection {
+	for _, sec := range f.sections {
+		if sec.name == name {
+			return &sec.contents
+		}
+	}
+	sec := &section{name: name}
+	f.sections = append(f.sections, sec)
+	return &sec.contents
+}
+
+func (f *UnitFile) String() string {
+	return formatSections(f.sections)
+}
+
+// formatSections writes sections in the unit file format, leaving out empty
+// ones.
+func formatSections(sections []*section) string {
+	res := ""
+	for _, sec := range sections {
 		if len(sec.contents) == 0 {
 			continue
 		}
@@ -139,3 +139,23 @@ WantedBy=multi-user.target`,
 		}
 	}
 }
+
+func TestBuildUnitFile(t *testing.T) {
+	unit := NewUnitFile()
+	match := unit.Section("Match")
+	network := unit.Section("Network")
+	unit.Section("Link")
+	match.Add("Name=eth0")
+	network.Add("DHCP=yes")
+	unit.Section("Match").Add("Type=ether")
+
+	expected := `[Match]
+Name=eth0
+Type=ether
+
+[Network]
+DHCP=yes`
+	if res := unit.String(); res != expected {
+		t.Errorf("result didn't match expected output.\nResult:\n%s\n\nExpected:\n%s", res, expected)
+	}
+}
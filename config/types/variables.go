@@ -0,0 +1,36 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+const (
+	VariableString = "string"
+	VariableNumber = "number"
+	VariableBool   = "bool"
+	VariableList   = "list"
+)
+
+var (
+	VariableTypes = []string{VariableString, VariableNumber, VariableBool, VariableList}
+)
+
+// Variable declares a variable that can be referenced as ${var.NAME} anywhere
+// in the config. The references are substituted before the config is parsed,
+// so the declarations don't take part in the conversion.
+type Variable struct {
+	// Type is one of VariableTypes, string if unset.
+	Type        string      `yaml:"type"`
+	Default     interface{} `yaml:"default"`
+	Description string      `yaml:"description"`
+}
@@ -0,0 +1,246 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package unitfile
+
+import (
+	"strings"
+)
+
+// set is a set of directive names.
+type set map[string]bool
+
+// newSet returns the set of the space separated names in lists.
+func newSet(lists ...string) set {
+	s := set{}
+	for _, list := range lists {
+		for _, name := range strings.Fields(list) {
+			s[name] = true
+		}
+	}
+	return s
+}
+
+// The directives below are those of systemd.directives(7) as of the systemd
+// shipped with Container Linux, including deprecated names systemd still
+// accepts.
+
+const (
+	conditions = `ConditionArchitecture ConditionVirtualization ConditionHost
+		ConditionKernelCommandLine ConditionKernelVersion ConditionSecurity
+		ConditionCapability ConditionACPower ConditionNeedsUpdate
+		ConditionFirstBoot ConditionPathExists ConditionPathExistsGlob
+		ConditionPathIsDirectory ConditionPathIsSymbolicLink
+		ConditionPathIsMountPoint ConditionPathIsReadWrite
+		ConditionDirectoryNotEmpty ConditionFileNotEmpty
+		ConditionFileIsExecutable ConditionUser ConditionGroup
+		ConditionControlGroupController`
+
+	unitSection = `Description Documentation Requires Requisite Wants BindsTo
+		BindTo PartOf Conflicts Before After OnFailure PropagatesReloadTo
+		ReloadPropagatedFrom JoinsNamespaceOf RequiresMountsFor
+		OnFailureJobMode OnFailureIsolate IgnoreOnIsolate StopWhenUnneeded
+		RefuseManualStart RefuseManualStop AllowIsolate DefaultDependencies
+		CollectMode JobTimeoutSec JobRunningTimeoutSec JobTimeoutAction
+		JobTimeoutRebootArgument StartLimitInterval StartLimitIntervalSec
+		StartLimitBurst StartLimitAction FailureAction SuccessAction
+		RebootArgument SourcePath`
+
+	installSection = `Alias WantedBy RequiredBy Also DefaultInstance`
+
+	exec = `WorkingDirectory RootDirectory RootImage MountAPIVFS User Group
+		DynamicUser SupplementaryGroups PAMName CapabilityBoundingSet
+		AmbientCapabilities NoNewPrivileges SecureBits SELinuxContext
+		AppArmorProfile SmackProcessLabel LimitCPU LimitFSIZE LimitDATA
+		LimitSTACK LimitCORE LimitRSS LimitNOFILE LimitAS LimitNPROC
+		LimitMEMLOCK LimitLOCKS LimitSIGPENDING LimitMSGQUEUE LimitNICE
+		LimitRTPRIO LimitRTTIME UMask KeyringMode OOMScoreAdjust
+		TimerSlackNSec Personality IgnoreSIGPIPE Nice CPUSchedulingPolicy
+		CPUSchedulingPriority CPUSchedulingResetOnFork CPUAffinity
+		IOSchedulingClass IOSchedulingPriority ProtectSystem ProtectHome
+		RuntimeDirectory StateDirectory CacheDirectory LogsDirectory
+		ConfigurationDirectory RuntimeDirectoryMode StateDirectoryMode
+		CacheDirectoryMode LogsDirectoryMode ConfigurationDirectoryMode
+		RuntimeDirectoryPreserve ReadWritePaths ReadOnlyPaths
+		InaccessiblePaths ReadWriteDirectories ReadOnlyDirectories
+		InaccessibleDirectories BindPaths BindReadOnlyPaths
+		TemporaryFileSystem PrivateTmp PrivateDevices PrivateNetwork
+		PrivateUsers ProtectKernelTunables ProtectKernelModules
+		ProtectControlGroups RestrictAddressFamilies RestrictNamespaces
+		LockPersonality MemoryDenyWriteExecute RestrictRealtime RemoveIPC
+		MountFlags SystemCallFilter SystemCallErrorNumber
+		SystemCallArchitectures Environment EnvironmentFile PassEnvironment
+		UnsetEnvironment StandardInput StandardOutput StandardError
+		StandardInputText StandardInputData LogLevelMax LogExtraFields
+		SyslogIdentifier SyslogFacility SyslogLevel SyslogLevelPrefix
+		TTYPath TTYReset TTYVHangup TTYVTDisallocate UtmpIdentifier
+		UtmpMode`
+
+	kill = `KillMode KillSignal SendSIGHUP SendSIGKILL`
+
+	resourceControl = `Slice Delegate CPUAccounting CPUWeight
+		StartupCPUWeight CPUShares StartupCPUShares CPUQuota
+		MemoryAccounting MemoryLow MemoryHigh MemoryMax MemorySwapMax
+		MemoryLimit TasksAccounting TasksMax IOAccounting IOWeight
+		StartupIOWeight IODeviceWeight IOReadBandwidthMax
+		IOWriteBandwidthMax IOReadIOPSMax IOWriteIOPSMax BlockIOAccounting
+		BlockIOWeight StartupBlockIOWeight BlockIODeviceWeight
+		BlockIOReadBandwidth BlockIOWriteBandwidth IPAccounting
+		IPAddressAllow IPAddressDeny DeviceAllow DevicePolicy`
+
+	serviceSection = `Type RemainAfterExit GuessMainPID PIDFile BusName
+		ExecStart ExecStartPre ExecStartPost ExecReload ExecStop ExecStopPost
+		RestartSec TimeoutStartSec TimeoutStopSec TimeoutSec RuntimeMaxSec
+		WatchdogSec Restart SuccessExitStatus RestartPreventExitStatus
+		RestartForceExitStatus PermissionsStartOnly RootDirectoryStartOnly
+		NonBlocking NotifyAccess Sockets FileDescriptorStoreMax
+		USBFunctionDescriptors USBFunctionStrings StartLimitInterval
+		StartLimitBurst StartLimitAction FailureAction RebootArgument`
+
+	timerSection = `OnActiveSec OnBootSec OnStartupSec OnUnitActiveSec
+		OnUnitInactiveSec OnCalendar AccuracySec RandomizedDelaySec Unit
+		Persistent WakeSystem RemainAfterElapse`
+
+	socketSection = `ListenStream ListenDatagram ListenSequentialPacket
+		ListenFIFO ListenSpecial ListenNetlink ListenMessageQueue
+		ListenUSBFunction SocketProtocol BindIPv6Only Backlog BindToDevice
+		SocketUser SocketGroup DirectoryMode SocketMode Accept Writable
+		MaxConnections MaxConnectionsPerSource KeepAlive KeepAliveTimeSec
+		KeepAliveIntervalSec KeepAliveProbes NoDelay Priority DeferAcceptSec
+		ReceiveBuffer SendBuffer IPTOS IPTTL Mark ReusePort SmackLabel
+		SmackLabelIPIn SmackLabelIPOut SELinuxContextFromNet PipeSize
+		MessageQueueMaxMessages MessageQueueMessageSize FreeBind Transparent
+		Broadcast PassCredentials PassSecurity TCPCongestion ExecStartPre
+		ExecStartPost ExecStopPre ExecStopPost TimeoutSec Service
+		RemoveOnStop Symlinks FileDescriptorName TriggerLimitIntervalSec
+		TriggerLimitBurst`
+
+	mountSection = `What Where Type Options SloppyOptions LazyUnmount
+		ForceUnmount DirectoryMode TimeoutSec`
+
+	matchConditions = `Host Virtualization KernelCommandLine KernelVersion
+		Architecture`
+
+	networkSection = `Description DHCP DHCPServer LinkLocalAddressing
+		IPv4LLRoute IPv6Token LLMNR MulticastDNS DNSOverTLS DNSSEC
+		DNSSECNegativeTrustAnchors LLDP EmitLLDP BindCarrier Address Gateway
+		DNS Domains NTP IPForward IPMasquerade IPv6PrivacyExtensions
+		IPv6AcceptRA IPv6DuplicateAddressDetection IPv6HopLimit
+		IPv4ProxyARP IPv6ProxyNDP IPv6ProxyNDPAddress IPv6PrefixDelegation
+		IPv6MTUBytes Bridge Bond VRF VLAN IPVLAN MACVLAN VXLAN Tunnel
+		ActiveSlave PrimarySlave ConfigureWithoutCarrier`
+
+	dhcpSection = `UseDNS UseNTP UseMTU Anonymize SendHostname UseHostname
+		Hostname UseDomains UseRoutes UseTimezone CriticalConnection
+		ClientIdentifier VendorClassIdentifier UserClass DUIDType
+		DUIDRawData IAID RequestBroadcast RouteMetric RouteTable ListenPort
+		RapidCommit`
+
+	bondSection = `Mode TransmitHashPolicy LACPTransmitRate MIIMonitorSec
+		UpDelaySec DownDelaySec LearnPacketIntervalSec AdSelect
+		FailOverMACPolicy ARPValidate ARPIntervalSec ARPIPTargets
+		ARPAllTargets PrimaryReselectPolicy ResendIGMP PacketsPerSlave
+		GratuitousARP AllSlavesActive MinLinks`
+
+	tunSection = `OneQueue MultiQueue PacketInfo VNetHeader User Group`
+)
+
+// directives are the directives systemd knows, by unit type and section.
+var directives = map[string]map[string]set{
+	"service": {
+		"Unit":    newSet(unitSection, conditions, asserts(conditions)),
+		"Service": newSet(serviceSection, exec, kill, resourceControl),
+		"Install": newSet(installSection),
+	},
+	"socket": {
+		"Unit":    newSet(unitSection, conditions, asserts(conditions)),
+		"Socket":  newSet(socketSection, exec, kill, resourceControl),
+		"Install": newSet(installSection),
+	},
+	"mount": {
+		"Unit":    newSet(unitSection, conditions, asserts(conditions)),
+		"Mount":   newSet(mountSection, exec, kill, resourceControl),
+		"Install": newSet(installSection),
+	},
+	"timer": {
+		"Unit":    newSet(unitSection, conditions, asserts(conditions)),
+		"Timer":   newSet(timerSection),
+		"Install": newSet(installSection),
+	},
+	"network": {
+		"Match":   newSet(`MACAddress Path Driver Type Name`, matchConditions),
+		"Link":    newSet(`MACAddress MTUBytes ARP Multicast AllMulticast Unmanaged RequiredForOnline`),
+		"Network": newSet(networkSection),
+		"Address": newSet(`Address Peer Broadcast Label PreferredLifetime Scope
+			HomeAddress DuplicateAddressDetection ManageTemporaryAddress
+			PrefixRoute AutoJoin`),
+		"Route": newSet(`Gateway GatewayOnLink Destination Source Metric
+			IPv6Preference Scope PreferredSource Table Protocol Type
+			InitialCongestionWindow InitialAdvertisedReceiveWindow QuickAck
+			MTUBytes`),
+		"RoutingPolicyRule": newSet(`TypeOfService From To FirewallMark Table
+			Priority IncomingInterface OutgoingInterface`),
+		"DHCP":         newSet(dhcpSection),
+		"IPv6AcceptRA": newSet(`UseDNS UseDomains RouteTable`),
+		"DHCPServer": newSet(`PoolOffset PoolSize DefaultLeaseTimeSec
+			MaxLeaseTimeSec EmitDNS DNS EmitNTP NTP EmitRouter EmitTimezone
+			Timezone`),
+		"IPv6PrefixDelegation": newSet(`Managed OtherInformation
+			RouterLifetimeSec RouterPreference EmitDNS DNS EmitDomains Domains
+			DNSLifetimeSec`),
+		"IPv6Prefix": newSet(`AddressAutoconfiguration OnLink Prefix
+			PreferredLifetimeSec ValidLifetimeSec`),
+		"Bridge": newSet(`UnicastFlood HairPin UseBPDU FastLeave
+			AllowPortToBeRoot Cost Priority`),
+		"BridgeFDB":  newSet(`MACAddress VLANId`),
+		"BridgeVLAN": newSet(`VLAN EgressUntagged PVID`),
+	},
+	"netdev": {
+		"Match":  newSet(matchConditions),
+		"NetDev": newSet(`Description Name Kind MTUBytes MACAddress`),
+		"Bridge": newSet(`HelloTimeSec MaxAgeSec ForwardDelaySec AgeingTimeSec
+			Priority GroupForwardMask DefaultPVID MulticastQuerier
+			MulticastSnooping VLANFiltering STP`),
+		"VLAN":    newSet(`Id GVRP MVRP LooseBinding ReorderHeader`),
+		"MACVLAN": newSet(`Mode`),
+		"MACVTAP": newSet(`Mode`),
+		"IPVLAN":  newSet(`Mode Flags`),
+		"VXLAN": newSet(`Id Remote Local TOS TTL MacLearning FDBAgeingSec
+			MaximumFDBEntries ReduceARPProxy L2MissNotification
+			L3MissNotification RouteShortCircuit UDPChecksum
+			UDP6ZeroChecksumTx UDP6ZeroChecksumRx RemoteChecksumTx
+			RemoteChecksumRx GroupPolicyExtension DestinationPort PortRange
+			FlowLabel`),
+		"GENEVE": newSet(`Id Remote TOS TTL UDPChecksum UDP6ZeroChecksumTx
+			UDP6ZeroChecksumRx DestinationPort FlowLabel`),
+		"Tunnel": newSet(`Local Remote TOS TTL DiscoverPathMTU IPv6FlowLabel
+			CopyDSCP EncapsulationLimit Key InputKey OutputKey Mode Independent
+			AllowLocalRemote`),
+		"Peer":      newSet(`Name MACAddress`),
+		"VXCAN":     newSet(`Peer`),
+		"Tun":       newSet(tunSection),
+		"Tap":       newSet(tunSection),
+		"Bond":      newSet(bondSection),
+		"VRF":       newSet(`TableId Table`),
+		"WireGuard": newSet(`PrivateKey ListenPort FwMark`),
+		"WireGuardPeer": newSet(`PublicKey PresharedKey AllowedIPs Endpoint
+			PersistentKeepalive`),
+	},
+}
+
+// asserts returns the Assert directives matching the Condition directives in
+// list.
+func asserts(list string) string {
+	return strings.Replace(list, "Condition", "Assert", -1)
+}
@@ -0,0 +1,205 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package unitfile parses the contents of systemd and networkd units, keeping
+// the line of every directive, and checks them against the sections and
+// directives systemd knows for each type of unit.
+package unitfile
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/coreos/go-systemd/unit"
+)
+
+// Option is a directive of a unit, on the line of the unit it starts on,
+// counting from 1. Line is 0 if it isn't known.
+type Option struct {
+	Section string
+	Name    string
+	Value   string
+	Line    int
+}
+
+// SyntaxError is a unit that can't be parsed, on the line of the unit the
+// error is on, counting from 1.
+type SyntaxError struct {
+	Line int
+	Err  error
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("invalid unit content: %v", e.Err)
+}
+
+// Parse parses the contents of a unit or drop-in with the same parser as
+// Ignition. Errors are *SyntaxErrors.
+func Parse(contents string) ([]Option, error) {
+	opts, err := deserialize(contents)
+	if err != nil {
+		return nil, &SyntaxError{Line: errorLine(contents), Err: err}
+	}
+
+	res := make([]Option, len(opts))
+	for i, opt := range opts {
+		res[i] = Option{Section: opt.Section, Name: opt.Name, Value: opt.Value}
+	}
+	// the parser doesn't track lines, so they are found by walking the
+	// contents the same way. If that ever disagrees with the parser, the
+	// lines are left unknown rather than wrong.
+	starts := optionLines(contents)
+	if len(starts) != len(res) {
+		return res, nil
+	}
+	for i, start := range starts {
+		if start.section != res[i].Section || start.name != res[i].Name {
+			return res, nil
+		}
+	}
+	for i, start := range starts {
+		res[i].Line = start.line
+	}
+	return res, nil
+}
+
+func deserialize(contents string) ([]*unit.UnitOption, error) {
+	return unit.Deserialize(strings.NewReader(contents))
+}
+
+// errorLine returns the line of contents a parse error is on: the last line
+// of the shortest prefix of contents that can't be parsed.
+func errorLine(contents string) int {
+	lines := strings.SplitAfter(contents, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	for i := 1; i < len(lines); i++ {
+		if _, err := deserialize(strings.Join(lines[:i], "")); err != nil {
+			return i
+		}
+	}
+	return len(lines)
+}
+
+type optionStart struct {
+	section string
+	name    string
+	line    int
+}
+
+// optionLines returns where each directive of contents starts.
+func optionLines(contents string) []optionStart {
+	var starts []optionStart
+	section := ""
+	inSection := false
+	continued := false
+	for i, line := range strings.Split(contents, "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		trimmed := strings.TrimSpace(line)
+		if continued {
+			// a value ends at an empty line or one without a
+			// trailing backslash
+			continued = trimmed != "" && strings.HasSuffix(line, `\`)
+			continue
+		}
+		switch {
+		case trimmed == "", trimmed[0] == '#', trimmed[0] == ';':
+		case trimmed[0] == '[':
+			section = strings.TrimPrefix(trimmed, "[")
+			if end := strings.Index(section, "]"); end >= 0 {
+				section = section[:end]
+			}
+			inSection = true
+		case inSection:
+			eq := strings.Index(trimmed, "=")
+			if eq < 0 {
+				continue
+			}
+			starts = append(starts, optionStart{
+				section: section,
+				name:    strings.TrimSpace(trimmed[:eq]),
+				line:    i + 1,
+			})
+			continued = strings.HasSuffix(line, `\`)
+		}
+	}
+	return starts
+}
+
+// Type returns the type of a unit from its name, like "service" for
+// "etcd-member.service". Drop-ins have the type of the unit they are for.
+func Type(name string) string {
+	return strings.TrimPrefix(path.Ext(name), ".")
+}
+
+// Problem is a section or directive systemd doesn't know, on the line of the
+// unit it is on. Directive is empty for unknown sections. Known holds the
+// sections or directives that are known instead, for suggestions.
+type Problem struct {
+	Line      int
+	Section   string
+	Directive string
+	Known     []string
+}
+
+// Check returns the sections and directives in opts that systemd doesn't know
+// for units of type unitType. Unknown sections are reported once, on the line
+// of their first directive. Sections and directives starting with "X-" are
+// extensions systemd ignores. Units of types without a list of directives
+// aren't checked.
+func Check(unitType string, opts []Option) []Problem {
+	sections, ok := directives[unitType]
+	if !ok {
+		return nil
+	}
+
+	var problems []Problem
+	reported := map[string]bool{}
+	for _, opt := range opts {
+		if strings.HasPrefix(opt.Section, "X-") || strings.HasPrefix(opt.Name, "X-") {
+			continue
+		}
+		known, ok := sections[opt.Section]
+		if !ok {
+			if !reported[opt.Section] {
+				reported[opt.Section] = true
+				problems = append(problems, Problem{Line: opt.Line, Section: opt.Section, Known: names(sections)})
+			}
+			continue
+		}
+		if !known[opt.Name] {
+			problems = append(problems, Problem{Line: opt.Line, Section: opt.Section, Directive: opt.Name, Known: names(known)})
+		}
+	}
+	return problems
+}
+
+func names(m interface{}) []string {
+	var res []string
+	switch m := m.(type) {
+	case map[string]set:
+		for name := range m {
+			res = append(res, name)
+		}
+	case set:
+		for name := range m {
+			res = append(res, name)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
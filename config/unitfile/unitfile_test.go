@@ -0,0 +1,95 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package unitfile
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in   string
+		opts []Option
+		err  error
+	}{
+		{
+			in: `# comment
+[Unit]
+Description=example
+
+[Service]
+  ; indented comment
+ExecStart=/usr/bin/echo \
+  continued
+Environment=A=1
+`,
+			opts: []Option{
+				{Section: "Unit", Name: "Description", Value: "example", Line: 3},
+				{Section: "Service", Name: "ExecStart", Value: "/usr/bin/echo \\\n  continued", Line: 7},
+				{Section: "Service", Name: "Environment", Value: "A=1", Line: 9},
+			},
+		},
+		{
+			in: "[Service]\nExecStart=/usr/bin/true\n[Install\nWantedBy=multi-user.target\n",
+			err: &SyntaxError{
+				Line: 3,
+				Err:  errors.New("unable to find end of section"),
+			},
+		},
+		{
+			in: "[Service]\nExecStart\n",
+			err: &SyntaxError{
+				Line: 2,
+				Err:  errors.New("unexpected newline encountered while parsing option name"),
+			},
+		},
+	}
+
+	for i, test := range tests {
+		opts, err := Parse(test.in)
+		assert.Equal(t, test.err, err, "#%d: bad error", i)
+		assert.Equal(t, test.opts, opts, "#%d: bad options", i)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	opts := []Option{
+		{Section: "Unit", Name: "AssertPathExists", Line: 1},
+		{Section: "Service", Name: "ExecStart", Line: 2},
+		{Section: "Service", Name: "MemoryMax", Line: 3},
+		{Section: "Service", Name: "Listen", Line: 4},
+		{Section: "Service", Name: "X-Extension", Line: 5},
+		{Section: "Sevrice", Name: "Type", Line: 6},
+		{Section: "Sevrice", Name: "User", Line: 7},
+		{Section: "X-Custom", Name: "Anything", Line: 8},
+	}
+
+	problems := Check("service", opts)
+	if assert.Len(t, problems, 2) {
+		assert.Equal(t, 4, problems[0].Line)
+		assert.Equal(t, "Listen", problems[0].Directive)
+		assert.Contains(t, problems[0].Known, "ExecStart")
+		assert.Equal(t, 6, problems[1].Line)
+		assert.Equal(t, "Sevrice", problems[1].Section)
+		assert.Equal(t, "", problems[1].Directive)
+		assert.Equal(t, []string{"Install", "Service", "Unit"}, problems[1].Known)
+	}
+
+	assert.Len(t, Check("socket", opts), 2, "service section in a socket")
+	assert.Nil(t, Check("path", opts), "unchecked type")
+}
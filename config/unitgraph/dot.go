@@ -0,0 +1,79 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package unitgraph
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// WriteDOT writes the graph in the DOT format of Graphviz. Units of the config
+// are boxes, bold if they are enabled and dashed if the config only has
+// drop-ins for them. Units they reference are ellipses, gray if they ship with
+// Container Linux and red if they don't exist. Edges point from the unit with
+// the directive to the unit it references and are labeled with the directive.
+func (g Graph) WriteDOT(w io.Writer) error {
+	var b bytes.Buffer
+	b.WriteString("digraph units {\n")
+	b.WriteString("\tnode [shape=box];\n")
+	for _, unit := range g.Units {
+		var style string
+		switch {
+		case unit.Enabled && !unit.Contents:
+			style = "bold,dashed"
+		case unit.Enabled:
+			style = "bold"
+		case !unit.Contents:
+			style = "dashed"
+		}
+		if style == "" {
+			fmt.Fprintf(&b, "\t%s;\n", strconv.Quote(unit.Name))
+		} else {
+			fmt.Fprintf(&b, "\t%s [style=%q];\n", strconv.Quote(unit.Name), style)
+		}
+	}
+
+	var referenced []string
+	seen := map[string]bool{}
+	for _, unit := range g.Units {
+		for _, edge := range unit.Edges {
+			if _, ok := g.byName[edge.To]; !ok && !seen[edge.To] {
+				seen[edge.To] = true
+				referenced = append(referenced, edge.To)
+			}
+		}
+	}
+	sort.Strings(referenced)
+	for _, name := range referenced {
+		color := "gray"
+		if !g.Defined(name) {
+			color = "red"
+		}
+		fmt.Fprintf(&b, "\t%s [shape=ellipse, color=%s, fontcolor=%s];\n", strconv.Quote(name), color, color)
+	}
+
+	for _, unit := range g.Units {
+		for _, edge := range unit.Edges {
+			fmt.Fprintf(&b, "\t%s -> %s [label=%s];\n", strconv.Quote(unit.Name), strconv.Quote(edge.To), edge.Directive)
+		}
+	}
+	b.WriteString("}\n")
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
@@ -0,0 +1,124 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package unitgraph
+
+import (
+	"strings"
+)
+
+// stockUnits are the units that ship with Container Linux, and that configs
+// commonly reference. Templates are listed by their template name, like
+// getty@.service.
+var stockUnits = newSet(
+	// targets of systemd.special(7)
+	`basic.target bluetooth.target cryptsetup.target
+	cryptsetup-pre.target ctrl-alt-del.target default.target
+	emergency.target exit.target final.target getty.target
+	getty-pre.target graphical.target halt.target hibernate.target
+	hybrid-sleep.target initrd.target initrd-fs.target
+	initrd-root-fs.target kexec.target local-fs.target
+	local-fs-pre.target multi-user.target network.target
+	network-online.target network-pre.target nss-lookup.target
+	nss-user-lookup.target paths.target poweroff.target printer.target
+	reboot.target remote-fs.target remote-fs-pre.target rescue.target
+	rpcbind.target shutdown.target sigpwr.target sleep.target
+	slices.target smartcard.target sockets.target sound.target
+	suspend.target swap.target sysinit.target system-update.target
+	time-sync.target timers.target umount.target initrd-switch-root.target
+	machines.target remote-cryptsetup.target system-update-pre.target`,
+
+	// slices and mounts
+	`-.slice system.slice user.slice machine.slice -.mount boot.mount
+	dev-hugepages.mount dev-mqueue.mount media.mount proc-sys-fs-binfmt_misc.mount
+	proc-sys-fs-binfmt_misc.automount sys-fs-fuse-connections.mount sys-kernel-config.mount
+	sys-kernel-debug.mount tmp.mount usr.mount usr-share-oem.mount`,
+
+	// systemd, as installed in the image
+	`dbus.service dbus.socket dbus-org.freedesktop.hostname1.service
+	dbus-org.freedesktop.locale1.service
+	dbus-org.freedesktop.login1.service
+	dbus-org.freedesktop.machine1.service
+	dbus-org.freedesktop.network1.service
+	dbus-org.freedesktop.resolve1.service
+	dbus-org.freedesktop.timedate1.service
+	autovt@.service console-getty.service container-getty@.service
+	debug-shell.service emergency.service getty@.service
+	rescue.service serial-getty@.service user@.service
+	ldconfig.service kmod-static-nodes.service quotaon.service
+	systemd-ask-password-console.path
+	systemd-ask-password-console.service
+	systemd-ask-password-wall.path systemd-ask-password-wall.service
+	systemd-backlight@.service systemd-binfmt.service
+	systemd-coredump.socket systemd-coredump@.service
+	systemd-exit.service systemd-firstboot.service
+	systemd-fsck-root.service systemd-fsck@.service
+	systemd-halt.service systemd-hibernate.service
+	systemd-hostnamed.service systemd-hwdb-update.service
+	systemd-hybrid-sleep.service systemd-initctl.service
+	systemd-initctl.socket systemd-journal-catalog-update.service
+	systemd-journal-flush.service systemd-journald.service
+	systemd-journald.socket systemd-journald-audit.socket
+	systemd-journald-dev-log.socket systemd-kexec.service
+	systemd-localed.service systemd-logind.service
+	systemd-machine-id-commit.service systemd-machined.service
+	systemd-modules-load.service systemd-networkd.service
+	systemd-networkd.socket systemd-networkd-wait-online.service
+	systemd-nspawn@.service systemd-poweroff.service
+	systemd-quotacheck.service systemd-random-seed.service
+	systemd-reboot.service systemd-remount-fs.service
+	systemd-resolved.service systemd-rfkill.service
+	systemd-rfkill.socket systemd-suspend.service
+	systemd-sysctl.service systemd-sysusers.service
+	systemd-timedated.service systemd-time-wait-sync.service
+	systemd-timesyncd.service systemd-tmpfiles-clean.service
+	systemd-tmpfiles-clean.timer systemd-tmpfiles-setup.service
+	systemd-tmpfiles-setup-dev.service systemd-udevd.service
+	systemd-udevd-control.socket systemd-udevd-kernel.socket
+	systemd-udev-settle.service systemd-udev-trigger.service
+	systemd-update-done.service systemd-update-utmp.service
+	systemd-update-utmp-runlevel.service
+	systemd-user-sessions.service systemd-vconsole-setup.service
+	systemd-volatile-root.service`,
+
+	// Container Linux
+	`containerd.service docker.service docker.socket etcd.service
+	etcd2.service etcd-member.service flanneld.service fleet.service
+	fleet.socket locksmithd.service update-engine.service
+	update-engine-stub.service update-engine-stub.timer
+	coreos-metadata.service coreos-metadata-sshkeys@.service
+	oem-cloudinit.service system-cloudinit@.service
+	user-cloudinit@.service user-config.target user-configdrive.service
+	sshd.socket sshd.service sshd@.service sshd-keygen.service
+	ntpd.service chronyd.service iscsid.service iscsi.service
+	multipathd.service rpc-statd.service rpcbind.service
+	nfs-server.service nfs-client.target lvm2-lvmetad.service
+	mdmonitor.service sssd.service rkt-gc.service rkt-gc.timer
+	rkt-metadata.service rkt-metadata.socket ignition-files.service
+	update-ssh-keys-after-ignition.service
+	coreos-setup-environment.service`,
+)
+
+type set map[string]bool
+
+// newSet returns the set of the space separated names in lists.
+func newSet(lists ...string) set {
+	s := set{}
+	for _, list := range lists {
+		for _, name := range strings.Fields(list) {
+			s[name] = true
+		}
+	}
+	return s
+}
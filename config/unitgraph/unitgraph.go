@@ -0,0 +1,351 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package unitgraph builds the graph of dependencies between the systemd units
+// of an Ignition config, checks it for mistakes like ordering cycles and
+// references to units that don't exist, and writes it in the DOT format.
+package unitgraph
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/coreos/container-linux-config-transpiler/config/unitfile"
+	ignTypes "github.com/coreos/ignition/config/v2_3/types"
+)
+
+// The directives that reference other units.
+var (
+	// dependencies are the directives of the [Unit] section that reference
+	// other units
+	dependencies = []string{"Requires", "Requisite", "Wants", "BindsTo", "PartOf", "After", "Before"}
+	// installs are the directives of the [Install] section that name the
+	// units that pull in a unit when it is enabled
+	installs = []string{"WantedBy", "RequiredBy"}
+)
+
+// Edge is a reference from one unit to another, by the directive that makes
+// it, like "After" or "WantedBy".
+type Edge struct {
+	Directive string
+	To        string
+}
+
+// Unit is a unit of the config and its references to other units.
+type Unit struct {
+	Name string
+	// Index is the index of the unit in the systemd units of the config.
+	Index int
+	// Contents is whether the config has the full contents of the unit,
+	// rather than only drop-ins for a unit shipped with Container Linux.
+	Contents bool
+	Enabled  bool
+	Edges    []Edge
+}
+
+// Graph is the graph of the units of a config.
+type Graph struct {
+	// Units are the units defined in the config, in the order they are
+	// defined.
+	Units  []*Unit
+	byName map[string]*Unit
+}
+
+// Build builds the graph of the units of cfg, from their contents and their
+// drop-ins. Units whose contents can't be parsed are left without edges,
+// since that is reported when the config is validated.
+func Build(cfg ignTypes.Config) Graph {
+	g := Graph{byName: map[string]*Unit{}}
+	for i, u := range cfg.Systemd.Units {
+		unit := &Unit{
+			Name:     u.Name,
+			Index:    i,
+			Contents: u.Contents != "",
+			Enabled:  u.Enable || (u.Enabled != nil && *u.Enabled),
+		}
+		values := map[string][]string{}
+		contents := []string{u.Contents}
+		for _, dropin := range u.Dropins {
+			contents = append(contents, dropin.Contents)
+		}
+		for _, c := range contents {
+			opts, err := unitfile.Parse(c)
+			if err != nil {
+				continue
+			}
+			for _, opt := range opts {
+				if !references(opt) {
+					continue
+				}
+				if opt.Value == "" {
+					// an empty value resets the list, like in
+					// drop-ins that replace a dependency
+					delete(values, opt.Name)
+					continue
+				}
+				values[opt.Name] = append(values[opt.Name], strings.Fields(opt.Value)...)
+			}
+		}
+		for _, directive := range append(append([]string{}, dependencies...), installs...) {
+			for _, to := range values[directive] {
+				unit.Edges = append(unit.Edges, Edge{Directive: directive, To: to})
+			}
+		}
+		g.Units = append(g.Units, unit)
+		g.byName[unit.Name] = unit
+	}
+	return g
+}
+
+// references returns whether opt references other units.
+func references(opt unitfile.Option) bool {
+	directives := dependencies
+	switch opt.Section {
+	case "Unit":
+	case "Install":
+		directives = installs
+	default:
+		return false
+	}
+	for _, directive := range directives {
+		if opt.Name == directive {
+			return true
+		}
+	}
+	return false
+}
+
+// Defined returns whether the unit named name exists on a machine booted with
+// the config, because it is defined in the config or ships with Container
+// Linux. Instances of template units exist if the template does, and names
+// with specifiers like %i are assumed to exist.
+func (g Graph) Defined(name string) bool {
+	if strings.Contains(name, "%") {
+		return true
+	}
+	// device units are created by udev for every device
+	if strings.HasSuffix(name, ".device") {
+		return true
+	}
+	candidates := []string{name}
+	if at := strings.Index(name, "@"); at >= 0 {
+		dot := strings.LastIndex(name, ".")
+		if dot > at {
+			candidates = append(candidates, name[:at+1]+name[dot:])
+		}
+	}
+	for _, candidate := range candidates {
+		if _, ok := g.byName[candidate]; ok || stockUnits[candidate] {
+			return true
+		}
+	}
+	return false
+}
+
+// Problem is a mistake in the dependencies of a unit of the config.
+type Problem struct {
+	// Index is the index of the unit in the systemd units of the config.
+	Index   int
+	Message string
+}
+
+// Check returns the ordering cycles between the units of the graph, their
+// references to units that don't exist, and the enabled units that are wanted
+// by units that don't exist. Cycles are reported for the first unit of the
+// cycle in the config.
+func (g Graph) Check() []Problem {
+	var problems []Problem
+	for _, unit := range g.Units {
+		reported := map[string]bool{}
+		for _, edge := range unit.Edges {
+			if g.Defined(edge.To) || reported[edge.To] {
+				continue
+			}
+			reported[edge.To] = true
+			switch edge.Directive {
+			case "WantedBy", "RequiredBy":
+				if unit.Enabled {
+					problems = append(problems, Problem{
+						Index:   unit.Index,
+						Message: fmt.Sprintf("%s is enabled, but the unit it is %s doesn't exist: %s", unit.Name, installedBy(edge.Directive), edge.To),
+					})
+				}
+			default:
+				problems = append(problems, Problem{
+					Index:   unit.Index,
+					Message: fmt.Sprintf("%s references a unit that isn't in the config or shipped with Container Linux: %s=%s", unit.Name, edge.Directive, edge.To),
+				})
+			}
+		}
+	}
+
+	for _, cycle := range g.cycles() {
+		names := make([]string, len(cycle)+1)
+		for i, unit := range cycle {
+			names[i] = unit.Name
+		}
+		names[len(cycle)] = cycle[0].Name
+		problems = append(problems, Problem{
+			Index:   cycle[0].Index,
+			Message: fmt.Sprintf("ordering cycle: %s", strings.Join(names, " -> ")),
+		})
+	}
+	sort.Stable(byIndex(problems))
+	return problems
+}
+
+func installedBy(directive string) string {
+	if directive == "RequiredBy" {
+		return "required by"
+	}
+	return "wanted by"
+}
+
+type byIndex []Problem
+
+func (p byIndex) Len() int           { return len(p) }
+func (p byIndex) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+func (p byIndex) Less(i, j int) bool { return p[i].Index < p[j].Index }
+
+// orderedAfter returns the units of the config unit is ordered after, by
+// its own After= and the Before= of other units.
+func (g Graph) orderedAfter(unit *Unit) []*Unit {
+	var after []*Unit
+	seen := map[*Unit]bool{}
+	add := func(u *Unit) {
+		if u != nil && !seen[u] {
+			seen[u] = true
+			after = append(after, u)
+		}
+	}
+	for _, edge := range unit.Edges {
+		if edge.Directive == "After" {
+			add(g.byName[edge.To])
+		}
+	}
+	for _, other := range g.Units {
+		for _, edge := range other.Edges {
+			if edge.Directive == "Before" && edge.To == unit.Name {
+				add(other)
+			}
+		}
+	}
+	return after
+}
+
+// cycles returns an ordering cycle for each group of units of the config that
+// are ordered after each other, starting at the unit of the group that is
+// first in the config. Units shipped with Container Linux aren't part of any
+// cycle, since their dependencies aren't known.
+func (g Graph) cycles() [][]*Unit {
+	// Tarjan's algorithm finds the strongly connected components
+	index := map[*Unit]int{}
+	low := map[*Unit]int{}
+	onStack := map[*Unit]bool{}
+	var stack []*Unit
+	var components [][]*Unit
+	var visit func(u *Unit)
+	visit = func(u *Unit) {
+		index[u] = len(index)
+		low[u] = index[u]
+		stack = append(stack, u)
+		onStack[u] = true
+		for _, v := range g.orderedAfter(u) {
+			if _, ok := index[v]; !ok {
+				visit(v)
+				low[u] = minInt(low[u], low[v])
+			} else if onStack[v] {
+				low[u] = minInt(low[u], index[v])
+			}
+		}
+		if low[u] != index[u] {
+			return
+		}
+		var component []*Unit
+		for {
+			v := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[v] = false
+			component = append(component, v)
+			if v == u {
+				break
+			}
+		}
+		components = append(components, component)
+	}
+	for _, u := range g.Units {
+		if _, ok := index[u]; !ok {
+			visit(u)
+		}
+	}
+
+	var cycles [][]*Unit
+	for _, component := range components {
+		members := map[*Unit]bool{}
+		first := component[0]
+		for _, u := range component {
+			members[u] = true
+			if u.Index < first.Index {
+				first = u
+			}
+		}
+		if cycle := g.shortestCycle(first, members); cycle != nil {
+			cycles = append(cycles, cycle)
+		}
+	}
+	sort.Sort(byFirstIndex(cycles))
+	return cycles
+}
+
+// shortestCycle returns the shortest ordering cycle from start through members,
+// or nil if there is none.
+func (g Graph) shortestCycle(start *Unit, members map[*Unit]bool) []*Unit {
+	previous := map[*Unit]*Unit{}
+	queue := []*Unit{start}
+	for len(queue) > 0 {
+		u := queue[0]
+		queue = queue[1:]
+		for _, v := range g.orderedAfter(u) {
+			if !members[v] {
+				continue
+			}
+			if v == start {
+				cycle := []*Unit{u}
+				for cycle[0] != start {
+					cycle = append([]*Unit{previous[cycle[0]]}, cycle...)
+				}
+				return cycle
+			}
+			if _, ok := previous[v]; !ok {
+				previous[v] = u
+				queue = append(queue, v)
+			}
+		}
+	}
+	return nil
+}
+
+type byFirstIndex [][]*Unit
+
+func (c byFirstIndex) Len() int           { return len(c) }
+func (c byFirstIndex) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
+func (c byFirstIndex) Less(i, j int) bool { return c[i][0].Index < c[j][0].Index }
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,123 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package unitgraph
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/coreos/container-linux-config-transpiler/internal/util"
+	ignTypes "github.com/coreos/ignition/config/v2_3/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		in  []ignTypes.Unit
+		out []Problem
+	}{
+		{
+			in: []ignTypes.Unit{
+				{
+					Name:     "app.service",
+					Enabled:  util.BoolToPtr(true),
+					Contents: "[Unit]\nRequires=docker.service db.service\nAfter=docker.service db.service\n[Install]\nWantedBy=multi-user.target",
+				},
+				{
+					Name:     "db.service",
+					Contents: "[Unit]\nWants=network-online.target\nAfter=network-online.target",
+				},
+				{
+					Name:    "docker.service",
+					Enable:  true,
+					Dropins: []ignTypes.SystemdDropin{{Name: "10-flags.conf", Contents: "[Service]\nEnvironment=DOCKER_OPTS=--debug"}},
+				},
+				{
+					Name:     "getty@tty2.service",
+					Contents: "[Unit]\nAfter=systemd-fsck@dev-sda1.service %i.mount",
+				},
+				{
+					Name:     "seed.service",
+					Contents: "[Unit]\nAfter=systemd-journal-flush.service systemd-random-seed.service",
+				},
+			},
+		},
+		{
+			in: []ignTypes.Unit{
+				{
+					Name:     "a.service",
+					Enable:   true,
+					Contents: "[Unit]\nWants=b.service\nAfter=b.service\nBindsTo=dev-sdb.device\n[Install]\nWantedBy=custom.target",
+				},
+				{
+					Name:     "b.service",
+					Contents: "[Unit]\nRequires=mising.service\n[Install]\nRequiredBy=other.target",
+				},
+				{
+					Name:     "c.service",
+					Contents: "[Unit]\nBefore=b.service\nAfter=a.service",
+				},
+				{
+					Name:     "d.service",
+					Contents: "[Unit]\nAfter=d.service",
+					Dropins: []ignTypes.SystemdDropin{
+						{Name: "10-reset.conf", Contents: "[Unit]\nRequires=\nRequires=missing.service"},
+					},
+				},
+			},
+			out: []Problem{
+				{Index: 0, Message: "a.service is enabled, but the unit it is wanted by doesn't exist: custom.target"},
+				{Index: 0, Message: "ordering cycle: a.service -> b.service -> c.service -> a.service"},
+				{Index: 1, Message: "b.service references a unit that isn't in the config or shipped with Container Linux: Requires=mising.service"},
+				{Index: 3, Message: "d.service references a unit that isn't in the config or shipped with Container Linux: Requires=missing.service"},
+				{Index: 3, Message: "ordering cycle: d.service -> d.service"},
+			},
+		},
+	}
+
+	for i, test := range tests {
+		g := Build(ignTypes.Config{Systemd: ignTypes.Systemd{Units: test.in}})
+		assert.Equal(t, test.out, g.Check(), "#%d: bad problems", i)
+	}
+}
+
+func TestWriteDOT(t *testing.T) {
+	g := Build(ignTypes.Config{Systemd: ignTypes.Systemd{Units: []ignTypes.Unit{
+		{
+			Name:     "app.service",
+			Enable:   true,
+			Contents: "[Unit]\nAfter=docker.service missing.service\n[Install]\nWantedBy=multi-user.target",
+		},
+		{
+			Name:    "docker.service",
+			Dropins: []ignTypes.SystemdDropin{{Name: "10-flags.conf", Contents: "[Service]\nEnvironment=DOCKER_OPTS=--debug"}},
+		},
+	}}})
+
+	expected := `digraph units {
+	node [shape=box];
+	"app.service" [style="bold"];
+	"docker.service" [style="dashed"];
+	"missing.service" [shape=ellipse, color=red, fontcolor=red];
+	"multi-user.target" [shape=ellipse, color=gray, fontcolor=gray];
+	"app.service" -> "docker.service" [label=After];
+	"app.service" -> "missing.service" [label=After];
+	"app.service" -> "multi-user.target" [label=WantedBy];
+}
+`
+	var b bytes.Buffer
+	assert.NoError(t, g.WriteDOT(&b))
+	assert.Equal(t, expected, b.String())
+}
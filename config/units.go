@@ -0,0 +1,161 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/coreos/container-linux-config-transpiler/config/astyaml"
+	"github.com/coreos/container-linux-config-transpiler/config/types"
+	"github.com/coreos/container-linux-config-transpiler/config/unitfile"
+	"github.com/coreos/container-linux-config-transpiler/config/unitgraph"
+	ignTypes "github.com/coreos/ignition/config/v2_3/types"
+	"github.com/coreos/ignition/config/validate/astnode"
+	"github.com/coreos/ignition/config/validate/report"
+)
+
+// checkUnitContents parses the contents of every systemd and networkd unit and
+// drop-in in cfg and warns about sections and directives systemd doesn't know
+// for the type of the unit, since systemd ignores them. Contents that can't be
+// parsed are left to the validation of the transpiled config. Entries are
+// positioned at the line of the contents they are about if the contents are a
+// block scalar, and at the contents otherwise.
+func checkUnitContents(root astnode.AstNode, cfg types.Config, data []byte) report.Report {
+	c := unitChecker{root: root, indents: astyaml.BlockScalarIndents(data)}
+	forEachUnit(cfg, func(name, contents string, path []interface{}) {
+		c.check(name, contents, path...)
+	})
+	return c.r
+}
+
+// forEachUnit calls fn with the name of every systemd and networkd unit of
+// cfg and the contents of the unit and of each of its drop-ins, along with the
+// path of the contents.
+func forEachUnit(cfg types.Config, fn func(name, contents string, path []interface{})) {
+	for i, unit := range cfg.Systemd.Units {
+		fn(unit.Name, unit.Contents, []interface{}{"systemd", "units", i, "contents"})
+		for j, dropin := range unit.Dropins {
+			fn(unit.Name, dropin.Contents, []interface{}{"systemd", "units", i, "dropins", j, "contents"})
+		}
+	}
+	for i, unit := range cfg.Networkd.Units {
+		fn(unit.Name, unit.Contents, []interface{}{"networkd", "units", i, "contents"})
+		for j, dropin := range unit.Dropins {
+			fn(unit.Name, dropin.Contents, []interface{}{"networkd", "units", i, "dropins", j, "contents"})
+		}
+	}
+}
+
+// unitContents returns the contents of the units and drop-ins of cfg, keyed
+// by unitContentsKey.
+func unitContents(cfg types.Config) map[string]bool {
+	contents := map[string]bool{}
+	forEachUnit(cfg, func(name, c string, _ []interface{}) {
+		contents[unitContentsKey(name, c)] = true
+	})
+	return contents
+}
+
+func unitContentsKey(name, contents string) string {
+	return name + "\x00" + contents
+}
+
+type unitChecker struct {
+	root astnode.AstNode
+	// indents are the indentations of block scalars, by the zero based
+	// line of their header
+	indents map[int]int
+	r       report.Report
+}
+
+// check checks the contents of the unit named name, or of one of its
+// drop-ins, found at path.
+func (c *unitChecker) check(name, contents string, path ...interface{}) {
+	if contents == "" {
+		return
+	}
+	opts, err := unitfile.Parse(contents)
+	if err != nil {
+		// Ignition reports contents it can't parse when the transpiled
+		// config is validated
+		return
+	}
+
+	unitType := unitfile.Type(name)
+	for _, problem := range unitfile.Check(unitType, opts) {
+		var message string
+		if problem.Directive == "" {
+			message = fmt.Sprintf("unknown section [%s] in %s unit %s", problem.Section, unitType, name)
+			if suggestion := suggestName(problem.Section, problem.Known); suggestion != "" {
+				message += fmt.Sprintf(", did you mean [%s]?", suggestion)
+			}
+		} else {
+			message = fmt.Sprintf("unknown directive %s in section [%s] of %s unit %s", problem.Directive, problem.Section, unitType, name)
+			if suggestion := suggestName(problem.Directive, problem.Known); suggestion != "" {
+				message += fmt.Sprintf(", did you mean %s?", suggestion)
+			}
+		}
+		c.add(report.Entry{Kind: report.EntryWarning, Message: message}, problem.Line, path)
+	}
+}
+
+// add positions entry at the given line of the contents at path, counting
+// from 1, or at the contents as a whole if line is 0, and adds it.
+func (c *unitChecker) add(entry report.Entry, line int, path []interface{}) {
+	if n, ok := astyaml.NodeAt(c.root, path...); ok {
+		entry.Line, entry.Column, _ = n.ValueLineCol(nil)
+		// the content of a block scalar starts on the line after its
+		// header, so its lines map to lines of the config
+		if indent, ok := c.indents[entry.Line-1]; ok && line > 0 && indent >= 0 {
+			entry.Line += line
+			entry.Column = indent + 1
+		}
+	}
+	c.r.Add(entry)
+}
+
+// suggestName returns the name in candidates closest to name ignoring case, or
+// an empty string if none of them is close enough to be a likely typo.
+func suggestName(name string, candidates []string) string {
+	lower := make([]string, len(candidates))
+	names := map[string]string{}
+	for i, candidate := range candidates {
+		lower[i] = strings.ToLower(candidate)
+		names[lower[i]] = candidate
+	}
+	return names[suggestKey(name, lower)]
+}
+
+// CheckUnitGraph warns about ordering cycles between the units of a
+// transpiled config, references to units that neither it nor Container Linux
+// have, and enabled units wanted by units that don't exist. Entries are
+// positioned at what the unit was generated from, if sourceMap is the source
+// map of the conversion, and its path is recorded in paths.
+func CheckUnitGraph(cfg ignTypes.Config, sourceMap types.SourceMap, paths *astyaml.ReportPaths) report.Report {
+	r := report.Report{}
+	for _, problem := range unitgraph.Build(cfg).Check() {
+		entry := report.Entry{Kind: report.EntryWarning, Message: problem.Message}
+		source, ok := sourceMap.Lookup(fmt.Sprintf("systemd.units[%d]", problem.Index))
+		if ok {
+			entry.Line, entry.Column = source.Line, source.Column
+		}
+		r.Add(entry)
+		// identical entries get their paths in the order they were set, so
+		// entries without a source get an empty one
+		paths.Set(entry, source.Path)
+	}
+	return r
+}
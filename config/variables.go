@@ -0,0 +1,482 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	yaml "github.com/ajeddeloh/yaml"
+	"github.com/coreos/container-linux-config-transpiler/config/astyaml"
+	"github.com/coreos/container-linux-config-transpiler/config/types"
+	"github.com/coreos/ignition/config/validate/astnode"
+	"github.com/coreos/ignition/config/validate/report"
+)
+
+var (
+	// variableRef matches references to variables, and escaped references
+	// starting with $$
+	variableRef = regexp.MustCompile(`\$?\$\{var\.([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+	ErrVariableList      = errors.New("list variables can only be used as a whole value")
+	ErrVariableMultiline = errors.New("variables with multiple lines can only be used as a whole value")
+)
+
+// number is the text of a number variable given as a string, which is kept
+// as is so that octal modes like 0644 keep their meaning.
+type number string
+
+// substituteVariables replaces every ${var.NAME} in data with the value of
+// the variable, which is taken from values or the default of its declaration
+// in the variables section. References that make up a whole value, like
+// `key: ${var.NAME}`, are replaced with the value encoded as YAML, so lists
+// and strings with special characters can be used. Other references, like
+// those in the middle of strings or in unit contents, are replaced with the
+// text of the value, escaped for the style of the scalar they are in. Plain
+// scalars are double-quoted first if the values would change their meaning,
+// like a " #" starting a comment. $${var.NAME} is replaced with ${var.NAME}.
+//
+// The values never span multiple lines, so the lines of reports about the
+// result are valid for data.
+func substituteVariables(data []byte, values map[string]interface{}) ([]byte, report.Report) {
+	r := report.Report{}
+	if !variableRef.Match(data) && len(values) == 0 {
+		return data, r
+	}
+
+	var decls struct {
+		Variables map[string]types.Variable `yaml:"variables"`
+	}
+	if err := yaml.Unmarshal(data, &decls); err != nil {
+		// the parser reports this
+		return data, r
+	}
+
+	resolved, declReport := resolveVariables(data, decls.Variables, values)
+	r.Merge(declReport)
+
+	blocks := astyaml.BlockScalarLines(data)
+	lines := strings.Split(string(data), "\n")
+	scalars := findScalars(data, lines)
+	r.Merge(quotePlainScalars(lines, scalars, decls.Variables, resolved))
+	for i, line := range lines {
+		content := line
+		if !blocks[i] {
+			content, _ = astyaml.SplitComment(line)
+		}
+
+		var out bytes.Buffer
+		last := 0
+		for _, m := range variableRef.FindAllStringSubmatchIndex(content, -1) {
+			out.WriteString(line[last:m[0]])
+			last = m[1]
+			ref := line[m[0]:m[1]]
+			if strings.HasPrefix(ref, "$$") {
+				out.WriteString(ref[1:])
+				continue
+			}
+
+			name := line[m[2]:m[3]]
+			whole := !blocks[i] && isWholeValue(content, m[0], m[1])
+			text, err := formatVariable(name, decls.Variables, resolved, whole)
+			if err == nil && !whole {
+				text = escapeVariable(text, scalarAt(scalars, i, m[0]))
+			}
+			if err != nil {
+				r.Add(report.Entry{
+					Kind:    report.EntryError,
+					Message: err.Error(),
+					Line:    i + 1,
+					Column:  m[0] + 1,
+				})
+				out.WriteString(ref)
+				continue
+			}
+			out.WriteString(text)
+		}
+		out.WriteString(line[last:])
+		lines[i] = out.String()
+	}
+	return []byte(strings.Join(lines, "\n")), r
+}
+
+// resolveVariables returns the values of all declared variables that are set
+// or have a default, converted to their types. Variables whose values are
+// invalid are left out.
+func resolveVariables(data []byte, decls map[string]types.Variable, values map[string]interface{}) (map[string]interface{}, report.Report) {
+	r := report.Report{}
+	var root astnode.AstNode
+	if nodes := yaml.UnmarshalToNode(data); nodes != nil {
+		root, _ = astyaml.FromYamlDocumentNode(*nodes)
+	}
+	addError := func(err error, path ...interface{}) {
+		entry := report.Entry{Kind: report.EntryError, Message: err.Error()}
+		if n, ok := astyaml.NodeAt(root, path...); ok {
+			entry.Line, entry.Column, _ = n.ValueLineCol(nil)
+		}
+		r.Add(entry)
+	}
+
+	resolved := map[string]interface{}{}
+	for _, name := range sortedKeys(decls) {
+		decl := decls[name]
+		if decl.Type == "" {
+			decl.Type = types.VariableString
+		}
+		if !isVariableType(decl.Type) {
+			addError(fmt.Errorf("variable %s has unknown type %q. Accepted values: %v", name, decl.Type, types.VariableTypes), "variables", name, "type")
+			continue
+		}
+		value, ok := values[name]
+		if ok {
+			v, err := convertVariable(decl.Type, value)
+			if err != nil {
+				r.Add(report.Entry{
+					Kind:    report.EntryError,
+					Message: fmt.Sprintf("value of variable %s: %v", name, err),
+				})
+				continue
+			}
+			resolved[name] = v
+		} else if decl.Default != nil {
+			value = decl.Default
+			if decl.Type == types.VariableNumber || decl.Type == types.VariableString {
+				// taken as written, like values from the command
+				// line, so that 0644 isn't turned into 420
+				if text, ok := scalarText(root, "variables", name, "default"); ok {
+					value = text
+				}
+			}
+			v, err := convertVariable(decl.Type, value)
+			if err != nil {
+				addError(fmt.Errorf("default of variable %s: %v", name, err), "variables", name, "default")
+				continue
+			}
+			resolved[name] = v
+		}
+	}
+
+	return resolved, r
+}
+
+// scalarText returns the text of the scalar at path as it is written in the
+// config.
+func scalarText(root astnode.AstNode, path ...interface{}) (string, bool) {
+	n, ok := astyaml.NodeAt(root, path...)
+	if !ok {
+		return "", false
+	}
+	y, ok := n.(astyaml.YamlNode)
+	if !ok || y.Kind != yaml.ScalarNode {
+		return "", false
+	}
+	return y.Value, true
+}
+
+// checkUndeclaredVariables warns about values of variables that aren't
+// declared, which are likely typos.
+func checkUndeclaredVariables(decls map[string]types.Variable, values map[string]interface{}) report.Report {
+	r := report.Report{}
+	var undeclared []string
+	for name := range values {
+		if _, ok := decls[name]; !ok {
+			undeclared = append(undeclared, name)
+		}
+	}
+	sort.Strings(undeclared)
+	for _, name := range undeclared {
+		r.Add(report.Entry{
+			Kind:    report.EntryWarning,
+			Message: fmt.Sprintf("variable %s is set but not declared", name),
+		})
+	}
+	return r
+}
+
+// convertVariable checks that v is of the given type, parsing it if it is a
+// string from the command line.
+func convertVariable(typ string, v interface{}) (interface{}, error) {
+	s, isString := v.(string)
+	switch typ {
+	case types.VariableString:
+		switch v.(type) {
+		case string, int, float64, bool:
+			return fmt.Sprint(v), nil
+		}
+		return nil, fmt.Errorf("%v is not a string", v)
+	case types.VariableNumber:
+		switch v.(type) {
+		case int, float64:
+			return v, nil
+		}
+		if isString {
+			if _, err := strconv.ParseInt(s, 0, 64); err == nil {
+				return number(s), nil
+			}
+			if _, err := strconv.ParseFloat(s, 64); err == nil {
+				return number(s), nil
+			}
+		}
+		return nil, fmt.Errorf("%v is not a number", v)
+	case types.VariableBool:
+		if b, ok := v.(bool); ok {
+			return b, nil
+		}
+		if isString {
+			if b, err := strconv.ParseBool(s); err == nil {
+				return b, nil
+			}
+		}
+		return nil, fmt.Errorf("%v is not a bool", v)
+	case types.VariableList:
+		if isString {
+			// lists from the command line are YAML, like [a, b]
+			var list []interface{}
+			if err := yaml.Unmarshal([]byte(s), &list); err != nil || list == nil {
+				return nil, fmt.Errorf("%s is not a list", s)
+			}
+			v = list
+		}
+		if list, ok := v.([]interface{}); ok {
+			for _, elem := range list {
+				switch elem.(type) {
+				case string, int, float64, bool:
+				default:
+					return nil, fmt.Errorf("list entry %v is not a string, number or bool", elem)
+				}
+			}
+			return list, nil
+		}
+		return nil, fmt.Errorf("%v is not a list", v)
+	}
+	return nil, fmt.Errorf("unknown type %q", typ)
+}
+
+// formatVariable returns the text replacing a reference to a variable.
+func formatVariable(name string, decls map[string]types.Variable, resolved map[string]interface{}, whole bool) (string, error) {
+	if _, ok := decls[name]; !ok {
+		return "", fmt.Errorf("variable %s is not declared", name)
+	}
+	value, ok := resolved[name]
+	if !ok {
+		return "", fmt.Errorf("variable %s is not set and has no default", name)
+	}
+	if n, ok := value.(number); ok {
+		return string(n), nil
+	}
+
+	if whole {
+		var out bytes.Buffer
+		encoder := json.NewEncoder(&out)
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(value); err != nil {
+			return "", err
+		}
+		return strings.TrimSuffix(out.String(), "\n"), nil
+	}
+	if _, ok := value.([]interface{}); ok {
+		return "", ErrVariableList
+	}
+	text := fmt.Sprint(value)
+	if strings.Contains(text, "\n") {
+		return "", ErrVariableMultiline
+	}
+	return text, nil
+}
+
+// scalar is a scalar of the config, starting at a line and column counting
+// from 0. style is the quote or block indicator it starts with, or 0 if it is
+// plain. References can't be in plain scalars of flow collections, which
+// can't contain braces.
+type scalar struct {
+	line, column int
+	style        byte
+	value        string
+}
+
+// findScalars returns the scalars of data, which is split into lines, in the
+// order they are written in.
+func findScalars(data []byte, lines []string) []*scalar {
+	var scalars []*scalar
+	var walk func(n *yaml.Node)
+	walk = func(n *yaml.Node) {
+		if n.Kind == yaml.ScalarNode {
+			s := &scalar{line: n.Line, column: n.Column, value: n.Value}
+			if n.Line < len(lines) && n.Column < len(lines[n.Line]) && strings.IndexByte(`"'|>`, lines[n.Line][n.Column]) >= 0 {
+				s.style = lines[n.Line][n.Column]
+			}
+			scalars = append(scalars, s)
+		}
+		for _, child := range n.Children {
+			walk(child)
+		}
+	}
+	if nodes := yaml.UnmarshalToNode(data); nodes != nil {
+		walk(nodes)
+	}
+	return scalars
+}
+
+// scalarAt returns the scalar a reference at a line and column is in, which
+// is the last one starting before it.
+func scalarAt(scalars []*scalar, line, column int) *scalar {
+	var at *scalar
+	for _, s := range scalars {
+		if s.line > line || s.line == line && s.column > column {
+			break
+		}
+		at = s
+	}
+	return at
+}
+
+// quotePlainScalars double-quotes the plain scalars of lines whose meaning
+// would change by replacing the references in them, so the values can be
+// escaped. Plain scalars spanning multiple lines can't be quoted, so that is
+// an error.
+func quotePlainScalars(lines []string, scalars []*scalar, decls map[string]types.Variable, resolved map[string]interface{}) report.Report {
+	r := report.Report{}
+	// going backwards keeps the columns of the scalars that are still to
+	// be quoted valid
+	for i := len(scalars) - 1; i >= 0; i-- {
+		s := scalars[i]
+		if s.style != 0 || !variableRef.MatchString(s.value) {
+			continue
+		}
+		content, _ := astyaml.SplitComment(lines[s.line])
+		if m := variableRef.FindStringIndex(s.value); m[0] == 0 && m[1] == len(s.value) && isWholeValue(content, s.column, s.column+m[1]) {
+			continue
+		}
+		text := variableRef.ReplaceAllStringFunc(s.value, func(ref string) string {
+			if strings.HasPrefix(ref, "$$") {
+				return ref[1:]
+			}
+			// errors are reported when the references are replaced
+			text, err := formatVariable(variableRef.FindStringSubmatch(ref)[1], decls, resolved, false)
+			if err != nil {
+				return ref
+			}
+			return text
+		})
+		if isPlainScalar(text) {
+			continue
+		}
+		if !strings.HasPrefix(lines[s.line][s.column:], s.value) {
+			r.Add(report.Entry{
+				Kind:    report.EntryError,
+				Message: "variables in plain scalars spanning multiple lines must not contain special characters, quote the scalar",
+				Line:    s.line + 1,
+				Column:  s.column + 1,
+			})
+			continue
+		}
+		quoted := doubleQuote(s.value)
+		lines[s.line] = lines[s.line][:s.column] + quoted + lines[s.line][s.column+len(s.value):]
+		s.style = '"'
+		for _, next := range scalars[i+1:] {
+			if next.line == s.line {
+				next.column += len(quoted) - len(s.value)
+			}
+		}
+	}
+	return r
+}
+
+// isPlainScalar returns whether text means the same written as a plain
+// scalar. Numbers and bools do, since they would be written the same way.
+func isPlainScalar(text string) bool {
+	var v interface{}
+	if err := yaml.Unmarshal([]byte(text), &v); err != nil {
+		return false
+	}
+	switch v := v.(type) {
+	case string:
+		return v == text
+	case []interface{}, map[interface{}]interface{}:
+		return false
+	}
+	return true
+}
+
+// escapeVariable escapes the text of a variable for the style of the scalar
+// it replaces a reference in.
+func escapeVariable(text string, s *scalar) string {
+	if s == nil {
+		return text
+	}
+	switch s.style {
+	case '"':
+		quoted := doubleQuote(text)
+		return quoted[1 : len(quoted)-1]
+	case '\'':
+		return strings.Replace(text, "'", "''", -1)
+	}
+	return text
+}
+
+// doubleQuote returns s as a double-quoted scalar, which can use the escapes
+// of JSON.
+func doubleQuote(s string) string {
+	var out bytes.Buffer
+	encoder := json.NewEncoder(&out)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(s)
+	return strings.TrimSuffix(out.String(), "\n")
+}
+
+// isWholeValue returns whether line[start:end] is a whole value of a mapping
+// or sequence rather than part of a string.
+func isWholeValue(line string, start, end int) bool {
+	after := strings.TrimSpace(line[end:])
+	if after != "" && !strings.ContainsAny(after[:1], ",]}") {
+		return false
+	}
+	before := strings.TrimRight(line[:start], " \t")
+	if before == "" {
+		return false
+	}
+	switch before[len(before)-1] {
+	case '[', ',':
+		return true
+	case ':', '-':
+		// the indicators need to be followed by whitespace
+		return len(before) < start
+	}
+	return false
+}
+
+func isVariableType(typ string) bool {
+	for _, t := range types.VariableTypes {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys(m map[string]types.Variable) []string {
+	var keys []string
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,361 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/coreos/container-linux-config-transpiler/config"
+	"github.com/coreos/container-linux-config-transpiler/config/astyaml"
+	"github.com/coreos/container-linux-config-transpiler/config/localfs"
+	"github.com/coreos/container-linux-config-transpiler/config/platform"
+	"github.com/coreos/container-linux-config-transpiler/config/policy"
+	"github.com/coreos/container-linux-config-transpiler/config/reportfmt"
+	"github.com/coreos/container-linux-config-transpiler/config/types"
+	"github.com/coreos/ignition/config/validate/report"
+)
+
+// buildMain implements `ct build`, which transpiles a base config with
+// overlays applied to it, or every config in a directory tree.
+func buildMain(args []string) {
+	flags := struct {
+		help         bool
+		pretty       bool
+		outFile      string
+		inDir        string
+		outDir       string
+		jobs         int
+		force        bool
+		strict       bool
+		platform     string
+		dynamicData  bool
+		filesDir     string
+		ignition     string
+		reportFormat string
+		overlays     stringList
+		vars         stringList
+		varFiles     stringList
+		policies     stringList
+	}{}
+
+	fs := flag.NewFlagSet("build", flag.ExitOnError)
+	fs.Usage = func() {
+		stderr("Usage: ct build [options] BASE")
+		stderr("       ct build [options] --in-dir DIR --out-dir DIR")
+		fs.PrintDefaults()
+	}
+	fs.BoolVar(&flags.help, "help", false, "Print help and exit.")
+	fs.BoolVar(&flags.pretty, "pretty", false, "Indent the resulting Ignition config.")
+	fs.StringVar(&flags.outFile, "out-file", "", "Path to the resulting Ignition config. Standard output unless specified otherwise.")
+	fs.StringVar(&flags.inDir, "in-dir", "", "Directory to transpile every .yaml and .yml file in, recursively.")
+	fs.StringVar(&flags.outDir, "out-dir", "", "Directory to write the Ignition configs of --in-dir to, mirroring its tree.")
+	fs.IntVar(&flags.jobs, "jobs", runtime.NumCPU(), "Number of configs of --in-dir to transpile at the same time.")
+	fs.BoolVar(&flags.force, "force", false, "Transpile every config of --in-dir, even if its inputs didn't change.")
+	fs.BoolVar(&flags.strict, "strict", false, "Fail if any warnings are encountered.")
+	fs.StringVar(&flags.platform, "platform", "", fmt.Sprintf("Platform to target. Accepted values: %v.", platform.Platforms))
+	fs.BoolVar(&flags.dynamicData, "dynamic-data-in-contents", false, "Replace dynamic data in the contents of units and inline files too, not only in the etcd and flannel sections.")
+	fs.StringVar(&flags.filesDir, "files-dir", "", "Directory to read local files from.")
+	fs.StringVar(&flags.ignition, "ignition-version", "", fmt.Sprintf("Ignition spec version to generate. Accepted values: %v. Defaults to %s.", types.IgnitionVersions, types.DefaultIgnitionVersion))
+	fs.StringVar(&flags.reportFormat, "report-format", reportfmt.FormatHuman, fmt.Sprintf("Format of the warnings and errors written to standard error. Accepted values: %v.", reportfmt.Formats))
+	fs.Var(&flags.overlays, "o", "Path to an overlay to apply to the base config. Can be given multiple times, overlays are applied in order.")
+	fs.Var(&flags.overlays, "overlay", "Same as -o.")
+	fs.Var(&flags.vars, "var", "Set a variable declared in the config, as NAME=VALUE. Can be given multiple times.")
+	fs.Var(&flags.varFiles, "var-file", "Path to a YAML file mapping variable names to values. Can be given multiple times, --var takes precedence.")
+	fs.Var(&flags.policies, "policy", "Path to a file of policies the configs must meet. Can be given multiple times.")
+
+	args = parseInterspersed(fs, args)
+
+	if flags.help {
+		fs.Usage()
+		return
+	}
+	batch := flags.inDir != "" || flags.outDir != ""
+	if (batch && (len(args) != 0 || flags.inDir == "" || flags.outDir == "" || flags.outFile != "")) || (!batch && len(args) != 1) {
+		fs.Usage()
+		os.Exit(1)
+	}
+	if !reportfmt.IsSupportedFormat(flags.reportFormat) {
+		stderr("Unknown report format %q. Accepted values: %v.", flags.reportFormat, reportfmt.Formats)
+		os.Exit(1)
+	}
+	if batch && flags.reportFormat != reportfmt.FormatHuman {
+		stderr("--in-dir only supports the %s report format", reportfmt.FormatHuman)
+		os.Exit(1)
+	}
+
+	b := &builder{
+		strict: flags.strict,
+		pretty: flags.pretty,
+		options: types.ConvertOptions{
+			Platform:              flags.platform,
+			DynamicDataInContents: flags.dynamicData,
+			FilesDir:              flags.filesDir,
+			IgnitionVersion:       flags.ignition,
+		},
+		overlays:  flags.overlays,
+		varFiles:  flags.varFiles,
+		variables: loadVariables(nil, flags.vars),
+		policies:  flags.policies,
+	}
+
+	if batch {
+		if !buildDir(b, flags.inDir, flags.outDir, flags.jobs, flags.force) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	res := b.build(args[0])
+	for _, r := range res.reports {
+		writeReport(flags.reportFormat, r.file())
+	}
+	if res.failure != "" {
+		if flags.reportFormat == reportfmt.FormatHuman {
+			stderr("%s", res.failure)
+		}
+		os.Exit(1)
+	}
+	writeOutput(flags.outFile, res.output)
+}
+
+// builder transpiles configs, applying the same overlays and options to each
+// of them. It can be used concurrently.
+type builder struct {
+	strict   bool
+	pretty   bool
+	options  types.ConvertOptions
+	overlays []string
+	// varFiles are read by every build, so that changes to them are picked
+	// up like changes to the config. variables take precedence over them.
+	varFiles  []string
+	variables map[string]interface{}
+	policies  []string
+	// sourceMap is whether to generate the source map of the output
+	sourceMap bool
+}
+
+// buildResult is the result of transpiling a config.
+type buildResult struct {
+	// output is the Ignition config, nil if the build failed
+	output []byte
+	// sourceMap is the source map of the output, if the builder generates
+	// one
+	sourceMap []byte
+	// failure describes why the build failed, if it did
+	failure string
+	// reports are the reports about the config and the overlays. The first
+	// one is about the config and present unless it couldn't be read, the
+	// others are only present if they have entries.
+	reports []fileReport
+	// inputs are the files the build read, with the SHA-256 of their
+	// contents
+	inputs map[string]string
+	// missing are the files the build failed to read
+	missing map[string]bool
+}
+
+// fileReport is a report about one of the files of a build.
+type fileReport struct {
+	r     report.Report
+	paths *astyaml.ReportPaths
+	data  []byte
+	path  string
+}
+
+func (r fileReport) file() reportfmt.File {
+	return reportfmt.File{Name: r.path, Source: r.data, Report: r.r, Paths: r.paths}
+}
+
+// build transpiles the config at path. It doesn't exit on failure but
+// describes it in the result, since it runs in the workers of buildDir and
+// the loop of watch.
+func (b *builder) build(path string) buildResult {
+	res := buildResult{inputs: map[string]string{}, missing: map[string]bool{}}
+	data, err := res.read(path)
+	if err != nil {
+		res.failure = fmt.Sprintf("Failed to read: %v", err)
+		return res
+	}
+	for _, include := range config.Includes(data, path) {
+		res.read(include)
+	}
+	var policies []policy.Policy
+	for _, policyPath := range b.policies {
+		policyData, err := res.read(policyPath)
+		if err != nil {
+			res.failure = fmt.Sprintf("Failed to read policies: %v", err)
+			return res
+		}
+		p, err := policy.Parse(policyData)
+		if err != nil {
+			res.failure = fmt.Sprintf("Failed to parse policies in %s: %v", policyPath, err)
+			return res
+		}
+		policies = append(policies, p...)
+	}
+
+	variables := b.variables
+	if len(b.varFiles) > 0 {
+		variables = map[string]interface{}{}
+		for _, varFile := range b.varFiles {
+			varData, err := res.read(varFile)
+			if err != nil {
+				res.failure = fmt.Sprintf("Failed to read variables: %v", err)
+				return res
+			}
+			fileVars, err := parseVariableFile(varData)
+			if err != nil {
+				res.failure = fmt.Sprintf("Failed to parse variables in %s: %v", varFile, err)
+				return res
+			}
+			for name, value := range fileVars {
+				variables[name] = value
+			}
+		}
+		for name, value := range b.variables {
+			variables[name] = value
+		}
+	}
+
+	cfg, ast, r := config.ParseWithOptions(data, config.ParseOptions{
+		Strict:    b.strict,
+		Path:      path,
+		Variables: variables,
+	})
+	res.reports = []fileReport{{r: r, data: data, path: path}}
+	if b.failed(r) {
+		res.failure = "Failed to parse config"
+		return res
+	}
+
+	for _, overlay := range b.overlays {
+		overlayData, err := res.read(overlay)
+		if err != nil {
+			res.failure = fmt.Sprintf("Failed to read overlay: %v", err)
+			return res
+		}
+		cfg, ast, r = config.Overlay(cfg, ast, overlayData)
+		if len(r.Entries) > 0 {
+			res.reports = append(res.reports, fileReport{r: r, data: overlayData, path: overlay})
+		}
+		if b.failed(r) {
+			res.failure = fmt.Sprintf("Failed to apply overlay %s", overlay)
+			return res
+		}
+	}
+
+	options := b.options
+	res.reports[0].paths = &astyaml.ReportPaths{}
+	options.ReportPaths = res.reports[0].paths
+	if options.FilesDir != "" {
+		options.Files = recordingFS{dir: options.FilesDir, res: &res}
+	}
+	if len(policies) > 0 || b.sourceMap {
+		options.SourceMap = &types.SourceMap{}
+	}
+	ignCfg, r := config.Convert(cfg, options, ast)
+	res.reports[0].r.Merge(r)
+	// the entries of the policies come after the conversion's, in the order
+	// their paths were recorded
+	if !r.IsFatal() && len(policies) > 0 {
+		res.reports[0].r.Merge(policy.Check(policies, policy.Input{
+			Config:    cfg,
+			AST:       ast,
+			Ignition:  ignCfg,
+			SourceMap: *options.SourceMap,
+			Paths:     options.ReportPaths,
+		}))
+	}
+	if b.failed(res.reports[0].r) {
+		res.failure = "Failed to transpile config"
+		return res
+	}
+	output, err := marshalConfig(ignCfg, b.pretty)
+	if err != nil {
+		res.failure = fmt.Sprintf("Failed to marshal output: %v", err)
+		return res
+	}
+	if b.sourceMap {
+		sourceMap, err := marshalJSON(options.SourceMap, b.pretty)
+		if err != nil {
+			res.failure = fmt.Sprintf("Failed to marshal source map: %v", err)
+			return res
+		}
+		res.sourceMap = sourceMap
+	}
+	res.output = output
+	return res
+}
+
+func (b *builder) failed(r report.Report) bool {
+	return r.IsFatal() || (b.strict && len(r.Entries) > 0)
+}
+
+// read reads a file, recording it as an input, or as missing if it can't be
+// read.
+func (res *buildResult) read(path string) ([]byte, error) {
+	data, err := ioutil.ReadFile(path)
+	res.record(path, data, err)
+	return data, err
+}
+
+func (res *buildResult) record(path string, data []byte, err error) {
+	if err != nil {
+		res.missing[path] = true
+	} else {
+		res.inputs[path] = hashContents(data)
+	}
+}
+
+// recordingFS reads local files from a directory and records them as inputs.
+type recordingFS struct {
+	dir string
+	res *buildResult
+}
+
+func (f recordingFS) ReadFile(name string) ([]byte, error) {
+	data, err := localfs.Dir(f.dir).ReadFile(name)
+	if c, cleanErr := localfs.Clean(name); cleanErr == nil {
+		f.res.record(filepath.Join(f.dir, filepath.FromSlash(c)), data, err)
+	}
+	return data, err
+}
+
+func hashContents(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// parseInterspersed parses args like fs.Parse, but also accepts flags after
+// the first positional argument, as in `ct build base.yaml -o overlay.yaml`.
+// It returns the positional arguments.
+func parseInterspersed(fs *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		fs.Parse(args)
+		if fs.NArg() == 0 {
+			return positional
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
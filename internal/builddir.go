@@ -0,0 +1,228 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/coreos/container-linux-config-transpiler/config/localfs"
+	"github.com/coreos/container-linux-config-transpiler/config/reportfmt"
+)
+
+// manifestName is the file in the output directory that records the inputs
+// of every config that was built, to skip configs whose inputs didn't change.
+const manifestName = ".ct-build.json"
+
+// manifestEntry records how a config was built.
+type manifestEntry struct {
+	// Options identifies the options the config was built with
+	Options string `json:"options"`
+	// Inputs are the SHA-256 of the files the build read, by path
+	Inputs map[string]string `json:"inputs"`
+}
+
+// dirJob is a config of the input directory.
+type dirJob struct {
+	// rel is the path of the config relative to the input directory
+	rel     string
+	in, out string
+	// upToDate is set if the config was skipped
+	upToDate bool
+	res      buildResult
+}
+
+// buildDir transpiles every config in inDir to the same path in outDir, with
+// the .ign extension. Configs are transpiled by jobs goroutines at a time,
+// and skipped if they and the files they read didn't change since they were
+// last transpiled, unless force is set. It writes a report of every config to
+// standard output and returns whether all of them were transpiled.
+func buildDir(b *builder, inDir, outDir string, jobs int, force bool) bool {
+	var queue []*dirJob
+	absOut := localfs.Abs(outDir)
+	err := filepath.Walk(inDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if localfs.Abs(path) == absOut {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		ext := filepath.Ext(path)
+		if ext != ".yaml" && ext != ".yml" {
+			return nil
+		}
+		rel, err := filepath.Rel(inDir, path)
+		if err != nil {
+			return err
+		}
+		queue = append(queue, &dirJob{
+			rel: rel,
+			in:  path,
+			out: filepath.Join(outDir, strings.TrimSuffix(rel, ext)+".ign"),
+		})
+		return nil
+	})
+	if err != nil {
+		stderr("Failed to read input directory: %v", err)
+		return false
+	}
+
+	manifestPath := filepath.Join(outDir, manifestName)
+	manifest := map[string]manifestEntry{}
+	if data, err := ioutil.ReadFile(manifestPath); err == nil {
+		// a broken manifest only means everything is rebuilt
+		json.Unmarshal(data, &manifest)
+	}
+	options := b.key()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	jobQueue := make(chan *dirJob)
+	if jobs < 1 {
+		jobs = 1
+	}
+	for i := 0; i < jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobQueue {
+				mu.Lock()
+				entry, ok := manifest[job.rel]
+				mu.Unlock()
+				if !force && ok && entry.Options == options && isUpToDate(entry, job.out) {
+					job.upToDate = true
+					continue
+				}
+
+				job.res = b.build(job.in)
+				if job.res.failure == "" {
+					if err := writeFile(job.out, job.res.output); err != nil {
+						job.res.failure = fmt.Sprintf("Failed to write: %v", err)
+					}
+				}
+				mu.Lock()
+				if job.res.failure == "" {
+					manifest[job.rel] = manifestEntry{Options: options, Inputs: job.res.inputs}
+				} else {
+					delete(manifest, job.rel)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, job := range queue {
+		jobQueue <- job
+	}
+	close(jobQueue)
+	wg.Wait()
+
+	// forget configs that were removed
+	current := map[string]bool{}
+	for _, job := range queue {
+		current[job.rel] = true
+	}
+	for rel := range manifest {
+		if !current[rel] {
+			delete(manifest, rel)
+		}
+	}
+
+	if data, err := json.MarshalIndent(manifest, "", "  "); err == nil {
+		if err := writeFile(manifestPath, append(data, '\n')); err != nil {
+			stderr("Failed to write %s: %v", manifestPath, err)
+		}
+	}
+
+	built, upToDate, failed := 0, 0, 0
+	for _, job := range queue {
+		switch {
+		case job.upToDate:
+			upToDate++
+			fmt.Printf("up to date  %s\n", job.in)
+			continue
+		case job.res.failure != "":
+			failed++
+			fmt.Printf("FAIL        %s\n", job.in)
+		default:
+			built++
+			fmt.Printf("ok          %s -> %s\n", job.in, job.out)
+		}
+		for _, r := range job.res.reports {
+			if len(r.r.Entries) > 0 {
+				reportfmt.Write(os.Stdout, reportfmt.FormatHuman, r.file())
+			}
+		}
+		if job.res.failure != "" {
+			fmt.Println(job.res.failure)
+		}
+	}
+	fmt.Printf("%d configs: %d transpiled, %d up to date, %d failed\n", len(queue), built, upToDate, failed)
+	return failed == 0
+}
+
+// key identifies the options of a builder, so that configs are rebuilt when
+// they change. The contents of the variable files are inputs of the builds
+// instead. Variables can hold any YAML value, including mappings that
+// JSON can't encode, so the key is a hash of their Go syntax, which fmt
+// prints with sorted map keys.
+func (b *builder) key() string {
+	options := struct {
+		Strict                bool
+		Pretty                bool
+		Platform              string
+		DynamicDataInContents bool
+		FilesDir              string
+		IgnitionVersion       string
+		Overlays              []string
+		VarFiles              []string
+		Variables             map[string]interface{}
+		Policies              []string
+	}{b.strict, b.pretty, b.options.Platform, b.options.DynamicDataInContents, b.options.FilesDir, b.options.IgnitionVersion, b.overlays, b.varFiles, b.variables, b.policies}
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%#v", options)))
+	return hex.EncodeToString(sum[:])
+}
+
+// isUpToDate returns whether the output of a build exists and none of its
+// inputs changed.
+func isUpToDate(entry manifestEntry, out string) bool {
+	if _, err := os.Stat(out); err != nil {
+		return false
+	}
+	for path, sum := range entry.Inputs {
+		data, err := ioutil.ReadFile(path)
+		if err != nil || hashContents(data) != sum {
+			return false
+		}
+	}
+	return true
+}
+
+// writeFile writes a file, creating its directory if needed.
+func writeFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
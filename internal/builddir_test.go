@@ -0,0 +1,96 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/coreos/container-linux-config-transpiler/config/types"
+)
+
+func TestBuilderKey(t *testing.T) {
+	// mappings from --var-file can't be encoded as JSON
+	nested := func(port int) *builder {
+		return &builder{
+			options: types.ConvertOptions{Platform: "ec2"},
+			variables: map[string]interface{}{
+				"app": map[interface{}]interface{}{"name": "web", "port": port},
+			},
+		}
+	}
+	if nested(80).key() != nested(80).key() {
+		t.Errorf("the key of the same options changed")
+	}
+	if nested(80).key() == nested(8080).key() {
+		t.Errorf("changing a nested variable didn't change the key")
+	}
+	if nested(80).key() == (&builder{options: types.ConvertOptions{Platform: "ec2"}}).key() {
+		t.Errorf("the key doesn't depend on the variables")
+	}
+}
+
+func TestBuildDirFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ct-build")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	inDir := filepath.Join(dir, "in")
+	outDir := filepath.Join(dir, "out")
+	if err := os.MkdirAll(inDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	configs := map[string]string{
+		"good.yaml": "passwd:\n  users:\n    - name: core\n",
+		"bad.yaml":  "passwd:\n  users:\n    - name: [\n",
+	}
+	for name, data := range configs {
+		if err := ioutil.WriteFile(filepath.Join(inDir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a failing config is reported by its worker while the others are
+	// still transpiled
+	if buildDir(&builder{}, inDir, outDir, 2, false) {
+		t.Errorf("the failing config wasn't reported")
+	}
+	if _, err := os.Stat(filepath.Join(outDir, "good.ign")); err != nil {
+		t.Errorf("the good config wasn't transpiled: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(outDir, "bad.ign")); err == nil {
+		t.Errorf("the failing config was written")
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(outDir, manifestName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest := map[string]manifestEntry{}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := manifest["good.yaml"]; !ok {
+		t.Errorf("the good config isn't in the manifest")
+	}
+	if _, ok := manifest["bad.yaml"]; ok {
+		t.Errorf("the failing config is in the manifest")
+	}
+}
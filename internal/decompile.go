@@ -0,0 +1,64 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/coreos/container-linux-config-transpiler/config"
+	"github.com/coreos/container-linux-config-transpiler/config/decompile"
+)
+
+// decompileMain implements `ct decompile`, which turns an Ignition config
+// into an equivalent Container Linux Config.
+func decompileMain(args []string) {
+	flags := struct {
+		help    bool
+		inFile  string
+		outFile string
+		strict  bool
+	}{}
+
+	fs := flag.NewFlagSet("decompile", flag.ExitOnError)
+	fs.BoolVar(&flags.help, "help", false, "Print help and exit.")
+	fs.StringVar(&flags.inFile, "in-file", "", "Path to the Ignition config. Standard input unless specified otherwise.")
+	fs.StringVar(&flags.outFile, "out-file", "", "Path to the resulting container linux config. Standard output unless specified otherwise.")
+	fs.BoolVar(&flags.strict, "strict", false, "Fail if any warnings are encountered.")
+
+	fs.Parse(args)
+
+	if flags.help {
+		fs.Usage()
+		return
+	}
+
+	cfg, report := config.Decompile(readInput(flags.inFile))
+	if len(report.Entries) > 0 {
+		stderr("%s", report.String())
+	}
+	if report.IsFatal() || (flags.strict && len(report.Entries) > 0) {
+		stderr("Failed to decompile config")
+		os.Exit(1)
+	}
+
+	dataOut, err := decompile.Marshal(cfg)
+	if err != nil {
+		stderr("Failed to marshal output: %v", err)
+		os.Exit(1)
+	}
+
+	writeOutput(flags.outFile, dataOut)
+}
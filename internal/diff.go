@@ -0,0 +1,171 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/coreos/container-linux-config-transpiler/config"
+	"github.com/coreos/container-linux-config-transpiler/config/astyaml"
+	"github.com/coreos/container-linux-config-transpiler/config/diff"
+	"github.com/coreos/container-linux-config-transpiler/config/reportfmt"
+	"github.com/coreos/container-linux-config-transpiler/config/types"
+	ignTypes "github.com/coreos/ignition/config/v2_3/types"
+)
+
+// Exit codes of `ct diff`, following diff(1).
+const (
+	diffExitSame    = 0
+	diffExitChanged = 1
+	diffExitError   = 2
+)
+
+// diffMain implements `ct diff`, which compares two configs resource by
+// resource. Each side is either a container linux config, which is
+// transpiled first, or an Ignition config. Both are brought into the form of
+// the same Ignition spec version before they are compared.
+func diffMain(args []string) {
+	flags := struct {
+		help        bool
+		strict      bool
+		platform    string
+		dynamicData bool
+		filesDir    string
+		ignition    string
+		vars        stringList
+		varFiles    stringList
+	}{}
+
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	fs.Usage = func() {
+		stderr("Usage: ct diff [options] OLD NEW")
+		fs.PrintDefaults()
+	}
+	fs.BoolVar(&flags.help, "help", false, "Print help and exit.")
+	fs.BoolVar(&flags.strict, "strict", false, "Fail if any warnings are encountered.")
+	fs.StringVar(&flags.platform, "platform", "", "Platform to target when transpiling container linux configs.")
+	fs.BoolVar(&flags.dynamicData, "dynamic-data-in-contents", false, "Replace dynamic data in the contents of units and inline files too, not only in the etcd and flannel sections.")
+	fs.StringVar(&flags.filesDir, "files-dir", "", "Directory to read local files from.")
+	fs.StringVar(&flags.ignition, "ignition-version", "", fmt.Sprintf("Ignition spec version to compare the configs in. Accepted values: %v. Defaults to %s.", types.IgnitionVersions, types.DefaultIgnitionVersion))
+	fs.Var(&flags.vars, "var", "Set a variable declared in the container linux configs, as NAME=VALUE. Can be given multiple times.")
+	fs.Var(&flags.varFiles, "var-file", "Path to a YAML file mapping variable names to values. Can be given multiple times, --var takes precedence.")
+
+	fs.Parse(args)
+
+	if flags.help {
+		fs.Usage()
+		return
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(diffExitError)
+	}
+
+	if _, err := types.ParseIgnitionVersion(flags.ignition); err != nil {
+		stderr("Unknown Ignition spec version %q. Accepted values: %v.", flags.ignition, types.IgnitionVersions)
+		os.Exit(diffExitError)
+	}
+	options := types.ConvertOptions{
+		Platform:              flags.platform,
+		DynamicDataInContents: flags.dynamicData,
+		FilesDir:              flags.filesDir,
+		IgnitionVersion:       flags.ignition,
+	}
+	variables := loadVariables(flags.varFiles, flags.vars)
+	old := loadIgnition(fs.Arg(0), options, variables, flags.strict)
+	new := loadIgnition(fs.Arg(1), options, variables, flags.strict)
+
+	changes := diff.Configs(old, new)
+	for _, c := range changes {
+		fmt.Println(c)
+	}
+	if len(changes) > 0 {
+		os.Exit(diffExitChanged)
+	}
+}
+
+// loadIgnition reads the config at path. Ignition configs are brought into
+// the form of the spec version of options, anything else is transpiled as a
+// container linux config. It exits on failure.
+func loadIgnition(path string, options types.ConvertOptions, variables map[string]interface{}, strict bool) ignTypes.Config {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		stderr("Failed to read: %v", err)
+		os.Exit(diffExitError)
+	}
+
+	if isIgnition(data) {
+		var cfg ignTypes.Config
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			stderr("%s: failed to parse Ignition config: %v", path, err)
+			os.Exit(diffExitError)
+		}
+		cfg, err := types.NormalizeConfig(cfg, options.IgnitionVersion)
+		if err != nil {
+			stderr("%s: %v", path, err)
+			os.Exit(diffExitError)
+		}
+		return cfg
+	}
+
+	cfg, ast, report := config.ParseWithOptions(data, config.ParseOptions{
+		Strict:    strict,
+		Path:      path,
+		Variables: variables,
+	})
+	if report.IsFatal() || (strict && len(report.Entries) > 0) {
+		writeDiffReport(reportfmt.File{Name: path, Source: data, Report: report})
+		stderr("Failed to parse config %s", path)
+		os.Exit(diffExitError)
+	}
+
+	options.ReportPaths = &astyaml.ReportPaths{}
+	ignCfg, convertReport := config.Convert(cfg, options, ast)
+	report.Merge(convertReport)
+	writeDiffReport(reportfmt.File{Name: path, Source: data, Report: report, Paths: options.ReportPaths})
+	if report.IsFatal() || (strict && len(report.Entries) > 0) {
+		stderr("Failed to transpile config %s", path)
+		os.Exit(diffExitError)
+	}
+	return ignCfg
+}
+
+// writeDiffReport writes the report about a config to standard error.
+func writeDiffReport(f reportfmt.File) {
+	if len(f.Report.Entries) == 0 {
+		return
+	}
+	stderr("%s:", f.Name)
+	if err := reportfmt.Write(os.Stderr, reportfmt.FormatHuman, f); err != nil {
+		stderr("Failed to write report: %v", err)
+		os.Exit(diffExitError)
+	}
+}
+
+// isIgnition returns whether data is an Ignition config rather than a
+// container linux config. Both may be JSON, but only Ignition configs have a
+// version.
+func isIgnition(data []byte) bool {
+	var cfg struct {
+		Ignition struct {
+			Version string `json:"version"`
+		} `json:"ignition"`
+	}
+	return json.Unmarshal(data, &cfg) == nil && cfg.Ignition.Version != ""
+}
@@ -0,0 +1,115 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/coreos/container-linux-config-transpiler/config/diff"
+	"github.com/coreos/container-linux-config-transpiler/config/format"
+)
+
+// fmtMain implements `ct fmt`, which rewrites configs in their canonical
+// form. Like gofmt, it reads standard input if no files are given and
+// otherwise prints the formatted files unless -l, -d or -w are set.
+func fmtMain(args []string) {
+	flags := struct {
+		help  bool
+		list  bool
+		diff  bool
+		write bool
+	}{}
+
+	fs := flag.NewFlagSet("fmt", flag.ExitOnError)
+	fs.Usage = func() {
+		stderr("Usage: ct fmt [options] [FILE...]")
+		fs.PrintDefaults()
+	}
+	fs.BoolVar(&flags.help, "help", false, "Print help and exit.")
+	fs.BoolVar(&flags.list, "l", false, "List files whose formatting differs from ct fmt's.")
+	fs.BoolVar(&flags.diff, "d", false, "Print diffs instead of the formatted files.")
+	fs.BoolVar(&flags.write, "w", false, "Write the result to the files instead of standard output.")
+
+	fs.Parse(args)
+
+	if flags.help {
+		fs.Usage()
+		return
+	}
+
+	if fs.NArg() == 0 {
+		if flags.write {
+			stderr("Can't use -w on standard input")
+			os.Exit(2)
+		}
+		if !fmtFile("<standard input>", readInput(""), flags.list, flags.diff, false) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	failed := false
+	for _, path := range fs.Args() {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			stderr("Failed to read: %v", err)
+			failed = true
+			continue
+		}
+		if !fmtFile(path, data, flags.list, flags.diff, flags.write) {
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// fmtFile formats a single config and handles the output flags. It returns
+// false if the config couldn't be formatted.
+func fmtFile(path string, data []byte, list, showDiff, write bool) bool {
+	out, err := format.Format(data)
+	if err != nil {
+		stderr("%s: %v", path, err)
+		return false
+	}
+
+	changed := !bytes.Equal(data, out)
+	if list && changed {
+		fmt.Println(path)
+	}
+	if showDiff && changed {
+		fmt.Print(diff.UnifiedDiff(path+".orig", path, string(data), string(out)))
+	}
+	if write && changed {
+		info, err := os.Stat(path)
+		if err != nil {
+			stderr("Failed to write: %v", err)
+			return false
+		}
+		if err := ioutil.WriteFile(path, out, info.Mode()); err != nil {
+			stderr("Failed to write: %v", err)
+			return false
+		}
+	}
+	if !list && !showDiff && !write {
+		os.Stdout.Write(out)
+	}
+	return true
+}
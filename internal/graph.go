@@ -0,0 +1,121 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/coreos/container-linux-config-transpiler/config"
+	"github.com/coreos/container-linux-config-transpiler/config/astyaml"
+	"github.com/coreos/container-linux-config-transpiler/config/platform"
+	"github.com/coreos/container-linux-config-transpiler/config/reportfmt"
+	"github.com/coreos/container-linux-config-transpiler/config/types"
+	"github.com/coreos/container-linux-config-transpiler/config/unitgraph"
+	ignTypes "github.com/coreos/ignition/config/v2_3/types"
+	"github.com/coreos/ignition/config/validate/report"
+)
+
+// graphMain implements `ct graph`, which checks the dependencies between the
+// systemd units of a config, including the units ct generates, and writes
+// them in the DOT format. The config is either a container linux config,
+// which is transpiled first, or an Ignition config.
+func graphMain(args []string) {
+	flags := struct {
+		help     bool
+		strict   bool
+		platform string
+		filesDir string
+		outFile  string
+		vars     stringList
+		varFiles stringList
+	}{}
+
+	fs := flag.NewFlagSet("graph", flag.ExitOnError)
+	fs.Usage = func() {
+		stderr("Usage: ct graph [options] [FILE]")
+		fs.PrintDefaults()
+	}
+	fs.BoolVar(&flags.help, "help", false, "Print help and exit.")
+	fs.BoolVar(&flags.strict, "strict", false, "Fail if any warnings are encountered.")
+	fs.StringVar(&flags.platform, "platform", "", fmt.Sprintf("Platform to target. Accepted values: %v.", platform.Platforms))
+	fs.StringVar(&flags.filesDir, "files-dir", "", "Directory to read local files from.")
+	fs.StringVar(&flags.outFile, "out-file", "", "Path to write the graph to. Standard output unless specified otherwise.")
+	fs.Var(&flags.vars, "var", "Set a variable declared in the config, as NAME=VALUE. Can be given multiple times.")
+	fs.Var(&flags.varFiles, "var-file", "Path to a YAML file mapping variable names to values. Can be given multiple times, --var takes precedence.")
+
+	fs.Parse(args)
+
+	if flags.help {
+		fs.Usage()
+		return
+	}
+	if fs.NArg() > 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	path := fs.Arg(0)
+	data := readInput(path)
+	var ignCfg ignTypes.Config
+	var r report.Report
+	paths := &astyaml.ReportPaths{}
+	if isIgnition(data) {
+		if err := json.Unmarshal(data, &ignCfg); err != nil {
+			stderr("Failed to parse Ignition config: %v", err)
+			os.Exit(1)
+		}
+		r = config.CheckUnitGraph(ignCfg, types.SourceMap{}, nil)
+	} else {
+		cfg, ast, parseReport := config.ParseWithOptions(data, config.ParseOptions{
+			Strict:    flags.strict,
+			Path:      path,
+			Variables: loadVariables(flags.varFiles, flags.vars),
+		})
+		r = parseReport
+		if !r.IsFatal() {
+			var convertReport report.Report
+			ignCfg, convertReport = config.Convert(cfg, types.ConvertOptions{
+				Platform:    flags.platform,
+				FilesDir:    flags.filesDir,
+				ReportPaths: paths,
+			}, ast)
+			// converting checks the units
+			r.Merge(convertReport)
+		}
+	}
+	writeReport(reportfmt.FormatHuman, reportfmt.File{Name: path, Source: data, Report: r, Paths: paths})
+	if r.IsFatal() || (flags.strict && len(r.Entries) > 0) {
+		stderr("Failed to check config")
+		os.Exit(1)
+	}
+
+	out := os.Stdout
+	if flags.outFile != "" {
+		var err error
+		out, err = os.Create(flags.outFile)
+		if err != nil {
+			stderr("Failed to open: %v", err)
+			os.Exit(1)
+		}
+		defer out.Close()
+	}
+	if err := unitgraph.Build(ignCfg).WriteDOT(out); err != nil {
+		stderr("Failed to write graph: %v", err)
+		os.Exit(1)
+	}
+}
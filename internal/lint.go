@@ -0,0 +1,127 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/coreos/container-linux-config-transpiler/config"
+	"github.com/coreos/container-linux-config-transpiler/config/astyaml"
+	"github.com/coreos/container-linux-config-transpiler/config/lint"
+	"github.com/coreos/container-linux-config-transpiler/config/reportfmt"
+)
+
+// lintMain implements `ct lint`, which checks configs against the lint rules
+// on top of the usual validation. The rules are configured by the lint config
+// given with --config, or .ctlint.yaml in the working directory if it exists.
+func lintMain(args []string) {
+	flags := struct {
+		help         bool
+		listRules    bool
+		strict       bool
+		config       string
+		reportFormat string
+		vars         stringList
+		varFiles     stringList
+	}{}
+
+	fs := flag.NewFlagSet("lint", flag.ExitOnError)
+	fs.Usage = func() {
+		stderr("Usage: ct lint [options] [FILE...]")
+		fs.PrintDefaults()
+	}
+	fs.BoolVar(&flags.help, "help", false, "Print help and exit.")
+	fs.BoolVar(&flags.listRules, "list-rules", false, "Print the lint rules and exit.")
+	fs.BoolVar(&flags.strict, "strict", false, "Fail if any warnings are encountered.")
+	fs.StringVar(&flags.config, "config", "", fmt.Sprintf("Path to the lint config. Defaults to %s if it exists.", lint.DefaultConfigName))
+	fs.StringVar(&flags.reportFormat, "report-format", reportfmt.FormatHuman, fmt.Sprintf("Format of the findings written to standard output. Accepted values: %v.", reportfmt.Formats))
+	fs.Var(&flags.vars, "var", "Set a variable declared in the configs, as NAME=VALUE. Can be given multiple times.")
+	fs.Var(&flags.varFiles, "var-file", "Path to a YAML file mapping variable names to values. Can be given multiple times, --var takes precedence.")
+
+	fs.Parse(args)
+
+	if flags.help {
+		fs.Usage()
+		return
+	}
+	if flags.listRules {
+		for _, rule := range lint.Rules {
+			fmt.Printf("%s (%s)\n  %s\n  %s\n", rule.ID, rule.Severity, rule.Description, rule.Doc())
+		}
+		return
+	}
+	if !reportfmt.IsSupportedFormat(flags.reportFormat) {
+		stderr("Unknown report format %q. Accepted values: %v.", flags.reportFormat, reportfmt.Formats)
+		os.Exit(1)
+	}
+
+	lintConfig := loadLintConfig(flags.config)
+	variables := loadVariables(flags.varFiles, flags.vars)
+
+	paths := fs.Args()
+	if len(paths) == 0 {
+		paths = []string{""}
+	}
+	failed := false
+	var files []reportfmt.File
+	for _, path := range paths {
+		data := readInput(path)
+		cfg, ast, r := config.ParseWithOptions(data, config.ParseOptions{
+			Strict:    flags.strict,
+			Path:      path,
+			Variables: variables,
+		})
+		reportPaths := &astyaml.ReportPaths{}
+		if !r.IsFatal() {
+			r.Merge(lint.Lint(cfg, ast, lintConfig, reportPaths))
+		}
+		files = append(files, reportfmt.File{Name: path, Source: data, Report: r, Paths: reportPaths})
+		if r.IsFatal() || (flags.strict && len(r.Entries) > 0) {
+			failed = true
+		}
+	}
+	if err := reportfmt.WriteFiles(os.Stdout, flags.reportFormat, files); err != nil {
+		stderr("Failed to write report: %v", err)
+		os.Exit(1)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// loadLintConfig reads the lint config at path, or the default one if path is
+// empty. It exits on failure.
+func loadLintConfig(path string) lint.Config {
+	explicit := path != ""
+	if !explicit {
+		path = lint.DefaultConfigName
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) && !explicit {
+		return lint.Config{}
+	} else if err != nil {
+		stderr("Failed to read lint config: %v", err)
+		os.Exit(1)
+	}
+	c, err := lint.ParseConfig(data)
+	if err != nil {
+		stderr("Failed to parse lint config %s: %v", path, err)
+		os.Exit(1)
+	}
+	return c
+}
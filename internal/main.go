@@ -22,9 +22,15 @@ import (
 	"os"
 	"strings"
 
+	yaml "github.com/ajeddeloh/yaml"
 	"github.com/coreos/container-linux-config-transpiler/config"
+	"github.com/coreos/container-linux-config-transpiler/config/astyaml"
 	"github.com/coreos/container-linux-config-transpiler/config/platform"
+	"github.com/coreos/container-linux-config-transpiler/config/policy"
+	"github.com/coreos/container-linux-config-transpiler/config/reportfmt"
+	"github.com/coreos/container-linux-config-transpiler/config/types"
 	"github.com/coreos/container-linux-config-transpiler/internal/version"
+	ignTypes "github.com/coreos/ignition/config/v2_3/types"
 )
 
 func stderr(f string, a ...interface{}) {
@@ -33,15 +39,49 @@ func stderr(f string, a ...interface{}) {
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "build":
+			buildMain(os.Args[2:])
+			return
+		case "decompile":
+			decompileMain(os.Args[2:])
+			return
+		case "diff":
+			diffMain(os.Args[2:])
+			return
+		case "fmt":
+			fmtMain(os.Args[2:])
+			return
+		case "graph":
+			graphMain(os.Args[2:])
+			return
+		case "lint":
+			lintMain(os.Args[2:])
+			return
+		case "serve":
+			serveMain(os.Args[2:])
+			return
+		}
+	}
+
 	flags := struct {
-		help     bool
-		pretty   bool
-		version  bool
-		inFile   string
-		outFile  string
-		strict   bool
-		platform string
-		filesDir string
+		help         bool
+		pretty       bool
+		version      bool
+		inFile       string
+		outFile      string
+		strict       bool
+		platform     string
+		dynamicData  bool
+		filesDir     string
+		ignition     string
+		sourceMap    string
+		reportFormat string
+		vars         stringList
+		varFiles     stringList
+		policies     stringList
+		watch        bool
 	}{}
 
 	flag.BoolVar(&flags.help, "help", false, "Print help and exit.")
@@ -51,7 +91,15 @@ func main() {
 	flag.StringVar(&flags.outFile, "out-file", "", "Path to the resulting Ignition config. Standard output unless specified otherwise.")
 	flag.BoolVar(&flags.strict, "strict", false, "Fail if any warnings are encountered.")
 	flag.StringVar(&flags.platform, "platform", "", fmt.Sprintf("Platform to target. Accepted values: %v.", platform.Platforms))
+	flag.BoolVar(&flags.dynamicData, "dynamic-data-in-contents", false, "Replace dynamic data in the contents of units and inline files too, not only in the etcd and flannel sections.")
 	flag.StringVar(&flags.filesDir, "files-dir", "", "Directory to read local files from.")
+	flag.StringVar(&flags.ignition, "ignition-version", "", fmt.Sprintf("Ignition spec version to generate. Accepted values: %v. Defaults to %s.", types.IgnitionVersions, types.DefaultIgnitionVersion))
+	flag.StringVar(&flags.reportFormat, "report-format", reportfmt.FormatHuman, fmt.Sprintf("Format of the warnings and errors written to standard error. Accepted values: %v.", reportfmt.Formats))
+	flag.Var(&flags.vars, "var", "Set a variable declared in the config, as NAME=VALUE. Can be given multiple times.")
+	flag.Var(&flags.varFiles, "var-file", "Path to a YAML file mapping variable names to values. Can be given multiple times, --var takes precedence.")
+	flag.Var(&flags.policies, "policy", "Path to a file of policies the config must meet. Can be given multiple times.")
+	flag.BoolVar(&flags.watch, "watch", false, "Transpile the config again whenever it or a file it reads changes, keeping the last good output and source map if it fails. Requires --in-file and --out-file.")
+	flag.StringVar(&flags.sourceMap, "source-map", "", "Path to write a map from the elements of the resulting Ignition config to the lines of the container linux config they were generated from.")
 
 	flag.Parse()
 
@@ -65,67 +113,236 @@ func main() {
 		return
 	}
 
-	var inFile *os.File
-	var outFile *os.File
+	if !reportfmt.IsSupportedFormat(flags.reportFormat) {
+		stderr("Unknown report format %q. Accepted values: %v.", flags.reportFormat, reportfmt.Formats)
+		os.Exit(1)
+	}
+	human := flags.reportFormat == reportfmt.FormatHuman
 
-	if flags.inFile == "" {
-		inFile = os.Stdin
-	} else {
-		var err error
-		inFile, err = os.Open(flags.inFile)
-		if err != nil {
-			stderr("Failed to open: %v", err)
+	if flags.watch {
+		if flags.inFile == "" || flags.outFile == "" {
+			stderr("--watch requires --in-file and --out-file")
+			os.Exit(1)
+		}
+		if !human {
+			stderr("--watch only supports the %s report format", reportfmt.FormatHuman)
 			os.Exit(1)
 		}
+		watch(&builder{
+			strict: flags.strict,
+			pretty: flags.pretty,
+			options: types.ConvertOptions{
+				Platform:              flags.platform,
+				DynamicDataInContents: flags.dynamicData,
+				FilesDir:              flags.filesDir,
+				IgnitionVersion:       flags.ignition,
+			},
+			varFiles:  flags.varFiles,
+			variables: loadVariables(nil, flags.vars),
+			policies:  flags.policies,
+			sourceMap: flags.sourceMap != "",
+		}, flags.inFile, flags.outFile, flags.sourceMap)
+		return
 	}
 
-	dataIn, err := ioutil.ReadAll(inFile)
-	if err != nil {
-		stderr("Failed to read: %v", err)
+	policies := loadPolicies(flags.policies)
+	dataIn := readInput(flags.inFile)
+
+	cfg, ast, report := config.ParseWithOptions(dataIn, config.ParseOptions{
+		Strict:    flags.strict,
+		Path:      flags.inFile,
+		Variables: loadVariables(flags.varFiles, flags.vars),
+	})
+	if report.IsFatal() || (flags.strict && len(report.Entries) > 0) {
+		writeReport(flags.reportFormat, reportfmt.File{Name: flags.inFile, Source: dataIn, Report: report})
+		if human {
+			stderr("Failed to parse config")
+		}
 		os.Exit(1)
 	}
 
-	cfg, ast, report := config.Parse(dataIn)
-	if len(report.Entries) > 0 {
-		stderr(report.String())
+	paths := &astyaml.ReportPaths{}
+	options := types.ConvertOptions{
+		Platform:              flags.platform,
+		DynamicDataInContents: flags.dynamicData,
+		FilesDir:              flags.filesDir,
+		IgnitionVersion:       flags.ignition,
+		ReportPaths:           paths,
+	}
+	if flags.sourceMap != "" || len(policies) > 0 {
+		options.SourceMap = &types.SourceMap{}
 	}
+	ignCfg, convertReport := config.Convert(cfg, options, ast)
+	report.Merge(convertReport)
+	// policies record their paths after the conversion, merge them in that
+	// order
+	if !report.IsFatal() && len(policies) > 0 {
+		report.Merge(policy.Check(policies, policy.Input{
+			Config:    cfg,
+			AST:       ast,
+			Ignition:  ignCfg,
+			SourceMap: *options.SourceMap,
+			Paths:     paths,
+		}))
+	}
+	writeReport(flags.reportFormat, reportfmt.File{Name: flags.inFile, Source: dataIn, Report: report, Paths: paths})
 	if report.IsFatal() || (flags.strict && len(report.Entries) > 0) {
-		stderr("Failed to parse config")
 		os.Exit(1)
 	}
 
-	ignCfg, report := config.Convert(cfg, flags.platform, ast)
-	if len(report.Entries) > 0 {
-		stderr(report.String())
-		if report.IsFatal() || flags.strict {
+	if flags.sourceMap != "" {
+		data, err := marshalJSON(options.SourceMap, flags.pretty)
+		if err != nil {
+			stderr("Failed to marshal source map: %v", err)
 			os.Exit(1)
 		}
+		writeOutput(flags.sourceMap, data)
 	}
+	data, err := marshalConfig(ignCfg, flags.pretty)
+	if err != nil {
+		stderr("Failed to marshal output: %v", err)
+		os.Exit(1)
+	}
+	writeOutput(flags.outFile, data)
+}
+
+// stringList is a flag that can be given multiple times.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
 
-	var dataOut []byte
-	if flags.pretty {
-		dataOut, err = json.MarshalIndent(&ignCfg, "", "  ")
-		dataOut = append(dataOut, '\n')
-	} else {
-		dataOut, err = json.Marshal(&ignCfg)
+// loadVariables reads the variables from the given files and NAME=VALUE
+// pairs, with later ones taking precedence. It exits on failure.
+func loadVariables(files, pairs []string) map[string]interface{} {
+	vars := map[string]interface{}{}
+	for _, path := range files {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			stderr("Failed to read variables: %v", err)
+			os.Exit(1)
+		}
+		fileVars, err := parseVariableFile(data)
+		if err != nil {
+			stderr("Failed to parse variables in %s: %v", path, err)
+			os.Exit(1)
+		}
+		for name, value := range fileVars {
+			vars[name] = value
+		}
 	}
+	for _, pair := range pairs {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			stderr("Invalid variable %q, expected NAME=VALUE", pair)
+			os.Exit(1)
+		}
+		vars[parts[0]] = parts[1]
+	}
+	return vars
+}
+
+// parseVariableFile parses the contents of a --var-file, which maps variable
+// names to values.
+func parseVariableFile(data []byte) (map[string]interface{}, error) {
+	var vars map[string]interface{}
+	err := yaml.Unmarshal(data, &vars)
+	return vars, err
+}
+
+// loadPolicies reads the policies in the given files. It exits on failure.
+func loadPolicies(paths []string) []policy.Policy {
+	var policies []policy.Policy
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			stderr("Failed to read policies: %v", err)
+			os.Exit(1)
+		}
+		p, err := policy.Parse(data)
+		if err != nil {
+			stderr("Failed to parse policies in %s: %v", path, err)
+			os.Exit(1)
+		}
+		policies = append(policies, p...)
+	}
+	return policies
+}
+
+// marshalConfig serializes a converted config in the types of its Ignition
+// spec version, indenting it if pretty is set.
+func marshalConfig(cfg ignTypes.Config, pretty bool) ([]byte, error) {
+	out, err := types.VersionedConfig(cfg)
 	if err != nil {
-		stderr("Failed to marshal output: %v", err)
+		return nil, err
+	}
+	return marshalJSON(out, pretty)
+}
+
+// marshalJSON serializes v, indenting it if pretty is set.
+func marshalJSON(v interface{}, pretty bool) ([]byte, error) {
+	if !pretty {
+		return json.Marshal(v)
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// writeReport writes the report about a config to standard error in the given
+// format. It exits on failure.
+func writeReport(format string, f reportfmt.File) {
+	if err := reportfmt.Write(os.Stderr, format, f); err != nil {
+		stderr("Failed to write report: %v", err)
+		os.Exit(1)
+	}
+}
+
+// readInput reads the file at the given path, or standard input if the path
+// is empty. It exits on failure.
+func readInput(path string) []byte {
+	inFile := os.Stdin
+	if path != "" {
+		var err error
+		inFile, err = os.Open(path)
+		if err != nil {
+			stderr("Failed to open: %v", err)
+			os.Exit(1)
+		}
+		defer inFile.Close()
+	}
+
+	data, err := ioutil.ReadAll(inFile)
+	if err != nil {
+		stderr("Failed to read: %v", err)
 		os.Exit(1)
 	}
+	return data
+}
 
-	if flags.outFile == "" {
-		outFile = os.Stdout
-	} else {
+// writeOutput writes data to the file at the given path, or standard output
+// if the path is empty. It exits on failure.
+func writeOutput(path string, data []byte) {
+	outFile := os.Stdout
+	if path != "" {
 		var err error
-		outFile, err = os.Create(flags.outFile)
+		outFile, err = os.Create(path)
 		if err != nil {
 			stderr("Failed to create: %v", err)
 			os.Exit(1)
 		}
+		defer outFile.Close()
 	}
 
-	if _, err := outFile.Write(dataOut); err != nil {
+	if _, err := outFile.Write(data); err != nil {
 		stderr("Failed to write: %v", err)
 		os.Exit(1)
 	}
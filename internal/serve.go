@@ -0,0 +1,70 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/coreos/container-linux-config-transpiler/internal/server"
+)
+
+// serveMain implements `ct serve`, which transpiles configs over HTTP.
+func serveMain(args []string) {
+	flags := struct {
+		help          bool
+		listen        string
+		filesDir      string
+		maxConfigSize int64
+	}{}
+
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	fs.Usage = func() {
+		stderr("Usage: ct serve [options]")
+		fs.PrintDefaults()
+	}
+	fs.BoolVar(&flags.help, "help", false, "Print help and exit.")
+	fs.StringVar(&flags.listen, "listen", ":8080", "Address to listen on.")
+	fs.StringVar(&flags.filesDir, "files-dir", "", "Directory to read local files from. Local files are an error unless specified.")
+	fs.Int64Var(&flags.maxConfigSize, "max-config-size", server.DefaultMaxConfigSize, "Largest config to accept, in bytes.")
+
+	fs.Parse(args)
+
+	if flags.help {
+		fs.Usage()
+		return
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	s := &http.Server{
+		Addr: flags.listen,
+		Handler: server.New(server.Options{
+			FilesDir:      flags.filesDir,
+			MaxConfigSize: flags.maxConfigSize,
+		}),
+		ReadTimeout:  time.Minute,
+		WriteTimeout: time.Minute,
+	}
+	stderr("Listening on %s", flags.listen)
+	if err := s.ListenAndServe(); err != nil {
+		stderr("Failed to serve: %v", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// durationBuckets are the upper bounds of the transpile duration histogram,
+// in seconds.
+var durationBuckets = []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5}
+
+// metrics counts transpile requests. It is written in the Prometheus text
+// exposition format.
+type metrics struct {
+	mu       sync.Mutex
+	inFlight int
+	// requests by status code
+	requests map[int]uint64
+	// observations per bucket of durationBuckets, not cumulative
+	buckets []uint64
+	count   uint64
+	sum     float64
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		requests: map[int]uint64{},
+		buckets:  make([]uint64, len(durationBuckets)),
+	}
+}
+
+func (m *metrics) begin() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.inFlight++
+}
+
+func (m *metrics) end(code int, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.inFlight--
+	m.requests[code]++
+	seconds := d.Seconds()
+	m.count++
+	m.sum += seconds
+	for i, bound := range durationBuckets {
+		if seconds <= bound {
+			m.buckets[i]++
+			break
+		}
+	}
+}
+
+func (m *metrics) serve(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write(m.text())
+}
+
+// text returns the metrics in the Prometheus text exposition format.
+func (m *metrics) text() []byte {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var out bytes.Buffer
+	out.WriteString("# HELP ct_transpile_requests_total Transpile requests by HTTP status code.\n")
+	out.WriteString("# TYPE ct_transpile_requests_total counter\n")
+	var codes []int
+	for code := range m.requests {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		fmt.Fprintf(&out, "ct_transpile_requests_total{code=\"%d\"} %d\n", code, m.requests[code])
+	}
+
+	out.WriteString("# HELP ct_transpile_duration_seconds Time spent serving transpile requests.\n")
+	out.WriteString("# TYPE ct_transpile_duration_seconds histogram\n")
+	var cumulative uint64
+	for i, bound := range durationBuckets {
+		cumulative += m.buckets[i]
+		fmt.Fprintf(&out, "ct_transpile_duration_seconds_bucket{le=\"%s\"} %d\n", strconv.FormatFloat(bound, 'g', -1, 64), cumulative)
+	}
+	fmt.Fprintf(&out, "ct_transpile_duration_seconds_bucket{le=\"+Inf\"} %d\n", m.count)
+	fmt.Fprintf(&out, "ct_transpile_duration_seconds_sum %s\n", strconv.FormatFloat(m.sum, 'g', -1, 64))
+	fmt.Fprintf(&out, "ct_transpile_duration_seconds_count %d\n", m.count)
+
+	out.WriteString("# HELP ct_transpile_in_flight Transpile requests being served.\n")
+	out.WriteString("# TYPE ct_transpile_in_flight gauge\n")
+	fmt.Fprintf(&out, "ct_transpile_in_flight %d\n", m.inFlight)
+	return out.Bytes()
+}
@@ -0,0 +1,190 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package server serves the transpiler over HTTP, for provisioning systems
+// that render Ignition configs on request.
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/coreos/container-linux-config-transpiler/config"
+	"github.com/coreos/container-linux-config-transpiler/config/astyaml"
+	"github.com/coreos/container-linux-config-transpiler/config/platform"
+	"github.com/coreos/container-linux-config-transpiler/config/reportfmt"
+	"github.com/coreos/container-linux-config-transpiler/config/types"
+	ignTypes "github.com/coreos/ignition/config/v2_3/types"
+	"github.com/coreos/ignition/config/validate/report"
+)
+
+// DefaultMaxConfigSize is the largest config accepted unless configured
+// otherwise.
+const DefaultMaxConfigSize = 1 << 20
+
+// Options configure a server.
+type Options struct {
+	// FilesDir is the directory local file sources are read from. Local
+	// file sources are an error if it is empty.
+	FilesDir string
+	// MaxConfigSize is the largest config in bytes that is accepted, or
+	// zero for DefaultMaxConfigSize.
+	MaxConfigSize int64
+}
+
+// Server handles the following endpoints:
+//
+//	POST /v1/transpile  transpiles the container linux config in the body
+//	GET  /healthz       reports that the server is up
+//	GET  /metrics       exposes metrics in the Prometheus text format
+//
+// The transpile endpoint accepts the platform, dynamic_data_in_contents,
+// pretty and strict query parameters, which work like the flags of ct.
+// Requests are served concurrently, every conversion has its own options.
+type Server struct {
+	options Options
+	metrics *metrics
+	mux     *http.ServeMux
+}
+
+// response is the body of the transpile endpoint. Ignition is only set if
+// the config was transpiled successfully.
+type response struct {
+	Ignition *ignTypes.Config  `json:"ignition,omitempty"`
+	Report   []reportfmt.Entry `json:"report"`
+}
+
+func New(options Options) *Server {
+	if options.MaxConfigSize == 0 {
+		options.MaxConfigSize = DefaultMaxConfigSize
+	}
+	s := &Server{
+		options: options,
+		metrics: newMetrics(),
+		mux:     http.NewServeMux(),
+	}
+	s.mux.HandleFunc("/v1/transpile", s.transpile)
+	s.mux.HandleFunc("/healthz", s.healthz)
+	s.mux.HandleFunc("/metrics", s.metrics.serve)
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, "ok")
+}
+
+func (s *Server) transpile(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	s.metrics.begin()
+	r.Body = http.MaxBytesReader(w, r.Body, s.options.MaxConfigSize)
+	code, resp, pretty := s.handleTranspile(r)
+	s.metrics.end(code, time.Since(start))
+
+	var data []byte
+	var err error
+	if pretty {
+		data, err = json.MarshalIndent(resp, "", "  ")
+	} else {
+		data, err = json.Marshal(resp)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(append(data, '\n'))
+}
+
+// handleTranspile transpiles the config of a request. It returns the status
+// code, the response and whether it should be indented.
+func (s *Server) handleTranspile(r *http.Request) (int, response, bool) {
+	query := r.URL.Query()
+	pretty, prettyErr := parseBool(query.Get("pretty"))
+	if r.Method != http.MethodPost {
+		return http.StatusMethodNotAllowed, errorResponse("method %s not allowed, use POST", r.Method), pretty
+	}
+	if prettyErr != nil {
+		return http.StatusBadRequest, errorResponse("invalid pretty: %v", prettyErr), false
+	}
+	strict, err := parseBool(query.Get("strict"))
+	if err != nil {
+		return http.StatusBadRequest, errorResponse("invalid strict: %v", err), pretty
+	}
+	dynamicData, err := parseBool(query.Get("dynamic_data_in_contents"))
+	if err != nil {
+		return http.StatusBadRequest, errorResponse("invalid dynamic_data_in_contents: %v", err), pretty
+	}
+	p := query.Get("platform")
+	if !platform.IsSupportedPlatform(p) {
+		return http.StatusBadRequest, errorResponse("unsupported platform %q, accepted values: %v", p, platform.Platforms), pretty
+	}
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		code := http.StatusBadRequest
+		if int64(len(data)) >= s.options.MaxConfigSize {
+			code = http.StatusRequestEntityTooLarge
+		}
+		return code, errorResponse("failed to read config: %v", err), pretty
+	}
+
+	cfg, ast, rep := config.ParseWithOptions(data, config.ParseOptions{
+		Strict: strict,
+		// requests must not read the server's files
+		NoIncludes: true,
+	})
+	paths := &astyaml.ReportPaths{}
+	if !failed(rep, strict) {
+		ignCfg, convertReport := config.Convert(cfg, types.ConvertOptions{
+			Platform:              p,
+			DynamicDataInContents: dynamicData,
+			FilesDir:              s.options.FilesDir,
+			ReportPaths:           paths,
+		}, ast)
+		rep.Merge(convertReport)
+		if !failed(rep, strict) {
+			return http.StatusOK, response{Ignition: &ignCfg, Report: reportfmt.Annotate(rep, data, paths)}, pretty
+		}
+	}
+	return http.StatusUnprocessableEntity, response{Report: reportfmt.Annotate(rep, data, paths)}, pretty
+}
+
+func failed(r report.Report, strict bool) bool {
+	return r.IsFatal() || (strict && len(r.Entries) > 0)
+}
+
+func errorResponse(format string, a ...interface{}) response {
+	return response{Report: []reportfmt.Entry{{
+		Kind:    report.EntryError.String(),
+		Message: fmt.Sprintf(format, a...),
+	}}}
+}
+
+// parseBool parses a boolean query parameter, which is false if it is empty.
+func parseBool(s string) (bool, error) {
+	if s == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(s)
+}
@@ -0,0 +1,154 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/coreos/container-linux-config-transpiler/config/reportfmt"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTranspile(t *testing.T) {
+	type in struct {
+		method string
+		query  string
+		body   string
+	}
+	type out struct {
+		code     int
+		ignition bool
+		report   []reportfmt.Entry
+	}
+
+	tests := []struct {
+		in  in
+		out out
+	}{
+		{
+			in:  in{method: "POST", body: "passwd:\n  users:\n    - name: core\n"},
+			out: out{code: http.StatusOK, ignition: true, report: []reportfmt.Entry{}},
+		},
+		{
+			in:  in{method: "POST", query: "platform=ec2", body: "systemd:\n  units:\n    - name: a.service\n      contents: \"{HOSTNAME}\"\n"},
+			out: out{code: http.StatusOK, ignition: true, report: []reportfmt.Entry{}},
+		},
+		{
+			in: in{method: "POST", query: "strict=true", body: "passwd:\n  users:\n    - name: core\n      sshkeys: []\n"},
+			out: out{code: http.StatusUnprocessableEntity, report: []reportfmt.Entry{{
+				Kind:    "error",
+				Message: "Config has unrecognized key: sshkeys",
+				Line:    4,
+				Column:  7,
+				Path:    "passwd.users[0].sshkeys",
+			}}},
+		},
+		{
+			in: in{method: "POST", body: "include: [/etc/passwd]\n"},
+			out: out{code: http.StatusUnprocessableEntity, report: []reportfmt.Entry{{
+				Kind:    "error",
+				Message: "include is not allowed here",
+				Line:    1,
+				Column:  11,
+				Path:    "include[0]",
+			}}},
+		},
+		{
+			in: in{method: "POST", query: "platform=mars"},
+			out: out{code: http.StatusBadRequest, report: []reportfmt.Entry{{
+				Kind:    "error",
+				Message: `unsupported platform "mars", accepted values: [azure digitalocean ec2 gce packet openstack-metadata vagrant-virtualbox cloudstack-configdrive custom]`,
+			}}},
+		},
+		{
+			in: in{method: "POST", query: "pretty=maybe"},
+			out: out{code: http.StatusBadRequest, report: []reportfmt.Entry{{
+				Kind:    "error",
+				Message: `invalid pretty: strconv.ParseBool: parsing "maybe": invalid syntax`,
+			}}},
+		},
+		{
+			in: in{method: "GET"},
+			out: out{code: http.StatusMethodNotAllowed, report: []reportfmt.Entry{{
+				Kind:    "error",
+				Message: "method GET not allowed, use POST",
+			}}},
+		},
+		{
+			in: in{method: "POST", body: strings.Repeat("#", 300)},
+			out: out{code: http.StatusRequestEntityTooLarge, report: []reportfmt.Entry{{
+				Kind:    "error",
+				Message: "failed to read config: http: request body too large",
+			}}},
+		},
+	}
+
+	s := New(Options{MaxConfigSize: 256})
+	for i, test := range tests {
+		req := httptest.NewRequest(test.in.method, "/v1/transpile?"+test.in.query, strings.NewReader(test.in.body))
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+
+		assert.Equal(t, test.out.code, w.Code, "#%d: bad status code", i)
+		var resp map[string]json.RawMessage
+		assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &resp), "#%d: bad response", i)
+		_, hasIgnition := resp["ignition"]
+		assert.Equal(t, test.out.ignition, hasIgnition, "#%d: bad ignition", i)
+		var report []reportfmt.Entry
+		assert.Nil(t, json.Unmarshal(resp["report"], &report), "#%d: bad report", i)
+		assert.Equal(t, test.out.report, report, "#%d: bad report", i)
+	}
+}
+
+func TestConcurrentTranspile(t *testing.T) {
+	s := New(Options{})
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			platform := []struct{ name, hostname string }{
+				{"ec2", "COREOS_EC2_HOSTNAME"},
+				{"gce", "COREOS_GCE_HOSTNAME"},
+				{"packet", "COREOS_PACKET_HOSTNAME"},
+			}[i%3]
+			body := fmt.Sprintf("systemd:\n  units:\n    - name: app%d.service\n      contents: \"{HOSTNAME}\"\n", i)
+			req := httptest.NewRequest("POST", "/v1/transpile?dynamic_data_in_contents=true&platform="+platform.name, strings.NewReader(body))
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Contains(t, w.Body.String(), fmt.Sprintf("app%d.service", i))
+			assert.Contains(t, w.Body.String(), platform.hostname)
+		}(i)
+	}
+	wg.Wait()
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Contains(t, w.Body.String(), "ct_transpile_requests_total{code=\"200\"} 20\n")
+	assert.Contains(t, w.Body.String(), "ct_transpile_duration_seconds_count 20\n")
+	assert.Contains(t, w.Body.String(), "ct_transpile_in_flight 0\n")
+
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/healthz", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "ok\n", w.Body.String())
+}
@@ -0,0 +1,185 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/coreos/ignition/config/validate/report"
+)
+
+// watchSettle is how long to wait for more changes after a change, so that
+// editors saving several files, or a file in several writes, cause a single
+// rebuild.
+const watchSettle = 100 * time.Millisecond
+
+// watchSet is the files a build depends on, by directory. Only the files
+// themselves are relevant, so that writing the output, the source map or
+// anything else next to them doesn't cause a rebuild.
+type watchSet struct {
+	files map[string]map[string]bool
+}
+
+func newWatchSet() watchSet {
+	return watchSet{files: map[string]map[string]bool{}}
+}
+
+// watchSetFor returns the files the build of inFile depends on: the files it
+// read, and the ones it failed to read, to notice when they are created.
+func watchSetFor(inFile string, res buildResult) watchSet {
+	set := newWatchSet()
+	set.addFile(inFile)
+	for path := range res.inputs {
+		set.addFile(path)
+	}
+	for path := range res.missing {
+		set.addFile(path)
+	}
+	return set
+}
+
+func (s watchSet) addFile(path string) {
+	dir, name := filepath.Split(filepath.Clean(path))
+	dir = filepath.Clean(dir)
+	if s.files[dir] == nil {
+		s.files[dir] = map[string]bool{}
+	}
+	s.files[dir][name] = true
+}
+
+// relevant returns whether a change to the named file of dir affects the
+// build.
+func (s watchSet) relevant(dir, name string) bool {
+	return s.files[dir][name]
+}
+
+// watch transpiles the config at inFile to outFile whenever it or a file it
+// depends on changes, until it is interrupted. The source map is written to
+// sourceMapFile, if set. Builds that fail leave the last good output and
+// source map in place.
+func watch(b *builder, inFile, outFile, sourceMapFile string) {
+	for {
+		start := time.Now()
+		res := b.build(inFile)
+		printWatchSummary(res, outFile, sourceMapFile)
+
+		if err := waitForChange(watchSetFor(inFile, res), start); err != nil {
+			stderr("Failed to watch for changes: %v", err)
+			os.Exit(1)
+		}
+		time.Sleep(watchSettle)
+	}
+}
+
+// snapshot returns the modification times of the relevant files of the set.
+func snapshot(set watchSet) map[string]time.Time {
+	times := map[string]time.Time{}
+	for dir := range set.files {
+		infos, err := ioutil.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, info := range infos {
+			if set.relevant(dir, info.Name()) {
+				times[filepath.Join(dir, info.Name())] = info.ModTime()
+			}
+		}
+	}
+	return times
+}
+
+// changedSince returns whether a relevant file of the set was modified at or
+// after since, like while the build that found the set was running.
+func changedSince(set watchSet, since time.Time) bool {
+	for _, mtime := range snapshot(set) {
+		if !mtime.Before(since) {
+			return true
+		}
+	}
+	return false
+}
+
+// printWatchSummary writes a line about the result of a build, followed by a
+// line for every warning and error, and writes the output and source map if
+// there is one.
+func printWatchSummary(res buildResult, outFile, sourceMapFile string) {
+	errors, warnings := 0, 0
+	for _, r := range res.reports {
+		for _, e := range r.r.Entries {
+			if e.Kind == report.EntryError {
+				errors++
+			} else {
+				warnings++
+			}
+		}
+	}
+	counts := fmt.Sprintf("%d errors, %d warnings", errors, warnings)
+	now := time.Now().Format("15:04:05")
+
+	if res.failure == "" && sourceMapFile != "" {
+		if err := writeFileAtomic(sourceMapFile, res.sourceMap); err != nil {
+			res.failure = fmt.Sprintf("Failed to write source map: %v", err)
+		}
+	}
+	if res.failure == "" {
+		if err := writeFileAtomic(outFile, res.output); err != nil {
+			res.failure = fmt.Sprintf("Failed to write: %v", err)
+		}
+	}
+	if res.failure == "" {
+		stderr("[%s] wrote %s (%s)", now, outFile, counts)
+	} else {
+		stderr("[%s] %s (%s), keeping the previous %s", now, res.failure, counts, outFile)
+	}
+	for _, r := range res.reports {
+		for _, e := range r.r.Entries {
+			position := r.path
+			if e.Line != 0 {
+				position += fmt.Sprintf(":%d", e.Line)
+			}
+			if e.Column != 0 {
+				position += fmt.Sprintf(":%d", e.Column)
+			}
+			stderr("  %s: %s: %s", position, e.Kind, e.Message)
+		}
+	}
+}
+
+// writeFileAtomic replaces a file, so that readers never see a partially
+// written one.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
@@ -0,0 +1,73 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// watchEvents are the inotify events that change a file of a directory,
+// including editors replacing it by renaming a new file over it.
+const watchEvents = syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_TO | syscall.IN_MOVED_FROM | syscall.IN_CREATE | syscall.IN_DELETE
+
+// waitForChange blocks until a file of the set changes, returning at once if
+// one changed since the given time. It watches the directories of the files
+// with inotify, since the files themselves may be replaced rather than
+// written to.
+func waitForChange(set watchSet, since time.Time) error {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC)
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(fd)
+
+	dirs := map[int]string{}
+	for dir := range set.files {
+		wd, err := syscall.InotifyAddWatch(fd, dir, watchEvents)
+		if err != nil {
+			// directories that don't exist yet can't change anything
+			continue
+		}
+		dirs[wd] = dir
+	}
+	// changes made before the watches were added, while the build ran, have
+	// no events
+	if changedSince(set, since) {
+		return nil
+	}
+
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := syscall.Read(fd, buf)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameBytes := buf[offset+syscall.SizeofInotifyEvent : offset+syscall.SizeofInotifyEvent+int(event.Len)]
+			name := string(bytes.TrimRight(nameBytes, "\x00"))
+			if dir, ok := dirs[int(event.Wd)]; ok && set.relevant(dir, name) {
+				return nil
+			}
+			offset += syscall.SizeofInotifyEvent + int(event.Len)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"time"
+)
+
+// watchPollInterval is how often the files are checked for changes on
+// systems without inotify.
+const watchPollInterval = 500 * time.Millisecond
+
+// waitForChange blocks until a file of the set changes, returning at once if
+// one changed since the given time. It polls the modification times of the
+// files of the directories of the set.
+func waitForChange(set watchSet, since time.Time) error {
+	before := snapshot(set)
+	if changedSince(set, since) {
+		return nil
+	}
+	for {
+		time.Sleep(watchPollInterval)
+		after := snapshot(set)
+		if len(after) != len(before) {
+			return nil
+		}
+		for path, mtime := range after {
+			if !before[path].Equal(mtime) {
+				return nil
+			}
+		}
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright 2018 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coreos/container-linux-config-transpiler/config/types"
+)
+
+const watchTestConfig = `storage:
+  files:
+    - path: /etc/nested
+      filesystem: root
+      mode: 0644
+      contents:
+        local: a/b/nested
+    - path: /etc/missing
+      filesystem: root
+      mode: 0644
+      contents:
+        local: missing
+`
+
+func TestWatchSet(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ct-watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the files directory also holds the config and its outputs
+	inFile := filepath.Join(dir, "config.yaml")
+	outFile := filepath.Join(dir, "config.ign")
+	sourceMapFile := filepath.Join(dir, "config.map.json")
+	nested := filepath.Join(dir, "a", "b", "nested")
+	if err := os.MkdirAll(filepath.Dir(nested), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(nested, []byte("before"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(inFile, []byte(watchTestConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	b := &builder{options: types.ConvertOptions{FilesDir: dir}, sourceMap: true}
+	start := time.Now()
+	res := b.build(inFile)
+	if res.failure == "" {
+		t.Fatalf("expected the build to fail on the missing local file")
+	}
+	set := watchSetFor(inFile, res)
+	// modification times are coarser than the clock
+	time.Sleep(20 * time.Millisecond)
+
+	if err := writeFileAtomic(outFile, []byte("{}")); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFileAtomic(sourceMapFile, []byte("{}")); err != nil {
+		t.Fatal(err)
+	}
+	if changedSince(set, start) {
+		t.Errorf("writing the output and source map counted as a change")
+	}
+
+	if err := ioutil.WriteFile(nested, []byte("after"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if !changedSince(set, start) {
+		t.Errorf("changing a nested local file wasn't noticed")
+	}
+
+	if !set.relevant(dir, "missing") {
+		t.Errorf("the local file that couldn't be read isn't watched")
+	}
+}
+
+func TestWatchVarFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ct-watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	inFile := filepath.Join(dir, "config.yaml")
+	varFile := filepath.Join(dir, "vars.yaml")
+	config := "variables:\n  host:\n    type: string\nstorage:\n  files:\n    - path: /etc/host\n      filesystem: root\n      contents:\n        inline: ${var.host}\n"
+	if err := ioutil.WriteFile(inFile, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(varFile, []byte("host: before\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	b := &builder{varFiles: []string{varFile}}
+	res := b.build(inFile)
+	if res.failure != "" {
+		t.Fatalf("unexpected failure: %s", res.failure)
+	}
+	if !watchSetFor(inFile, res).relevant(dir, "vars.yaml") {
+		t.Errorf("the variable file isn't watched")
+	}
+
+	if err := ioutil.WriteFile(varFile, []byte("host: after\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	res = b.build(inFile)
+	if res.failure != "" {
+		t.Fatalf("unexpected failure: %s", res.failure)
+	}
+	if !strings.Contains(string(res.output), "after") {
+		t.Errorf("the changed variable file wasn't read again: %s", res.output)
+	}
+}